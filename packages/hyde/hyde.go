@@ -8,6 +8,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/sashabaranov/go-openai"
 	"github.com/stillmatic/gollum"
+	"github.com/stillmatic/gollum/packages/llm"
 	"github.com/viterin/vek/vek32"
 )
 
@@ -55,42 +56,40 @@ func (z *ZeroShotPrompter) BuildPrompt(ctx context.Context, prompt string) strin
 }
 
 type LLMGenerator struct {
-	Model gollum.ChatCompleter
+	Model  llm.Responder
+	Config llm.ModelConfig
 }
 
-func NewLLMGenerator(model gollum.ChatCompleter) *LLMGenerator {
+func NewLLMGenerator(model llm.Responder, config llm.ModelConfig) *LLMGenerator {
 	return &LLMGenerator{
-		Model: model,
+		Model:  model,
+		Config: config,
 	}
 }
 
 func (l *LLMGenerator) Generate(ctx context.Context, prompt string, n int) ([]string, error) {
-	createChatCompletionReq := openai.ChatCompletionRequest{
-		Messages: []openai.ChatCompletionMessage{
+	req := llm.InferRequest{
+		Messages: []llm.InferMessage{
 			{
-				Role:    openai.ChatMessageRoleUser,
+				Role:    "user",
 				Content: prompt,
 			},
 		},
-		Model: openai.GPT3Dot5Turbo,
-		N:     n,
+		ModelConfig: l.Config,
 		// hyperparams from https://github.com/texttron/hyde/blob/74101c5157e04f7b57559e7da8ef4a4e5b6da82b/src/hyde/generator.py#LL15C121-L15C121
-		Temperature:      0.9,
-		MaxTokens:        512,
-		TopP:             1,
-		FrequencyPenalty: 0,
-		PresencePenalty:  0,
-		Stop:             []string{"\n\n\n"},
-	}
-	resp, err := l.Model.CreateChatCompletion(ctx, createChatCompletionReq)
+		// top_p=1 is the default, leave it unset since some providers reject it alongside temperature.
+		MessageOptions: llm.MessageOptions{
+			Temperature:   0.9,
+			MaxTokens:     512,
+			StopSequences: []string{"\n\n\n"},
+			Candidates:    n,
+		},
+	}
+	resp, err := l.Model.Infer(ctx, req)
 	if err != nil {
 		return make([]string, 0), err
 	}
-	replies := make([]string, n)
-	for i, choice := range resp.Choices {
-		replies[i] = choice.Message.Content
-	}
-	return replies, nil
+	return resp.Contents(), nil
 }
 
 type LLMEncoder struct {
@@ -10,18 +10,36 @@ import (
 	"github.com/stillmatic/gollum"
 	mock_gollum "github.com/stillmatic/gollum/internal/mocks"
 	"github.com/stillmatic/gollum/internal/testutil"
+	"github.com/stillmatic/gollum/packages/llm"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/mock/gomock"
 )
 
+// fakeResponder returns as many candidates as requested.
+type fakeResponder struct {
+	llm.Responder
+	lastReq llm.InferRequest
+}
+
+func (f *fakeResponder) Infer(ctx context.Context, req llm.InferRequest) (*llm.InferResponse, error) {
+	f.lastReq = req
+	candidates := make([]llm.Candidate, max(1, req.MessageOptions.Candidates))
+	for i := range candidates {
+		candidates[i] = llm.Candidate{Content: fmt.Sprintf("test? %d", i), FinishReason: llm.FinishReasonStop}
+	}
+	res := &llm.InferResponse{}
+	res.SetCandidates(candidates)
+	return res, nil
+}
+
 func TestHyde(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	embedder := mock_gollum.NewMockEmbedder(ctrl)
-	completer := mock_gollum.NewMockChatCompleter(ctrl)
+	responder := &fakeResponder{}
 	prompter := hyde.NewZeroShotPrompter(
 		"Roleplay as a character. Write a short biographical answer to the question.\nQ: %s\nA:",
 	)
-	generator := hyde.NewLLMGenerator(completer)
+	generator := hyde.NewLLMGenerator(responder, llm.ModelConfig{ProviderType: llm.ProviderOpenAI, ModelName: "gpt-4o-mini"})
 	encoder := hyde.NewLLMEncoder(embedder)
 	vs := vectorstore.NewMemoryVectorStore(embedder)
 	for i := range make([]int, 10) {
@@ -42,10 +60,11 @@ func TestHyde(t *testing.T) {
 	t.Run("generator", func(t *testing.T) {
 		ctx := context.Background()
 		k := 10
-		completer.EXPECT().CreateChatCompletion(ctx, gomock.Any()).Return(testutil.GetRandomChatCompletionResponse(k), nil)
 		res, err := generator.Generate(ctx, "What is your name?", k)
 		assert.NoError(t, err)
 		assert.Equal(t, 10, len(res))
+		assert.Equal(t, 10, responder.lastReq.MessageOptions.Candidates)
+		assert.Zero(t, responder.lastReq.MessageOptions.TopP)
 	})
 
 	t.Run("encoder", func(t *testing.T) {
@@ -64,7 +83,6 @@ func TestHyde(t *testing.T) {
 
 	t.Run("e2e", func(t *testing.T) {
 		ctx := context.Background()
-		completer.EXPECT().CreateChatCompletion(ctx, gomock.Any()).Return(testutil.GetRandomChatCompletionResponse(3), nil)
 		embedder.EXPECT().CreateEmbeddings(ctx, gomock.Any()).Return(testutil.GetRandomEmbeddingResponse(4, 1536), nil)
 		res, err := hyde.SearchEndToEnd(ctx, "What is your name?", 3)
 		assert.NoError(t, err)
@@ -78,8 +96,8 @@ func BenchmarkHyde(b *testing.B) {
 	)
 	ctrl := gomock.NewController(b)
 	embedder := mock_gollum.NewMockEmbedder(ctrl)
-	completer := mock_gollum.NewMockChatCompleter(ctrl)
-	generator := hyde.NewLLMGenerator(completer)
+	responder := &fakeResponder{}
+	generator := hyde.NewLLMGenerator(responder, llm.ModelConfig{ProviderType: llm.ProviderOpenAI, ModelName: "gpt-4o-mini"})
 	encoder := hyde.NewLLMEncoder(embedder)
 	vs := vectorstore.NewMemoryVectorStore(embedder)
 	searcher := hyde.NewVectorSearcher(
@@ -96,7 +114,6 @@ func BenchmarkHyde(b *testing.B) {
 			b.ResetTimer()
 			for i := 0; i < b.N; i++ {
 				k := 8
-				completer.EXPECT().CreateChatCompletion(context.Background(), gomock.Any()).Return(testutil.GetRandomChatCompletionResponse(k), nil)
 				embedder.EXPECT().CreateEmbeddings(context.Background(), gomock.Any()).Return(testutil.GetRandomEmbeddingResponse(k+1, 1536), nil)
 				_, err := hyde.SearchEndToEnd(context.Background(), "What is your name?", k)
 				assert.NoError(b, err)
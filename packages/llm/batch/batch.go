@@ -0,0 +1,210 @@
+// Package batch runs large sets of requests through the providers' batch APIs, which answer within a day at
+// a discount, typically half price. The openai and anthropic providers implement Backend.
+package batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/stillmatic/gollum/packages/llm"
+)
+
+// Item is a request in a batch. CustomID matches the result back to the request.
+type Item struct {
+	CustomID string
+	Request  llm.InferRequest
+}
+
+// Result is the outcome of one Item. Exactly one of Response and Err is set.
+type Result struct {
+	CustomID string
+	Response *llm.InferResponse
+	Err      error
+}
+
+// State is the progress of a batch job, normalized across providers.
+type State string
+
+const (
+	// StateInProgress means the job is validating, running or finalizing.
+	StateInProgress State = "in_progress"
+	// StateEnded means results are available. Items which were cancelled or expired have an error.
+	StateEnded State = "ended"
+	// StateFailed means the whole job failed, e.g. because the input was invalid, and there are no results.
+	StateFailed State = "failed"
+)
+
+// Status is a snapshot of a batch job.
+type Status struct {
+	State     State
+	Total     int
+	Succeeded int
+	Failed    int
+	// Message explains a failed job.
+	Message string
+}
+
+// Backend is a provider's batch API.
+type Backend interface {
+	// SubmitBatch creates a batch job for the items and returns its ID.
+	SubmitBatch(ctx context.Context, items []Item) (string, error)
+	BatchStatus(ctx context.Context, jobID string) (Status, error)
+	// BatchResults returns the results of an ended job by custom ID. The items are those the job was submitted
+	// with, they are needed to interpret the responses, e.g. for costs and response formats.
+	BatchResults(ctx context.Context, jobID string, items []Item) (map[string]Result, error)
+	CancelBatch(ctx context.Context, jobID string) error
+}
+
+var (
+	// ErrJobFailed is returned when a whole batch job fails.
+	ErrJobFailed = errors.New("batch job failed")
+	// ErrNotProcessed is the error of items which were cancelled, expired or are missing from the results.
+	ErrNotProcessed = errors.New("batch item was not processed")
+)
+
+// ItemError is the error of an item the provider failed to process.
+type ItemError struct {
+	// StatusCode is the HTTP status the request would have had, if the provider reports one.
+	StatusCode int
+	// Type is the provider's error type or code, e.g. "invalid_request_error".
+	Type    string
+	Message string
+}
+
+func (e *ItemError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("batch item failed with status %d: %s: %s", e.StatusCode, e.Type, e.Message)
+	}
+	return fmt.Sprintf("batch item failed: %s: %s", e.Type, e.Message)
+}
+
+// Config configures a Runner. The zero value polls every 30 seconds, backing off to every 10 minutes, and doesn't
+// persist jobs.
+type Config struct {
+	// Store persists submitted jobs, so a restarted process resumes waiting for its job instead of submitting
+	// the requests again.
+	Store Store
+	// PollInterval is the wait before the first status check, doubling after each check.
+	PollInterval time.Duration
+	// MaxPollInterval caps the wait between status checks.
+	MaxPollInterval time.Duration
+}
+
+// Runner submits batches to a backend and waits for their results.
+type Runner struct {
+	backend Backend
+	config  Config
+}
+
+func NewRunner(backend Backend, config Config) *Runner {
+	if config.PollInterval <= 0 {
+		config.PollInterval = 30 * time.Second
+	}
+	if config.MaxPollInterval <= 0 {
+		config.MaxPollInterval = 10 * time.Minute
+	}
+	if config.MaxPollInterval < config.PollInterval {
+		config.MaxPollInterval = config.PollInterval
+	}
+	if config.Store == nil {
+		config.Store = NewMemoryStore()
+	}
+	return &Runner{backend: backend, config: config}
+}
+
+// Items gives the requests the custom IDs Run uses, their index in reqs.
+func Items(reqs []llm.InferRequest) []Item {
+	items := make([]Item, len(reqs))
+	for i, req := range reqs {
+		items[i] = Item{CustomID: fmt.Sprintf("req-%d", i), Request: req}
+	}
+	return items
+}
+
+// Run submits the requests as a batch job named name and waits for it to end, returning a result per request in
+// the order of reqs. If the store has a job with that name, e.g. from a run that was interrupted, Run waits for
+// that job instead of submitting a new one, so reqs must be the same. The job is removed from the store once its
+// results are fetched, or once it fails, so the next Run with the name submits the requests again.
+func (r *Runner) Run(ctx context.Context, name string, reqs []llm.InferRequest) ([]Result, error) {
+	items := Items(reqs)
+	job, err := r.config.Store.Load(ctx, name)
+	switch {
+	case errors.Is(err, ErrJobNotFound):
+		job, err = r.Submit(ctx, name, items)
+		if err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, fmt.Errorf("failed to load batch job %s: %w", name, err)
+	case job.Count != len(items):
+		return nil, fmt.Errorf("batch job %s has %d requests, got %d", name, job.Count, len(items))
+	}
+
+	if _, err := r.Wait(ctx, job.ID); err != nil {
+		// a failed job has no results to wait for, other errors leave it to be resumed
+		if errors.Is(err, ErrJobFailed) {
+			if delErr := r.config.Store.Delete(ctx, name); delErr != nil {
+				return nil, fmt.Errorf("failed to delete batch job %s: %w", name, delErr)
+			}
+		}
+		return nil, err
+	}
+	byID, err := r.backend.BatchResults(ctx, job.ID, items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get results of batch job %s: %w", job.ID, err)
+	}
+	if err := r.config.Store.Delete(ctx, name); err != nil {
+		return nil, fmt.Errorf("failed to delete batch job %s: %w", name, err)
+	}
+
+	results := make([]Result, len(items))
+	for i, item := range items {
+		res, ok := byID[item.CustomID]
+		if !ok {
+			res = Result{CustomID: item.CustomID, Err: fmt.Errorf("%w: missing from the results", ErrNotProcessed)}
+		}
+		results[i] = res
+	}
+	return results, nil
+}
+
+// Submit submits the items as a batch job and saves it in the store under name.
+func (r *Runner) Submit(ctx context.Context, name string, items []Item) (Job, error) {
+	id, err := r.backend.SubmitBatch(ctx, items)
+	if err != nil {
+		return Job{}, fmt.Errorf("failed to submit batch job %s: %w", name, err)
+	}
+	job := Job{Name: name, ID: id, Count: len(items), SubmittedAt: time.Now()}
+	if err := r.config.Store.Save(ctx, job); err != nil {
+		return Job{}, fmt.Errorf("failed to save batch job %s with ID %s: %w", name, id, err)
+	}
+	return job, nil
+}
+
+// Wait polls the job with exponential backoff until it ends, fails or ctx is done.
+func (r *Runner) Wait(ctx context.Context, jobID string) (Status, error) {
+	interval := r.config.PollInterval
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return Status{}, ctx.Err()
+		case <-timer.C:
+		}
+		status, err := r.backend.BatchStatus(ctx, jobID)
+		if err != nil {
+			return status, fmt.Errorf("failed to get status of batch job %s: %w", jobID, err)
+		}
+		switch status.State {
+		case StateEnded:
+			return status, nil
+		case StateFailed:
+			return status, fmt.Errorf("%w: %s: %s", ErrJobFailed, jobID, status.Message)
+		}
+		interval = min(2*interval, r.config.MaxPollInterval)
+		timer.Reset(interval)
+	}
+}
@@ -0,0 +1,138 @@
+package batch_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/batch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBackend ends jobs after a number of status checks, answering each request with its last message.
+type fakeBackend struct {
+	mu        sync.Mutex
+	submitted [][]batch.Item
+	polls     int
+	endAfter  int
+	state     batch.State
+}
+
+func (b *fakeBackend) SubmitBatch(_ context.Context, items []batch.Item) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.submitted = append(b.submitted, items)
+	return "job-1", nil
+}
+
+func (b *fakeBackend) BatchStatus(_ context.Context, _ string) (batch.Status, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.polls++
+	if b.polls < b.endAfter {
+		return batch.Status{State: batch.StateInProgress}, nil
+	}
+	if b.state == batch.StateFailed {
+		return batch.Status{State: batch.StateFailed, Message: "invalid input file"}, nil
+	}
+	return batch.Status{State: batch.StateEnded}, nil
+}
+
+func (b *fakeBackend) BatchResults(_ context.Context, _ string, items []batch.Item) (map[string]batch.Result, error) {
+	results := make(map[string]batch.Result)
+	// the last item is left out, as if it expired
+	for _, item := range items[:len(items)-1] {
+		msgs := item.Request.Messages
+		if msgs[len(msgs)-1].Content == "fail" {
+			results[item.CustomID] = batch.Result{CustomID: item.CustomID, Err: &batch.ItemError{Type: "invalid_request_error", Message: "bad"}}
+			continue
+		}
+		results[item.CustomID] = batch.Result{CustomID: item.CustomID, Response: &llm.InferResponse{Content: msgs[len(msgs)-1].Content}}
+	}
+	return results, nil
+}
+
+func (b *fakeBackend) CancelBatch(_ context.Context, _ string) error {
+	return nil
+}
+
+func requests(contents ...string) []llm.InferRequest {
+	reqs := make([]llm.InferRequest, len(contents))
+	for i, c := range contents {
+		reqs[i] = llm.InferRequest{Messages: []llm.InferMessage{{Role: "user", Content: c}}}
+	}
+	return reqs
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	backend := &fakeBackend{endAfter: 3}
+	store := batch.NewMemoryStore()
+	r := batch.NewRunner(backend, batch.Config{Store: store, PollInterval: time.Millisecond, MaxPollInterval: 2 * time.Millisecond})
+
+	results, err := r.Run(ctx, "nightly", requests("a", "fail", "b", "c"))
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+	assert.Equal(t, "req-0", results[0].CustomID)
+	assert.Equal(t, "a", results[0].Response.Content)
+	var itemErr *batch.ItemError
+	assert.ErrorAs(t, results[1].Err, &itemErr)
+	assert.Equal(t, "b", results[2].Response.Content)
+	assert.ErrorIs(t, results[3].Err, batch.ErrNotProcessed)
+	assert.Equal(t, 3, backend.polls)
+
+	// the job is forgotten once its results are in
+	_, err = store.Load(ctx, "nightly")
+	assert.ErrorIs(t, err, batch.ErrJobNotFound)
+}
+
+func TestRunResumes(t *testing.T) {
+	ctx := context.Background()
+	store, err := batch.NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, store.Save(ctx, batch.Job{Name: "nightly/1", ID: "job-1", Count: 2, SubmittedAt: time.Now()}))
+
+	backend := &fakeBackend{endAfter: 1}
+	r := batch.NewRunner(backend, batch.Config{Store: store, PollInterval: time.Millisecond})
+	_, err = r.Run(ctx, "nightly/1", requests("a"))
+	assert.ErrorContains(t, err, "has 2 requests, got 1")
+
+	results, err := r.Run(ctx, "nightly/1", requests("a", "b"))
+	require.NoError(t, err)
+	assert.Empty(t, backend.submitted)
+	assert.Equal(t, "a", results[0].Response.Content)
+}
+
+func TestRunFailedJob(t *testing.T) {
+	ctx := context.Background()
+	store := batch.NewMemoryStore()
+	backend := &fakeBackend{endAfter: 1, state: batch.StateFailed}
+	r := batch.NewRunner(backend, batch.Config{Store: store, PollInterval: time.Millisecond})
+	_, err := r.Run(ctx, "nightly", requests("a", "b"))
+	assert.ErrorIs(t, err, batch.ErrJobFailed)
+
+	// the failed job is forgotten, so the next run submits the requests again
+	_, err = store.Load(ctx, "nightly")
+	assert.ErrorIs(t, err, batch.ErrJobNotFound)
+	backend.state = batch.StateEnded
+	results, err := r.Run(ctx, "nightly", requests("a", "b"))
+	require.NoError(t, err)
+	assert.Len(t, backend.submitted, 2)
+	assert.Equal(t, "a", results[0].Response.Content)
+}
+
+func TestWait(t *testing.T) {
+	backend := &fakeBackend{endAfter: 2, state: batch.StateFailed}
+	r := batch.NewRunner(backend, batch.Config{PollInterval: time.Millisecond})
+	_, err := r.Wait(context.Background(), "job-1")
+	assert.ErrorIs(t, err, batch.ErrJobFailed)
+	assert.ErrorContains(t, err, "invalid input file")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = batch.NewRunner(&fakeBackend{endAfter: 100}, batch.Config{PollInterval: time.Hour}).Wait(ctx, "job-1")
+	assert.ErrorIs(t, err, context.Canceled)
+}
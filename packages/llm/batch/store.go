@@ -0,0 +1,139 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Job is a submitted batch job.
+type Job struct {
+	// Name identifies the job in a Store, e.g. "nightly-2025-01-31".
+	Name string `json:"name"`
+	// ID is the provider's batch ID.
+	ID string `json:"id"`
+	// Count is the number of requests in the job.
+	Count       int       `json:"count"`
+	SubmittedAt time.Time `json:"submitted_at"`
+}
+
+// ErrJobNotFound is returned by Store.Load when there is no job with the name.
+var ErrJobNotFound = errors.New("batch job not found")
+
+// Store persists submitted jobs by name.
+type Store interface {
+	// Save adds or replaces the job.
+	Save(ctx context.Context, job Job) error
+	// Load returns ErrJobNotFound if there is no job with the name.
+	Load(ctx context.Context, name string) (Job, error)
+	// Delete removes the job, it is not an error if there is none.
+	Delete(ctx context.Context, name string) error
+}
+
+// MemoryStore keeps jobs in memory, for the lifetime of the process.
+type MemoryStore struct {
+	mu   sync.Mutex
+	jobs map[string]Job
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: make(map[string]Job)}
+}
+
+func (s *MemoryStore) Save(_ context.Context, job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.Name] = job
+	return nil
+}
+
+func (s *MemoryStore) Load(_ context.Context, name string) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[name]
+	if !ok {
+		return Job{}, fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+	return job, nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.jobs, name)
+	return nil
+}
+
+// FileStore keeps each job in a JSON file in a directory.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore returns a store in dir, creating dir if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create batch job directory: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+var invalidFileChars = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+func (s *FileStore) path(name string) string {
+	return filepath.Join(s.dir, invalidFileChars.ReplaceAllString(name, "_")+".json")
+}
+
+func (s *FileStore) Save(_ context.Context, job Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal batch job: %w", err)
+	}
+	// write then rename, so a crash never leaves a partial file
+	tmp, err := os.CreateTemp(s.dir, ".job-*")
+	if err != nil {
+		return fmt.Errorf("failed to save batch job: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save batch job: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save batch job: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path(job.Name)); err != nil {
+		return fmt.Errorf("failed to save batch job: %w", err)
+	}
+	return nil
+}
+
+func (s *FileStore) Load(_ context.Context, name string) (Job, error) {
+	data, err := os.ReadFile(s.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return Job{}, fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+	if err != nil {
+		return Job{}, fmt.Errorf("failed to load batch job: %w", err)
+	}
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return Job{}, fmt.Errorf("failed to unmarshal batch job: %w", err)
+	}
+	return job, nil
+}
+
+func (s *FileStore) Delete(_ context.Context, name string) error {
+	if err := os.Remove(s.path(name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete batch job: %w", err)
+	}
+	return nil
+}
+
+var _ Store = &MemoryStore{}
+var _ Store = &FileStore{}
@@ -0,0 +1,92 @@
+package llm
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrStreamingCandidates is returned when a stream is requested with more than one candidate.
+var ErrStreamingCandidates = errors.New("streaming doesn't support more than one candidate")
+
+// Candidate is one of several responses generated for the same request.
+type Candidate struct {
+	Content      string
+	ToolCalls    []ToolCall
+	FinishReason FinishReason
+}
+
+// Contents returns the content of every candidate, or just Content if only one was requested.
+func (r *InferResponse) Contents() []string {
+	if len(r.Candidates) == 0 {
+		return []string{r.Content}
+	}
+	contents := make([]string, len(r.Candidates))
+	for i, c := range r.Candidates {
+		contents[i] = c.Content
+	}
+	return contents
+}
+
+// SetCandidates copies the first candidate to the top level fields, and keeps all of them in Candidates if
+// there is more than one.
+func (r *InferResponse) SetCandidates(candidates []Candidate) {
+	if len(candidates) > 1 {
+		r.Candidates = candidates
+	}
+	if len(candidates) > 0 {
+		r.Content = candidates[0].Content
+		r.ToolCalls = candidates[0].ToolCalls
+		r.FinishReason = candidates[0].FinishReason
+	}
+}
+
+// InferParallel emulates MessageOptions.Candidates for providers which can only generate one response per call,
+// by calling infer once per candidate in parallel. Usage and Cost are summed over the calls.
+// If any call fails, the others are cancelled and the first error is returned.
+func InferParallel(ctx context.Context, req InferRequest, infer func(context.Context, InferRequest) (*InferResponse, error)) (*InferResponse, error) {
+	n := req.MessageOptions.Candidates
+	req.MessageOptions.Candidates = 0
+	if n <= 1 {
+		return infer(ctx, req)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	responses := make([]*InferResponse, n)
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := infer(ctx, req)
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			responses[i] = res
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	merged := &InferResponse{Model: responses[0].Model}
+	candidates := make([]Candidate, n)
+	for i, res := range responses {
+		candidates[i] = Candidate{Content: res.Content, ToolCalls: res.ToolCalls, FinishReason: res.FinishReason}
+		merged.Usage = merged.Usage.Add(res.Usage)
+		merged.Cost += res.Cost
+	}
+	merged.SetCandidates(candidates)
+	return merged, nil
+}
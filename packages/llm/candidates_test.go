@@ -0,0 +1,68 @@
+package llm_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInferParallel(t *testing.T) {
+	req := llm.InferRequest{
+		Messages:       []llm.InferMessage{{Role: "user", Content: "hello"}},
+		MessageOptions: llm.MessageOptions{Candidates: 3},
+	}
+
+	t.Run("merges the responses", func(t *testing.T) {
+		var calls atomic.Int32
+		res, err := llm.InferParallel(context.Background(), req, func(ctx context.Context, req llm.InferRequest) (*llm.InferResponse, error) {
+			// each call generates a single candidate
+			assert.Zero(t, req.MessageOptions.Candidates)
+			i := calls.Add(1)
+			return &llm.InferResponse{
+				Content:      fmt.Sprintf("hi %d", i),
+				FinishReason: llm.FinishReasonStop,
+				Model:        "test-model",
+				Usage:        llm.Usage{InputTokens: 10, OutputTokens: 5},
+				Cost:         0.5,
+			}, nil
+		})
+		require.NoError(t, err)
+		assert.EqualValues(t, 3, calls.Load())
+		require.Len(t, res.Candidates, 3)
+		assert.ElementsMatch(t, []string{"hi 1", "hi 2", "hi 3"}, res.Contents())
+		assert.Equal(t, res.Candidates[0].Content, res.Content)
+		assert.Equal(t, llm.Usage{InputTokens: 30, OutputTokens: 15}, res.Usage)
+		assert.Equal(t, 1.5, res.Cost)
+		assert.Equal(t, "test-model", res.Model)
+	})
+
+	t.Run("fails if any call fails", func(t *testing.T) {
+		boom := errors.New("boom")
+		var calls atomic.Int32
+		_, err := llm.InferParallel(context.Background(), req, func(ctx context.Context, req llm.InferRequest) (*llm.InferResponse, error) {
+			if calls.Add(1) == 1 {
+				return nil, boom
+			}
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+		assert.ErrorIs(t, err, boom)
+	})
+
+	t.Run("single candidate", func(t *testing.T) {
+		req := req
+		req.MessageOptions.Candidates = 0
+		res, err := llm.InferParallel(context.Background(), req, func(ctx context.Context, req llm.InferRequest) (*llm.InferResponse, error) {
+			return &llm.InferResponse{Content: "hi"}, nil
+		})
+		require.NoError(t, err)
+		assert.Nil(t, res.Candidates)
+		assert.Equal(t, []string{"hi"}, res.Contents())
+	})
+}
@@ -0,0 +1,125 @@
+package llm
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// Capabilities are the features a model supports. ValidateRequest checks requests against them before they
+// are sent, so unsupported requests fail with a descriptive error instead of a provider error.
+type Capabilities struct {
+	// Vision is image input, from data or URLs.
+	Vision bool `json:"vision" yaml:"vision"`
+	// Audio is audio input.
+	Audio bool `json:"audio" yaml:"audio"`
+	// Documents is PDF input.
+	Documents bool `json:"documents" yaml:"documents"`
+	Tools     bool `json:"tools" yaml:"tools"`
+	Streaming bool `json:"streaming" yaml:"streaming"`
+	// SystemPrompt is support for system messages. o1-mini, for one, rejects them.
+	SystemPrompt bool `json:"system_prompt" yaml:"system_prompt"`
+	// PromptCaching is support for InferMessage.ShouldCache, explicit or automatic.
+	PromptCaching bool `json:"prompt_caching" yaml:"prompt_caching"`
+	// Temperature is support for setting the temperature. Reasoning models, e.g. o1, reject it.
+	Temperature bool `json:"temperature" yaml:"temperature"`
+}
+
+// Capability names a feature in an UnsupportedCapabilityError.
+type Capability string
+
+const (
+	CapabilityTools         Capability = "tools"
+	CapabilityStreaming     Capability = "streaming"
+	CapabilitySystemPrompt  Capability = "system_prompt"
+	CapabilityPromptCaching Capability = "prompt_caching"
+)
+
+// ErrUnsupportedCapability matches every *UnsupportedCapabilityError.
+var ErrUnsupportedCapability = errors.New("unsupported capability")
+
+// UnsupportedCapabilityError is returned by ValidateRequest when a request needs a feature the model lacks.
+type UnsupportedCapabilityError struct {
+	Capability Capability
+	Model      string
+}
+
+func (e *UnsupportedCapabilityError) Error() string {
+	return fmt.Sprintf("%s is not supported by model %s", e.Capability, e.Model)
+}
+
+func (e *UnsupportedCapabilityError) Is(target error) bool {
+	return target == ErrUnsupportedCapability
+}
+
+// ErrWrongModelType is returned when an LLM config is used for embeddings or the other way around.
+var ErrWrongModelType = errors.New("wrong model type")
+
+// ValidateRequest checks a request against the capabilities of its model, without any network calls.
+// Set streaming for requests to GenerateResponseAsync. Configs without Capabilities are not checked.
+//
+// Unsupported parts return an *UnsupportedPartError, temperature an *UnsupportedOptionError and anything else
+// an *UnsupportedCapabilityError.
+func ValidateRequest(req InferRequest, streaming bool) error {
+	cfg := req.ModelConfig
+	if cfg.ModelType == ModelTypeEmbedding {
+		return errors.Wrapf(ErrWrongModelType, "%s is an embedding model", cfg.ModelName)
+	}
+	caps := cfg.Capabilities
+	if caps == nil {
+		return nil
+	}
+	unsupported := func(c Capability) error {
+		return &UnsupportedCapabilityError{Capability: c, Model: cfg.ModelName}
+	}
+
+	if streaming && !caps.Streaming {
+		return unsupported(CapabilityStreaming)
+	}
+	if len(req.Tools) > 0 && !caps.Tools {
+		return unsupported(CapabilityTools)
+	}
+	if req.MessageOptions.Temperature != 0 && !caps.Temperature {
+		return &UnsupportedOptionError{Option: OptionTemperature, Model: cfg.ModelName}
+	}
+	for _, m := range req.Messages {
+		if m.Role == "system" && !caps.SystemPrompt {
+			return unsupported(CapabilitySystemPrompt)
+		}
+		if m.ShouldCache && !caps.PromptCaching {
+			return unsupported(CapabilityPromptCaching)
+		}
+		for _, part := range m.ContentParts() {
+			if !caps.supportsPart(part) {
+				return &UnsupportedPartError{Type: part.Type, MIMEType: part.MIMEType, Model: cfg.ModelName}
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateEmbedRequest checks an embedding request against the capabilities of its model.
+// Configs without Capabilities are not checked.
+func ValidateEmbedRequest(req EmbedRequest) error {
+	cfg := req.ModelConfig
+	if cfg.ModelType == ModelTypeLLM {
+		return errors.Wrapf(ErrWrongModelType, "%s is not an embedding model", cfg.ModelName)
+	}
+	if cfg.Capabilities != nil && len(req.Image) > 0 && !cfg.Capabilities.Vision {
+		return &UnsupportedPartError{Type: PartTypeImage, MIMEType: DetectMIMEType(req.Image), Model: cfg.ModelName}
+	}
+	return nil
+}
+
+func (c *Capabilities) supportsPart(part Part) bool {
+	switch part.Type {
+	case PartTypeImage, PartTypeImageURL:
+		return c.Vision
+	case PartTypeAudio:
+		return c.Audio
+	case PartTypeDocument:
+		return c.Documents
+	default:
+		return true
+	}
+}
@@ -0,0 +1,101 @@
+package llm_test
+
+import (
+	"testing"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRequest(t *testing.T) {
+	store := llm.NewModelConfigStore()
+	config := func(name string) llm.ModelConfig {
+		cfg, ok := store.GetConfig(name)
+		assert.True(t, ok, name)
+		return cfg
+	}
+	user := llm.InferMessage{Role: "user", Content: "hi"}
+	image := llm.InferMessage{Role: "user", Parts: []llm.Part{llm.TextPart("what's this?"), llm.ImageURLPart("https://example.com/cat.png")}}
+	tool := llm.Tool{Name: "weather", Parameters: map[string]any{"type": "object"}}
+
+	tests := []struct {
+		name      string
+		req       llm.InferRequest
+		streaming bool
+		wantErr   error
+	}{
+		{
+			name: "supported",
+			req:  llm.InferRequest{ModelConfig: config(llm.ConfigGPT4o), Messages: []llm.InferMessage{{Role: "system", Content: "be brief"}, image}, Tools: []llm.Tool{tool}},
+		},
+		{
+			name:    "image on a text model",
+			req:     llm.InferRequest{ModelConfig: config(llm.ConfigDeepseekChat), Messages: []llm.InferMessage{image}},
+			wantErr: llm.ErrUnsupportedPart,
+		},
+		{
+			name:    "audio on a model without audio",
+			req:     llm.InferRequest{ModelConfig: config(llm.ConfigClaude3Dot7Sonnet), Messages: []llm.InferMessage{{Role: "user", Parts: []llm.Part{llm.AudioPart([]byte("RIFF0000WAVEfmt "))}}}},
+			wantErr: llm.ErrUnsupportedPart,
+		},
+		{
+			name:    "temperature on o1",
+			req:     llm.InferRequest{ModelConfig: config(llm.ConfigOpenAIO1), Messages: []llm.InferMessage{user}, MessageOptions: llm.MessageOptions{Temperature: 0.7}},
+			wantErr: llm.ErrUnsupportedOption,
+		},
+		{
+			name:    "system prompt on o1-mini",
+			req:     llm.InferRequest{ModelConfig: config(llm.ConfigOpenAIO1Mini), Messages: []llm.InferMessage{{Role: "system", Content: "be brief"}, user}},
+			wantErr: llm.ErrUnsupportedCapability,
+		},
+		{
+			name:    "tools",
+			req:     llm.InferRequest{ModelConfig: config(llm.ConfigGroqGemma9B), Messages: []llm.InferMessage{user}, Tools: []llm.Tool{tool}},
+			wantErr: llm.ErrUnsupportedCapability,
+		},
+		{
+			name:    "caching",
+			req:     llm.InferRequest{ModelConfig: config(llm.ConfigClaude3Dot5SonnetVertex), Messages: []llm.InferMessage{{Role: "user", Content: "hi", ShouldCache: true}}},
+			wantErr: llm.ErrUnsupportedCapability,
+		},
+		{
+			name:    "embedding model",
+			req:     llm.InferRequest{ModelConfig: config(llm.ConfigOpenAITextEmbedding3Small), Messages: []llm.InferMessage{user}},
+			wantErr: llm.ErrWrongModelType,
+		},
+		{
+			name:      "unknown capabilities aren't checked",
+			req:       llm.InferRequest{ModelConfig: llm.ModelConfig{ProviderType: llm.ProviderOpenAI, ModelName: "custom"}, Messages: []llm.InferMessage{image}},
+			streaming: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := llm.ValidateRequest(tt.req, tt.streaming)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+
+	t.Run("streaming", func(t *testing.T) {
+		cfg := config(llm.ConfigGPT4o)
+		cfg.Capabilities = &llm.Capabilities{Temperature: true}
+		req := llm.InferRequest{ModelConfig: cfg, Messages: []llm.InferMessage{user}}
+		assert.NoError(t, llm.ValidateRequest(req, false))
+		err := llm.ValidateRequest(req, true)
+		assert.ErrorIs(t, err, llm.ErrUnsupportedCapability)
+		assert.EqualError(t, err, "streaming is not supported by model gpt-4o-2024-08-06")
+	})
+}
+
+func TestValidateEmbedRequest(t *testing.T) {
+	cfg, _ := llm.NewModelConfigStore().GetConfig(llm.ConfigOpenAITextEmbedding3Small)
+	assert.NoError(t, llm.ValidateEmbedRequest(llm.EmbedRequest{ModelConfig: cfg, Input: []string{"hi"}}))
+	assert.ErrorIs(t, llm.ValidateEmbedRequest(llm.EmbedRequest{ModelConfig: cfg, Image: []byte("\x89PNG\r\n\x1a\n")}), llm.ErrUnsupportedPart)
+
+	cfg, _ = llm.NewModelConfigStore().GetConfig(llm.ConfigGPT4o)
+	assert.ErrorIs(t, llm.ValidateEmbedRequest(llm.EmbedRequest{ModelConfig: cfg, Input: []string{"hi"}}), llm.ErrWrongModelType)
+}
@@ -10,9 +10,17 @@ const (
 	ProviderTogether   ProviderType = "together"
 	ProviderHyperbolic ProviderType = "hyperbolic"
 	ProviderDeepseek   ProviderType = "deepseek"
+	// Azure OpenAI routes requests by ModelConfig.Deployment
+	ProviderAzureOpenAI ProviderType = "azureopenai"
+	// Amazon Bedrock, see the bedrock provider package
+	ProviderBedrock ProviderType = "bedrock"
 
 	ProviderVoyage     ProviderType = "voyage"
 	ProviderMixedBread ProviderType = "mixedbread"
+
+	// local servers, see the local provider package
+	ProviderOllama   ProviderType = "ollama"
+	ProviderLlamaCpp ProviderType = "llamacpp"
 )
 
 // configs are user declared, here's some useful defaults
@@ -57,6 +65,12 @@ const (
 	ConfigClaude3Dot5SonnetVertex = "claude-3.5-sonnet-vertex"
 	ConfigLlama405BVertex         = "llama-405b-vertex"
 
+	// Bedrock
+	ConfigClaude3Dot6SonnetBedrock = "claude-3.6-sonnet-bedrock"
+	ConfigClaude3Dot5HaikuBedrock  = "claude-3.5-haiku-bedrock"
+	ConfigLlama70BBedrock          = "llama-70b-bedrock"
+	ConfigLlama8BBedrock           = "llama-8b-bedrock"
+
 	// Embedding models
 	ConfigOpenAITextEmbedding3Small = "openai-text-embedding-3-small"
 	ConfigOpenAITextEmbedding3Large = "openai-text-embedding-3-large"
@@ -64,8 +78,18 @@ const (
 
 	ConfigGeminiTextEmbedding4 = "gemini-text-embedding-004"
 
+	// Hyperbolic's serverless API has no embedding models, only text, image and audio generation, so there are
+	// no Hyperbolic embedding configs. NewHyperbolicProvider embeds with any config added for a model it serves.
+	ConfigTogetherBGELargeEnV15        = "together-bge-large-en-v1.5"
+	ConfigTogetherBGEBaseEnV15         = "together-bge-base-en-v1.5"
+	ConfigTogetherM2Bert80M8kRetrieval = "together-m2-bert-80m-8k-retrieval"
+	ConfigTogetherMultilingualE5Large  = "together-multilingual-e5-large-instruct"
+
 	ConfigMxbaiEmbedLargeV1    = "mxbai-embed-large-v1"
 	ConfigVoyageLarge2Instruct = "voyage-large-2-instruct"
+
+	ConfigTitanTextEmbedV2Bedrock     = "titan-text-embed-v2-bedrock"
+	ConfigCohereEmbedEnglishV3Bedrock = "cohere-embed-english-v3-bedrock"
 )
 
 var configs = map[string]ModelConfig{
@@ -75,6 +99,10 @@ var configs = map[string]ModelConfig{
 		ModelType:                        ModelTypeLLM,
 		CentiCentsPerMillionInputTokens:  30000,
 		CentiCentsPerMillionOutputTokens: 150000,
+		Pricing:                          &Pricing{CacheReadPerMillionTokens: 3_000, CacheWritePerMillionTokens: 37_500, BatchDiscount: 0.5},
+		ContextWindow:                    200_000,
+		MaxOutputTokens:                  8_192,
+		Capabilities:                     capabilities(claudeCapabilities),
 	},
 	ConfigClaude3Dot5SonnetVertex: {
 		ProviderType:                     ProviderVertex,
@@ -82,20 +110,80 @@ var configs = map[string]ModelConfig{
 		ModelType:                        ModelTypeLLM,
 		CentiCentsPerMillionInputTokens:  30000,
 		CentiCentsPerMillionOutputTokens: 150000,
+		ContextWindow:                    200_000,
+		MaxOutputTokens:                  8_192,
+		Capabilities:                     capabilities(claudeCapabilities, withoutCaching),
 	},
 	ConfigLlama405BVertex: {
 		ProviderType: ProviderVertex,
 		ModelName:    "llama3-405b-instruct-maas",
 		ModelType:    ModelTypeLLM,
 		//	The Llama 3.1 API service is at no cost during public preview, and will be priced as per dollar-per-1M-tokens at GA.
+		ContextWindow:   128_000,
+		MaxOutputTokens: 4_096,
+		Capabilities:    capabilities(chatCapabilities),
+	},
+	ConfigClaude3Dot6SonnetBedrock: {
+		ProviderType:                     ProviderBedrock,
+		ModelName:                        "anthropic.claude-3-5-sonnet-20241022-v2:0",
+		ModelType:                        ModelTypeLLM,
+		CentiCentsPerMillionInputTokens:  30000,
+		CentiCentsPerMillionOutputTokens: 150000,
+		ContextWindow:                    200_000,
+		MaxOutputTokens:                  8_192,
+		Capabilities:                     capabilities(claudeCapabilities, withoutCaching),
+	},
+	ConfigClaude3Dot5HaikuBedrock: {
+		ProviderType:                     ProviderBedrock,
+		ModelName:                        "anthropic.claude-3-5-haiku-20241022-v1:0",
+		ModelType:                        ModelTypeLLM,
+		CentiCentsPerMillionInputTokens:  8000,
+		CentiCentsPerMillionOutputTokens: 40000,
+		ContextWindow:                    200_000,
+		MaxOutputTokens:                  8_192,
+		Capabilities:                     capabilities(claudeCapabilities, withoutCaching, withoutVision),
+	},
+	ConfigLlama70BBedrock: {
+		ProviderType:                     ProviderBedrock,
+		ModelName:                        "meta.llama3-1-70b-instruct-v1:0",
+		ModelType:                        ModelTypeLLM,
+		CentiCentsPerMillionInputTokens:  7200,
+		CentiCentsPerMillionOutputTokens: 7200,
+		ContextWindow:                    128_000,
+		MaxOutputTokens:                  2_048,
+		Capabilities:                     capabilities(chatCapabilities),
+	},
+	ConfigLlama8BBedrock: {
+		ProviderType:                     ProviderBedrock,
+		ModelName:                        "meta.llama3-1-8b-instruct-v1:0",
+		ModelType:                        ModelTypeLLM,
+		CentiCentsPerMillionInputTokens:  2200,
+		CentiCentsPerMillionOutputTokens: 2200,
+		ContextWindow:                    128_000,
+		MaxOutputTokens:                  2_048,
+		Capabilities:                     capabilities(chatCapabilities),
 	},
 	ConfigClaude3Dot6Sonnet: {
-		ProviderType: ProviderAnthropic,
-		ModelName:    "claude-3-5-sonnet-20241022",
+		ProviderType:                     ProviderAnthropic,
+		ModelName:                        "claude-3-5-sonnet-20241022",
+		ModelType:                        ModelTypeLLM,
+		CentiCentsPerMillionInputTokens:  30000,
+		CentiCentsPerMillionOutputTokens: 150000,
+		Pricing:                          &Pricing{CacheReadPerMillionTokens: 3_000, CacheWritePerMillionTokens: 37_500, BatchDiscount: 0.5},
+		ContextWindow:                    200_000,
+		MaxOutputTokens:                  8_192,
+		Capabilities:                     capabilities(claudeCapabilities),
 	},
 	ConfigClaude3Dot7Sonnet: {
-		ProviderType: ProviderAnthropic,
-		ModelName:    "claude-3-7-sonnet-latest",
+		ProviderType:                     ProviderAnthropic,
+		ModelName:                        "claude-3-7-sonnet-latest",
+		ModelType:                        ModelTypeLLM,
+		CentiCentsPerMillionInputTokens:  30000,
+		CentiCentsPerMillionOutputTokens: 150000,
+		Pricing:                          &Pricing{CacheReadPerMillionTokens: 3_000, CacheWritePerMillionTokens: 37_500, BatchDiscount: 0.5},
+		ContextWindow:                    200_000,
+		MaxOutputTokens:                  64_000,
+		Capabilities:                     capabilities(claudeCapabilities),
 	},
 	ConfigGPT4Mini: {
 		ProviderType:                     ProviderOpenAI,
@@ -103,43 +191,76 @@ var configs = map[string]ModelConfig{
 		ModelType:                        ModelTypeLLM,
 		CentiCentsPerMillionInputTokens:  1_500,
 		CentiCentsPerMillionOutputTokens: 6_000,
+		Pricing:                          &Pricing{CacheReadPerMillionTokens: 750, BatchDiscount: 0.5},
+		ContextWindow:                    128_000,
+		MaxOutputTokens:                  16_384,
+		Capabilities:                     capabilities(gptCapabilities),
 	},
 	ConfigGPT4o: {
 		ProviderType: ProviderOpenAI,
 		// NB 2025-01-08: 2024-08-06 remains 'latest', but there is also 'gpt-4o-2024-11-20'
 		ModelName:                        "gpt-4o-2024-08-06",
+		ModelType:                        ModelTypeLLM,
 		CentiCentsPerMillionInputTokens:  25_000,
 		CentiCentsPerMillionOutputTokens: 100_000,
+		Pricing:                          &Pricing{CacheReadPerMillionTokens: 12_500, BatchDiscount: 0.5},
+		ContextWindow:                    128_000,
+		MaxOutputTokens:                  16_384,
+		Capabilities:                     capabilities(gptCapabilities),
 	},
 	ConfigOpenAIO1: {
 		ProviderType:                     ProviderOpenAI,
 		ModelName:                        "o1",
+		ModelType:                        ModelTypeLLM,
 		CentiCentsPerMillionInputTokens:  150_000,
 		CentiCentsPerMillionOutputTokens: 600_000,
+		Pricing:                          &Pricing{CacheReadPerMillionTokens: 75_000, BatchDiscount: 0.5},
+		ContextWindow:                    200_000,
+		MaxOutputTokens:                  100_000,
+		Capabilities:                     capabilities(gptCapabilities, withoutTemperature),
 	},
 	ConfigOpenAIO1Mini: {
 		ProviderType:                     ProviderOpenAI,
 		ModelName:                        "o1-mini",
+		ModelType:                        ModelTypeLLM,
 		CentiCentsPerMillionInputTokens:  30_000,
 		CentiCentsPerMillionOutputTokens: 120_000,
+		Pricing:                          &Pricing{CacheReadPerMillionTokens: 15_000, BatchDiscount: 0.5},
+		ContextWindow:                    128_000,
+		MaxOutputTokens:                  65_536,
+		Capabilities:                     capabilities(gptCapabilities, withoutTemperature, withoutVision, withoutTools, withoutSystemPrompt),
 	},
 	ConfigOpenAIO3Mini: {
 		ProviderType:                     ProviderOpenAI,
 		ModelName:                        "o3-mini",
+		ModelType:                        ModelTypeLLM,
 		CentiCentsPerMillionInputTokens:  150_000,
 		CentiCentsPerMillionOutputTokens: 600_000,
+		Pricing:                          &Pricing{CacheReadPerMillionTokens: 75_000, BatchDiscount: 0.5},
+		ContextWindow:                    200_000,
+		MaxOutputTokens:                  100_000,
+		Capabilities:                     capabilities(gptCapabilities, withoutTemperature, withoutVision),
 	},
 	ConfigOpenAIO1Preview: {
 		ProviderType:                     ProviderOpenAI,
 		ModelName:                        "o1-preview",
+		ModelType:                        ModelTypeLLM,
 		CentiCentsPerMillionInputTokens:  150_000,
 		CentiCentsPerMillionOutputTokens: 600_000,
+		Pricing:                          &Pricing{CacheReadPerMillionTokens: 75_000, BatchDiscount: 0.5},
+		ContextWindow:                    128_000,
+		MaxOutputTokens:                  32_768,
+		Capabilities:                     capabilities(gptCapabilities, withoutTemperature, withoutVision, withoutTools, withoutSystemPrompt),
 	},
 	ConfigGroqLlama70B: {
 		ProviderType:                     ProviderGroq,
 		ModelName:                        "llama-3.3-70b-versatile",
+		ModelType:                        ModelTypeLLM,
 		CentiCentsPerMillionInputTokens:  5900,
 		CentiCentsPerMillionOutputTokens: 7900,
+		ContextWindow:                    131_072,
+		MaxOutputTokens:                  32_768,
+		Capabilities:                     capabilities(chatCapabilities),
 	},
 	ConfigGroqMixtral: {
 		ProviderType:                     ProviderGroq,
@@ -147,6 +268,9 @@ var configs = map[string]ModelConfig{
 		ModelType:                        ModelTypeLLM,
 		CentiCentsPerMillionInputTokens:  2400,
 		CentiCentsPerMillionOutputTokens: 2400,
+		ContextWindow:                    32_768,
+		MaxOutputTokens:                  32_768,
+		Capabilities:                     capabilities(chatCapabilities),
 	},
 	ConfigGroqGemma9B: {
 		ProviderType:                     ProviderGroq,
@@ -154,6 +278,9 @@ var configs = map[string]ModelConfig{
 		ModelType:                        ModelTypeLLM,
 		CentiCentsPerMillionInputTokens:  2000,
 		CentiCentsPerMillionOutputTokens: 2000,
+		ContextWindow:                    8_192,
+		MaxOutputTokens:                  8_192,
+		Capabilities:                     capabilities(chatCapabilities, withoutTools),
 	},
 	ConfigGroqLlama8B: {
 		ProviderType:                     ProviderGroq,
@@ -161,6 +288,9 @@ var configs = map[string]ModelConfig{
 		CentiCentsPerMillionInputTokens:  500,
 		CentiCentsPerMillionOutputTokens: 800,
 		ModelName:                        "llama-3.1-8b-instant",
+		ContextWindow:                    131_072,
+		MaxOutputTokens:                  8_192,
+		Capabilities:                     capabilities(chatCapabilities),
 	},
 	ConfigTogetherGemma27B: {
 		ProviderType:                     ProviderTogether,
@@ -168,6 +298,9 @@ var configs = map[string]ModelConfig{
 		ModelType:                        ModelTypeLLM,
 		CentiCentsPerMillionOutputTokens: 8000,
 		CentiCentsPerMillionInputTokens:  8000,
+		ContextWindow:                    8_192,
+		MaxOutputTokens:                  8_192,
+		Capabilities:                     capabilities(chatCapabilities, withoutTools, withoutSystemPrompt),
 	},
 	ConfigTogetherDeepseekCoder33B: {
 		ProviderType:                     ProviderTogether,
@@ -175,34 +308,62 @@ var configs = map[string]ModelConfig{
 		ModelType:                        ModelTypeLLM,
 		CentiCentsPerMillionOutputTokens: 8000,
 		CentiCentsPerMillionInputTokens:  8000,
+		ContextWindow:                    16_384,
+		MaxOutputTokens:                  16_384,
+		Capabilities:                     capabilities(chatCapabilities, withoutTools),
 	},
 	ConfigGemini1Dot5Flash: {
-		ProviderType: ProviderGoogle,
-		ModelName:    "gemini-1.5-flash",
-		ModelType:    ModelTypeLLM,
-		// assumes < 128k
+		ProviderType:                     ProviderGoogle,
+		ModelName:                        "gemini-1.5-flash",
+		ModelType:                        ModelTypeLLM,
 		CentiCentsPerMillionOutputTokens: 3000,
 		CentiCentsPerMillionInputTokens:  750,
+		Pricing: &Pricing{
+			CacheReadPerMillionTokens: 187.5,
+			Tiers:                     []PricingTier{{AboveInputTokens: 128_000, InputPerMillionTokens: 1_500, OutputPerMillionTokens: 6_000, CacheReadPerMillionTokens: 375}},
+		},
+		ContextWindow:   1_048_576,
+		MaxOutputTokens: 8_192,
+		Capabilities:    capabilities(geminiCapabilities),
 	},
 	ConfigGemini1Dot5Flash8B: {
-		ProviderType: ProviderGoogle,
-		ModelName:    "gemini-1.5-flash-8b",
-		ModelType:    ModelTypeLLM,
-		// assumes < 128k
+		ProviderType:                     ProviderGoogle,
+		ModelName:                        "gemini-1.5-flash-8b",
+		ModelType:                        ModelTypeLLM,
 		CentiCentsPerMillionOutputTokens: 1500,
 		CentiCentsPerMillionInputTokens:  375,
+		Pricing: &Pricing{
+			CacheReadPerMillionTokens: 100,
+			Tiers:                     []PricingTier{{AboveInputTokens: 128_000, InputPerMillionTokens: 750, OutputPerMillionTokens: 3_000, CacheReadPerMillionTokens: 200}},
+		},
+		ContextWindow:   1_048_576,
+		MaxOutputTokens: 8_192,
+		Capabilities:    capabilities(geminiCapabilities),
 	},
 	ConfigGemini1Dot5Pro: {
-		ProviderType: ProviderGoogle,
-		ModelName:    "gemini-1.5-pro",
-		ModelType:    ModelTypeLLM,
-		// assumes < 128k
+		ProviderType:                     ProviderGoogle,
+		ModelName:                        "gemini-1.5-pro",
+		ModelType:                        ModelTypeLLM,
 		CentiCentsPerMillionOutputTokens: 50000,
 		CentiCentsPerMillionInputTokens:  12500,
+		Pricing: &Pricing{
+			CacheReadPerMillionTokens: 3_125,
+			Tiers:                     []PricingTier{{AboveInputTokens: 128_000, InputPerMillionTokens: 25_000, OutputPerMillionTokens: 100_000, CacheReadPerMillionTokens: 6_250}},
+		},
+		ContextWindow:   2_097_152,
+		MaxOutputTokens: 8_192,
+		Capabilities:    capabilities(geminiCapabilities),
 	},
 	ConfigGemini2Flash: {
-		ProviderType: ProviderGoogle,
-		ModelName:    "gemini-2.0-flash",
+		ProviderType:                     ProviderGoogle,
+		ModelName:                        "gemini-2.0-flash",
+		ModelType:                        ModelTypeLLM,
+		CentiCentsPerMillionInputTokens:  1000,
+		CentiCentsPerMillionOutputTokens: 4000,
+		Pricing:                          &Pricing{CacheReadPerMillionTokens: 250},
+		ContextWindow:                    1_048_576,
+		MaxOutputTokens:                  8_192,
+		Capabilities:                     capabilities(geminiCapabilities),
 	},
 	ConfigHyperbolicLlama405B: {
 		ProviderType: ProviderHyperbolic,
@@ -211,6 +372,8 @@ var configs = map[string]ModelConfig{
 
 		CentiCentsPerMillionInputTokens:  40000,
 		CentiCentsPerMillionOutputTokens: 40000,
+		ContextWindow:                    131_072,
+		Capabilities:                     capabilities(chatCapabilities),
 	},
 	ConfigHyperbolicLlama405BBase: {
 		ProviderType: ProviderHyperbolic,
@@ -219,6 +382,8 @@ var configs = map[string]ModelConfig{
 
 		CentiCentsPerMillionInputTokens:  40000,
 		CentiCentsPerMillionOutputTokens: 40000,
+		ContextWindow:                    131_072,
+		Capabilities:                     capabilities(chatCapabilities, withoutTools, withoutSystemPrompt),
 	},
 	ConfigHyperbolicLlama70B: {
 		ProviderType: ProviderHyperbolic,
@@ -227,6 +392,8 @@ var configs = map[string]ModelConfig{
 
 		CentiCentsPerMillionInputTokens:  4000,
 		CentiCentsPerMillionOutputTokens: 4000,
+		ContextWindow:                    131_072,
+		Capabilities:                     capabilities(chatCapabilities),
 	},
 	ConfigHyperbolicLlama8B: {
 		ProviderType: ProviderHyperbolic,
@@ -235,6 +402,8 @@ var configs = map[string]ModelConfig{
 
 		CentiCentsPerMillionInputTokens:  1000,
 		CentiCentsPerMillionOutputTokens: 1000,
+		ContextWindow:                    131_072,
+		Capabilities:                     capabilities(chatCapabilities),
 	},
 
 	ConfigDeepseekChat: {
@@ -242,51 +411,148 @@ var configs = map[string]ModelConfig{
 		ModelName:    "deepseek-chat",
 		ModelType:    ModelTypeLLM,
 
-		// assume cache miss
 		CentiCentsPerMillionInputTokens:  1400,
 		CentiCentsPerMillionOutputTokens: 2800,
+		Pricing:                          &Pricing{CacheReadPerMillionTokens: 140},
+		ContextWindow:                    65_536,
+		MaxOutputTokens:                  8_192,
+		Capabilities:                     capabilities(chatCapabilities, withCaching),
 	},
 	ConfigDeepseekCoder: {
 		ProviderType: ProviderDeepseek,
 		ModelName:    "deepseek-coder",
 		ModelType:    ModelTypeLLM,
 
-		// assume cache miss
 		CentiCentsPerMillionInputTokens:  1400,
 		CentiCentsPerMillionOutputTokens: 2800,
+		Pricing:                          &Pricing{CacheReadPerMillionTokens: 140},
+		ContextWindow:                    65_536,
+		MaxOutputTokens:                  8_192,
+		Capabilities:                     capabilities(chatCapabilities, withCaching),
 	},
 
 	ConfigOpenAITextEmbedding3Small: {
-		ProviderType: ProviderOpenAI,
-		ModelName:    "text-embedding-3-small",
-		ModelType:    ModelTypeEmbedding,
+		ProviderType:  ProviderOpenAI,
+		ModelName:     "text-embedding-3-small",
+		ModelType:     ModelTypeEmbedding,
+		ContextWindow: 8_191,
+		Capabilities:  capabilities(embeddingCapabilities),
 	},
 	ConfigOpenAITextEmbedding3Large: {
-		ProviderType: ProviderOpenAI,
-		ModelName:    "text-embedding-3-large",
-		ModelType:    ModelTypeEmbedding,
+		ProviderType:  ProviderOpenAI,
+		ModelName:     "text-embedding-3-large",
+		ModelType:     ModelTypeEmbedding,
+		ContextWindow: 8_191,
+		Capabilities:  capabilities(embeddingCapabilities),
 	},
 	ConfigOpenAITextEmbeddingAda002: {
-		ProviderType: ProviderOpenAI,
-		ModelName:    "text-embedding-ada-002",
-		ModelType:    ModelTypeEmbedding,
+		ProviderType:  ProviderOpenAI,
+		ModelName:     "text-embedding-ada-002",
+		ModelType:     ModelTypeEmbedding,
+		ContextWindow: 8_191,
+		Capabilities:  capabilities(embeddingCapabilities),
 	},
 
 	ConfigGeminiTextEmbedding4: {
-		ProviderType: ProviderGoogle,
-		ModelName:    "text-embedding-004",
-		ModelType:    ModelTypeEmbedding,
+		ProviderType:  ProviderGoogle,
+		ModelName:     "text-embedding-004",
+		ModelType:     ModelTypeEmbedding,
+		ContextWindow: 2_048,
+		Capabilities:  capabilities(embeddingCapabilities),
+	},
+
+	ConfigTogetherBGELargeEnV15: {
+		ProviderType:  ProviderTogether,
+		ModelName:     "BAAI/bge-large-en-v1.5",
+		ModelType:     ModelTypeEmbedding,
+		ContextWindow: 512,
+		Capabilities:  capabilities(embeddingCapabilities),
+	},
+	ConfigTogetherBGEBaseEnV15: {
+		ProviderType:  ProviderTogether,
+		ModelName:     "BAAI/bge-base-en-v1.5",
+		ModelType:     ModelTypeEmbedding,
+		ContextWindow: 512,
+		Capabilities:  capabilities(embeddingCapabilities),
+	},
+	ConfigTogetherM2Bert80M8kRetrieval: {
+		ProviderType:  ProviderTogether,
+		ModelName:     "togethercomputer/m2-bert-80M-8k-retrieval",
+		ModelType:     ModelTypeEmbedding,
+		ContextWindow: 8_192,
+		Capabilities:  capabilities(embeddingCapabilities),
+	},
+	ConfigTogetherMultilingualE5Large: {
+		ProviderType:  ProviderTogether,
+		ModelName:     "intfloat/multilingual-e5-large-instruct",
+		ModelType:     ModelTypeEmbedding,
+		ContextWindow: 514,
+		Capabilities:  capabilities(embeddingCapabilities),
 	},
 
 	ConfigMxbaiEmbedLargeV1: {
-		ProviderType: ProviderMixedBread,
-		ModelName:    "mxbai-embed-large-v1",
-		ModelType:    ModelTypeEmbedding,
+		ProviderType:  ProviderMixedBread,
+		ModelName:     "mxbai-embed-large-v1",
+		ModelType:     ModelTypeEmbedding,
+		ContextWindow: 512,
+		Capabilities:  capabilities(embeddingCapabilities),
 	},
 
 	ConfigVoyageLarge2Instruct: {
-		ProviderType: ProviderVoyage,
-		ModelName:    "voyage-large-2-instruct",
-		ModelType:    ModelTypeEmbedding,
+		ProviderType:  ProviderVoyage,
+		ModelName:     "voyage-large-2-instruct",
+		ModelType:     ModelTypeEmbedding,
+		ContextWindow: 16_000,
+		Capabilities:  capabilities(embeddingCapabilities),
+	},
+
+	ConfigTitanTextEmbedV2Bedrock: {
+		ProviderType:                    ProviderBedrock,
+		ModelName:                       "amazon.titan-embed-text-v2:0",
+		ModelType:                       ModelTypeEmbedding,
+		CentiCentsPerMillionInputTokens: 200,
+		ContextWindow:                   8_192,
+		Capabilities:                    capabilities(embeddingCapabilities),
+	},
+	ConfigCohereEmbedEnglishV3Bedrock: {
+		ProviderType:                    ProviderBedrock,
+		ModelName:                       "cohere.embed-english-v3",
+		ModelType:                       ModelTypeEmbedding,
+		CentiCentsPerMillionInputTokens: 1000,
+		ContextWindow:                   512,
+		Capabilities:                    capabilities(embeddingCapabilities),
 	},
 }
+
+// capability sets shared by the built-in configs
+var (
+	claudeCapabilities = Capabilities{
+		Vision: true, Documents: true, Tools: true, Streaming: true, SystemPrompt: true, PromptCaching: true, Temperature: true,
+	}
+	// OpenAI caches long prompts automatically
+	gptCapabilities = Capabilities{
+		Vision: true, Tools: true, Streaming: true, SystemPrompt: true, PromptCaching: true, Temperature: true,
+	}
+	geminiCapabilities = Capabilities{
+		Vision: true, Audio: true, Documents: true, Tools: true, Streaming: true, SystemPrompt: true, PromptCaching: true,
+		Temperature: true,
+	}
+	// chatCapabilities are those of the open weight chat models
+	chatCapabilities      = Capabilities{Tools: true, Streaming: true, SystemPrompt: true, Temperature: true}
+	embeddingCapabilities = Capabilities{}
+)
+
+func withoutCaching(c *Capabilities)      { c.PromptCaching = false }
+func withCaching(c *Capabilities)         { c.PromptCaching = true }
+func withoutTemperature(c *Capabilities)  { c.Temperature = false }
+func withoutVision(c *Capabilities)       { c.Vision = false }
+func withoutTools(c *Capabilities)        { c.Tools = false }
+func withoutSystemPrompt(c *Capabilities) { c.SystemPrompt = false }
+
+// capabilities returns a copy of base with the changes applied, so configs don't share capabilities.
+func capabilities(base Capabilities, changes ...func(*Capabilities)) *Capabilities {
+	for _, change := range changes {
+		change(&base)
+	}
+	return &base
+}
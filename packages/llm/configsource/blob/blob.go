@@ -0,0 +1,33 @@
+// Package blob loads model configs from an object in a gocloud bucket, e.g. on GCS or S3.
+package blob
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"gocloud.dev/blob"
+)
+
+// NewConfigSource reads configs from a YAML or JSON object in the bucket, see llm.ModelConfigStore.Load for the
+// format.
+func NewConfigSource(bucket *blob.Bucket, key string) llm.ConfigSource {
+	return bucketSource{bucket: bucket, key: key}
+}
+
+type bucketSource struct {
+	bucket *blob.Bucket
+	key    string
+}
+
+func (s bucketSource) Read(ctx context.Context) ([]byte, error) {
+	return s.bucket.ReadAll(ctx, s.key)
+}
+
+func (s bucketSource) Version(ctx context.Context) (string, error) {
+	attrs, err := s.bucket.Attributes(ctx, s.key)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%d-%d", attrs.ETag, attrs.ModTime.UnixNano(), attrs.Size), nil
+}
@@ -0,0 +1,30 @@
+package blob_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/configsource/blob"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob/fileblob"
+)
+
+func TestConfigSource(t *testing.T) {
+	ctx := context.Background()
+	bucket, err := fileblob.OpenBucket(t.TempDir(), nil)
+	require.NoError(t, err)
+	defer bucket.Close()
+	require.NoError(t, bucket.WriteAll(ctx, "configs/models.yaml", []byte("gpt-4o:\n  base_url: https://bucket.internal/v1\n"), nil))
+
+	src := blob.NewConfigSource(bucket, "configs/models.yaml")
+	store, err := llm.LoadModelConfigStore(ctx, src)
+	require.NoError(t, err)
+	cfg, _ := store.GetConfig(llm.ConfigGPT4o)
+	assert.Equal(t, "https://bucket.internal/v1", cfg.BaseURL)
+
+	version, err := src.Version(ctx)
+	require.NoError(t, err)
+	assert.NotEmpty(t, version)
+}
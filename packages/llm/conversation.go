@@ -0,0 +1,365 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Conversation owns a chat history along with the model and options used to continue it.
+// It is safe for concurrent use. Turns are taken one at a time: Send, Reply, Stream and Append wait for the
+// previous turn to finish, so every request sees the whole history and a failed turn only rolls back its own
+// messages.
+type Conversation struct {
+	// turn is held from adding the user message until the reply is added or rolled back
+	turn      sync.Mutex
+	mu        sync.Mutex
+	id        string
+	parentID  string
+	config    ModelConfig
+	options   MessageOptions
+	messages  []InferMessage
+	updatedAt time.Time
+}
+
+// NewConversation starts an empty conversation with a new ID. An empty system prompt adds no system message.
+func NewConversation(config ModelConfig, options MessageOptions, system string) *Conversation {
+	c := &Conversation{
+		id:        uuid.NewString(),
+		config:    config,
+		options:   options,
+		updatedAt: time.Now(),
+	}
+	if system != "" {
+		c.messages = append(c.messages, InferMessage{Role: "system", Content: system})
+	}
+	return c
+}
+
+func (c *Conversation) ID() string {
+	return c.id
+}
+
+// ParentID is the ID of the conversation this one was forked from, if any.
+func (c *Conversation) ParentID() string {
+	return c.parentID
+}
+
+// UpdatedAt is when a message was last added or removed.
+func (c *Conversation) UpdatedAt() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.updatedAt
+}
+
+// Messages returns a copy of the history.
+func (c *Conversation) Messages() []InferMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]InferMessage(nil), c.messages...)
+}
+
+// SetModel changes the model and options used for the next replies.
+func (c *Conversation) SetModel(config ModelConfig, options MessageOptions) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.config = config
+	c.options = options
+}
+
+// Append adds messages to the history, e.g. tool results before calling Reply.
+func (c *Conversation) Append(messages ...InferMessage) {
+	c.turn.Lock()
+	defer c.turn.Unlock()
+	c.add(messages...)
+}
+
+func (c *Conversation) add(messages ...InferMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, messages...)
+	c.updatedAt = time.Now()
+}
+
+// Request builds the request for the next reply.
+func (c *Conversation) Request() InferRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return InferRequest{
+		Messages:       append([]InferMessage(nil), c.messages...),
+		ModelConfig:    c.config,
+		MessageOptions: c.options,
+	}
+}
+
+// Send adds a user message and gets the model's reply, which is added to the history.
+// If the request fails the user message is removed again, so Send can be retried.
+func (c *Conversation) Send(ctx context.Context, r Responder, content string) (*InferResponse, error) {
+	c.turn.Lock()
+	defer c.turn.Unlock()
+	n := c.push(InferMessage{Role: "user", Content: content})
+	res, err := c.reply(ctx, r)
+	if err != nil {
+		c.truncate(n)
+		return nil, err
+	}
+	return res, nil
+}
+
+// Reply gets the model's reply to the history as it is, e.g. after appending tool results, and adds it.
+func (c *Conversation) Reply(ctx context.Context, r Responder) (*InferResponse, error) {
+	c.turn.Lock()
+	defer c.turn.Unlock()
+	return c.reply(ctx, r)
+}
+
+func (c *Conversation) reply(ctx context.Context, r Responder) (*InferResponse, error) {
+	res, err := r.Infer(ctx, c.Request())
+	if err != nil {
+		return nil, err
+	}
+	c.add(InferMessage{Role: "assistant", Content: res.Content, ToolCalls: res.ToolCalls})
+	return res, nil
+}
+
+// Stream is like Send but streams the reply. The reply is added to the history when the stream ends with EOF.
+// If it fails, or ctx is cancelled first, the user message is removed again. The turn lasts until the channel
+// is drained or ctx is cancelled, so the next turn waits for that.
+func (c *Conversation) Stream(ctx context.Context, r Responder, content string) (<-chan StreamDelta, error) {
+	c.turn.Lock()
+	n := c.push(InferMessage{Role: "user", Content: content})
+	ch, err := r.GenerateResponseAsync(ctx, c.Request())
+	if err != nil {
+		c.truncate(n)
+		c.turn.Unlock()
+		return nil, err
+	}
+
+	outChan := make(chan StreamDelta)
+	go func() {
+		defer c.turn.Unlock()
+		defer close(outChan)
+		var text strings.Builder
+		done := false
+		defer func() {
+			if !done {
+				c.truncate(n)
+			}
+		}()
+		for delta := range ch {
+			text.WriteString(delta.Text)
+			if delta.EOF {
+				c.add(InferMessage{Role: "assistant", Content: text.String(), ToolCalls: delta.ToolCalls})
+				done = true
+			}
+			select {
+			case outChan <- delta:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return outChan, nil
+}
+
+// push appends a message and returns the length of the history before it.
+func (c *Conversation) push(m InferMessage) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := len(c.messages)
+	c.messages = append(c.messages, m)
+	c.updatedAt = time.Now()
+	return n
+}
+
+func (c *Conversation) truncate(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if n < len(c.messages) {
+		c.messages = c.messages[:n]
+		c.updatedAt = time.Now()
+	}
+}
+
+// Turns returns the number of user messages in the history.
+func (c *Conversation) Turns() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	turns := 0
+	for _, m := range c.messages {
+		if m.Role == "user" {
+			turns++
+		}
+	}
+	return turns
+}
+
+// Fork returns a copy of the conversation with a new ID, which can continue independently.
+func (c *Conversation) Fork() *Conversation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.fork(len(c.messages))
+}
+
+// BranchAt forks the conversation just before the given turn, counting user messages from 0, so a different
+// message can be sent in its place. BranchAt(Turns()) is the same as Fork.
+func (c *Conversation) BranchAt(turn int) (*Conversation, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	seen := 0
+	for i, m := range c.messages {
+		if m.Role != "user" {
+			continue
+		}
+		if seen == turn {
+			return c.fork(i), nil
+		}
+		seen++
+	}
+	if turn == seen {
+		return c.fork(len(c.messages)), nil
+	}
+	return nil, errors.Errorf("can't branch at turn %d, conversation has %d turns", turn, seen)
+}
+
+func (c *Conversation) fork(n int) *Conversation {
+	return &Conversation{
+		id:        uuid.NewString(),
+		parentID:  c.id,
+		config:    c.config,
+		options:   c.options,
+		messages:  append([]InferMessage(nil), c.messages[:n]...),
+		updatedAt: time.Now(),
+	}
+}
+
+type conversationJSON struct {
+	ID             string         `json:"id"`
+	ParentID       string         `json:"parent_id,omitempty"`
+	ModelConfig    ModelConfig    `json:"model_config"`
+	MessageOptions MessageOptions `json:"message_options"`
+	Messages       []InferMessage `json:"messages"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+}
+
+func (c *Conversation) MarshalJSON() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return json.Marshal(conversationJSON{
+		ID:             c.id,
+		ParentID:       c.parentID,
+		ModelConfig:    c.config,
+		MessageOptions: c.options,
+		Messages:       c.messages,
+		UpdatedAt:      c.updatedAt,
+	})
+}
+
+func (c *Conversation) UnmarshalJSON(b []byte) error {
+	var cj conversationJSON
+	if err := json.Unmarshal(b, &cj); err != nil {
+		return errors.Wrap(err, "could not unmarshal conversation")
+	}
+	if cj.ID == "" {
+		return errors.New("conversation has no id")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.id = cj.ID
+	c.parentID = cj.ParentID
+	c.config = cj.ModelConfig
+	c.options = cj.MessageOptions
+	c.messages = cj.Messages
+	c.updatedAt = cj.UpdatedAt
+	return nil
+}
+
+// ErrConversationNotFound is returned by a ConversationStore when there is no conversation with the ID.
+var ErrConversationNotFound = errors.New("conversation not found")
+
+// ConversationStore persists conversations by ID.
+type ConversationStore interface {
+	// Save creates or replaces the conversation.
+	Save(ctx context.Context, c *Conversation) error
+	Load(ctx context.Context, id string) (*Conversation, error)
+	Delete(ctx context.Context, id string) error
+	// List returns the IDs of all stored conversations, most recently updated first.
+	List(ctx context.Context) ([]string, error)
+}
+
+// MemoryConversationStore keeps conversations in memory, e.g. for tests. Conversations are stored as JSON, so
+// changes after Save aren't visible until the next Save.
+type MemoryConversationStore struct {
+	mu            sync.RWMutex
+	conversations map[string][]byte
+	updatedAt     map[string]time.Time
+}
+
+func NewMemoryConversationStore() *MemoryConversationStore {
+	return &MemoryConversationStore{
+		conversations: make(map[string][]byte),
+		updatedAt:     make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryConversationStore) Save(_ context.Context, c *Conversation) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conversations[c.ID()] = b
+	s.updatedAt[c.ID()] = c.UpdatedAt()
+	return nil
+}
+
+func (s *MemoryConversationStore) Load(_ context.Context, id string) (*Conversation, error) {
+	s.mu.RLock()
+	b, ok := s.conversations[id]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, errors.Wrap(ErrConversationNotFound, id)
+	}
+	c := &Conversation{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *MemoryConversationStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conversations, id)
+	delete(s.updatedAt, id)
+	return nil
+}
+
+func (s *MemoryConversationStore) List(_ context.Context) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := make([]string, 0, len(s.conversations))
+	for id := range s.conversations {
+		ids = append(ids, id)
+	}
+	sortByUpdated(ids, s.updatedAt)
+	return ids, nil
+}
+
+func sortByUpdated(ids []string, updatedAt map[string]time.Time) {
+	slices.SortFunc(ids, func(a, b string) int {
+		if c := updatedAt[b].Compare(updatedAt[a]); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+}
+
+var _ ConversationStore = &MemoryConversationStore{}
@@ -0,0 +1,197 @@
+package llm_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	mock_llm "github.com/stillmatic/gollum/packages/llm/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+var conversationConfig = llm.ModelConfig{ProviderType: llm.ProviderOpenAI, ModelName: "gpt-4o-mini"}
+
+func TestConversationSend(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	responder := mock_llm.NewMockResponder(ctrl)
+	c := llm.NewConversation(conversationConfig, llm.MessageOptions{MaxTokens: 100}, "be brief")
+
+	responder.EXPECT().Infer(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, req llm.InferRequest) (*llm.InferResponse, error) {
+			assert.Equal(t, conversationConfig, req.ModelConfig)
+			assert.Equal(t, 100, req.MessageOptions.MaxTokens)
+			assert.Equal(t, []llm.InferMessage{
+				{Role: "system", Content: "be brief"},
+				{Role: "user", Content: "hi"},
+			}, req.Messages)
+			return &llm.InferResponse{Content: "hello"}, nil
+		})
+	res, err := c.Send(context.Background(), responder, "hi")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", res.Content)
+	assert.Equal(t, 1, c.Turns())
+	assert.Equal(t, llm.InferMessage{Role: "assistant", Content: "hello"}, c.Messages()[2])
+
+	t.Run("failed requests are rolled back", func(t *testing.T) {
+		responder.EXPECT().Infer(gomock.Any(), gomock.Any()).Return(nil, errors.New("boom"))
+		_, err := c.Send(context.Background(), responder, "again")
+		assert.Error(t, err)
+		assert.Len(t, c.Messages(), 3)
+	})
+}
+
+func TestConversationConcurrentSends(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	responder := mock_llm.NewMockResponder(ctrl)
+	c := llm.NewConversation(conversationConfig, llm.MessageOptions{}, "")
+
+	responder.EXPECT().Infer(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, req llm.InferRequest) (*llm.InferResponse, error) {
+			// every request is the history of completed turns plus its own message
+			for i, m := range req.Messages[:len(req.Messages)-1] {
+				if i%2 == 0 {
+					assert.Equal(t, "user", m.Role)
+				} else {
+					assert.Equal(t, "assistant", m.Role)
+				}
+			}
+			last := req.Messages[len(req.Messages)-1]
+			// give other sends a chance to interleave
+			time.Sleep(time.Millisecond)
+			if last.Content == "fail" {
+				return nil, errors.New("boom")
+			}
+			return &llm.InferResponse{Content: "re: " + last.Content}, nil
+		}).Times(20)
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			content := "fail"
+			if i%2 == 0 {
+				content = fmt.Sprint(i)
+			}
+			_, _ = c.Send(context.Background(), responder, content)
+		}()
+	}
+	wg.Wait()
+
+	// failed turns only rolled back their own message
+	messages := c.Messages()
+	require.Len(t, messages, 20)
+	for i := 0; i < len(messages); i += 2 {
+		assert.NotEqual(t, "fail", messages[i].Content)
+		assert.Equal(t, "re: "+messages[i].Content, messages[i+1].Content)
+	}
+}
+
+func TestConversationStream(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	responder := mock_llm.NewMockResponder(ctrl)
+	c := llm.NewConversation(conversationConfig, llm.MessageOptions{}, "")
+
+	ch := make(chan llm.StreamDelta, 3)
+	ch <- llm.StreamDelta{Text: "hel"}
+	ch <- llm.StreamDelta{Text: "lo"}
+	ch <- llm.StreamDelta{EOF: true}
+	close(ch)
+	responder.EXPECT().GenerateResponseAsync(gomock.Any(), gomock.Any()).Return(ch, nil)
+
+	out, err := c.Stream(context.Background(), responder, "hi")
+	require.NoError(t, err)
+	var text string
+	for delta := range out {
+		text += delta.Text
+	}
+	assert.Equal(t, "hello", text)
+	assert.Equal(t, []llm.InferMessage{
+		{Role: "user", Content: "hi"},
+		{Role: "assistant", Content: "hello"},
+	}, c.Messages())
+
+	t.Run("failed streams are rolled back", func(t *testing.T) {
+		ch := make(chan llm.StreamDelta, 2)
+		ch <- llm.StreamDelta{Text: "par"}
+		ch <- llm.StreamDelta{Err: errors.New("boom")}
+		close(ch)
+		responder.EXPECT().GenerateResponseAsync(gomock.Any(), gomock.Any()).Return(ch, nil)
+
+		out, err := c.Stream(context.Background(), responder, "again")
+		require.NoError(t, err)
+		for range out {
+		}
+		assert.Len(t, c.Messages(), 2)
+	})
+}
+
+func TestConversationBranching(t *testing.T) {
+	c := llm.NewConversation(conversationConfig, llm.MessageOptions{}, "system")
+	c.Append(
+		llm.InferMessage{Role: "user", Content: "one"},
+		llm.InferMessage{Role: "assistant", Content: "1"},
+		llm.InferMessage{Role: "user", Content: "two"},
+		llm.InferMessage{Role: "assistant", Content: "2"},
+	)
+
+	fork := c.Fork()
+	assert.NotEqual(t, c.ID(), fork.ID())
+	assert.Equal(t, c.ID(), fork.ParentID())
+	fork.Append(llm.InferMessage{Role: "user", Content: "three"})
+	assert.Equal(t, 2, c.Turns())
+	assert.Equal(t, 3, fork.Turns())
+
+	branch, err := c.BranchAt(1)
+	require.NoError(t, err)
+	assert.Equal(t, c.Messages()[:3], branch.Messages())
+
+	branch, err = c.BranchAt(2)
+	require.NoError(t, err)
+	assert.Equal(t, c.Messages(), branch.Messages())
+
+	_, err = c.BranchAt(3)
+	assert.Error(t, err)
+}
+
+func TestConversationJSON(t *testing.T) {
+	c := llm.NewConversation(conversationConfig, llm.MessageOptions{MaxTokens: 10}, "system")
+	c.Append(llm.InferMessage{Role: "user", Parts: []llm.Part{llm.TextPart("look"), llm.ImageURLPart("https://example.com/cat.png")}})
+
+	b, err := json.Marshal(c)
+	require.NoError(t, err)
+	var got llm.Conversation
+	require.NoError(t, json.Unmarshal(b, &got))
+	assert.Equal(t, c.ID(), got.ID())
+	assert.Equal(t, c.Messages(), got.Messages())
+	assert.Equal(t, c.Request(), got.Request())
+	assert.True(t, c.UpdatedAt().Equal(got.UpdatedAt()))
+}
+
+func TestMemoryConversationStore(t *testing.T) {
+	ctx := context.Background()
+	store := llm.NewMemoryConversationStore()
+	c := llm.NewConversation(conversationConfig, llm.MessageOptions{}, "system")
+	require.NoError(t, store.Save(ctx, c))
+	fork := c.Fork()
+	require.NoError(t, store.Save(ctx, fork))
+
+	got, err := store.Load(ctx, c.ID())
+	require.NoError(t, err)
+	assert.Equal(t, c.Messages(), got.Messages())
+
+	ids, err := store.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{fork.ID(), c.ID()}, ids)
+
+	require.NoError(t, store.Delete(ctx, c.ID()))
+	_, err = store.Load(ctx, c.ID())
+	assert.ErrorIs(t, err, llm.ErrConversationNotFound)
+}
@@ -0,0 +1,132 @@
+package llm
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Provider errors are classified into these kinds, so callers can handle them the same way for every provider,
+// e.g. errors.Is(err, llm.ErrRateLimited). Use errors.As with an *APIError for the status code and retry delay.
+var (
+	// ErrRateLimited is a 429, the request can be retried after a delay.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrContextLengthExceeded is a request which doesn't fit in the model's context window.
+	ErrContextLengthExceeded = errors.New("context length exceeded")
+	// ErrContentFiltered is a prompt or response blocked by the provider's content filters.
+	ErrContentFiltered = errors.New("content filtered")
+	// ErrAuthentication is a 401 or 403, e.g. a bad API key or a model the key has no access to.
+	ErrAuthentication = errors.New("authentication failed")
+	// ErrInvalidRequest is any other 4xx, or a 5xx which isn't transient like 501, the request would fail again
+	// if retried.
+	ErrInvalidRequest = errors.New("invalid request")
+	// ErrServerOverloaded is a 500, 502, 503, 504, 408 or Anthropic's 529, the request can be retried.
+	ErrServerOverloaded = errors.New("server overloaded")
+)
+
+// APIError is an error from a provider's API, classified as one of the errors above.
+// It matches both its Kind and the underlying error, so SDK error types are still available through errors.As.
+type APIError struct {
+	// Kind is one of ErrRateLimited, ErrContextLengthExceeded, ErrContentFiltered, ErrAuthentication,
+	// ErrInvalidRequest or ErrServerOverloaded.
+	Kind     error
+	Provider ProviderType
+	// StatusCode is the HTTP status code, or 0 if there was none, e.g. for errors in a stream.
+	StatusCode int
+	// RetryAfter is how long the provider asked us to wait before retrying, or 0 if it didn't say.
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *APIError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *APIError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// ClassifyError wraps an error returned by a provider's API in an *APIError, if its kind can be told from the
+// HTTP status code, the provider's error code (e.g. "context_length_exceeded") or the message. statusCode is 0
+// and code is "" when the error has none, retryAfter is how long the provider asked us to wait, if it said.
+// Other errors, and nil, are returned as they are.
+func ClassifyError(provider ProviderType, err error, statusCode int, code string, retryAfter time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return err
+	}
+	kind := errorKind(statusCode, code+" "+err.Error())
+	if kind == nil {
+		return err
+	}
+	return &APIError{Kind: kind, Provider: provider, StatusCode: statusCode, RetryAfter: retryAfter, Err: err}
+}
+
+// Providers don't agree on status codes for these, e.g. OpenAI returns a 400 for long prompts and Gemini a 400
+// for a blocked prompt, so they are told apart by the error code or message.
+var (
+	contextLengthMessages = []string{
+		"context_length_exceeded",
+		"maximum context length",
+		"prompt is too long",
+		"exceed context limit",
+		"exceeds the maximum number of tokens",
+		"exceeds the available context size",
+		"context window",
+		"input is too long",
+	}
+	contentFilterMessages = []string{
+		"content_filter",
+		"content_policy_violation",
+		"content management policy",
+		"responsibleaipolicyviolation",
+	}
+)
+
+// statusOverloaded is the non-standard status Anthropic uses when the API is overloaded.
+const statusOverloaded = 529
+
+// transientStatusCodes are the statuses of requests which may succeed if retried. Other 5xx, e.g. 501 Not
+// Implemented, are permanent.
+var transientStatusCodes = []int{
+	http.StatusRequestTimeout,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+	statusOverloaded,
+}
+
+func errorKind(code int, msg string) error {
+	msg = strings.ToLower(msg)
+	switch {
+	case code == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case slices.Contains(transientStatusCodes, code):
+		return ErrServerOverloaded
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return ErrAuthentication
+	case containsAny(msg, contextLengthMessages):
+		return ErrContextLengthExceeded
+	case containsAny(msg, contentFilterMessages):
+		return ErrContentFiltered
+	case code >= 400:
+		return ErrInvalidRequest
+	}
+	return nil
+}
+
+func containsAny(s string, substrs []string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package llm_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		want   error
+	}{
+		{http.StatusTooManyRequests, "slow down", llm.ErrRateLimited},
+		{http.StatusUnauthorized, "invalid api key", llm.ErrAuthentication},
+		{http.StatusForbidden, "no access to model", llm.ErrAuthentication},
+		{529, "overloaded", llm.ErrServerOverloaded},
+		{http.StatusBadGateway, "bad gateway", llm.ErrServerOverloaded},
+		{http.StatusBadRequest, "prompt is too long: 210000 tokens > 200000 maximum", llm.ErrContextLengthExceeded},
+		{http.StatusBadRequest, "The input token count (1200000) exceeds the maximum number of tokens allowed (1048576).", llm.ErrContextLengthExceeded},
+		{http.StatusBadRequest, `{"error": {"code": "content_filter"}}`, llm.ErrContentFiltered},
+		{http.StatusNotFound, "model not found", llm.ErrInvalidRequest},
+		// permanent server errors aren't worth retrying
+		{http.StatusNotImplemented, "not implemented", llm.ErrInvalidRequest},
+		{http.StatusHTTPVersionNotSupported, "http version not supported", llm.ErrInvalidRequest},
+	}
+	for _, tt := range tests {
+		err := llm.ClassifyError(llm.ProviderVoyage, errors.New(tt.body), tt.status, "", 0)
+		assert.ErrorIs(t, err, tt.want, tt.body)
+		var apiErr *llm.APIError
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, tt.status, apiErr.StatusCode)
+		assert.Equal(t, llm.ProviderVoyage, apiErr.Provider)
+	}
+
+	// the retry delay is kept
+	err := llm.ClassifyError(llm.ProviderVoyage, errors.New("slow down"), http.StatusTooManyRequests, "", 2*time.Second)
+	var apiErr *llm.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, 2*time.Second, apiErr.RetryAfter)
+
+	// the provider's error code is matched like the message
+	err = llm.ClassifyError(llm.ProviderOpenAI, errors.New("too many tokens"), http.StatusBadRequest, "context_length_exceeded", 0)
+	assert.ErrorIs(t, err, llm.ErrContextLengthExceeded)
+
+	// errors without a status are only classified by their message
+	assert.ErrorIs(t, llm.ClassifyError(llm.ProviderLlamaCpp, errors.New("the request exceeds the available context size"), 0, "", 0), llm.ErrContextLengthExceeded)
+	connErr := errors.New("connection refused")
+	assert.Equal(t, connErr, llm.ClassifyError(llm.ProviderLlamaCpp, connErr, 0, "", 0))
+	assert.NoError(t, llm.ClassifyError(llm.ProviderLlamaCpp, nil, 0, "", 0))
+}
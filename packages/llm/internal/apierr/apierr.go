@@ -0,0 +1,114 @@
+// Package apierr extracts HTTP status codes, error codes and retry delays from the errors returned by provider
+// SDKs, so that the llm package doesn't depend on them.
+package apierr
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/googleapis/gax-go/v2/apierror"
+	"github.com/liushuangls/go-anthropic/v2"
+	"github.com/sashabaranov/go-openai"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StatusOverloaded is the non-standard status Anthropic uses when the API is overloaded.
+const StatusOverloaded = 529
+
+// StatusCode returns the HTTP status code of an error returned by a provider, or 0 if it doesn't have one,
+// e.g. because the request never reached the server.
+func StatusCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode
+	}
+
+	var oaiAPIErr *openai.APIError
+	if errors.As(err, &oaiAPIErr) {
+		return oaiAPIErr.HTTPStatusCode
+	}
+	var oaiReqErr *openai.RequestError
+	if errors.As(err, &oaiReqErr) {
+		return oaiReqErr.HTTPStatusCode
+	}
+
+	// anthropic API errors only have a type, which maps 1:1 to status codes
+	var antAPIErr *anthropic.APIError
+	if errors.As(err, &antAPIErr) {
+		return anthropicStatusCodes[antAPIErr.Type]
+	}
+	var antReqErr *anthropic.RequestError
+	if errors.As(err, &antReqErr) {
+		return antReqErr.StatusCode
+	}
+
+	var gapiErr *googleapi.Error
+	if errors.As(err, &gapiErr) {
+		return gapiErr.Code
+	}
+	var gaxErr *apierror.APIError
+	if errors.As(err, &gaxErr) {
+		if code := gaxErr.HTTPCode(); code > 0 {
+			return code
+		}
+		return grpcStatusCodes[gaxErr.GRPCStatus().Code()]
+	}
+	if s, ok := status.FromError(err); ok {
+		return grpcStatusCodes[s.Code()]
+	}
+	return 0
+}
+
+var anthropicStatusCodes = map[anthropic.ErrType]int{
+	anthropic.ErrTypeInvalidRequest: http.StatusBadRequest,
+	anthropic.ErrTypeAuthentication: http.StatusUnauthorized,
+	anthropic.ErrTypePermission:     http.StatusForbidden,
+	anthropic.ErrTypeNotFound:       http.StatusNotFound,
+	anthropic.ErrTypeTooLarge:       http.StatusRequestEntityTooLarge,
+	anthropic.ErrTypeRateLimit:      http.StatusTooManyRequests,
+	anthropic.ErrTypeApi:            http.StatusInternalServerError,
+	anthropic.ErrTypeOverloaded:     StatusOverloaded,
+}
+
+// grpcStatusCodes follows the mapping in google.golang.org/genproto/googleapis/rpc/code.
+var grpcStatusCodes = map[codes.Code]int{
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.FailedPrecondition: http.StatusBadRequest,
+	codes.OutOfRange:         http.StatusBadRequest,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.Aborted:            http.StatusConflict,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.Canceled:           499,
+	codes.Internal:           http.StatusInternalServerError,
+	codes.Unknown:            http.StatusInternalServerError,
+	codes.DataLoss:           http.StatusInternalServerError,
+	codes.Unimplemented:      http.StatusNotImplemented,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+}
+
+// Code returns the provider's machine-readable error code or type, e.g. "context_length_exceeded", or "" if
+// the error doesn't have one.
+func Code(err error) string {
+	var oaiAPIErr *openai.APIError
+	if errors.As(err, &oaiAPIErr) {
+		if code, ok := oaiAPIErr.Code.(string); ok && code != "" {
+			return code
+		}
+		return oaiAPIErr.Type
+	}
+	var antAPIErr *anthropic.APIError
+	if errors.As(err, &antAPIErr) {
+		return string(antAPIErr.Type)
+	}
+	return ""
+}
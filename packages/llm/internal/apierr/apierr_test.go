@@ -0,0 +1,50 @@
+package apierr_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/internal/apierr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header http.Header
+		want   time.Duration
+		ok     bool
+	}{
+		{http.Header{"Retry-After": []string{"2"}}, 2 * time.Second, true},
+		{http.Header{"Retry-After": []string{now.Add(30 * time.Second).Format(http.TimeFormat)}}, 30 * time.Second, true},
+		{http.Header{"Retry-After": []string{"2"}, "Retry-After-Ms": []string{"1500"}}, 1500 * time.Millisecond, true},
+		{http.Header{"Retry-After": []string{"soon"}}, 0, false},
+		{http.Header{}, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := apierr.ParseRetryAfter(tt.header, now)
+		assert.Equal(t, tt.ok, ok)
+		assert.Equal(t, tt.want, got)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	header := http.Header{"Retry-After": []string{"2"}}
+	err := apierr.Classify(llm.ProviderVoyage, &apierr.HTTPError{StatusCode: http.StatusTooManyRequests, Header: header})
+	assert.ErrorIs(t, err, llm.ErrRateLimited)
+	var apiErr *llm.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+	assert.Equal(t, 2*time.Second, apiErr.RetryAfter)
+
+	err = apierr.Classify(llm.ProviderAnthropic, &apierr.HTTPError{StatusCode: apierr.StatusOverloaded})
+	assert.ErrorIs(t, err, llm.ErrServerOverloaded)
+
+	connErr := errors.New("connection refused")
+	assert.Equal(t, connErr, apierr.Classify(llm.ProviderVoyage, connErr))
+	assert.NoError(t, apierr.Classify(llm.ProviderVoyage, nil))
+}
@@ -0,0 +1,15 @@
+package apierr
+
+import (
+	"github.com/stillmatic/gollum/packages/llm"
+)
+
+// Classify extracts the status code, error code and retry delay from an error returned by a provider's SDK or
+// API, and classifies it with llm.ClassifyError.
+func Classify(provider llm.ProviderType, err error) error {
+	if err == nil {
+		return nil
+	}
+	after, _ := RetryAfter(err)
+	return llm.ClassifyError(provider, err, StatusCode(err), Code(err), after)
+}
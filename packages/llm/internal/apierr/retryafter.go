@@ -0,0 +1,113 @@
+package apierr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+// HTTPError is returned by providers which call their API directly rather than through an SDK.
+type HTTPError struct {
+	StatusCode int
+	Body       string
+	Header     http.Header
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("API request failed with status code %d: %s", e.StatusCode, e.Body)
+}
+
+type retryAfterError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryAfterError) Error() string { return e.err.Error() }
+func (e *retryAfterError) Unwrap() error { return e.err }
+
+// WithRetryAfter attaches the delay from the response's Retry-After header, if there is one, to err.
+func WithRetryAfter(err error, header http.Header) error {
+	if err == nil {
+		return nil
+	}
+	after, ok := ParseRetryAfter(header, time.Now())
+	if !ok {
+		return err
+	}
+	return &retryAfterError{err: err, after: after}
+}
+
+// RetryAfter returns how long the provider asked us to wait before retrying, if it did.
+func RetryAfter(err error) (time.Duration, bool) {
+	var raErr *retryAfterError
+	if errors.As(err, &raErr) {
+		return raErr.after, true
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return ParseRetryAfter(httpErr.Header, time.Now())
+	}
+	var gapiErr *googleapi.Error
+	if errors.As(err, &gapiErr) {
+		return ParseRetryAfter(gapiErr.Header, time.Now())
+	}
+	return 0, false
+}
+
+// ParseRetryAfter reads the delay from a Retry-After header, which is either seconds or an HTTP date.
+// OpenAI's retry-after-ms is preferred when present since it is more precise.
+func ParseRetryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	if header == nil {
+		return 0, false
+	}
+	if ms, err := strconv.ParseFloat(header.Get("Retry-After-Ms"), 64); err == nil && ms >= 0 {
+		return time.Duration(ms * float64(time.Millisecond)), true
+	}
+	v := header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil && secs >= 0 {
+		return time.Duration(secs * float64(time.Second)), true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+type headerKey struct{}
+
+// RecordHeaders returns a context which makes HeaderTransport copy the response headers into the returned header,
+// for SDKs which don't expose them on errors.
+func RecordHeaders(ctx context.Context) (context.Context, http.Header) {
+	header := make(http.Header)
+	return context.WithValue(ctx, headerKey{}, header), header
+}
+
+// HeaderTransport records response headers for requests made with a context from RecordHeaders.
+type HeaderTransport struct {
+	Base http.RoundTripper
+}
+
+func (t HeaderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if header, ok := req.Context().Value(headerKey{}).(http.Header); ok {
+		for k, v := range resp.Header {
+			header[k] = v
+		}
+	}
+	return resp, nil
+}
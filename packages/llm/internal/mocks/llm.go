@@ -1,6 +1,10 @@
 // Code generated by MockGen. DO NOT EDIT.
 // Source: llm.go
-
+//
+// Generated by this command:
+//
+//	mockgen -source llm.go -destination internal/mocks/llm.go
+//
 // Package mock_llm is a generated GoMock package.
 package mock_llm
 
@@ -45,7 +49,7 @@ func (m *MockResponder) GenerateResponse(ctx context.Context, req llm.InferReque
 }
 
 // GenerateResponse indicates an expected call of GenerateResponse.
-func (mr *MockResponderMockRecorder) GenerateResponse(ctx, req interface{}) *gomock.Call {
+func (mr *MockResponderMockRecorder) GenerateResponse(ctx, req any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GenerateResponse", reflect.TypeOf((*MockResponder)(nil).GenerateResponse), ctx, req)
 }
@@ -60,11 +64,26 @@ func (m *MockResponder) GenerateResponseAsync(ctx context.Context, req llm.Infer
 }
 
 // GenerateResponseAsync indicates an expected call of GenerateResponseAsync.
-func (mr *MockResponderMockRecorder) GenerateResponseAsync(ctx, req interface{}) *gomock.Call {
+func (mr *MockResponderMockRecorder) GenerateResponseAsync(ctx, req any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GenerateResponseAsync", reflect.TypeOf((*MockResponder)(nil).GenerateResponseAsync), ctx, req)
 }
 
+// Infer mocks base method.
+func (m *MockResponder) Infer(ctx context.Context, req llm.InferRequest) (*llm.InferResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Infer", ctx, req)
+	ret0, _ := ret[0].(*llm.InferResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Infer indicates an expected call of Infer.
+func (mr *MockResponderMockRecorder) Infer(ctx, req any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Infer", reflect.TypeOf((*MockResponder)(nil).Infer), ctx, req)
+}
+
 // MockEmbedder is a mock of Embedder interface.
 type MockEmbedder struct {
 	ctrl     *gomock.Controller
@@ -98,7 +117,7 @@ func (m *MockEmbedder) GenerateEmbedding(ctx context.Context, req llm.EmbedReque
 }
 
 // GenerateEmbedding indicates an expected call of GenerateEmbedding.
-func (mr *MockEmbedderMockRecorder) GenerateEmbedding(ctx, req interface{}) *gomock.Call {
+func (mr *MockEmbedderMockRecorder) GenerateEmbedding(ctx, req any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GenerateEmbedding", reflect.TypeOf((*MockEmbedder)(nil).GenerateEmbedding), ctx, req)
 }
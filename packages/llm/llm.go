@@ -14,14 +14,33 @@ const (
 	ModelTypeEmbedding ModelType = "embedding"
 )
 
+// ModelConfig describes a model and how to reach it. The tags are used when loading configs from files,
+// see ModelConfigStore.Load.
 type ModelConfig struct {
-	ProviderType ProviderType
-	ModelName    string
-	BaseURL      string
-
-	ModelType                        ModelType
-	CentiCentsPerMillionInputTokens  int
-	CentiCentsPerMillionOutputTokens int
+	ProviderType ProviderType `json:"provider_type" yaml:"provider_type"`
+	ModelName    string       `json:"model_name" yaml:"model_name"`
+	BaseURL      string       `json:"base_url,omitempty" yaml:"base_url,omitempty"`
+	// Deployment is the Azure OpenAI deployment serving the model. Azure routes requests by deployment rather
+	// than model, so this defaults to ModelName.
+	Deployment string `json:"deployment,omitempty" yaml:"deployment,omitempty"`
+
+	ModelType                        ModelType `json:"model_type" yaml:"model_type"`
+	CentiCentsPerMillionInputTokens  int       `json:"centi_cents_per_million_input_tokens,omitempty" yaml:"centi_cents_per_million_input_tokens,omitempty"`
+	CentiCentsPerMillionOutputTokens int       `json:"centi_cents_per_million_output_tokens,omitempty" yaml:"centi_cents_per_million_output_tokens,omitempty"`
+	// Pricing covers prompt caching, batch discounts, long context tiers and media, see Cost.
+	Pricing *Pricing `json:"pricing,omitempty" yaml:"pricing,omitempty"`
+
+	// ContextWindow is the most tokens the model accepts, input and output combined. 0 means unknown.
+	ContextWindow int `json:"context_window,omitempty" yaml:"context_window,omitempty"`
+	// MaxOutputTokens is the most tokens the model generates in one response. 0 means unknown.
+	MaxOutputTokens int `json:"max_output_tokens,omitempty" yaml:"max_output_tokens,omitempty"`
+
+	// Encoding overrides the BPE encoding used to count tokens, e.g. EncodingO200k for an OpenAI-compatible
+	// provider serving an OpenAI model. By default it is picked from the provider and model name.
+	Encoding string `json:"encoding,omitempty" yaml:"encoding,omitempty"`
+
+	// Capabilities are what the model supports, checked by ValidateRequest. Nil means unknown, so nothing is checked.
+	Capabilities *Capabilities `json:"capabilities,omitempty" yaml:"capabilities,omitempty"`
 }
 
 // MessageOptions are options that can be passed to the model for generating a response.
@@ -29,6 +48,28 @@ type ModelConfig struct {
 type MessageOptions struct {
 	MaxTokens   int
 	Temperature float32
+
+	// The options below are unset by default, leaving the provider's defaults. Providers return an
+	// UnsupportedOptionError when an option is set which the provider or model doesn't support.
+
+	// TopP samples from the smallest set of tokens whose probabilities add up to TopP.
+	TopP float32
+	// TopK samples from the K most likely tokens.
+	TopK int
+	// StopSequences stop generation when the model outputs any of them.
+	StopSequences []string
+	// Seed makes sampling deterministic, on a best effort basis.
+	Seed             *int
+	PresencePenalty  float32
+	FrequencyPenalty float32
+	// ReasoningEffort is how hard OpenAI reasoning models, e.g. o1 and o3-mini, think before responding.
+	ReasoningEffort ReasoningEffort
+	// ThinkingBudget enables Anthropic extended thinking with up to this many tokens, which must be at least
+	// 1024 and less than MaxTokens.
+	ThinkingBudget int
+	// Candidates is the number of responses to generate, returned in InferResponse.Candidates.
+	// Streaming only supports one candidate.
+	Candidates int
 }
 
 type InferMessage struct {
@@ -36,6 +77,14 @@ type InferMessage struct {
 	Role    string
 	Image   []byte
 	Audio   []byte
+	// Parts is the content of the message as an ordered list of text, images, documents and audio.
+	// If set, it is used instead of Content, Image and Audio.
+	Parts []Part
+
+	// ToolCalls are the tools requested by the model, set on "assistant" messages.
+	ToolCalls []ToolCall
+	// ToolCallID links a "tool" message, which carries the tool output in Content, to the call it answers.
+	ToolCallID string
 
 	ShouldCache bool
 }
@@ -47,15 +96,55 @@ type InferRequest struct {
 	ModelConfig ModelConfig
 	// MessageOptions are options that can be passed to the model for generating a response.
 	MessageOptions MessageOptions
+
+	// Tools the model may call. Calls are returned in InferResponse.ToolCalls.
+	Tools []Tool
+	// ToolChoice is optional, by default the model decides whether to call a tool.
+	ToolChoice *ToolChoice
+	// ResponseFormat is optional, if set the model responds with JSON matching its schema.
+	// See InferStructured to validate and decode the response.
+	ResponseFormat *ResponseFormat
+}
+
+type InferResponse struct {
+	Content   string
+	ToolCalls []ToolCall
+
+	FinishReason FinishReason
+	// Model is the model ID that served the request, as resolved by the provider.
+	Model string
+	Usage Usage
+	// Cost is the dollar cost of the request, computed from the ModelConfig pricing.
+	Cost float64
+
+	// Candidates are set when more than one candidate was generated. Content, ToolCalls and FinishReason
+	// above are those of the first candidate, Usage and Cost cover all of them.
+	Candidates []Candidate
 }
 
+// StreamDelta is a single message on the channel returned by GenerateResponseAsync.
+// Every stream ends with exactly one terminal delta, with either EOF or Err set, after which the channel is closed.
 type StreamDelta struct {
 	Text string
-	EOF  bool
+	// EOF marks the final delta of a successful stream.
+	EOF bool
+	// Err marks the final delta of a failed stream. Text received before it is incomplete.
+	Err error
+
+	// The fields below are only set on the EOF delta and describe the whole response.
+	ToolCalls    []ToolCall
+	FinishReason FinishReason
+	Model        string
+	Usage        Usage
+	Cost         float64
 }
 
 type Responder interface {
 	GenerateResponse(ctx context.Context, req InferRequest) (string, error)
+	// Infer is like GenerateResponse but returns the full response, including any tool calls.
+	Infer(ctx context.Context, req InferRequest) (*InferResponse, error)
+	// GenerateResponseAsync streams the response, see StreamDelta for the contract.
+	// If ctx is cancelled the channel is closed, possibly without a terminal delta.
 	GenerateResponseAsync(ctx context.Context, req InferRequest) (<-chan StreamDelta, error)
 }
 
@@ -0,0 +1,202 @@
+// Package llmtest implements a conformance suite for llm.Responder implementations.
+//
+// Providers test against a fake server: the suite describes each response as a Scenario,
+// the provider's test renders it in the provider's wire format and the suite checks
+// that the resulting stream follows the llm.StreamDelta contract.
+package llmtest
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Scenario describes a response for a fake provider server to send.
+type Scenario struct {
+	Name string
+	// Status, if set, makes the server reject the request with this HTTP status before streaming.
+	Status int
+	// Chunks of text to stream, in order. Empty chunks must not end the stream.
+	Chunks []string
+	// ToolCalls to send after the text.
+	ToolCalls []llm.ToolCall
+	// Usage to report. Only input and output tokens are checked.
+	Usage llm.Usage
+	// Fail makes the server break off the stream after sending Chunks, e.g. by truncating the body.
+	Fail bool
+	// Hang makes the server block after sending Chunks until the client goes away.
+	Hang bool
+}
+
+// FinishReason is the finish reason the suite expects for the scenario.
+func (s Scenario) FinishReason() llm.FinishReason {
+	if len(s.ToolCalls) > 0 {
+		return llm.FinishReasonToolCalls
+	}
+	return llm.FinishReasonStop
+}
+
+// Scenarios are the responses exercised by TestStreaming.
+var Scenarios = []Scenario{
+	{
+		Name:   "text",
+		Chunks: []string{"Hello", ", ", "world", "!"},
+		Usage:  llm.Usage{InputTokens: 10, OutputTokens: 4},
+	},
+	{
+		Name:   "empty chunks",
+		Chunks: []string{"Hello", "", " world"},
+		Usage:  llm.Usage{InputTokens: 10, OutputTokens: 2},
+	},
+	{
+		Name:   "tool calls",
+		Chunks: []string{"Let me check."},
+		ToolCalls: []llm.ToolCall{
+			{ID: "call_1", Name: "get_weather", Arguments: `{"location":"Paris"}`},
+		},
+		Usage: llm.Usage{InputTokens: 20, OutputTokens: 12},
+	},
+	{
+		Name:   "stream failure",
+		Chunks: []string{"Hello"},
+		Fail:   true,
+	},
+	{
+		Name:   "request failure",
+		Status: 500,
+	},
+}
+
+// Request is a minimal request for the suite. Providers may adjust the model config.
+var Request = llm.InferRequest{
+	Messages: []llm.InferMessage{
+		{Role: "system", Content: "You are a helpful assistant."},
+		{Role: "user", Content: "Say hello."},
+	},
+	ModelConfig: llm.ModelConfig{
+		ModelName: "test-model",
+		ModelType: llm.ModelTypeLLM,
+	},
+	MessageOptions: llm.MessageOptions{
+		MaxTokens: 128,
+	},
+}
+
+const streamTimeout = 5 * time.Second
+
+// TestStreaming checks GenerateResponseAsync against every Scenario, plus cancellation.
+// newResponder must return a Responder that talks to a server sending the given scenario.
+func TestStreaming(t *testing.T, newResponder func(t *testing.T, s Scenario) llm.Responder) {
+	for _, s := range Scenarios {
+		t.Run(s.Name, func(t *testing.T) {
+			r := newResponder(t, s)
+			ctx, cancel := context.WithTimeout(context.Background(), streamTimeout)
+			defer cancel()
+
+			deltas := collect(t, ctx, r, Request)
+			require.NotEmpty(t, deltas, "stream must end with a terminal delta")
+			last := deltas[len(deltas)-1]
+			for _, d := range deltas[:len(deltas)-1] {
+				assert.False(t, d.EOF, "EOF must only be set on the last delta")
+				assert.NoError(t, d.Err, "Err must only be set on the last delta")
+			}
+
+			if s.Fail || s.Status != 0 {
+				assert.Error(t, last.Err, "failed stream must end with an error")
+				assert.False(t, last.EOF, "failed stream must not report EOF")
+				return
+			}
+
+			assert.NoError(t, last.Err)
+			assert.True(t, last.EOF, "successful stream must end with EOF")
+			assert.Equal(t, strings.Join(s.Chunks, ""), text(deltas))
+			assert.Equal(t, s.FinishReason(), last.FinishReason)
+			assert.Equal(t, s.Usage.InputTokens, last.Usage.InputTokens)
+			assert.Equal(t, s.Usage.OutputTokens, last.Usage.OutputTokens)
+			assertToolCalls(t, s.ToolCalls, last.ToolCalls)
+		})
+	}
+
+	t.Run("cancellation", func(t *testing.T) {
+		s := Scenario{Name: "cancellation", Chunks: []string{"Hello"}, Hang: true}
+		r := newResponder(t, s)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ch, err := r.GenerateResponseAsync(ctx, Request)
+		require.NoError(t, err)
+		select {
+		case d := <-ch:
+			assert.Equal(t, "Hello", d.Text)
+		case <-time.After(streamTimeout):
+			t.Fatal("timed out waiting for first delta")
+		}
+		cancel()
+		// the channel must be closed promptly, whether or not a terminal delta is sent
+		deadline := time.After(streamTimeout)
+		for {
+			select {
+			case _, ok := <-ch:
+				if !ok {
+					return
+				}
+			case <-deadline:
+				t.Fatal("channel not closed after cancellation")
+			}
+		}
+	})
+}
+
+func collect(t *testing.T, ctx context.Context, r llm.Responder, req llm.InferRequest) []llm.StreamDelta {
+	t.Helper()
+	ch, err := r.GenerateResponseAsync(ctx, req)
+	if err != nil {
+		// failing before the stream starts is also allowed
+		return []llm.StreamDelta{{Err: err}}
+	}
+	var deltas []llm.StreamDelta
+	for {
+		select {
+		case d, ok := <-ch:
+			if !ok {
+				return deltas
+			}
+			deltas = append(deltas, d)
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for stream to close")
+		}
+	}
+}
+
+func text(deltas []llm.StreamDelta) string {
+	var sb strings.Builder
+	for _, d := range deltas {
+		sb.WriteString(d.Text)
+	}
+	return sb.String()
+}
+
+// assertToolCalls compares names and arguments. IDs are not compared since not every provider has them.
+func assertToolCalls(t *testing.T, expected, actual []llm.ToolCall) {
+	t.Helper()
+	require.Len(t, actual, len(expected))
+	for i := range expected {
+		assert.Equal(t, expected[i].Name, actual[i].Name)
+		assert.JSONEq(t, expected[i].Arguments, actual[i].Arguments)
+	}
+}
+
+// MustJSON marshals v, for fake servers building responses.
+func MustJSON(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
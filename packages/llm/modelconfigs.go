@@ -1,34 +1,279 @@
 package llm
 
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// ModelConfigStore holds model configs by name. It is safe for concurrent use.
 type ModelConfigStore struct {
+	mu sync.RWMutex
+	// base is the defaults plus configs added with AddConfig, loaded files are merged over it
+	base    map[string]ModelConfig
 	configs map[string]ModelConfig
 }
 
+// NewModelConfigStore returns a store with the built-in configs, e.g. ConfigGPT4o, with environment variables
+// applied, see ModelConfigEnvVar.
 func NewModelConfigStore() *ModelConfigStore {
-	return &ModelConfigStore{
-		configs: configs,
-	}
+	return NewModelConfigStoreWithConfigs(configs)
 }
 
+// NewModelConfigStoreWithConfigs returns a store with only the given configs, with environment variables
+// applied. The configs are copied. Invalid environment variables are skipped, Load reports them.
 func NewModelConfigStoreWithConfigs(configs map[string]ModelConfig) *ModelConfigStore {
-	return &ModelConfigStore{
-		configs: configs,
+	m := &ModelConfigStore{
+		base:    make(map[string]ModelConfig, len(configs)),
+		configs: make(map[string]ModelConfig, len(configs)),
+	}
+	for name, cfg := range configs {
+		cfg = cfg.clone()
+		m.base[name] = cfg
+		m.configs[name], _ = applyEnvOverrides(name, cfg)
+	}
+	return m
+}
+
+// clone copies the config's pricing and capabilities, so changing the copy leaves the original alone.
+func (c ModelConfig) clone() ModelConfig {
+	if c.Pricing != nil {
+		p := *c.Pricing
+		p.Tiers = slices.Clone(p.Tiers)
+		c.Pricing = &p
 	}
+	if c.Capabilities != nil {
+		caps := *c.Capabilities
+		c.Capabilities = &caps
+	}
+	return c
+}
+
+// LoadModelConfigStore returns a store with the built-in configs, with the source merged over them.
+// See Load for the format.
+func LoadModelConfigStore(ctx context.Context, src ConfigSource) (*ModelConfigStore, error) {
+	m := NewModelConfigStore()
+	if err := m.Load(ctx, src); err != nil {
+		return nil, err
+	}
+	return m, nil
 }
 
+// GetConfig returns a copy of the named config, which the caller may change.
 func (m *ModelConfigStore) GetConfig(configName string) (ModelConfig, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	config, ok := m.configs[configName]
-	return config, ok
+	return config.clone(), ok
 }
 
+// GetConfigNames returns the names of all configs, sorted.
 func (m *ModelConfigStore) GetConfigNames() []string {
-	var configNames []string
-	for k := range m.configs {
-		configNames = append(configNames, k)
-	}
-	return configNames
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return slices.Sorted(maps.Keys(m.configs))
 }
 
+// AddConfig adds or replaces a config. It is kept when the store is reloaded, unless the source has a config
+// with the same name. The config is copied.
 func (m *ModelConfigStore) AddConfig(configName string, config ModelConfig) {
-	m.configs[configName] = config
+	config = config.clone()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.base[configName] = config
+	m.configs[configName], _ = applyEnvOverrides(configName, config)
+}
+
+// Load reads configs from src and merges them over the store's defaults and added configs, replacing anything
+// loaded before. The source is YAML or JSON, mapping config names to ModelConfig fields:
+//
+//	gpt-4o:
+//	  base_url: https://proxy.internal/v1
+//	my-llama:
+//	  provider_type: together
+//	  model_name: meta-llama/Llama-3.3-70B-Instruct-Turbo
+//	  model_type: llm
+//
+// Fields of existing configs which the source doesn't set are kept. Environment variables override fields
+// after that, see ModelConfigEnvVar. The result is validated before it replaces the current configs, so on
+// error the store is unchanged.
+func (m *ModelConfigStore) Load(ctx context.Context, src ConfigSource) error {
+	data, err := src.Read(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not read model configs")
+	}
+	var entries map[string]yaml.Node
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return errors.Wrap(err, "could not parse model configs")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	merged := maps.Clone(m.base)
+	for name, node := range entries {
+		// yaml decodes into the existing pointers, which are shared with the base configs
+		cfg := merged[name].clone()
+		if err := node.Decode(&cfg); err != nil {
+			return errors.Wrapf(err, "invalid model config %s", name)
+		}
+		merged[name] = cfg
+	}
+	for name, cfg := range merged {
+		cfg, err := applyEnvOverrides(name, cfg)
+		if err != nil {
+			return err
+		}
+		if err := cfg.Validate(); err != nil {
+			return errors.Wrapf(err, "invalid model config %s", name)
+		}
+		merged[name] = cfg
+	}
+	m.configs = merged
+	return nil
+}
+
+// Watch reloads the store whenever the source's version changes, checking every interval, until ctx is done.
+// Failed reloads leave the store unchanged and are passed to onError, if set.
+func (m *ModelConfigStore) Watch(ctx context.Context, src ConfigSource, interval time.Duration, onError func(error)) error {
+	version, err := src.Version(ctx)
+	if err != nil && onError != nil {
+		onError(err)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		v, err := src.Version(ctx)
+		if err == nil && v == version {
+			continue
+		}
+		if err == nil {
+			err = m.Load(ctx, src)
+		}
+		if err != nil {
+			if onError != nil {
+				onError(err)
+			}
+			continue
+		}
+		version = v
+	}
+}
+
+// ErrInvalidModelConfig matches every error returned by ModelConfig.Validate.
+var ErrInvalidModelConfig = errors.New("invalid model config")
+
+// knownProviders are the provider types a config can use.
+var knownProviders = []ProviderType{
+	ProviderAnthropic, ProviderGoogle, ProviderVertex, ProviderBedrock,
+	ProviderOpenAI, ProviderAzureOpenAI, ProviderGroq, ProviderTogether, ProviderHyperbolic, ProviderDeepseek,
+	ProviderVoyage, ProviderMixedBread,
+	ProviderOllama, ProviderLlamaCpp,
+}
+
+// Validate checks that the config has a known provider, a model name and a model type.
+func (c ModelConfig) Validate() error {
+	if !slices.Contains(knownProviders, c.ProviderType) {
+		return errors.Wrapf(ErrInvalidModelConfig, "unknown provider type %q", c.ProviderType)
+	}
+	if c.ModelName == "" {
+		return errors.Wrap(ErrInvalidModelConfig, "model name is not set")
+	}
+	if c.ModelType != ModelTypeLLM && c.ModelType != ModelTypeEmbedding {
+		return errors.Wrapf(ErrInvalidModelConfig, "model type must be %s or %s, got %q", ModelTypeLLM, ModelTypeEmbedding, c.ModelType)
+	}
+	return nil
+}
+
+var envNameChars = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// ModelConfigEnvVar returns the environment variable which overrides a field of a config in a store, e.g. GOLLUM_MODEL_GPT_4O_BASE_URL for the base_url of gpt-4o. The overridable fields are provider_type,
+// model_name, base_url, deployment, context_window, max_output_tokens and encoding.
+func ModelConfigEnvVar(configName, field string) string {
+	return "GOLLUM_MODEL_" + strings.Trim(envNameChars.ReplaceAllString(strings.ToUpper(configName), "_"), "_") +
+		"_" + strings.ToUpper(field)
+}
+
+// applyEnvOverrides sets the fields of cfg which have an environment variable. Fields whose variable can't be
+// parsed are left as they are, and the first such error is returned.
+func applyEnvOverrides(name string, cfg ModelConfig) (ModelConfig, error) {
+	lookup := func(field string) (string, bool) {
+		return os.LookupEnv(ModelConfigEnvVar(name, field))
+	}
+	lookupInt := func(field string, dst *int) error {
+		v, ok := lookup(field)
+		if !ok {
+			return nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return errors.Wrapf(err, "invalid %s", ModelConfigEnvVar(name, field))
+		}
+		*dst = n
+		return nil
+	}
+
+	if v, ok := lookup("provider_type"); ok {
+		cfg.ProviderType = ProviderType(v)
+	}
+	if v, ok := lookup("model_name"); ok {
+		cfg.ModelName = v
+	}
+	if v, ok := lookup("base_url"); ok {
+		cfg.BaseURL = v
+	}
+	if v, ok := lookup("deployment"); ok {
+		cfg.Deployment = v
+	}
+	if v, ok := lookup("encoding"); ok {
+		cfg.Encoding = v
+	}
+	err := lookupInt("context_window", &cfg.ContextWindow)
+	if mErr := lookupInt("max_output_tokens", &cfg.MaxOutputTokens); err == nil {
+		err = mErr
+	}
+	return cfg, err
+}
+
+// ConfigSource is where a ModelConfigStore loads configs from. Sources other than files live in their own
+// packages, e.g. configsource/blob for buckets.
+type ConfigSource interface {
+	Read(ctx context.Context) ([]byte, error)
+	// Version changes whenever the contents change, e.g. a modification time.
+	Version(ctx context.Context) (string, error)
+}
+
+// FileConfigSource reads configs from a YAML or JSON file.
+func FileConfigSource(path string) ConfigSource {
+	return fileSource{path: path}
+}
+
+type fileSource struct {
+	path string
+}
+
+func (s fileSource) Read(_ context.Context) ([]byte, error) {
+	return os.ReadFile(s.path)
+}
+
+func (s fileSource) Version(_ context.Context) (string, error) {
+	fi, err := os.Stat(s.path)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d-%d", fi.ModTime().UnixNano(), fi.Size()), nil
 }
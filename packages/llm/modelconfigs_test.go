@@ -0,0 +1,217 @@
+package llm_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfigFile(t *testing.T, dir, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o644))
+	return path
+}
+
+func TestDefaultConfigsAreValid(t *testing.T) {
+	store := llm.NewModelConfigStore()
+	for _, name := range store.GetConfigNames() {
+		cfg, _ := store.GetConfig(name)
+		assert.NoError(t, cfg.Validate(), name)
+	}
+}
+
+func TestModelConfigStoreLoad(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	t.Run("yaml", func(t *testing.T) {
+		path := writeConfigFile(t, dir, "models.yaml", `
+gpt-4o:
+  base_url: https://proxy.internal/v1
+my-llama:
+  provider_type: together
+  model_name: meta-llama/Llama-3.3-70B-Instruct-Turbo
+  model_type: llm
+  context_window: 131072
+`)
+		store, err := llm.LoadModelConfigStore(ctx, llm.FileConfigSource(path))
+		require.NoError(t, err)
+
+		cfg, ok := store.GetConfig(llm.ConfigGPT4o)
+		require.True(t, ok)
+		assert.Equal(t, "https://proxy.internal/v1", cfg.BaseURL)
+		// fields the file doesn't set are kept
+		assert.Equal(t, "gpt-4o-2024-08-06", cfg.ModelName)
+		assert.Equal(t, 25_000, cfg.CentiCentsPerMillionInputTokens)
+
+		cfg, ok = store.GetConfig("my-llama")
+		require.True(t, ok)
+		assert.Equal(t, llm.ModelConfig{
+			ProviderType:  llm.ProviderTogether,
+			ModelName:     "meta-llama/Llama-3.3-70B-Instruct-Turbo",
+			ModelType:     llm.ModelTypeLLM,
+			ContextWindow: 131072,
+		}, cfg)
+	})
+
+	t.Run("partial override", func(t *testing.T) {
+		path := writeConfigFile(t, dir, "override.yaml", `
+gpt-4o:
+  capabilities:
+    vision: false
+  pricing:
+    batch_discount: 0.9
+`)
+		store, err := llm.LoadModelConfigStore(ctx, llm.FileConfigSource(path))
+		require.NoError(t, err)
+		cfg, _ := store.GetConfig(llm.ConfigGPT4o)
+		assert.False(t, cfg.Capabilities.Vision)
+		assert.True(t, cfg.Capabilities.Tools)
+		assert.Equal(t, 0.9, cfg.Pricing.BatchDiscount)
+
+		// other stores keep the built-in values
+		cfg, _ = llm.NewModelConfigStore().GetConfig(llm.ConfigGPT4o)
+		assert.True(t, cfg.Capabilities.Vision)
+		assert.Equal(t, 0.5, cfg.Pricing.BatchDiscount)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		path := writeConfigFile(t, dir, "models.json", `{"my-embedder": {"provider_type": "openai", "model_name": "text-embedding-3-small", "model_type": "embedding"}}`)
+		store, err := llm.LoadModelConfigStore(ctx, llm.FileConfigSource(path))
+		require.NoError(t, err)
+		cfg, ok := store.GetConfig("my-embedder")
+		require.True(t, ok)
+		assert.Equal(t, llm.ModelTypeEmbedding, cfg.ModelType)
+	})
+
+	t.Run("env overrides", func(t *testing.T) {
+		path := writeConfigFile(t, dir, "empty.yaml", "{}")
+		assert.Equal(t, "GOLLUM_MODEL_GPT_4O_BASE_URL", llm.ModelConfigEnvVar(llm.ConfigGPT4o, "base_url"))
+		defaults, _ := llm.NewModelConfigStore().GetConfig(llm.ConfigGPT4o)
+		t.Setenv("GOLLUM_MODEL_GPT_4O_BASE_URL", "http://localhost:8080/v1")
+		t.Setenv("GOLLUM_MODEL_GPT_4O_CONTEXT_WINDOW", "1000")
+
+		store, err := llm.LoadModelConfigStore(ctx, llm.FileConfigSource(path))
+		require.NoError(t, err)
+		cfg, _ := store.GetConfig(llm.ConfigGPT4o)
+		assert.Equal(t, "http://localhost:8080/v1", cfg.BaseURL)
+		assert.Equal(t, 1000, cfg.ContextWindow)
+
+		// stores built without a source apply them too
+		cfg, _ = llm.NewModelConfigStore().GetConfig(llm.ConfigGPT4o)
+		assert.Equal(t, "http://localhost:8080/v1", cfg.BaseURL)
+		assert.Equal(t, 1000, cfg.ContextWindow)
+
+		t.Setenv("GOLLUM_MODEL_GPT_4O_CONTEXT_WINDOW", "lots")
+		_, err = llm.LoadModelConfigStore(ctx, llm.FileConfigSource(path))
+		assert.ErrorContains(t, err, "GOLLUM_MODEL_GPT_4O_CONTEXT_WINDOW")
+		// without a source to report it, the invalid value is skipped
+		cfg, _ = llm.NewModelConfigStore().GetConfig(llm.ConfigGPT4o)
+		assert.Equal(t, "http://localhost:8080/v1", cfg.BaseURL)
+		assert.Equal(t, defaults.ContextWindow, cfg.ContextWindow)
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		tests := map[string]string{
+			"unknown provider": "bad:\n  provider_type: nope\n  model_name: x\n  model_type: llm\n",
+			"no model name":    "bad:\n  provider_type: openai\n  model_type: llm\n",
+			"no model type":    "bad:\n  provider_type: openai\n  model_name: x\n",
+		}
+		for name, contents := range tests {
+			t.Run(name, func(t *testing.T) {
+				path := writeConfigFile(t, dir, "bad.yaml", contents)
+				store := llm.NewModelConfigStore()
+				err := store.Load(ctx, llm.FileConfigSource(path))
+				assert.ErrorIs(t, err, llm.ErrInvalidModelConfig)
+				_, ok := store.GetConfig("bad")
+				assert.False(t, ok)
+			})
+		}
+	})
+}
+
+func TestModelConfigStoreAddConfig(t *testing.T) {
+	store := llm.NewModelConfigStore()
+	store.AddConfig("custom", llm.ModelConfig{ProviderType: llm.ProviderGroq, ModelName: "custom", ModelType: llm.ModelTypeLLM})
+
+	// stores don't share configs
+	_, ok := llm.NewModelConfigStore().GetConfig("custom")
+	assert.False(t, ok)
+
+	// configs are copied in and out, so changing them doesn't change the store
+	pricing := &llm.Pricing{BatchDiscount: 0.5}
+	store.AddConfig("priced", llm.ModelConfig{ProviderType: llm.ProviderGroq, ModelName: "priced", ModelType: llm.ModelTypeLLM, Pricing: pricing})
+	pricing.BatchDiscount = 0.2
+	cfg, _ := store.GetConfig("priced")
+	assert.Equal(t, 0.5, cfg.Pricing.BatchDiscount)
+	cfg.Pricing.BatchDiscount = 0.3
+	cfg, _ = store.GetConfig("gpt-4o")
+	cfg.Capabilities.Vision = false
+	cfg, _ = store.GetConfig("priced")
+	assert.Equal(t, 0.5, cfg.Pricing.BatchDiscount)
+	cfg, _ = store.GetConfig("gpt-4o")
+	assert.True(t, cfg.Capabilities.Vision)
+
+	// added configs survive a reload
+	path := writeConfigFile(t, t.TempDir(), "models.yaml", "{}")
+	require.NoError(t, store.Load(context.Background(), llm.FileConfigSource(path)))
+	_, ok = store.GetConfig("custom")
+	assert.True(t, ok)
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			store.AddConfig("custom", llm.ModelConfig{ProviderType: llm.ProviderGroq, ModelName: "custom", ModelType: llm.ModelTypeLLM, ContextWindow: i})
+		}()
+		go func() {
+			defer wg.Done()
+			store.GetConfig("custom")
+			store.GetConfigNames()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestModelConfigStoreWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfigFile(t, dir, "models.yaml", "gpt-4o:\n  base_url: https://one.internal/v1\n")
+	src := llm.FileConfigSource(path)
+	store, err := llm.LoadModelConfigStore(context.Background(), src)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := make(chan error, 10)
+	go store.Watch(ctx, src, 5*time.Millisecond, func(err error) { errs <- err })
+
+	baseURL := func() string {
+		cfg, _ := store.GetConfig(llm.ConfigGPT4o)
+		return cfg.BaseURL
+	}
+
+	// make sure the modification time changes
+	time.Sleep(10 * time.Millisecond)
+	writeConfigFile(t, dir, "models.yaml", "gpt-4o:\n  base_url: https://two.internal/v1\n")
+	assert.Eventually(t, func() bool { return baseURL() == "https://two.internal/v1" }, time.Second, 5*time.Millisecond)
+
+	// invalid files are reported and ignored
+	time.Sleep(10 * time.Millisecond)
+	writeConfigFile(t, dir, "models.yaml", "gpt-4o:\n  provider_type: nope\n")
+	select {
+	case err := <-errs:
+		assert.ErrorIs(t, err, llm.ErrInvalidModelConfig)
+	case <-time.After(time.Second):
+		t.Fatal("expected an error")
+	}
+	assert.Equal(t, "https://two.internal/v1", baseURL())
+}
@@ -0,0 +1,94 @@
+package llm
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/pkg/errors"
+)
+
+type ReasoningEffort string
+
+const (
+	ReasoningEffortLow    ReasoningEffort = "low"
+	ReasoningEffortMedium ReasoningEffort = "medium"
+	ReasoningEffortHigh   ReasoningEffort = "high"
+)
+
+// Option names one of the optional MessageOptions.
+type Option string
+
+const (
+	OptionTopP             Option = "top_p"
+	OptionTopK             Option = "top_k"
+	OptionStopSequences    Option = "stop_sequences"
+	OptionSeed             Option = "seed"
+	OptionPresencePenalty  Option = "presence_penalty"
+	OptionFrequencyPenalty Option = "frequency_penalty"
+	OptionReasoningEffort  Option = "reasoning_effort"
+	OptionThinkingBudget   Option = "thinking_budget"
+	OptionCandidates       Option = "candidates"
+	// OptionTemperature isn't reported by Set, since 0 means the default, see Capabilities.Temperature.
+	OptionTemperature Option = "temperature"
+)
+
+// ErrUnsupportedOption matches every *UnsupportedOptionError.
+var ErrUnsupportedOption = errors.New("unsupported option")
+
+// UnsupportedOptionError is returned when a request sets an option which the provider or model doesn't support.
+type UnsupportedOptionError struct {
+	Option Option
+	Model  string
+}
+
+func (e *UnsupportedOptionError) Error() string {
+	return fmt.Sprintf("option %s is not supported by model %s", e.Option, e.Model)
+}
+
+func (e *UnsupportedOptionError) Is(target error) bool {
+	return target == ErrUnsupportedOption
+}
+
+// Set returns the optional options which are set. MaxTokens and Temperature are supported everywhere, so they
+// are not included.
+func (o MessageOptions) Set() []Option {
+	var set []Option
+	if o.TopP != 0 {
+		set = append(set, OptionTopP)
+	}
+	if o.TopK != 0 {
+		set = append(set, OptionTopK)
+	}
+	if len(o.StopSequences) > 0 {
+		set = append(set, OptionStopSequences)
+	}
+	if o.Seed != nil {
+		set = append(set, OptionSeed)
+	}
+	if o.PresencePenalty != 0 {
+		set = append(set, OptionPresencePenalty)
+	}
+	if o.FrequencyPenalty != 0 {
+		set = append(set, OptionFrequencyPenalty)
+	}
+	if o.ReasoningEffort != "" {
+		set = append(set, OptionReasoningEffort)
+	}
+	if o.ThinkingBudget != 0 {
+		set = append(set, OptionThinkingBudget)
+	}
+	if o.Candidates > 1 {
+		set = append(set, OptionCandidates)
+	}
+	return set
+}
+
+// Check returns an UnsupportedOptionError for the first option which is set but not supported by the model.
+func (o MessageOptions) Check(model string, supported ...Option) error {
+	for _, opt := range o.Set() {
+		if !slices.Contains(supported, opt) {
+			return &UnsupportedOptionError{Option: opt, Model: model}
+		}
+	}
+	return nil
+}
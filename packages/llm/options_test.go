@@ -0,0 +1,26 @@
+package llm_test
+
+import (
+	"testing"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageOptionsCheck(t *testing.T) {
+	seed := 42
+	opts := llm.MessageOptions{MaxTokens: 100, Temperature: 0.5, TopP: 0.9, Seed: &seed}
+	assert.Equal(t, []llm.Option{llm.OptionTopP, llm.OptionSeed}, opts.Set())
+
+	assert.NoError(t, opts.Check("gpt-4o", llm.OptionTopP, llm.OptionSeed, llm.OptionStopSequences))
+
+	err := opts.Check("claude-3-5-sonnet-latest", llm.OptionTopP, llm.OptionTopK)
+	assert.ErrorIs(t, err, llm.ErrUnsupportedOption)
+	var optErr *llm.UnsupportedOptionError
+	assert.ErrorAs(t, err, &optErr)
+	assert.Equal(t, llm.OptionSeed, optErr.Option)
+	assert.Equal(t, "option seed is not supported by model claude-3-5-sonnet-latest", err.Error())
+
+	// MaxTokens and Temperature are always supported
+	assert.NoError(t, llm.MessageOptions{MaxTokens: 100, Temperature: 1}.Check("any"))
+}
@@ -0,0 +1,107 @@
+package llm
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// PartType is the kind of content in a Part.
+type PartType string
+
+const (
+	PartTypeText     PartType = "text"
+	PartTypeImage    PartType = "image"
+	PartTypeImageURL PartType = "image_url"
+	PartTypeDocument PartType = "document"
+	PartTypeAudio    PartType = "audio"
+)
+
+// Part is one piece of a message's content. Use the constructors, e.g. TextPart or ImagePart, to build them.
+type Part struct {
+	Type PartType
+	// Text is set on text parts.
+	Text string
+	// Data is set on image, document and audio parts.
+	Data []byte
+	// MIMEType of Data, e.g. "image/jpeg", or of the file at URL. The constructors detect it from Data.
+	MIMEType string
+	// URL is set on image URL parts.
+	URL string
+}
+
+func TextPart(text string) Part {
+	return Part{Type: PartTypeText, Text: text}
+}
+
+// ImagePart builds an image part, detecting the image type from the data.
+func ImagePart(data []byte) Part {
+	return Part{Type: PartTypeImage, Data: data, MIMEType: DetectMIMEType(data)}
+}
+
+// ImageURLPart builds a part for an image which the provider fetches itself.
+func ImageURLPart(url string) Part {
+	return Part{Type: PartTypeImageURL, URL: url}
+}
+
+// DocumentPart builds a document part, e.g. a PDF, detecting the type from the data.
+func DocumentPart(data []byte) Part {
+	return Part{Type: PartTypeDocument, Data: data, MIMEType: DetectMIMEType(data)}
+}
+
+// AudioPart builds an audio part, detecting the audio format from the data.
+func AudioPart(data []byte) Part {
+	return Part{Type: PartTypeAudio, Data: data, MIMEType: DetectMIMEType(data)}
+}
+
+// DetectMIMEType sniffs the MIME type of data, e.g. "image/png" or "application/pdf".
+func DetectMIMEType(data []byte) string {
+	mimeType, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	// providers use the more common name for WAV
+	if mimeType == "audio/wave" {
+		return "audio/wav"
+	}
+	return mimeType
+}
+
+// ContentParts returns the content of the message in order. Messages without Parts are converted from
+// Content, Image and Audio, in that order.
+func (m InferMessage) ContentParts() []Part {
+	if len(m.Parts) > 0 {
+		return m.Parts
+	}
+	var parts []Part
+	if m.Content != "" {
+		parts = append(parts, TextPart(m.Content))
+	}
+	if len(m.Image) > 0 {
+		parts = append(parts, ImagePart(m.Image))
+	}
+	if len(m.Audio) > 0 {
+		parts = append(parts, AudioPart(m.Audio))
+	}
+	return parts
+}
+
+// ErrUnsupportedPart matches every *UnsupportedPartError.
+var ErrUnsupportedPart = errors.New("unsupported part")
+
+// UnsupportedPartError is returned when a message has a part which the provider or model can't handle.
+type UnsupportedPartError struct {
+	Type     PartType
+	MIMEType string
+	Model    string
+}
+
+func (e *UnsupportedPartError) Error() string {
+	if e.MIMEType != "" {
+		return fmt.Sprintf("%s parts of type %s are not supported by model %s", e.Type, e.MIMEType, e.Model)
+	}
+	return fmt.Sprintf("%s parts are not supported by model %s", e.Type, e.Model)
+}
+
+func (e *UnsupportedPartError) Is(target error) bool {
+	return target == ErrUnsupportedPart
+}
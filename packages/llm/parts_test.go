@@ -0,0 +1,50 @@
+package llm_test
+
+import (
+	"testing"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	pngData  = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	jpegData = []byte("\xff\xd8\xff\xe0\x00\x10JFIF")
+	pdfData  = []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3")
+	wavData  = []byte("RIFF\x24\x00\x00\x00WAVEfmt ")
+)
+
+func TestDetectMIMEType(t *testing.T) {
+	assert.Equal(t, "image/png", llm.DetectMIMEType(pngData))
+	assert.Equal(t, "image/jpeg", llm.DetectMIMEType(jpegData))
+	assert.Equal(t, "application/pdf", llm.DetectMIMEType(pdfData))
+	assert.Equal(t, "audio/wav", llm.DetectMIMEType(wavData))
+	assert.Equal(t, "text/plain", llm.DetectMIMEType([]byte("hello")))
+}
+
+func TestContentParts(t *testing.T) {
+	t.Run("converts legacy fields", func(t *testing.T) {
+		m := llm.InferMessage{Role: "user", Content: "what's this?", Image: jpegData, Audio: wavData}
+		assert.Equal(t, []llm.Part{
+			{Type: llm.PartTypeText, Text: "what's this?"},
+			{Type: llm.PartTypeImage, Data: jpegData, MIMEType: "image/jpeg"},
+			{Type: llm.PartTypeAudio, Data: wavData, MIMEType: "audio/wav"},
+		}, m.ContentParts())
+	})
+
+	t.Run("parts replace legacy fields", func(t *testing.T) {
+		parts := []llm.Part{llm.ImagePart(pngData), llm.TextPart("compare to"), llm.ImageURLPart("https://example.com/cat.jpg")}
+		m := llm.InferMessage{Role: "user", Content: "ignored", Parts: parts}
+		assert.Equal(t, parts, m.ContentParts())
+	})
+
+	t.Run("empty message", func(t *testing.T) {
+		assert.Empty(t, llm.InferMessage{Role: "assistant"}.ContentParts())
+	})
+}
+
+func TestUnsupportedPartError(t *testing.T) {
+	err := error(&llm.UnsupportedPartError{Type: llm.PartTypeAudio, MIMEType: "audio/wav", Model: "gpt-4o"})
+	assert.ErrorIs(t, err, llm.ErrUnsupportedPart)
+	assert.Equal(t, "audio parts of type audio/wav are not supported by model gpt-4o", err.Error())
+}
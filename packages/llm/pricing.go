@@ -0,0 +1,74 @@
+package llm
+
+// Pricing is the detailed price list of a model, on top of the input and output rates on ModelConfig.
+// Prices are in centi-cents, i.e. 1/10,000 of a dollar, like the ModelConfig rates. Zero rates fall back to the
+// input rate, so a config without Pricing charges every input token at the input rate.
+type Pricing struct {
+	// CacheReadPerMillionTokens is charged for input tokens read from the prompt cache.
+	CacheReadPerMillionTokens float64 `json:"cache_read_per_million_tokens,omitempty" yaml:"cache_read_per_million_tokens,omitempty"`
+	// CacheWritePerMillionTokens is charged for input tokens written to the prompt cache, e.g. 1.25x the input
+	// rate on Anthropic.
+	CacheWritePerMillionTokens float64 `json:"cache_write_per_million_tokens,omitempty" yaml:"cache_write_per_million_tokens,omitempty"`
+	// BatchDiscount is the fraction taken off requests made through a batch API, e.g. 0.5 for half price.
+	BatchDiscount float64 `json:"batch_discount,omitempty" yaml:"batch_discount,omitempty"`
+	// Tiers replace the token rates for requests with long prompts, e.g. Gemini 1.5 above 128k tokens.
+	// The tier with the highest threshold below the request's input tokens applies to the whole request.
+	Tiers []PricingTier `json:"tiers,omitempty" yaml:"tiers,omitempty"`
+}
+
+// PricingTier are the token rates for requests with more than AboveInputTokens input tokens.
+type PricingTier struct {
+	AboveInputTokens           int     `json:"above_input_tokens" yaml:"above_input_tokens"`
+	InputPerMillionTokens      float64 `json:"input_per_million_tokens" yaml:"input_per_million_tokens"`
+	OutputPerMillionTokens     float64 `json:"output_per_million_tokens" yaml:"output_per_million_tokens"`
+	CacheReadPerMillionTokens  float64 `json:"cache_read_per_million_tokens,omitempty" yaml:"cache_read_per_million_tokens,omitempty"`
+	CacheWritePerMillionTokens float64 `json:"cache_write_per_million_tokens,omitempty" yaml:"cache_write_per_million_tokens,omitempty"`
+}
+
+// centiCentsPerDollar is the conversion between ModelConfig prices and dollars.
+const centiCentsPerDollar = 10_000
+
+// Cost returns the dollar cost of the given usage at the ModelConfig's prices, including prompt caching and
+// long context tiers. Images and audio are billed as input tokens by every supported provider, so they are
+// included in InputTokens. Configs without pricing cost nothing.
+func Cost(cfg ModelConfig, usage Usage) float64 {
+	rates := PricingTier{
+		InputPerMillionTokens:  float64(cfg.CentiCentsPerMillionInputTokens),
+		OutputPerMillionTokens: float64(cfg.CentiCentsPerMillionOutputTokens),
+	}
+	var p Pricing
+	if cfg.Pricing != nil {
+		p = *cfg.Pricing
+		rates.CacheReadPerMillionTokens = p.CacheReadPerMillionTokens
+		rates.CacheWritePerMillionTokens = p.CacheWritePerMillionTokens
+	}
+	for _, tier := range p.Tiers {
+		if usage.InputTokens > tier.AboveInputTokens && tier.AboveInputTokens >= rates.AboveInputTokens {
+			rates = tier
+		}
+	}
+	cacheRead := rates.CacheReadPerMillionTokens
+	if cacheRead == 0 {
+		cacheRead = rates.InputPerMillionTokens
+	}
+	cacheWrite := rates.CacheWritePerMillionTokens
+	if cacheWrite == 0 {
+		cacheWrite = rates.InputPerMillionTokens
+	}
+
+	uncached := usage.InputTokens - usage.CachedInputTokens - usage.CacheCreationInputTokens
+	centiCents := (float64(uncached)*rates.InputPerMillionTokens +
+		float64(usage.CachedInputTokens)*cacheRead +
+		float64(usage.CacheCreationInputTokens)*cacheWrite +
+		float64(usage.OutputTokens)*rates.OutputPerMillionTokens) / 1_000_000
+	return centiCents / centiCentsPerDollar
+}
+
+// BatchCost is like Cost, for requests made through a batch API at the model's batch discount.
+func BatchCost(cfg ModelConfig, usage Usage) float64 {
+	cost := Cost(cfg, usage)
+	if cfg.Pricing != nil {
+		cost *= 1 - cfg.Pricing.BatchDiscount
+	}
+	return cost
+}
@@ -0,0 +1,70 @@
+package llm_test
+
+import (
+	"testing"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCostPricing(t *testing.T) {
+	store := llm.NewModelConfigStore()
+	config := func(name string) llm.ModelConfig {
+		cfg, ok := store.GetConfig(name)
+		require.True(t, ok, name)
+		return cfg
+	}
+
+	t.Run("prompt caching", func(t *testing.T) {
+		cfg := config(llm.ConfigClaude3Dot7Sonnet)
+		// $3 / M uncached, $0.30 / M cache reads, $3.75 / M cache writes, $15 / M output
+		cost := llm.Cost(cfg, llm.Usage{
+			InputTokens:              3_000_000,
+			CachedInputTokens:        1_000_000,
+			CacheCreationInputTokens: 1_000_000,
+			OutputTokens:             1_000_000,
+		})
+		assert.InDelta(t, 3+0.30+3.75+15, cost, 1e-9)
+	})
+
+	t.Run("cache reads without a rate cost the input rate", func(t *testing.T) {
+		cfg := config(llm.ConfigGroqLlama70B)
+		assert.InDelta(t,
+			llm.Cost(cfg, llm.Usage{InputTokens: 1_000_000}),
+			llm.Cost(cfg, llm.Usage{InputTokens: 1_000_000, CachedInputTokens: 500_000}),
+			1e-9)
+	})
+
+	t.Run("long context tiers", func(t *testing.T) {
+		cfg := config(llm.ConfigGemini1Dot5Pro)
+		// $1.25 / M input and $5 / M output up to 128k
+		assert.InDelta(t, 0.125+0.5, llm.Cost(cfg, llm.Usage{InputTokens: 100_000, OutputTokens: 100_000}), 1e-9)
+		// the whole request costs double above 128k
+		assert.InDelta(t, 0.5+1, llm.Cost(cfg, llm.Usage{InputTokens: 200_000, OutputTokens: 100_000}), 1e-9)
+		// cached tokens too
+		assert.InDelta(t, 0.0625+0.25, llm.Cost(cfg, llm.Usage{InputTokens: 200_000, CachedInputTokens: 100_000}), 1e-9)
+	})
+
+	t.Run("highest matching tier wins", func(t *testing.T) {
+		cfg := llm.ModelConfig{
+			CentiCentsPerMillionInputTokens: 10_000,
+			Pricing: &llm.Pricing{Tiers: []llm.PricingTier{
+				{AboveInputTokens: 200_000, InputPerMillionTokens: 30_000},
+				{AboveInputTokens: 100_000, InputPerMillionTokens: 20_000},
+			}},
+		}
+		assert.InDelta(t, 0.3, llm.Cost(cfg, llm.Usage{InputTokens: 150_000}), 1e-9)
+		assert.InDelta(t, 0.9, llm.Cost(cfg, llm.Usage{InputTokens: 300_000}), 1e-9)
+	})
+
+	t.Run("batch discount", func(t *testing.T) {
+		cfg := config(llm.ConfigGPT4o)
+		usage := llm.Usage{InputTokens: 1_000_000, OutputTokens: 500_000}
+		assert.InDelta(t, 7.5, llm.Cost(cfg, usage), 1e-9)
+		assert.InDelta(t, 3.75, llm.BatchCost(cfg, usage), 1e-9)
+		// no discount without pricing
+		cfg = config(llm.ConfigGroqLlama70B)
+		assert.InDelta(t, llm.Cost(cfg, usage), llm.BatchCost(cfg, usage), 1e-9)
+	})
+}
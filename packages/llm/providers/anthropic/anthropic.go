@@ -3,10 +3,15 @@ package anthropic
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"log/slog"
+	"net/http"
 	"slices"
+	"strings"
 
 	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/internal/apierr"
+	"github.com/stillmatic/gollum/packages/llm/providers/transport"
 
 	"github.com/liushuangls/go-anthropic/v2"
 	"github.com/pkg/errors"
@@ -17,28 +22,45 @@ type Provider struct {
 	cacheEnabled bool
 }
 
-func NewAnthropicProvider(apiKey string) *Provider {
+func NewAnthropicProvider(apiKey string, opts ...transport.Option) *Provider {
 	return &Provider{
-		client: anthropic.NewClient(apiKey),
+		client: newClient(apiKey, opts),
 	}
 }
 
-func NewAnthropicProviderWithCache(apiKey string) *Provider {
-	client := anthropic.NewClient(apiKey, anthropic.WithBetaVersion(anthropic.BetaPromptCaching20240731))
+// NewAnthropicProviderWithCache returns a provider which sends the prompt caching beta header, which messages
+// with ShouldCache need.
+func NewAnthropicProviderWithCache(apiKey string, opts ...transport.Option) *Provider {
 	return &Provider{
-		client:       client,
+		client:       newClient(apiKey, opts, anthropic.WithBetaVersion(anthropic.BetaPromptCaching20240731)),
 		cacheEnabled: true,
 	}
 }
 
+func newClient(apiKey string, opts []transport.Option, clientOpts ...anthropic.ClientOption) *anthropic.Client {
+	settings := transport.Apply(opts...)
+	clientOpts = append(clientOpts, anthropic.WithHTTPClient(settings.Client()))
+	if settings.BaseURL != "" {
+		clientOpts = append(clientOpts, anthropic.WithBaseURL(settings.BaseURL))
+	}
+	return anthropic.NewClient(apiKey, clientOpts...)
+}
+
 func reqToMessages(req llm.InferRequest) ([]anthropic.Message, []anthropic.MessageSystemPart, error) {
 	msgs := make([]anthropic.Message, 0)
 	systemMsgs := make([]anthropic.MessageSystemPart, 0)
 	for _, m := range req.Messages {
 		if m.Role == "system" {
+			var text strings.Builder
+			for _, part := range m.ContentParts() {
+				if part.Type != llm.PartTypeText {
+					return nil, nil, &llm.UnsupportedPartError{Type: part.Type, Model: req.ModelConfig.ModelName}
+				}
+				text.WriteString(part.Text)
+			}
 			msgContent := anthropic.MessageSystemPart{
 				Type: "text",
-				Text: m.Content,
+				Text: text.String(),
 			}
 			if m.ShouldCache {
 				msgContent.CacheControl = &anthropic.MessageCacheControl{
@@ -49,23 +71,47 @@ func reqToMessages(req llm.InferRequest) ([]anthropic.Message, []anthropic.Messa
 			continue
 		}
 
+		// tool results are sent as user content. consecutive results must share a single user turn.
+		if m.Role == "tool" {
+			resContent := anthropic.NewToolResultMessageContent(m.ToolCallID, m.Content, false)
+			if len(msgs) > 0 && msgs[len(msgs)-1].Role == anthropic.RoleUser && isToolResultMessage(msgs[len(msgs)-1]) {
+				msgs[len(msgs)-1].Content = append(msgs[len(msgs)-1].Content, resContent)
+			} else {
+				msgs = append(msgs, anthropic.Message{
+					Role:    anthropic.RoleUser,
+					Content: []anthropic.MessageContent{resContent},
+				})
+			}
+			continue
+		}
+
 		// only allow user and assistant roles
 		// TODO: this should be a little cleaner...
 		if !(slices.Index([]string{string(anthropic.RoleUser), string(anthropic.RoleAssistant)}, m.Role) > -1) {
 			return nil, nil, errors.New("invalid role")
 		}
 		content := make([]anthropic.MessageContent, 0)
-		txtContent := anthropic.NewTextMessageContent(m.Content)
+		for _, part := range m.ContentParts() {
+			c, err := partToAnthropic(part, req.ModelConfig.ModelName)
+			if err != nil {
+				return nil, nil, err
+			}
+			content = append(content, c)
+		}
+		// anthropic rejects empty text blocks, which are common alongside tool calls
+		if len(content) == 0 && len(m.ToolCalls) == 0 {
+			content = append(content, anthropic.NewTextMessageContent(""))
+		}
 		// this will fail if the model is not configured to cache
-		if m.ShouldCache {
-			txtContent.SetCacheControl()
+		if m.ShouldCache && len(content) > 0 {
+			content[len(content)-1].SetCacheControl()
 		}
-		content = append(content, txtContent)
-		if m.Image != nil && len(m.Image) > 0 {
-			b64Image := base64.StdEncoding.EncodeToString(m.Image)
-			// TODO: support other image types
-			content = append(content, anthropic.NewImageMessageContent(
-				anthropic.MessageContentSource{Type: "base64", MediaType: "image/png", Data: b64Image}))
+		for _, tc := range m.ToolCalls {
+			args := tc.Arguments
+			if args == "" {
+				args = "{}"
+			}
+			content = append(content, anthropic.NewToolUseMessageContent(tc.ID, tc.Name, json.RawMessage(args)))
 		}
 		newMsg := anthropic.Message{
 			Role:    anthropic.ChatRole(m.Role),
@@ -78,69 +124,342 @@ func reqToMessages(req llm.InferRequest) ([]anthropic.Message, []anthropic.Messa
 	return msgs, systemMsgs, nil
 }
 
+// anthropicImageTypes are the image types anthropic accepts.
+var anthropicImageTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+func partToAnthropic(part llm.Part, model string) (anthropic.MessageContent, error) {
+	switch {
+	case part.Type == llm.PartTypeText:
+		return anthropic.NewTextMessageContent(part.Text), nil
+	case part.Type == llm.PartTypeImage && slices.Contains(anthropicImageTypes, part.MIMEType):
+		return anthropic.NewImageMessageContent(anthropic.NewMessageContentSource(
+			anthropic.MessagesContentSourceTypeBase64, part.MIMEType, base64.StdEncoding.EncodeToString(part.Data))), nil
+	case part.Type == llm.PartTypeDocument && part.MIMEType == "application/pdf":
+		return anthropic.NewDocumentMessageContent(anthropic.NewMessageContentSource(
+			anthropic.MessagesContentSourceTypeBase64, part.MIMEType, base64.StdEncoding.EncodeToString(part.Data))), nil
+	default:
+		// the client can't send URL sources, and anthropic doesn't take audio
+		return anthropic.MessageContent{}, &llm.UnsupportedPartError{Type: part.Type, MIMEType: part.MIMEType, Model: model}
+	}
+}
+
+func isToolResultMessage(m anthropic.Message) bool {
+	for _, c := range m.Content {
+		if c.Type != anthropic.MessagesContentTypeToolResult {
+			return false
+		}
+	}
+	return true
+}
+
+func toolsToAnthropic(tools []llm.Tool) []anthropic.ToolDefinition {
+	if len(tools) == 0 {
+		return nil
+	}
+	defs := make([]anthropic.ToolDefinition, len(tools))
+	for i, t := range tools {
+		schema := t.Parameters
+		// input_schema is required, even for tools without arguments
+		if schema == nil {
+			schema = map[string]any{"type": "object"}
+		}
+		defs[i] = anthropic.ToolDefinition{
+			Name:        t.Name,
+			Description: t.Description,
+			InputSchema: schema,
+		}
+	}
+	return defs
+}
+
+func toolChoiceToAnthropic(tc llm.ToolChoice) *anthropic.ToolChoice {
+	switch tc.Type {
+	case llm.ToolChoiceRequired:
+		return &anthropic.ToolChoice{Type: "any"}
+	case llm.ToolChoiceTool:
+		return &anthropic.ToolChoice{Type: "tool", Name: tc.Name}
+	default:
+		return &anthropic.ToolChoice{Type: string(tc.Type)}
+	}
+}
+
+// supportsThinking reports whether the model supports extended thinking.
+func supportsThinking(model string) bool {
+	for _, prefix := range []string{"claude-3-7-sonnet", "claude-sonnet-4", "claude-opus-4"} {
+		if strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 func (p *Provider) GenerateResponse(ctx context.Context, req llm.InferRequest) (string, error) {
+	res, err := p.Infer(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	return res.Content, nil
+}
+
+func messagesRequest(req llm.InferRequest) (anthropic.MessagesRequest, error) {
 	msgs, systemPrompt, err := reqToMessages(req)
 	if err != nil {
-		return "", errors.Wrap(err, "invalid messages")
+		return anthropic.MessagesRequest{}, errors.Wrap(err, "invalid messages")
+	}
+	opts := req.MessageOptions
+	// candidates are emulated by Infer
+	supported := []llm.Option{llm.OptionTopP, llm.OptionTopK, llm.OptionStopSequences, llm.OptionCandidates}
+	if supportsThinking(req.ModelConfig.ModelName) {
+		supported = append(supported, llm.OptionThinkingBudget)
+	}
+	if err := opts.Check(req.ModelConfig.ModelName, supported...); err != nil {
+		return anthropic.MessagesRequest{}, err
 	}
 	msgsReq := anthropic.MessagesRequest{
-		Model:       anthropic.Model(req.ModelConfig.ModelName),
-		Messages:    msgs,
-		MaxTokens:   req.MessageOptions.MaxTokens,
-		Temperature: &req.MessageOptions.Temperature,
+		Model:         anthropic.Model(req.ModelConfig.ModelName),
+		Messages:      msgs,
+		MaxTokens:     opts.MaxTokens,
+		Temperature:   &opts.Temperature,
+		StopSequences: opts.StopSequences,
+		Tools:         toolsToAnthropic(req.Tools),
+	}
+	if opts.TopP != 0 {
+		msgsReq.TopP = &opts.TopP
+	}
+	if opts.TopK != 0 {
+		msgsReq.TopK = &opts.TopK
+	}
+	if opts.ThinkingBudget != 0 {
+		// thinking doesn't allow changing the temperature or top_k, or forcing tool use
+		if opts.TopK != 0 {
+			return anthropic.MessagesRequest{}, errors.New("top_k can't be combined with extended thinking")
+		}
+		if req.ResponseFormat != nil {
+			return anthropic.MessagesRequest{}, errors.New("response format can't be combined with extended thinking")
+		}
+		if tc := req.ToolChoice; tc != nil && (tc.Type == llm.ToolChoiceRequired || tc.Type == llm.ToolChoiceTool) {
+			return anthropic.MessagesRequest{}, errors.Errorf("tool choice %s can't be combined with extended thinking", tc.Type)
+		}
+		msgsReq.Temperature = nil
+		msgsReq.Thinking = &anthropic.Thinking{Type: anthropic.ThinkingTypeEnabled, BudgetTokens: opts.ThinkingBudget}
+	}
+	if req.ToolChoice != nil {
+		msgsReq.ToolChoice = toolChoiceToAnthropic(*req.ToolChoice)
+	}
+	// anthropic has no JSON mode, so we force a call to a tool whose input schema is the response format
+	if rf := req.ResponseFormat; rf != nil {
+		if req.ToolChoice != nil {
+			return anthropic.MessagesRequest{}, errors.New("response format can't be combined with a tool choice")
+		}
+		description := rf.Description
+		if description == "" {
+			description = "Respond with JSON matching the schema."
+		}
+		msgsReq.Tools = append(msgsReq.Tools, anthropic.ToolDefinition{
+			Name:        rf.Name,
+			Description: description,
+			InputSchema: rf.Schema,
+		})
+		msgsReq.ToolChoice = &anthropic.ToolChoice{Type: "tool", Name: rf.Name}
 	}
 	if systemPrompt != nil && len(systemPrompt) > 0 {
 		msgsReq.MultiSystem = systemPrompt
 	}
+	return msgsReq, nil
+}
+
+// validate checks the request against the model's capabilities, and that cached messages are only sent by a
+// provider created with NewAnthropicProviderWithCache.
+func (p *Provider) validate(req llm.InferRequest, streaming bool) error {
+	if err := llm.ValidateRequest(req, streaming); err != nil {
+		return err
+	}
+	if p.cacheEnabled {
+		return nil
+	}
+	for _, m := range req.Messages {
+		if m.ShouldCache {
+			err := &llm.UnsupportedCapabilityError{Capability: llm.CapabilityPromptCaching, Model: req.ModelConfig.ModelName}
+			return errors.Wrap(err, "provider was created without caching, use NewAnthropicProviderWithCache")
+		}
+	}
+	return nil
+}
+
+// Infer generates a response. Anthropic can't generate several candidates in one call, so they are generated
+// by parallel calls.
+func (p *Provider) Infer(ctx context.Context, req llm.InferRequest) (*llm.InferResponse, error) {
+	if err := p.validate(req, false); err != nil {
+		return nil, err
+	}
+	return llm.InferParallel(ctx, req, p.infer)
+}
+
+func (p *Provider) infer(ctx context.Context, req llm.InferRequest) (*llm.InferResponse, error) {
+	msgsReq, err := messagesRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	res, err := p.createMessagesStream(ctx, msgsReq, "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return responseFromAnthropic(req, res), nil
+}
+
+// createMessagesStream streams the request, calling onText for each chunk of text if set.
+// If formatTool is set, the input of calls to that tool is streamed as text too.
+// The client treats a stream that is cut off as complete, so we check that it ended with message_stop.
+func (p *Provider) createMessagesStream(ctx context.Context, msgsReq anthropic.MessagesRequest, formatTool string, onText func(string)) (anthropic.MessagesResponse, error) {
+	stopped := false
+	formatBlock := -1
 	res, err := p.client.CreateMessagesStream(ctx, anthropic.MessagesStreamRequest{
 		MessagesRequest: msgsReq,
+		OnContentBlockStart: func(data anthropic.MessagesEventContentBlockStartData) {
+			if formatTool != "" && data.ContentBlock.MessageContentToolUse != nil &&
+				data.ContentBlock.MessageContentToolUse.Name == formatTool {
+				formatBlock = data.Index
+			}
+		},
+		OnContentBlockDelta: func(data anthropic.MessagesEventContentBlockDeltaData) {
+			if onText == nil {
+				return
+			}
+			// other tool use blocks stream their input as partial JSON, which is returned with the full response
+			if data.Index == formatBlock && data.Delta.PartialJson != nil && *data.Delta.PartialJson != "" {
+				onText(*data.Delta.PartialJson)
+				return
+			}
+			if data.Delta.Text == nil || *data.Delta.Text == "" {
+				return
+			}
+			onText(*data.Delta.Text)
+		},
+		OnMessageStop: func(anthropic.MessagesEventMessageStopData) {
+			stopped = true
+		},
 	})
 	if err != nil {
-		return "", errors.Wrap(err, "anthropic messages stream error")
+		return res, errors.Wrap(apiError(err, res.Header()), "anthropic messages stream error")
+	}
+	if !stopped {
+		return res, errors.New("anthropic messages stream ended unexpectedly")
+	}
+	return res, nil
+}
+
+// apiError classifies an error from the API, with the delay from the response's Retry-After header if it has one.
+func apiError(err error, header http.Header) error {
+	return apierr.Classify(llm.ProviderAnthropic, apierr.WithRetryAfter(err, header))
+}
+
+func responseFromAnthropic(req llm.InferRequest, res anthropic.MessagesResponse) *llm.InferResponse {
+	resp := &llm.InferResponse{}
+	var text strings.Builder
+	for _, c := range res.Content {
+		switch c.Type {
+		case anthropic.MessagesContentTypeText:
+			text.WriteString(c.GetText())
+		case anthropic.MessagesContentTypeToolUse:
+			if req.ResponseFormat != nil && c.MessageContentToolUse.Name == req.ResponseFormat.Name {
+				text.Write(c.MessageContentToolUse.Input)
+				continue
+			}
+			resp.ToolCalls = append(resp.ToolCalls, llm.ToolCall{
+				ID:        c.MessageContentToolUse.ID,
+				Name:      c.MessageContentToolUse.Name,
+				Arguments: string(c.MessageContentToolUse.Input),
+			})
+		}
+	}
+	resp.Content = text.String()
+	resp.FinishReason = finishReasonFromAnthropic(res.StopReason)
+	if len(resp.ToolCalls) > 0 {
+		resp.FinishReason = llm.FinishReasonToolCalls
+	} else if req.ResponseFormat != nil && resp.FinishReason == llm.FinishReasonToolCalls {
+		// the only call was to the response format tool
+		resp.FinishReason = llm.FinishReasonStop
 	}
+	resp.Model = string(res.Model)
+	resp.Usage = usageFromAnthropic(res.Usage)
+	resp.Cost = llm.Cost(req.ModelConfig, resp.Usage)
+	return resp
+}
+
+func finishReasonFromAnthropic(sr anthropic.MessagesStopReason) llm.FinishReason {
+	switch sr {
+	case anthropic.MessagesStopReasonEndTurn, anthropic.MessagesStopReasonStopSequence:
+		return llm.FinishReasonStop
+	case anthropic.MessagesStopReasonMaxTokens:
+		return llm.FinishReasonLength
+	case anthropic.MessagesStopReasonToolUse:
+		return llm.FinishReasonToolCalls
+	default:
+		return llm.FinishReasonOther
+	}
+}
 
-	return res.GetFirstContentText(), nil
+// usageFromAnthropic normalizes usage, anthropic reports cached tokens separately from input tokens.
+func usageFromAnthropic(u anthropic.MessagesUsage) llm.Usage {
+	return llm.Usage{
+		InputTokens:              u.InputTokens + u.CacheReadInputTokens + u.CacheCreationInputTokens,
+		OutputTokens:             u.OutputTokens,
+		CachedInputTokens:        u.CacheReadInputTokens,
+		CacheCreationInputTokens: u.CacheCreationInputTokens,
+	}
 }
 
 func (p *Provider) GenerateResponseAsync(ctx context.Context, req llm.InferRequest) (<-chan llm.StreamDelta, error) {
+	if err := p.validate(req, true); err != nil {
+		return nil, err
+	}
 	outChan := make(chan llm.StreamDelta)
 	go func() {
 		defer close(outChan)
-		msgs, systemPrompt, err := reqToMessages(req)
-		if err != nil {
-			slog.Error("invalid messages", "err", err)
+		if req.MessageOptions.Candidates > 1 {
+			sendDelta(ctx, outChan, llm.StreamDelta{Err: llm.ErrStreamingCandidates})
 			return
 		}
-		msgsReq := anthropic.MessagesRequest{
-			Model:       anthropic.Model(req.ModelConfig.ModelName),
-			Messages:    msgs,
-			MaxTokens:   req.MessageOptions.MaxTokens,
-			Temperature: &req.MessageOptions.Temperature,
-		}
-		if systemPrompt != nil {
-			msgsReq.MultiSystem = systemPrompt
+		msgsReq, err := messagesRequest(req)
+		if err != nil {
+			sendDelta(ctx, outChan, llm.StreamDelta{Err: err})
+			return
 		}
 
-		_, err = p.client.CreateMessagesStream(ctx, anthropic.MessagesStreamRequest{
-			MessagesRequest: msgsReq,
-			OnContentBlockDelta: func(data anthropic.MessagesEventContentBlockDeltaData) {
-				if data.Delta.Text == nil {
-					outChan <- llm.StreamDelta{
-						EOF: true,
-					}
-					return
-				}
-
-				outChan <- llm.StreamDelta{
-					Text: *data.Delta.Text,
-				}
-			},
+		var formatTool string
+		if req.ResponseFormat != nil {
+			formatTool = req.ResponseFormat.Name
+		}
+		res, err := p.createMessagesStream(ctx, msgsReq, formatTool, func(text string) {
+			sendDelta(ctx, outChan, llm.StreamDelta{Text: text})
 		})
 		if err != nil {
 			slog.Error("anthropic messages stream error", "err", err)
+			sendDelta(ctx, outChan, llm.StreamDelta{Err: err})
 			return
 		}
+
+		resp := responseFromAnthropic(req, res)
+		sendDelta(ctx, outChan, llm.StreamDelta{
+			EOF:          true,
+			ToolCalls:    resp.ToolCalls,
+			FinishReason: resp.FinishReason,
+			Model:        resp.Model,
+			Usage:        resp.Usage,
+			Cost:         resp.Cost,
+		})
 	}()
 
 	return outChan, nil
 }
+
+// sendDelta sends the delta unless the context is done first, returning whether it was sent.
+func sendDelta(ctx context.Context, ch chan<- llm.StreamDelta, delta llm.StreamDelta) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case ch <- delta:
+		return true
+	}
+}
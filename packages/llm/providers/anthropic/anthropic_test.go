@@ -0,0 +1,314 @@
+package anthropic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/llmtest"
+	"github.com/stillmatic/gollum/packages/llm/providers/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveScenario renders the scenario as a messages event stream.
+func serveScenario(s llmtest.Scenario) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.Status != 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(s.Status)
+			fmt.Fprint(w, `{"type":"error","error":{"type":"api_error","message":"server error"}}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		send := func(event string, v any) {
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, llmtest.MustJSON(v))
+			w.(http.Flusher).Flush()
+		}
+
+		send("message_start", map[string]any{"type": "message_start", "message": map[string]any{
+			"id": "msg_1", "type": "message", "role": "assistant", "model": "test-model", "content": []any{},
+			"usage": map[string]any{"input_tokens": s.Usage.InputTokens, "output_tokens": 1},
+		}})
+		send("content_block_start", map[string]any{"type": "content_block_start", "index": 0,
+			"content_block": map[string]any{"type": "text", "text": ""}})
+		for _, c := range s.Chunks {
+			send("content_block_delta", map[string]any{"type": "content_block_delta", "index": 0,
+				"delta": map[string]any{"type": "text_delta", "text": c}})
+		}
+		if s.Hang {
+			<-r.Context().Done()
+			return
+		}
+		if s.Fail {
+			send("error", map[string]any{"type": "error", "error": map[string]any{"type": "overloaded_error", "message": "Overloaded"}})
+			return
+		}
+		send("content_block_stop", map[string]any{"type": "content_block_stop", "index": 0})
+		for i, tc := range s.ToolCalls {
+			idx := i + 1
+			send("content_block_start", map[string]any{"type": "content_block_start", "index": idx,
+				"content_block": map[string]any{"type": "tool_use", "id": tc.ID, "name": tc.Name, "input": map[string]any{}}})
+			mid := len(tc.Arguments) / 2
+			for _, part := range []string{tc.Arguments[:mid], tc.Arguments[mid:]} {
+				send("content_block_delta", map[string]any{"type": "content_block_delta", "index": idx,
+					"delta": map[string]any{"type": "input_json_delta", "partial_json": part}})
+			}
+			send("content_block_stop", map[string]any{"type": "content_block_stop", "index": idx})
+		}
+		stopReason := "end_turn"
+		if len(s.ToolCalls) > 0 {
+			stopReason = "tool_use"
+		}
+		send("message_delta", map[string]any{"type": "message_delta",
+			"delta": map[string]any{"stop_reason": stopReason},
+			"usage": map[string]any{"output_tokens": s.Usage.OutputTokens}})
+		send("message_stop", map[string]any{"type": "message_stop"})
+	}
+}
+
+func TestStreaming(t *testing.T) {
+	llmtest.TestStreaming(t, func(t *testing.T, s llmtest.Scenario) llm.Responder {
+		srv := httptest.NewServer(serveScenario(s))
+		t.Cleanup(srv.Close)
+		return NewAnthropicProvider("fake-key", transport.WithBaseURL(srv.URL))
+	})
+}
+
+type answer struct {
+	Answer     string  `json:"answer" jsonschema:"required"`
+	Confidence float64 `json:"confidence" jsonschema:"required"`
+}
+
+func TestResponseFormat(t *testing.T) {
+	scenario := llmtest.Scenario{
+		ToolCalls: []llm.ToolCall{{ID: "toolu_1", Name: "answer", Arguments: `{"answer":"42","confidence":0.9}`}},
+		Usage:     llm.Usage{InputTokens: 10, OutputTokens: 5},
+	}
+	var body struct {
+		Tools []struct {
+			Name        string         `json:"name"`
+			InputSchema map[string]any `json:"input_schema"`
+		} `json:"tools"`
+		ToolChoice struct {
+			Type string `json:"type"`
+			Name string `json:"name"`
+		} `json:"tool_choice"`
+	}
+	serve := serveScenario(scenario)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(b, &body))
+		r.Body = io.NopCloser(bytes.NewReader(b))
+		serve(w, r)
+	}))
+	defer srv.Close()
+	p := NewAnthropicProvider("fake-key", transport.WithBaseURL(srv.URL))
+
+	t.Run("forces a call to the format tool", func(t *testing.T) {
+		got, res, err := llm.InferStructured[answer](context.Background(), p, llmtest.Request)
+		require.NoError(t, err)
+		assert.Equal(t, answer{Answer: "42", Confidence: 0.9}, got)
+		assert.Empty(t, res.ToolCalls)
+		assert.Equal(t, llm.FinishReasonStop, res.FinishReason)
+
+		require.Len(t, body.Tools, 1)
+		assert.Equal(t, "answer", body.Tools[0].Name)
+		assert.Equal(t, "object", body.Tools[0].InputSchema["type"])
+		assert.Equal(t, "tool", body.ToolChoice.Type)
+		assert.Equal(t, "answer", body.ToolChoice.Name)
+	})
+
+	t.Run("streams the tool input as text", func(t *testing.T) {
+		req := llmtest.Request
+		req.ResponseFormat = llm.NewResponseFormat[answer]()
+		ch, err := p.GenerateResponseAsync(context.Background(), req)
+		require.NoError(t, err)
+		var text string
+		var final llm.StreamDelta
+		for delta := range ch {
+			text += delta.Text
+			if delta.EOF {
+				final = delta
+			}
+		}
+		assert.JSONEq(t, `{"answer":"42","confidence":0.9}`, text)
+		assert.True(t, final.EOF)
+		assert.Empty(t, final.ToolCalls)
+		assert.Equal(t, llm.FinishReasonStop, final.FinishReason)
+	})
+
+	t.Run("can't be combined with a tool choice", func(t *testing.T) {
+		req := llmtest.Request
+		req.ResponseFormat = llm.NewResponseFormat[answer]()
+		req.ToolChoice = &llm.ToolChoice{Type: llm.ToolChoiceRequired}
+		_, err := p.Infer(context.Background(), req)
+		assert.ErrorContains(t, err, "tool choice")
+	})
+}
+
+func TestMessageOptions(t *testing.T) {
+	var body map[string]any
+	serve := serveScenario(llmtest.Scenario{Chunks: []string{"hi"}})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = nil
+		b, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(b, &body))
+		serve(w, r)
+	}))
+	defer srv.Close()
+	p := NewAnthropicProvider("fake-key", transport.WithBaseURL(srv.URL))
+
+	t.Run("sampling options", func(t *testing.T) {
+		req := llmtest.Request
+		req.MessageOptions = llm.MessageOptions{MaxTokens: 100, TopP: 0.5, TopK: 20, StopSequences: []string{"END"}}
+		_, err := p.Infer(context.Background(), req)
+		require.NoError(t, err)
+		assert.EqualValues(t, 0.5, body["top_p"])
+		assert.EqualValues(t, 20, body["top_k"])
+		assert.Equal(t, []any{"END"}, body["stop_sequences"])
+	})
+
+	t.Run("extended thinking", func(t *testing.T) {
+		req := llmtest.Request
+		req.ModelConfig.ModelName = "claude-3-7-sonnet-latest"
+		req.MessageOptions = llm.MessageOptions{MaxTokens: 4096, ThinkingBudget: 2048}
+		_, err := p.Infer(context.Background(), req)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"type": "enabled", "budget_tokens": float64(2048)}, body["thinking"])
+		assert.NotContains(t, body, "temperature")
+
+		// thinking only allows the model to choose whether to call tools
+		req.Tools = []llm.Tool{{Name: "weather", Parameters: map[string]any{"type": "object"}}}
+		for _, tc := range []llm.ToolChoice{{Type: llm.ToolChoiceRequired}, {Type: llm.ToolChoiceTool, Name: "weather"}} {
+			req.ToolChoice = &tc
+			body = nil
+			_, err = p.Infer(context.Background(), req)
+			assert.ErrorContains(t, err, "extended thinking")
+			assert.Nil(t, body)
+		}
+		req.ToolChoice = &llm.ToolChoice{Type: llm.ToolChoiceAuto}
+		_, err = p.Infer(context.Background(), req)
+		require.NoError(t, err)
+		req.Tools, req.ToolChoice = nil, nil
+
+		req.ModelConfig.ModelName = "claude-3-5-sonnet-latest"
+		_, err = p.Infer(context.Background(), req)
+		assert.ErrorIs(t, err, llm.ErrUnsupportedOption)
+	})
+
+	t.Run("unsupported options", func(t *testing.T) {
+		req := llmtest.Request
+		req.MessageOptions.PresencePenalty = 0.5
+		_, err := p.Infer(context.Background(), req)
+		var optErr *llm.UnsupportedOptionError
+		require.ErrorAs(t, err, &optErr)
+		assert.Equal(t, llm.OptionPresencePenalty, optErr.Option)
+	})
+}
+
+func TestCandidates(t *testing.T) {
+	var calls atomic.Int32
+	serve := serveScenario(llmtest.Scenario{Chunks: []string{"hi"}, Usage: llm.Usage{InputTokens: 10, OutputTokens: 5}})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		serve(w, r)
+	}))
+	defer srv.Close()
+	p := NewAnthropicProvider("fake-key", transport.WithBaseURL(srv.URL))
+
+	req := llmtest.Request
+	req.MessageOptions.Candidates = 3
+	res, err := p.Infer(context.Background(), req)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, calls.Load())
+	assert.Equal(t, []string{"hi", "hi", "hi"}, res.Contents())
+	assert.Equal(t, llm.Usage{InputTokens: 30, OutputTokens: 15}, res.Usage)
+
+	ch, err := p.GenerateResponseAsync(context.Background(), req)
+	require.NoError(t, err)
+	delta := <-ch
+	assert.ErrorIs(t, delta.Err, llm.ErrStreamingCandidates)
+}
+
+func TestMessageParts(t *testing.T) {
+	var body struct {
+		Messages []struct {
+			Content []map[string]any `json:"content"`
+		} `json:"messages"`
+	}
+	serve := serveScenario(llmtest.Scenario{Chunks: []string{"cats"}})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(b, &body))
+		serve(w, r)
+	}))
+	defer srv.Close()
+	p := NewAnthropicProvider("fake-key", transport.WithBaseURL(srv.URL))
+
+	jpeg := []byte("\xff\xd8\xff\xe0\x00\x10JFIF")
+	pdf := []byte("%PDF-1.7\n")
+	req := llmtest.Request
+	req.Messages = []llm.InferMessage{
+		{Role: "user", Parts: []llm.Part{llm.ImagePart(jpeg), llm.DocumentPart(pdf), llm.TextPart("Summarize these.")}},
+	}
+	_, err := p.Infer(context.Background(), req)
+	require.NoError(t, err)
+	require.Len(t, body.Messages, 1)
+	content := body.Messages[0].Content
+	require.Len(t, content, 3)
+	assert.Equal(t, "image", content[0]["type"])
+	assert.Equal(t, map[string]any{"type": "base64", "media_type": "image/jpeg", "data": "/9j/4AAQSkZJRg=="}, content[0]["source"])
+	assert.Equal(t, "document", content[1]["type"])
+	assert.Equal(t, "application/pdf", content[1]["source"].(map[string]any)["media_type"])
+	assert.Equal(t, "Summarize these.", content[2]["text"])
+
+	for _, part := range []llm.Part{llm.ImageURLPart("https://example.com/cat.png"), llm.AudioPart([]byte("RIFF\x24\x00\x00\x00WAVEfmt "))} {
+		req.Messages[0].Parts = []llm.Part{part}
+		_, err = p.Infer(context.Background(), req)
+		assert.ErrorIs(t, err, llm.ErrUnsupportedPart)
+	}
+}
+
+func TestPromptCachingValidation(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		serveScenario(llmtest.Scenarios[0])(w, r)
+	}))
+	defer srv.Close()
+
+	cfg, _ := llm.NewModelConfigStore().GetConfig(llm.ConfigClaude3Dot6Sonnet)
+	req := llm.InferRequest{
+		Messages: []llm.InferMessage{
+			{Role: "system", Content: "A long shared prefix.", ShouldCache: true},
+			{Role: "user", Content: "Say hello."},
+		},
+		ModelConfig:    cfg,
+		MessageOptions: llm.MessageOptions{MaxTokens: 128},
+	}
+
+	// fails locally on a provider without the caching beta
+	p := NewAnthropicProvider("fake-key", transport.WithBaseURL(srv.URL))
+	_, err := p.Infer(context.Background(), req)
+	assert.ErrorIs(t, err, llm.ErrUnsupportedCapability)
+	assert.ErrorContains(t, err, "NewAnthropicProviderWithCache")
+	_, err = p.GenerateResponseAsync(context.Background(), req)
+	assert.ErrorIs(t, err, llm.ErrUnsupportedCapability)
+	assert.Zero(t, calls.Load())
+
+	p = NewAnthropicProviderWithCache("fake-key", transport.WithBaseURL(srv.URL))
+	_, err = p.Infer(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), calls.Load())
+}
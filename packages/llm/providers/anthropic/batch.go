@@ -0,0 +1,121 @@
+package anthropic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/batch"
+
+	"github.com/liushuangls/go-anthropic/v2"
+	"github.com/pkg/errors"
+)
+
+// SubmitBatch creates a Message Batch. Batches can't generate several candidates per request.
+func (p *Provider) SubmitBatch(ctx context.Context, items []batch.Item) (string, error) {
+	batchReq := anthropic.BatchRequest{Requests: make([]anthropic.InnerRequests, len(items))}
+	for i, item := range items {
+		if item.Request.MessageOptions.Candidates > 1 {
+			return "", errors.Errorf("invalid request %s: batches don't support more than one candidate", item.CustomID)
+		}
+		if err := p.validate(item.Request, false); err != nil {
+			return "", errors.Wrapf(err, "invalid request %s", item.CustomID)
+		}
+		msgsReq, err := messagesRequest(item.Request)
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid request %s", item.CustomID)
+		}
+		batchReq.Requests[i] = anthropic.InnerRequests{CustomId: item.CustomID, Params: msgsReq}
+	}
+	res, err := p.client.CreateBatch(ctx, batchReq)
+	if err != nil {
+		return "", errors.Wrap(apiError(err, res.Header()), "anthropic batch error")
+	}
+	return string(res.Id), nil
+}
+
+func (p *Provider) BatchStatus(ctx context.Context, jobID string) (batch.Status, error) {
+	res, err := p.client.RetrieveBatch(ctx, anthropic.BatchId(jobID))
+	if err != nil {
+		return batch.Status{}, errors.Wrap(apiError(err, res.Header()), "anthropic batch error")
+	}
+	counts := res.RequestCounts
+	status := batch.Status{
+		State:     batch.StateInProgress,
+		Total:     counts.Processing + counts.Succeeded + counts.Errored + counts.Canceled + counts.Expired,
+		Succeeded: counts.Succeeded,
+		Failed:    counts.Errored,
+	}
+	// anthropic validates requests on submission, so a batch that was accepted always ends with results
+	if res.ProcessingStatus == anthropic.ProcessingStatusEnded {
+		status.State = batch.StateEnded
+	}
+	return status, nil
+}
+
+// batchResultLine is a line of the results file. The client's own type drops the errors.
+type batchResultLine struct {
+	CustomID string `json:"custom_id"`
+	Result   struct {
+		Type    anthropic.ResultType        `json:"type"`
+		Message *anthropic.MessagesResponse `json:"message"`
+		Error   *struct {
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"error"`
+	} `json:"result"`
+}
+
+// BatchResults fetches the results of an ended batch. Costs are at the batch discount.
+func (p *Provider) BatchResults(ctx context.Context, jobID string, items []batch.Item) (map[string]batch.Result, error) {
+	res, err := p.client.RetrieveBatchResults(ctx, anthropic.BatchId(jobID))
+	if err != nil {
+		return nil, errors.Wrap(apiError(err, res.Header()), "anthropic batch error")
+	}
+	reqs := make(map[string]llm.InferRequest, len(items))
+	for _, item := range items {
+		reqs[item.CustomID] = item.Request
+	}
+
+	results := make(map[string]batch.Result, len(items))
+	for _, data := range bytes.Split(res.RawResponse, []byte("\n")) {
+		if len(bytes.TrimSpace(data)) == 0 {
+			continue
+		}
+		var line batchResultLine
+		if err := json.Unmarshal(data, &line); err != nil {
+			return nil, errors.Wrap(err, "invalid line in batch results")
+		}
+		results[line.CustomID] = resultFromAnthropic(reqs[line.CustomID], line)
+	}
+	return results, nil
+}
+
+func resultFromAnthropic(req llm.InferRequest, line batchResultLine) batch.Result {
+	result := batch.Result{CustomID: line.CustomID}
+	switch r := line.Result; {
+	case r.Type == anthropic.ResultTypeSucceeded && r.Message != nil:
+		resp := responseFromAnthropic(req, *r.Message)
+		resp.Cost = llm.BatchCost(req.ModelConfig, resp.Usage)
+		result.Response = resp
+	case r.Type == anthropic.ResultTypeErrored && r.Error != nil:
+		result.Err = &batch.ItemError{Type: r.Error.Error.Type, Message: r.Error.Error.Message}
+	default:
+		result.Err = fmt.Errorf("%w: %s", batch.ErrNotProcessed, r.Type)
+	}
+	return result
+}
+
+func (p *Provider) CancelBatch(ctx context.Context, jobID string) error {
+	res, err := p.client.CancelBatch(ctx, anthropic.BatchId(jobID))
+	if err != nil {
+		return errors.Wrap(apiError(err, res.Header()), "anthropic batch error")
+	}
+	return nil
+}
+
+var _ batch.Backend = &Provider{}
@@ -0,0 +1,88 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/batch"
+	"github.com/stillmatic/gollum/packages/llm/providers/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatch(t *testing.T) {
+	var submitted struct {
+		Requests []struct {
+			CustomID string         `json:"custom_id"`
+			Params   map[string]any `json:"params"`
+		} `json:"requests"`
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /messages/batches", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&submitted))
+		fmt.Fprint(w, `{"id": "msgbatch_1", "type": "message_batch", "processing_status": "in_progress"}`)
+	})
+	polls := 0
+	mux.HandleFunc("GET /messages/batches/msgbatch_1", func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		status := "in_progress"
+		if polls > 1 {
+			status = "ended"
+		}
+		fmt.Fprintf(w, `{"id": "msgbatch_1", "type": "message_batch", "processing_status": %q,
+			"request_counts": {"processing": 0, "succeeded": 1, "errored": 1, "canceled": 0, "expired": 1}}`, status)
+	})
+	mux.HandleFunc("GET /messages/batches/msgbatch_1/results", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"custom_id": "req-2", "result": {"type": "expired"}}`)
+		fmt.Fprintln(w, `{"custom_id": "req-0", "result": {"type": "succeeded", "message": {"id": "msg_1", "type": "message", "role": "assistant", "model": "claude-3-5-haiku-20241022", "content": [{"type": "tool_use", "id": "toolu_1", "name": "answer", "input": {"answer": "42"}}], "stop_reason": "tool_use", "usage": {"input_tokens": 1000000, "output_tokens": 0}}}}`)
+		fmt.Fprintln(w, `{"custom_id": "req-1", "result": {"type": "errored", "error": {"type": "error", "error": {"type": "invalid_request_error", "message": "too long"}}}}`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	cfg := llm.ModelConfig{
+		ProviderType: llm.ProviderAnthropic, ModelName: "claude-3-5-haiku-latest", CentiCentsPerMillionInputTokens: 8_000,
+		Pricing: &llm.Pricing{BatchDiscount: 0.5},
+	}
+	reqs := make([]llm.InferRequest, 3)
+	for i := range reqs {
+		reqs[i] = llm.InferRequest{
+			ModelConfig:    cfg,
+			Messages:       []llm.InferMessage{{Role: "user", Content: "what is the answer?"}},
+			MessageOptions: llm.MessageOptions{MaxTokens: 100},
+			ResponseFormat: &llm.ResponseFormat{Name: "answer", Schema: map[string]any{"type": "object"}},
+		}
+	}
+
+	p := NewAnthropicProvider("fake-key", transport.WithBaseURL(srv.URL))
+	results, err := batch.NewRunner(p, batch.Config{PollInterval: time.Millisecond}).Run(context.Background(), "test", reqs)
+	require.NoError(t, err)
+
+	require.Len(t, submitted.Requests, 3)
+	assert.Equal(t, "req-0", submitted.Requests[0].CustomID)
+	assert.Equal(t, "claude-3-5-haiku-latest", submitted.Requests[0].Params["model"])
+
+	require.Len(t, results, 3)
+	require.NoError(t, results[0].Err)
+	// the response format tool call is the content
+	assert.Equal(t, `{"answer": "42"}`, results[0].Response.Content)
+	assert.Equal(t, llm.FinishReasonStop, results[0].Response.FinishReason)
+	assert.InDelta(t, 0.4, results[0].Response.Cost, 1e-9)
+	var itemErr *batch.ItemError
+	require.ErrorAs(t, results[1].Err, &itemErr)
+	assert.Equal(t, "too long", itemErr.Message)
+	assert.ErrorIs(t, results[2].Err, batch.ErrNotProcessed)
+
+	t.Run("candidates", func(t *testing.T) {
+		req := reqs[0]
+		req.MessageOptions.Candidates = 2
+		_, err := p.SubmitBatch(context.Background(), batch.Items([]llm.InferRequest{req}))
+		assert.ErrorContains(t, err, "more than one candidate")
+	})
+}
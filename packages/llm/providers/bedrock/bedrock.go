@@ -0,0 +1,139 @@
+// Package bedrock implements llm.Responder and llm.Embedder for models on Amazon Bedrock: chat through the
+// Converse and ConverseStream APIs, and Titan and Cohere embeddings through InvokeModel. Requests are signed
+// with SigV4 here, so the AWS SDK isn't needed.
+package bedrock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/internal/apierr"
+	"github.com/stillmatic/gollum/packages/llm/providers/transport"
+)
+
+// signingName is the service name Bedrock runtime requests are signed for.
+const signingName = "bedrock"
+
+// Credentials are AWS access keys. SessionToken is only set for temporary credentials, e.g. from an assumed role.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// CredentialsFromEnv reads AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+func CredentialsFromEnv() Credentials {
+	return Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// CredentialsFunc returns the credentials to sign a request with. It is called for every request, so it
+// should cache credentials until they expire.
+type CredentialsFunc func(ctx context.Context) (Credentials, error)
+
+type Provider struct {
+	region  string
+	creds   CredentialsFunc
+	baseURL string
+	client  *http.Client
+}
+
+// NewBedrockProvider returns a provider for the Bedrock runtime in region, e.g. us-east-1.
+func NewBedrockProvider(region string, creds Credentials, opts ...transport.Option) *Provider {
+	static := func(context.Context) (Credentials, error) { return creds, nil }
+	return NewBedrockProviderWithCredentialsFunc(region, static, opts...)
+}
+
+// NewBedrockProviderWithCredentialsFunc is like NewBedrockProvider, for credentials which expire.
+func NewBedrockProviderWithCredentialsFunc(region string, creds CredentialsFunc, opts ...transport.Option) *Provider {
+	settings := transport.Apply(opts...)
+	baseURL := settings.BaseURLOr(fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com", region))
+	return &Provider{
+		region:  region,
+		creds:   creds,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  settings.Client(),
+	}
+}
+
+// post signs and sends body as JSON to an operation on the model, e.g. converse, and returns the response,
+// which the caller must close. Responses other than 200 are returned as a classified *apierr.HTTPError.
+func (p *Provider) post(ctx context.Context, modelID, operation string, body any) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	u, err := url.Parse(p.baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	// model IDs have colons, which are escaped like the AWS SDKs do so the path matches the signature
+	basePath := u.EscapedPath()
+	u.Path = strings.TrimRight(u.Path, "/") + "/model/" + modelID + "/" + operation
+	u.RawPath = strings.TrimRight(basePath, "/") + "/model/" + uriEncode(modelID) + "/" + operation
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	creds, err := p.creds(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get AWS credentials: %w", err)
+	}
+	signRequest(httpReq, data, creds, p.region, signingName, time.Now())
+
+	// the zero value is usable too
+	client := p.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, apierr.Classify(llm.ProviderBedrock, &apierr.HTTPError{StatusCode: resp.StatusCode, Body: string(respBody), Header: resp.Header})
+	}
+	return resp, nil
+}
+
+// invoke posts body to the InvokeModel API and decodes the model's response into out.
+func (p *Provider) invoke(ctx context.Context, modelID string, body, out any) error {
+	resp, err := p.post(ctx, modelID, "invoke", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return nil
+}
+
+// sendDelta sends the delta unless the context is done first, returning whether it was sent.
+func sendDelta(ctx context.Context, ch chan<- llm.StreamDelta, delta llm.StreamDelta) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case ch <- delta:
+		return true
+	}
+}
+
+var _ llm.Responder = &Provider{}
+var _ llm.Embedder = &Provider{}
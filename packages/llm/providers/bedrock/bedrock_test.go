@@ -0,0 +1,292 @@
+package bedrock
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/llmtest"
+	"github.com/stillmatic/gollum/packages/llm/providers/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const claudeModel = "anthropic.claude-3-5-haiku-20241022-v1:0"
+
+var testCreds = Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret", SessionToken: "session"}
+
+func newTestProvider(url string) *Provider {
+	return NewBedrockProvider("us-east-1", testCreds, transport.WithBaseURL(url))
+}
+
+// encodeEvent encodes an event stream message with string headers.
+func encodeEvent(headers map[string]string, payload []byte) []byte {
+	var h bytes.Buffer
+	for name, value := range headers {
+		h.WriteByte(byte(len(name)))
+		h.WriteString(name)
+		h.WriteByte(headerTypeString)
+		binary.Write(&h, binary.BigEndian, uint16(len(value)))
+		h.WriteString(value)
+	}
+	totalLen := preludeLen + h.Len() + len(payload) + 4
+	msg := binary.BigEndian.AppendUint32(nil, uint32(totalLen))
+	msg = binary.BigEndian.AppendUint32(msg, uint32(h.Len()))
+	msg = binary.BigEndian.AppendUint32(msg, crc32.ChecksumIEEE(msg))
+	msg = append(msg, h.Bytes()...)
+	msg = append(msg, payload...)
+	return binary.BigEndian.AppendUint32(msg, crc32.ChecksumIEEE(msg))
+}
+
+// serveScenario renders the scenario as a ConverseStream response.
+func serveScenario(s llmtest.Scenario) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.Status != 0 {
+			w.WriteHeader(s.Status)
+			fmt.Fprint(w, `{"message":"internal error"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+		send := func(eventType string, payload any) {
+			headers := map[string]string{":message-type": "event", ":event-type": eventType, ":content-type": "application/json"}
+			w.Write(encodeEvent(headers, []byte(llmtest.MustJSON(payload))))
+			w.(http.Flusher).Flush()
+		}
+
+		send("messageStart", map[string]any{"role": "assistant"})
+		for _, c := range s.Chunks {
+			send("contentBlockDelta", map[string]any{"contentBlockIndex": 0, "delta": map[string]any{"text": c}})
+		}
+		if s.Hang {
+			<-r.Context().Done()
+			return
+		}
+		if s.Fail {
+			event := encodeEvent(map[string]string{":event-type": "contentBlockDelta"}, []byte(`{"delta":{"text":"!"}}`))
+			w.Write(event[:len(event)/2])
+			return
+		}
+		stopReason := "end_turn"
+		for i, tc := range s.ToolCalls {
+			index := i + 1
+			send("contentBlockStart", map[string]any{"contentBlockIndex": index, "start": map[string]any{
+				"toolUse": map[string]any{"toolUseId": tc.ID, "name": tc.Name},
+			}})
+			// tool input arrives as partial JSON
+			half := len(tc.Arguments) / 2
+			for _, part := range []string{tc.Arguments[:half], tc.Arguments[half:]} {
+				send("contentBlockDelta", map[string]any{"contentBlockIndex": index, "delta": map[string]any{
+					"toolUse": map[string]any{"input": part},
+				}})
+			}
+			stopReason = "tool_use"
+		}
+		send("messageStop", map[string]any{"stopReason": stopReason})
+		send("metadata", map[string]any{"usage": map[string]any{
+			"inputTokens":  s.Usage.InputTokens,
+			"outputTokens": s.Usage.OutputTokens,
+			"totalTokens":  s.Usage.TotalTokens(),
+		}})
+	}
+}
+
+func TestStreaming(t *testing.T) {
+	llmtest.TestStreaming(t, func(t *testing.T, s llmtest.Scenario) llm.Responder {
+		srv := httptest.NewServer(serveScenario(s))
+		t.Cleanup(srv.Close)
+		return newTestProvider(srv.URL)
+	})
+}
+
+func TestStreamException(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers := map[string]string{":message-type": "exception", ":exception-type": "throttlingException"}
+		w.Write(encodeEvent(headers, []byte(`{"message":"Too many requests, please wait before trying again."}`)))
+	}))
+	defer srv.Close()
+
+	req := llmtest.Request
+	req.ModelConfig.ModelName = claudeModel
+	ch, err := newTestProvider(srv.URL).GenerateResponseAsync(context.Background(), req)
+	require.NoError(t, err)
+	var last llm.StreamDelta
+	for d := range ch {
+		last = d
+	}
+	assert.ErrorIs(t, last.Err, llm.ErrRateLimited)
+}
+
+func TestInfer(t *testing.T) {
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/model/"+claudeModel+"/converse", r.URL.Path)
+		// the colon in the model ID is escaped, as it is in the signature
+		assert.Equal(t, "/model/anthropic.claude-3-5-haiku-20241022-v1%3A0/converse", r.URL.EscapedPath())
+		auth := r.Header.Get("Authorization")
+		assert.True(t, strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/"), auth)
+		assert.Contains(t, auth, "/us-east-1/bedrock/aws4_request")
+		assert.Equal(t, "session", r.Header.Get("X-Amz-Security-Token"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		fmt.Fprint(w, `{
+			"output": {"message": {"role": "assistant", "content": [
+				{"text": "Checking."},
+				{"toolUse": {"toolUseId": "tooluse_1", "name": "get_weather", "input": {"location": "Paris"}}}
+			]}},
+			"stopReason": "tool_use",
+			"usage": {"inputTokens": 10, "outputTokens": 5, "totalTokens": 15, "cacheReadInputTokens": 4}
+		}`)
+	}))
+	defer srv.Close()
+
+	res, err := newTestProvider(srv.URL).Infer(context.Background(), llm.InferRequest{
+		Messages: []llm.InferMessage{
+			{Role: "system", Content: "Be brief."},
+			{Role: "user", Content: "Weather in Paris and Rome?"},
+			{Role: "assistant", ToolCalls: []llm.ToolCall{
+				{ID: "tooluse_0", Name: "get_weather", Arguments: `{"location":"Rome"}`},
+			}},
+			{Role: "tool", ToolCallID: "tooluse_0", Content: "sunny"},
+		},
+		Tools:          []llm.Tool{{Name: "get_weather", Description: "Get the weather."}},
+		ModelConfig:    llm.ModelConfig{ProviderType: llm.ProviderBedrock, ModelName: claudeModel},
+		MessageOptions: llm.MessageOptions{MaxTokens: 100, TopK: 5},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "Checking.", res.Content)
+	require.Len(t, res.ToolCalls, 1)
+	assert.Equal(t, llm.ToolCall{ID: "tooluse_1", Name: "get_weather", Arguments: `{"location": "Paris"}`}, res.ToolCalls[0])
+	assert.Equal(t, llm.FinishReasonToolCalls, res.FinishReason)
+	assert.Equal(t, 14, res.Usage.InputTokens)
+	assert.Equal(t, 4, res.Usage.CachedInputTokens)
+
+	assert.Equal(t, []any{map[string]any{"text": "Be brief."}}, body["system"])
+	assert.Equal(t, map[string]any{"top_k": float64(5)}, body["additionalModelRequestFields"])
+	msgs := body["messages"].([]any)
+	require.Len(t, msgs, 3)
+	// tool results are sent as user content
+	result := msgs[2].(map[string]any)
+	assert.Equal(t, "user", result["role"])
+	assert.Equal(t, "tooluse_0", result["content"].([]any)[0].(map[string]any)["toolResult"].(map[string]any)["toolUseId"])
+	tools := body["toolConfig"].(map[string]any)["tools"].([]any)
+	assert.Equal(t, "get_weather", tools[0].(map[string]any)["toolSpec"].(map[string]any)["name"])
+}
+
+func TestInferResponseFormat(t *testing.T) {
+	var body struct {
+		ToolConfig toolConfig `json:"toolConfig"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		fmt.Fprint(w, `{
+			"output": {"message": {"role": "assistant", "content": [
+				{"toolUse": {"toolUseId": "tooluse_1", "name": "answer", "input": {"answer": "42"}}}
+			]}},
+			"stopReason": "tool_use",
+			"usage": {"inputTokens": 10, "outputTokens": 5, "totalTokens": 15}
+		}`)
+	}))
+	defer srv.Close()
+
+	res, err := newTestProvider(srv.URL).Infer(context.Background(), llm.InferRequest{
+		Messages:       []llm.InferMessage{{Role: "user", Content: "What is the answer?"}},
+		ResponseFormat: &llm.ResponseFormat{Name: "answer", Schema: map[string]any{"type": "object"}},
+		ModelConfig:    llm.ModelConfig{ProviderType: llm.ProviderBedrock, ModelName: claudeModel},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `{"answer": "42"}`, res.Content)
+	assert.Empty(t, res.ToolCalls)
+	assert.Equal(t, llm.FinishReasonStop, res.FinishReason)
+	require.NotNil(t, body.ToolConfig.ToolChoice)
+	assert.Equal(t, "answer", body.ToolConfig.ToolChoice.Tool.Name)
+}
+
+func TestInferErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"message":"Input is too long for requested model."}`)
+	}))
+	defer srv.Close()
+
+	p := newTestProvider(srv.URL)
+	_, err := p.Infer(context.Background(), llm.InferRequest{
+		Messages:    []llm.InferMessage{{Role: "user", Content: "hello"}},
+		ModelConfig: llm.ModelConfig{ProviderType: llm.ProviderBedrock, ModelName: claudeModel},
+	})
+	assert.ErrorIs(t, err, llm.ErrContextLengthExceeded)
+
+	// top_k is only passed on to Claude models
+	_, err = p.Infer(context.Background(), llm.InferRequest{
+		Messages:       []llm.InferMessage{{Role: "user", Content: "hello"}},
+		ModelConfig:    llm.ModelConfig{ProviderType: llm.ProviderBedrock, ModelName: "meta.llama3-1-8b-instruct-v1:0"},
+		MessageOptions: llm.MessageOptions{TopK: 5},
+	})
+	assert.Error(t, err)
+
+	_, err = p.Infer(context.Background(), llm.InferRequest{
+		Messages:    []llm.InferMessage{{Role: "user", Parts: []llm.Part{llm.ImageURLPart("https://example.com/cat.png")}}},
+		ModelConfig: llm.ModelConfig{ProviderType: llm.ProviderBedrock, ModelName: claudeModel},
+	})
+	var partErr *llm.UnsupportedPartError
+	assert.True(t, errors.As(err, &partErr))
+}
+
+func TestGenerateEmbedding(t *testing.T) {
+	var titanCalls, cohereCalls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		switch r.URL.Path {
+		case "/model/amazon.titan-embed-text-v2:0/invoke":
+			titanCalls++
+			assert.Equal(t, float64(256), body["dimensions"])
+			fmt.Fprintf(w, `{"embedding": [%d, 0.5], "inputTextTokenCount": 2}`, titanCalls)
+		case "/model/cohere.embed-english-v3/invoke":
+			cohereCalls++
+			assert.Equal(t, "search_query", body["input_type"])
+			texts := body["texts"].([]any)
+			embeddings := make([][]float32, len(texts))
+			for i := range texts {
+				embeddings[i] = []float32{float32(i)}
+			}
+			fmt.Fprint(w, llmtest.MustJSON(map[string]any{"embeddings": embeddings}))
+		default:
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+	p := newTestProvider(srv.URL)
+
+	res, err := p.GenerateEmbedding(context.Background(), llm.EmbedRequest{
+		Input:       []string{"hello", "world"},
+		Dimensions:  256,
+		ModelConfig: llm.ModelConfig{ProviderType: llm.ProviderBedrock, ModelName: "amazon.titan-embed-text-v2:0"},
+	})
+	require.NoError(t, err)
+	require.Len(t, res.Data, 2)
+	assert.Equal(t, []float32{2, 0.5}, res.Data[1].Values)
+
+	// more inputs than fit in one Cohere request
+	input := make([]string, cohereMaxBatchSize+1)
+	for i := range input {
+		input[i] = fmt.Sprintf("text %d", i)
+	}
+	res, err = p.GenerateEmbedding(context.Background(), llm.EmbedRequest{
+		Input:       input,
+		Prompt:      "search_query",
+		ModelConfig: llm.ModelConfig{ProviderType: llm.ProviderBedrock, ModelName: "cohere.embed-english-v3"},
+	})
+	require.NoError(t, err)
+	assert.Len(t, res.Data, len(input))
+	assert.Equal(t, 2, cohereCalls)
+	assert.Equal(t, []float32{0}, res.Data[cohereMaxBatchSize].Values)
+}
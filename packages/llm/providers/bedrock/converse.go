@@ -0,0 +1,552 @@
+package bedrock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/internal/apierr"
+)
+
+type converseInput struct {
+	Messages        []bedrockMessage `json:"messages"`
+	System          []bedrockContent `json:"system,omitempty"`
+	InferenceConfig inferenceConfig  `json:"inferenceConfig"`
+	ToolConfig      *toolConfig      `json:"toolConfig,omitempty"`
+	// AdditionalModelRequestFields are passed to the model as they are, e.g. top_k for Claude.
+	AdditionalModelRequestFields map[string]any `json:"additionalModelRequestFields,omitempty"`
+}
+
+type bedrockMessage struct {
+	Role    string           `json:"role"`
+	Content []bedrockContent `json:"content"`
+}
+
+// bedrockContent is a content block, only one of its fields is set.
+type bedrockContent struct {
+	Text       string             `json:"text,omitempty"`
+	Image      *bedrockMedia      `json:"image,omitempty"`
+	Document   *bedrockMedia      `json:"document,omitempty"`
+	ToolUse    *bedrockToolUse    `json:"toolUse,omitempty"`
+	ToolResult *bedrockToolResult `json:"toolResult,omitempty"`
+}
+
+type bedrockMedia struct {
+	Format string `json:"format"`
+	// Name is required for documents.
+	Name   string `json:"name,omitempty"`
+	Source struct {
+		Bytes []byte `json:"bytes"`
+	} `json:"source"`
+}
+
+type bedrockToolUse struct {
+	ToolUseID string          `json:"toolUseId"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input"`
+}
+
+type bedrockToolResult struct {
+	ToolUseID string           `json:"toolUseId"`
+	Content   []bedrockContent `json:"content"`
+}
+
+type inferenceConfig struct {
+	MaxTokens     int      `json:"maxTokens,omitempty"`
+	Temperature   *float32 `json:"temperature,omitempty"`
+	TopP          *float32 `json:"topP,omitempty"`
+	StopSequences []string `json:"stopSequences,omitempty"`
+}
+
+type toolConfig struct {
+	Tools      []bedrockTool `json:"tools"`
+	ToolChoice *toolChoice   `json:"toolChoice,omitempty"`
+}
+
+type bedrockTool struct {
+	ToolSpec struct {
+		Name        string `json:"name"`
+		Description string `json:"description,omitempty"`
+		InputSchema struct {
+			JSON any `json:"json"`
+		} `json:"inputSchema"`
+	} `json:"toolSpec"`
+}
+
+// toolChoice has one of its fields set. Bedrock has no way to disable tools other than leaving them out.
+type toolChoice struct {
+	Auto *struct{} `json:"auto,omitempty"`
+	Any  *struct{} `json:"any,omitempty"`
+	Tool *struct {
+		Name string `json:"name"`
+	} `json:"tool,omitempty"`
+}
+
+type bedrockUsage struct {
+	InputTokens           int `json:"inputTokens"`
+	OutputTokens          int `json:"outputTokens"`
+	CacheReadInputTokens  int `json:"cacheReadInputTokens"`
+	CacheWriteInputTokens int `json:"cacheWriteInputTokens"`
+}
+
+type converseOutput struct {
+	Output struct {
+		Message bedrockMessage `json:"message"`
+	} `json:"output"`
+	StopReason string       `json:"stopReason"`
+	Usage      bedrockUsage `json:"usage"`
+}
+
+// isClaude reports whether the model is an Anthropic model, including cross-region inference profiles like
+// us.anthropic.claude-3-5-haiku-20241022-v1:0.
+func isClaude(model string) bool {
+	return strings.Contains(model, "anthropic.")
+}
+
+func newTool(name, description string, schema any) bedrockTool {
+	var t bedrockTool
+	t.ToolSpec.Name = name
+	t.ToolSpec.Description = description
+	// the input schema is required, even for tools without arguments
+	if schema == nil {
+		schema = map[string]any{"type": "object"}
+	}
+	t.ToolSpec.InputSchema.JSON = schema
+	return t
+}
+
+func toolChoiceFor(name string) *toolChoice {
+	tc := &toolChoice{Tool: &struct {
+		Name string `json:"name"`
+	}{Name: name}}
+	return tc
+}
+
+func converseRequest(req llm.InferRequest) (converseInput, error) {
+	opts := req.MessageOptions
+	model := req.ModelConfig.ModelName
+	// candidates are emulated by Infer
+	supported := []llm.Option{llm.OptionTopP, llm.OptionStopSequences, llm.OptionCandidates}
+	if isClaude(model) {
+		supported = append(supported, llm.OptionTopK)
+	}
+	if err := opts.Check(model, supported...); err != nil {
+		return converseInput{}, err
+	}
+	msgs, system, err := messagesToBedrock(req)
+	if err != nil {
+		return converseInput{}, fmt.Errorf("invalid messages: %w", err)
+	}
+
+	in := converseInput{
+		Messages: msgs,
+		System:   system,
+		InferenceConfig: inferenceConfig{
+			MaxTokens:     opts.MaxTokens,
+			Temperature:   &opts.Temperature,
+			StopSequences: opts.StopSequences,
+		},
+	}
+	if opts.TopP != 0 {
+		in.InferenceConfig.TopP = &opts.TopP
+	}
+	if opts.TopK != 0 {
+		in.AdditionalModelRequestFields = map[string]any{"top_k": opts.TopK}
+	}
+
+	var tools []bedrockTool
+	for _, t := range req.Tools {
+		tools = append(tools, newTool(t.Name, t.Description, t.Parameters))
+	}
+	var choice *toolChoice
+	if tc := req.ToolChoice; tc != nil {
+		switch tc.Type {
+		case llm.ToolChoiceNone:
+			tools = nil
+		case llm.ToolChoiceRequired:
+			choice = &toolChoice{Any: &struct{}{}}
+		case llm.ToolChoiceTool:
+			choice = toolChoiceFor(tc.Name)
+		default:
+			choice = &toolChoice{Auto: &struct{}{}}
+		}
+	}
+	// Converse has no JSON mode, so we force a call to a tool whose input schema is the response format
+	if rf := req.ResponseFormat; rf != nil {
+		if req.ToolChoice != nil {
+			return converseInput{}, errors.New("response format can't be combined with a tool choice")
+		}
+		description := rf.Description
+		if description == "" {
+			description = "Respond with JSON matching the schema."
+		}
+		tools = append(tools, newTool(rf.Name, description, rf.Schema))
+		choice = toolChoiceFor(rf.Name)
+	}
+	if len(tools) > 0 {
+		in.ToolConfig = &toolConfig{Tools: tools, ToolChoice: choice}
+	}
+	return in, nil
+}
+
+func messagesToBedrock(req llm.InferRequest) ([]bedrockMessage, []bedrockContent, error) {
+	model := req.ModelConfig.ModelName
+	var msgs []bedrockMessage
+	var system []bedrockContent
+	documents := 0
+	for _, m := range req.Messages {
+		switch m.Role {
+		case "system":
+			for _, part := range m.ContentParts() {
+				if part.Type != llm.PartTypeText {
+					return nil, nil, &llm.UnsupportedPartError{Type: part.Type, Model: model}
+				}
+				system = append(system, bedrockContent{Text: part.Text})
+			}
+			continue
+		case "tool":
+			// tool results are sent as user content. consecutive results must share a single user turn.
+			result := bedrockContent{ToolResult: &bedrockToolResult{
+				ToolUseID: m.ToolCallID,
+				Content:   []bedrockContent{{Text: m.Content}},
+			}}
+			if n := len(msgs); n > 0 && msgs[n-1].Role == "user" && isToolResults(msgs[n-1]) {
+				msgs[n-1].Content = append(msgs[n-1].Content, result)
+			} else {
+				msgs = append(msgs, bedrockMessage{Role: "user", Content: []bedrockContent{result}})
+			}
+			continue
+		case "user", "assistant":
+		default:
+			return nil, nil, fmt.Errorf("invalid role %q", m.Role)
+		}
+
+		msg := bedrockMessage{Role: m.Role}
+		for _, part := range m.ContentParts() {
+			c, err := partToBedrock(part, model, &documents)
+			if err != nil {
+				return nil, nil, err
+			}
+			msg.Content = append(msg.Content, c)
+		}
+		for _, tc := range m.ToolCalls {
+			args := tc.Arguments
+			if args == "" {
+				args = "{}"
+			}
+			msg.Content = append(msg.Content, bedrockContent{ToolUse: &bedrockToolUse{
+				ToolUseID: tc.ID,
+				Name:      tc.Name,
+				Input:     json.RawMessage(args),
+			}})
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, system, nil
+}
+
+func isToolResults(m bedrockMessage) bool {
+	for _, c := range m.Content {
+		if c.ToolResult == nil {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	imageFormats = map[string]string{
+		"image/png":  "png",
+		"image/jpeg": "jpeg",
+		"image/gif":  "gif",
+		"image/webp": "webp",
+	}
+	documentFormats = map[string]string{
+		"application/pdf":    "pdf",
+		"text/csv":           "csv",
+		"text/html":          "html",
+		"text/plain":         "txt",
+		"text/markdown":      "md",
+		"application/msword": "doc",
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document": "docx",
+		"application/vnd.ms-excel": "xls",
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": "xlsx",
+	}
+)
+
+// partToBedrock converts a part, naming documents in order since Bedrock requires unique document names.
+func partToBedrock(part llm.Part, model string, documents *int) (bedrockContent, error) {
+	switch part.Type {
+	case llm.PartTypeText:
+		return bedrockContent{Text: part.Text}, nil
+	case llm.PartTypeImage:
+		if format, ok := imageFormats[part.MIMEType]; ok {
+			media := &bedrockMedia{Format: format}
+			media.Source.Bytes = part.Data
+			return bedrockContent{Image: media}, nil
+		}
+	case llm.PartTypeDocument:
+		if format, ok := documentFormats[part.MIMEType]; ok {
+			*documents++
+			media := &bedrockMedia{Format: format, Name: fmt.Sprintf("document-%d", *documents)}
+			media.Source.Bytes = part.Data
+			return bedrockContent{Document: media}, nil
+		}
+	}
+	// Converse only takes inline images, and no audio
+	return bedrockContent{}, &llm.UnsupportedPartError{Type: part.Type, MIMEType: part.MIMEType, Model: model}
+}
+
+func (p *Provider) GenerateResponse(ctx context.Context, req llm.InferRequest) (string, error) {
+	res, err := p.Infer(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	return res.Content, nil
+}
+
+// Infer generates a response. Converse can't generate several candidates in one call, so they are generated
+// by parallel calls.
+func (p *Provider) Infer(ctx context.Context, req llm.InferRequest) (*llm.InferResponse, error) {
+	if err := llm.ValidateRequest(req, false); err != nil {
+		return nil, err
+	}
+	return llm.InferParallel(ctx, req, p.infer)
+}
+
+func (p *Provider) infer(ctx context.Context, req llm.InferRequest) (*llm.InferResponse, error) {
+	in, err := converseRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.post(ctx, req.ModelConfig.ModelName, "converse", in)
+	if err != nil {
+		return nil, fmt.Errorf("bedrock converse error: %w", err)
+	}
+	defer resp.Body.Close()
+	var out converseOutput
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return responseFromBedrock(req, out), nil
+}
+
+func responseFromBedrock(req llm.InferRequest, out converseOutput) *llm.InferResponse {
+	resp := &llm.InferResponse{Model: req.ModelConfig.ModelName}
+	var text strings.Builder
+	for _, c := range out.Output.Message.Content {
+		switch {
+		case c.ToolUse != nil && req.ResponseFormat != nil && c.ToolUse.Name == req.ResponseFormat.Name:
+			text.Write(c.ToolUse.Input)
+		case c.ToolUse != nil:
+			resp.ToolCalls = append(resp.ToolCalls, llm.ToolCall{
+				ID:        c.ToolUse.ToolUseID,
+				Name:      c.ToolUse.Name,
+				Arguments: string(c.ToolUse.Input),
+			})
+		default:
+			text.WriteString(c.Text)
+		}
+	}
+	resp.Content = text.String()
+	resp.FinishReason = finishReasonFromBedrock(out.StopReason)
+	if len(resp.ToolCalls) > 0 {
+		resp.FinishReason = llm.FinishReasonToolCalls
+	} else if req.ResponseFormat != nil && resp.FinishReason == llm.FinishReasonToolCalls {
+		// the only call was to the response format tool
+		resp.FinishReason = llm.FinishReasonStop
+	}
+	resp.Usage = usageFromBedrock(out.Usage)
+	resp.Cost = llm.Cost(req.ModelConfig, resp.Usage)
+	return resp
+}
+
+func finishReasonFromBedrock(stopReason string) llm.FinishReason {
+	switch stopReason {
+	case "end_turn", "stop_sequence":
+		return llm.FinishReasonStop
+	case "max_tokens":
+		return llm.FinishReasonLength
+	case "tool_use":
+		return llm.FinishReasonToolCalls
+	case "guardrail_intervened", "content_filtered":
+		return llm.FinishReasonContentFilter
+	default:
+		return llm.FinishReasonOther
+	}
+}
+
+// usageFromBedrock normalizes usage, Bedrock reports cached tokens separately from input tokens.
+func usageFromBedrock(u bedrockUsage) llm.Usage {
+	return llm.Usage{
+		InputTokens:              u.InputTokens + u.CacheReadInputTokens + u.CacheWriteInputTokens,
+		OutputTokens:             u.OutputTokens,
+		CachedInputTokens:        u.CacheReadInputTokens,
+		CacheCreationInputTokens: u.CacheWriteInputTokens,
+	}
+}
+
+// GenerateResponseAsync streams the response with ConverseStream.
+func (p *Provider) GenerateResponseAsync(ctx context.Context, req llm.InferRequest) (<-chan llm.StreamDelta, error) {
+	if err := llm.ValidateRequest(req, true); err != nil {
+		return nil, err
+	}
+	outChan := make(chan llm.StreamDelta)
+	go func() {
+		defer close(outChan)
+		if req.MessageOptions.Candidates > 1 {
+			sendDelta(ctx, outChan, llm.StreamDelta{Err: llm.ErrStreamingCandidates})
+			return
+		}
+		resp, err := p.stream(ctx, req, func(text string) bool {
+			return sendDelta(ctx, outChan, llm.StreamDelta{Text: text})
+		})
+		if err != nil {
+			sendDelta(ctx, outChan, llm.StreamDelta{Err: err})
+			return
+		}
+		sendDelta(ctx, outChan, llm.StreamDelta{
+			EOF:          true,
+			ToolCalls:    resp.ToolCalls,
+			FinishReason: resp.FinishReason,
+			Model:        resp.Model,
+			Usage:        resp.Usage,
+			Cost:         resp.Cost,
+		})
+	}()
+	return outChan, nil
+}
+
+// streamEvent is the payload of any ConverseStream event, only the fields of its type are set.
+type streamEvent struct {
+	ContentBlockIndex int `json:"contentBlockIndex"`
+	Start             *struct {
+		ToolUse *bedrockToolUse `json:"toolUse"`
+	} `json:"start"`
+	Delta *struct {
+		Text    string `json:"text"`
+		ToolUse *struct {
+			Input string `json:"input"`
+		} `json:"toolUse"`
+	} `json:"delta"`
+	StopReason string        `json:"stopReason"`
+	Usage      *bedrockUsage `json:"usage"`
+	Message    string        `json:"message"`
+}
+
+// streamExceptionStatus maps the exceptions sent in a stream to the status codes they have as responses.
+var streamExceptionStatus = map[string]int{
+	"throttlingException":         429,
+	"validationException":         400,
+	"modelTimeoutException":       408,
+	"modelStreamErrorException":   424,
+	"internalServerException":     500,
+	"serviceUnavailableException": 503,
+}
+
+// stream calls onText with each chunk of text, stopping early if it returns false, and returns the full response.
+// The input of calls to the response format tool is streamed as text too.
+func (p *Provider) stream(ctx context.Context, req llm.InferRequest, onText func(string) bool) (*llm.InferResponse, error) {
+	in, err := converseRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	httpResp, err := p.post(ctx, req.ModelConfig.ModelName, "converse-stream", in)
+	if err != nil {
+		return nil, fmt.Errorf("bedrock converse stream error: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	// blocks are built up by index, tool inputs arrive as partial JSON
+	blocks := make(map[int]*bedrockContent)
+	inputs := make(map[int]*strings.Builder)
+	block := func(i int) *bedrockContent {
+		if blocks[i] == nil {
+			blocks[i] = &bedrockContent{}
+		}
+		return blocks[i]
+	}
+	var out converseOutput
+	stopped := false
+	events := newEventReader(httpResp.Body)
+	for {
+		msg, err := events.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var event streamEvent
+		if err := json.Unmarshal(msg.Payload, &event); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal stream event: %w", err)
+		}
+		if msg.Headers[":message-type"] == "exception" {
+			exception := msg.Headers[":exception-type"]
+			status, ok := streamExceptionStatus[exception]
+			if !ok {
+				return nil, fmt.Errorf("bedrock stream %s: %s", exception, event.Message)
+			}
+			return nil, apierr.Classify(llm.ProviderBedrock, &apierr.HTTPError{StatusCode: status, Body: string(msg.Payload)})
+		}
+
+		switch msg.Headers[":event-type"] {
+		case "contentBlockStart":
+			if event.Start != nil && event.Start.ToolUse != nil {
+				block(event.ContentBlockIndex).ToolUse = event.Start.ToolUse
+				inputs[event.ContentBlockIndex] = &strings.Builder{}
+			}
+		case "contentBlockDelta":
+			if event.Delta == nil {
+				continue
+			}
+			b := block(event.ContentBlockIndex)
+			chunk := event.Delta.Text
+			if event.Delta.ToolUse != nil && b.ToolUse != nil {
+				inputs[event.ContentBlockIndex].WriteString(event.Delta.ToolUse.Input)
+				chunk = ""
+				if req.ResponseFormat != nil && b.ToolUse.Name == req.ResponseFormat.Name {
+					chunk = event.Delta.ToolUse.Input
+				}
+			} else {
+				b.Text += chunk
+			}
+			if chunk != "" && !onText(chunk) {
+				return nil, ctx.Err()
+			}
+		case "messageStop":
+			out.StopReason = event.StopReason
+			stopped = true
+		case "metadata":
+			if event.Usage != nil {
+				out.Usage = *event.Usage
+			}
+		}
+	}
+	if !stopped {
+		return nil, errors.New("bedrock stream ended unexpectedly")
+	}
+
+	indices := make([]int, 0, len(blocks))
+	for i := range blocks {
+		indices = append(indices, i)
+	}
+	slices.Sort(indices)
+	for _, i := range indices {
+		b := *blocks[i]
+		if b.ToolUse != nil {
+			input := inputs[i].String()
+			if input == "" {
+				input = "{}"
+			}
+			b.ToolUse.Input = json.RawMessage(input)
+		}
+		out.Output.Message.Content = append(out.Output.Message.Content, b)
+	}
+	return responseFromBedrock(req, out), nil
+}
@@ -0,0 +1,95 @@
+package bedrock
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/stillmatic/gollum/packages/llm"
+)
+
+// cohereMaxBatchSize is the most texts Cohere embedding models take in one request.
+const cohereMaxBatchSize = 96
+
+// cohereInputTypes are the input types Cohere embeddings accept, which can be given as the request's Prompt.
+var cohereInputTypes = map[string]bool{
+	"search_document": true,
+	"search_query":    true,
+	"classification":  true,
+	"clustering":      true,
+}
+
+type titanEmbedRequest struct {
+	InputText  string `json:"inputText"`
+	Dimensions int    `json:"dimensions,omitempty"`
+}
+
+type titanEmbedResponse struct {
+	Embedding []float32 `json:"embedding"`
+}
+
+type cohereEmbedRequest struct {
+	Texts     []string `json:"texts"`
+	InputType string   `json:"input_type"`
+}
+
+type cohereEmbedResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+// GenerateEmbedding embeds text with Titan or Cohere models through InvokeModel. Titan models take one input per
+// request, so they are embedded one by one. For Cohere models, Prompt may be an input type like search_query,
+// it defaults to search_document.
+func (p *Provider) GenerateEmbedding(ctx context.Context, req llm.EmbedRequest) (*llm.EmbeddingResponse, error) {
+	if len(req.Image) > 0 {
+		return nil, fmt.Errorf("image embedding not supported by Bedrock")
+	}
+	model := req.ModelConfig.ModelName
+	switch {
+	case strings.Contains(model, "amazon.titan-embed"):
+		return p.embedTitan(ctx, model, req)
+	case strings.Contains(model, "cohere.embed"):
+		return p.embedCohere(ctx, model, req)
+	default:
+		return nil, fmt.Errorf("unsupported Bedrock embedding model %s", model)
+	}
+}
+
+func (p *Provider) embedTitan(ctx context.Context, model string, req llm.EmbedRequest) (*llm.EmbeddingResponse, error) {
+	data := make([]llm.Embedding, 0, len(req.Input))
+	for _, input := range req.Input {
+		var out titanEmbedResponse
+		err := p.invoke(ctx, model, titanEmbedRequest{InputText: input, Dimensions: req.Dimensions}, &out)
+		if err != nil {
+			return nil, fmt.Errorf("bedrock embedding error: %w", err)
+		}
+		data = append(data, llm.Embedding{Values: out.Embedding})
+	}
+	return &llm.EmbeddingResponse{Data: data}, nil
+}
+
+func (p *Provider) embedCohere(ctx context.Context, model string, req llm.EmbedRequest) (*llm.EmbeddingResponse, error) {
+	if req.Dimensions != 0 {
+		return nil, fmt.Errorf("custom dimensions not supported by Cohere embeddings")
+	}
+	inputType := "search_document"
+	if cohereInputTypes[req.Prompt] {
+		inputType = req.Prompt
+	}
+	data := make([]llm.Embedding, 0, len(req.Input))
+	for start := 0; start < len(req.Input); start += cohereMaxBatchSize {
+		end := min(start+cohereMaxBatchSize, len(req.Input))
+		var out cohereEmbedResponse
+		err := p.invoke(ctx, model, cohereEmbedRequest{Texts: req.Input[start:end], InputType: inputType}, &out)
+		if err != nil {
+			return nil, fmt.Errorf("bedrock embedding error: %w", err)
+		}
+		if len(out.Embeddings) != end-start {
+			return nil, fmt.Errorf("expected %d embeddings, got %d", end-start, len(out.Embeddings))
+		}
+		for _, values := range out.Embeddings {
+			data = append(data, llm.Embedding{Values: values})
+		}
+	}
+	return &llm.EmbeddingResponse{Data: data}, nil
+}
@@ -0,0 +1,93 @@
+package bedrock
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// ConverseStream responses use the AWS event stream encoding: binary messages, each a prelude with the lengths,
+// headers and a payload, checksummed with CRC32.
+// See https://docs.aws.amazon.com/transcribe/latest/dg/streaming-setting-up.html#streaming-event-stream.
+
+const (
+	preludeLen = 12
+	// maxMessageLen is the limit set by the encoding.
+	maxMessageLen = 16 * 1024 * 1024
+	// headerTypeString is the only header value type Bedrock sends.
+	headerTypeString = 7
+)
+
+// eventMessage is a decoded event stream message.
+type eventMessage struct {
+	Headers map[string]string
+	Payload []byte
+}
+
+type eventReader struct {
+	r *bufio.Reader
+}
+
+func newEventReader(r io.Reader) *eventReader {
+	return &eventReader{r: bufio.NewReader(r)}
+}
+
+// Read returns the next message, or io.EOF if the stream ended cleanly between messages.
+func (e *eventReader) Read() (eventMessage, error) {
+	prelude := make([]byte, preludeLen)
+	if _, err := io.ReadFull(e.r, prelude); err != nil {
+		if errors.Is(err, io.EOF) {
+			return eventMessage{}, io.EOF
+		}
+		return eventMessage{}, fmt.Errorf("failed to read event prelude: %w", err)
+	}
+	totalLen := binary.BigEndian.Uint32(prelude[0:4])
+	headersLen := binary.BigEndian.Uint32(prelude[4:8])
+	if crc32.ChecksumIEEE(prelude[:8]) != binary.BigEndian.Uint32(prelude[8:12]) {
+		return eventMessage{}, errors.New("event prelude checksum mismatch")
+	}
+	if totalLen > maxMessageLen || totalLen < preludeLen+headersLen+4 {
+		return eventMessage{}, fmt.Errorf("invalid event length %d", totalLen)
+	}
+
+	msg := make([]byte, totalLen)
+	copy(msg, prelude)
+	if _, err := io.ReadFull(e.r, msg[preludeLen:]); err != nil {
+		return eventMessage{}, fmt.Errorf("failed to read event: %w", err)
+	}
+	if crc32.ChecksumIEEE(msg[:totalLen-4]) != binary.BigEndian.Uint32(msg[totalLen-4:]) {
+		return eventMessage{}, errors.New("event checksum mismatch")
+	}
+
+	headers, err := parseEventHeaders(msg[preludeLen : preludeLen+headersLen])
+	if err != nil {
+		return eventMessage{}, err
+	}
+	return eventMessage{Headers: headers, Payload: msg[preludeLen+headersLen : totalLen-4]}, nil
+}
+
+// parseEventHeaders reads the string headers. Other value types are rejected, since their lengths differ.
+func parseEventHeaders(b []byte) (map[string]string, error) {
+	headers := make(map[string]string)
+	for len(b) > 0 {
+		nameLen := int(b[0])
+		if len(b) < 1+nameLen+3 {
+			return nil, errors.New("truncated event header")
+		}
+		name := string(b[1 : 1+nameLen])
+		b = b[1+nameLen:]
+		if b[0] != headerTypeString {
+			return nil, fmt.Errorf("unsupported type %d for event header %s", b[0], name)
+		}
+		valueLen := int(binary.BigEndian.Uint16(b[1:3]))
+		if len(b) < 3+valueLen {
+			return nil, errors.New("truncated event header")
+		}
+		headers[name] = string(b[3 : 3+valueLen])
+		b = b[3+valueLen:]
+	}
+	return headers, nil
+}
@@ -0,0 +1,150 @@
+// Package budget enforces spending limits per key, using the pricing in each request's ModelConfig.
+package budget
+
+import (
+	"context"
+
+	"github.com/stillmatic/gollum/packages/llm"
+)
+
+// DefaultKey is charged for requests whose context has no key.
+const DefaultKey = "default"
+
+type keyCtxKey struct{}
+
+// WithKey returns a context whose requests are charged to key, e.g. a user, job or tenant ID.
+func WithKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, keyCtxKey{}, key)
+}
+
+// KeyFromContext returns the key requests with this context are charged to.
+func KeyFromContext(ctx context.Context) string {
+	if key, ok := ctx.Value(keyCtxKey{}).(string); ok {
+		return key
+	}
+	return DefaultKey
+}
+
+// Responder implements llm.Responder, charging each request to the key in its context.
+// Before a request is sent, its worst case cost is estimated from the input and MaxTokens,
+// and the request is refused with an *ExceededError if that could take the key over its limit.
+type Responder struct {
+	underlying llm.Responder
+	ledger     *Ledger
+}
+
+func NewBudgetResponder(underlying llm.Responder, ledger *Ledger) *Responder {
+	return &Responder{
+		underlying: underlying,
+		ledger:     ledger,
+	}
+}
+
+func (r *Responder) GenerateResponse(ctx context.Context, req llm.InferRequest) (string, error) {
+	res, err := r.Infer(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	return res.Content, nil
+}
+
+func (r *Responder) Infer(ctx context.Context, req llm.InferRequest) (*llm.InferResponse, error) {
+	key := KeyFromContext(ctx)
+	estimated := llm.Cost(req.ModelConfig, llm.EstimateUsage(req))
+	if err := r.ledger.reserve(key, estimated); err != nil {
+		return nil, err
+	}
+	res, err := r.underlying.Infer(ctx, req)
+	if err != nil {
+		r.ledger.release(key, estimated)
+		return nil, err
+	}
+	r.ledger.settle(key, estimated, cost(req.ModelConfig, res.Cost, res.Usage), res.Usage)
+	return res, nil
+}
+
+func (r *Responder) GenerateResponseAsync(ctx context.Context, req llm.InferRequest) (<-chan llm.StreamDelta, error) {
+	key := KeyFromContext(ctx)
+	estimated := llm.Cost(req.ModelConfig, llm.EstimateUsage(req))
+	if err := r.ledger.reserve(key, estimated); err != nil {
+		return nil, err
+	}
+	ch, err := r.underlying.GenerateResponseAsync(ctx, req)
+	if err != nil {
+		r.ledger.release(key, estimated)
+		return nil, err
+	}
+
+	outChan := make(chan llm.StreamDelta)
+	go func() {
+		defer close(outChan)
+		settled, emitted := false, false
+		defer func() {
+			if settled {
+				return
+			}
+			// streams which fail part way or are abandoned have no usage, charge the estimate to be safe
+			if emitted {
+				r.ledger.settle(key, estimated, estimated, llm.Usage{})
+			} else {
+				r.ledger.release(key, estimated)
+			}
+		}()
+		for delta := range ch {
+			if delta.EOF {
+				r.ledger.settle(key, estimated, cost(req.ModelConfig, delta.Cost, delta.Usage), delta.Usage)
+				settled = true
+			}
+			if delta.Text != "" {
+				emitted = true
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case outChan <- delta:
+			}
+		}
+	}()
+	return outChan, nil
+}
+
+// cost prefers the cost reported with the response, and falls back to computing it from usage.
+func cost(cfg llm.ModelConfig, reported float64, usage llm.Usage) float64 {
+	if reported > 0 {
+		return reported
+	}
+	return llm.Cost(cfg, usage)
+}
+
+// Embedder implements llm.Embedder, charging each request to the key in its context.
+// Embedding responses don't report usage, so they are charged the estimated cost.
+type Embedder struct {
+	underlying llm.Embedder
+	ledger     *Ledger
+}
+
+func NewBudgetEmbedder(underlying llm.Embedder, ledger *Ledger) *Embedder {
+	return &Embedder{
+		underlying: underlying,
+		ledger:     ledger,
+	}
+}
+
+func (e *Embedder) GenerateEmbedding(ctx context.Context, req llm.EmbedRequest) (*llm.EmbeddingResponse, error) {
+	key := KeyFromContext(ctx)
+	usage := llm.EstimateEmbeddingUsage(req)
+	estimated := llm.Cost(req.ModelConfig, usage)
+	if err := e.ledger.reserve(key, estimated); err != nil {
+		return nil, err
+	}
+	res, err := e.underlying.GenerateEmbedding(ctx, req)
+	if err != nil {
+		e.ledger.release(key, estimated)
+		return nil, err
+	}
+	e.ledger.settle(key, estimated, estimated, usage)
+	return res, nil
+}
+
+var _ llm.Responder = &Responder{}
+var _ llm.Embedder = &Embedder{}
@@ -0,0 +1,127 @@
+package budget_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	mock_llm "github.com/stillmatic/gollum/packages/llm/internal/mocks"
+	"github.com/stillmatic/gollum/packages/llm/providers/budget"
+	_ "github.com/stillmatic/gollum/packages/llm/tokenizer/bpe"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+// $1 per million tokens in, $2 per million out
+var cfg = llm.ModelConfig{
+	ProviderType:                     llm.ProviderOpenAI,
+	ModelName:                        "o1",
+	CentiCentsPerMillionInputTokens:  10_000,
+	CentiCentsPerMillionOutputTokens: 20_000,
+}
+
+func TestBudgetResponder(t *testing.T) {
+	req := llm.InferRequest{
+		Messages:       []llm.InferMessage{{Role: "user", Content: "hello"}},
+		ModelConfig:    cfg,
+		MessageOptions: llm.MessageOptions{MaxTokens: 100_000},
+	}
+	usage := llm.Usage{InputTokens: 100_000, OutputTokens: 50_000}
+
+	t.Run("charges keys and refuses once over the limit", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		underlying := mock_llm.NewMockResponder(ctrl)
+		ledger := budget.NewLedger()
+		ledger.SetLimit("alice", 0.5)
+		r := budget.NewBudgetResponder(underlying, ledger)
+		alice := budget.WithKey(context.Background(), "alice")
+
+		underlying.EXPECT().Infer(alice, req).Return(&llm.InferResponse{Usage: usage}, nil).Times(2)
+		for range 2 {
+			_, err := r.Infer(alice, req)
+			assert.NoError(t, err)
+		}
+		account := ledger.Account("alice")
+		assert.InDelta(t, 0.4, account.Spent, 1e-9)
+		assert.Equal(t, 2, account.Requests)
+		assert.Equal(t, 200_000, account.InputTokens)
+
+		// the next request could cost up to $0.2
+		_, err := r.GenerateResponse(alice, req)
+		assert.ErrorIs(t, err, budget.ErrBudgetExceeded)
+		var exceeded *budget.ExceededError
+		assert.ErrorAs(t, err, &exceeded)
+		assert.Equal(t, "alice", exceeded.Key)
+
+		// other keys are unaffected
+		underlying.EXPECT().Infer(gomock.Any(), req).Return(&llm.InferResponse{Usage: usage}, nil)
+		_, err = r.Infer(context.Background(), req)
+		assert.NoError(t, err)
+		assert.InDelta(t, 0.2, ledger.Account(budget.DefaultKey).Spent, 1e-9)
+	})
+
+	t.Run("failed requests are not charged", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		underlying := mock_llm.NewMockResponder(ctrl)
+		ledger := budget.NewLedger()
+		ledger.SetLimit(budget.DefaultKey, 0.3)
+		r := budget.NewBudgetResponder(underlying, ledger)
+
+		underlying.EXPECT().Infer(gomock.Any(), req).Return(nil, errors.New("boom"))
+		underlying.EXPECT().Infer(gomock.Any(), req).Return(&llm.InferResponse{Usage: usage}, nil)
+		_, err := r.Infer(context.Background(), req)
+		assert.Error(t, err)
+		_, err = r.Infer(context.Background(), req)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, ledger.Account(budget.DefaultKey).Requests)
+	})
+
+	t.Run("streams are charged on EOF", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		underlying := mock_llm.NewMockResponder(ctrl)
+		ledger := budget.NewLedger()
+		r := budget.NewBudgetResponder(underlying, ledger)
+
+		ch := make(chan llm.StreamDelta, 2)
+		ch <- llm.StreamDelta{Text: "hi"}
+		ch <- llm.StreamDelta{EOF: true, Usage: usage, Cost: 0.25}
+		close(ch)
+		underlying.EXPECT().GenerateResponseAsync(gomock.Any(), req).Return(ch, nil)
+
+		out, err := r.GenerateResponseAsync(context.Background(), req)
+		assert.NoError(t, err)
+		for range out {
+		}
+		assert.InDelta(t, 0.25, ledger.Account(budget.DefaultKey).Spent, 1e-9)
+	})
+}
+
+func TestBudgetEmbedder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	underlying := mock_llm.NewMockEmbedder(ctrl)
+	ledger := budget.NewLedger()
+	e := budget.NewBudgetEmbedder(underlying, ledger)
+	req := llm.EmbedRequest{Input: []string{"hello world"}, ModelConfig: cfg}
+
+	underlying.EXPECT().GenerateEmbedding(gomock.Any(), req).Return(&llm.EmbeddingResponse{}, nil)
+	_, err := e.GenerateEmbedding(context.Background(), req)
+	assert.NoError(t, err)
+	account := ledger.Account(budget.DefaultKey)
+	assert.Equal(t, 2, account.InputTokens)
+	assert.InDelta(t, 2e-6, account.Spent, 1e-12)
+}
+
+func TestLedgerPersistence(t *testing.T) {
+	ledger := budget.NewLedger()
+	ledger.SetLimit("alice", 10)
+	ledger.SetLimit("bob", 5)
+
+	var buf bytes.Buffer
+	assert.NoError(t, ledger.Save(&buf))
+	loaded, err := budget.LoadLedger(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, ledger.Accounts(), loaded.Accounts())
+	assert.Equal(t, 10.0, loaded.Account("alice").Limit)
+}
@@ -0,0 +1,144 @@
+package budget
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/stillmatic/gollum/packages/llm"
+)
+
+// ErrBudgetExceeded matches every *ExceededError.
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// ExceededError is returned when a request could take a key's spend over its limit.
+type ExceededError struct {
+	Key string
+	// Limit, Spent and Estimated are in dollars. Spent includes requests which are still in flight.
+	Limit     float64
+	Spent     float64
+	Estimated float64
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("budget exceeded for %q: spent $%.4f of $%.4f, request could cost up to $%.4f",
+		e.Key, e.Spent, e.Limit, e.Estimated)
+}
+
+func (e *ExceededError) Is(target error) bool {
+	return target == ErrBudgetExceeded
+}
+
+// Account is the spend of a single key.
+type Account struct {
+	Key string `json:"key"`
+	// Limit in dollars, 0 means no limit.
+	Limit        float64 `json:"limit,omitempty"`
+	Spent        float64 `json:"spent"`
+	Requests     int     `json:"requests"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+
+	// reserved is the estimated cost of requests in flight
+	reserved float64
+}
+
+// Ledger tracks spend per key, e.g. per user, job or tenant. It is safe for concurrent use.
+type Ledger struct {
+	mu       sync.Mutex
+	accounts map[string]*Account
+}
+
+func NewLedger() *Ledger {
+	return &Ledger{accounts: make(map[string]*Account)}
+}
+
+func (l *Ledger) account(key string) *Account {
+	a, ok := l.accounts[key]
+	if !ok {
+		a = &Account{Key: key}
+		l.accounts[key] = a
+	}
+	return a
+}
+
+// SetLimit sets the most a key may spend in dollars, 0 removes the limit.
+func (l *Ledger) SetLimit(key string, dollars float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.account(key).Limit = dollars
+}
+
+// Account returns a copy of the key's account.
+func (l *Ledger) Account(key string) Account {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if a, ok := l.accounts[key]; ok {
+		return *a
+	}
+	return Account{Key: key}
+}
+
+// Accounts returns a copy of every account, sorted by key.
+func (l *Ledger) Accounts() []Account {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	accounts := make([]Account, 0, len(l.accounts))
+	for _, a := range l.accounts {
+		accounts = append(accounts, *a)
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Key < accounts[j].Key })
+	return accounts
+}
+
+// reserve holds the estimated cost of a request against the key's limit until settle is called.
+func (l *Ledger) reserve(key string, estimated float64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	a := l.account(key)
+	if a.Limit > 0 && a.Spent+a.reserved+estimated > a.Limit {
+		return &ExceededError{Key: key, Limit: a.Limit, Spent: a.Spent + a.reserved, Estimated: estimated}
+	}
+	a.reserved += estimated
+	return nil
+}
+
+// settle replaces a reservation with the actual cost of the request.
+func (l *Ledger) settle(key string, estimated, cost float64, usage llm.Usage) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	a := l.account(key)
+	a.reserved -= estimated
+	a.Spent += cost
+	a.Requests++
+	a.InputTokens += usage.InputTokens
+	a.OutputTokens += usage.OutputTokens
+}
+
+// release drops a reservation for a request which failed.
+func (l *Ledger) release(key string, estimated float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.account(key).reserved -= estimated
+}
+
+// Save writes the accounts as JSON.
+func (l *Ledger) Save(w io.Writer) error {
+	return json.NewEncoder(w).Encode(l.Accounts())
+}
+
+// LoadLedger reads a ledger written by Save.
+func LoadLedger(r io.Reader) (*Ledger, error) {
+	var accounts []Account
+	if err := json.NewDecoder(r).Decode(&accounts); err != nil {
+		return nil, fmt.Errorf("failed to decode ledger: %w", err)
+	}
+	l := NewLedger()
+	for _, a := range accounts {
+		l.accounts[a.Key] = &a
+	}
+	return l, nil
+}
@@ -62,6 +62,11 @@ func (cr *CachedResponder) GenerateResponse(ctx context.Context, req llm.InferRe
 	return response, nil
 }
 
+func (cr *CachedResponder) Infer(ctx context.Context, req llm.InferRequest) (*llm.InferResponse, error) {
+	// the cache only stores response text, so full responses (e.g. with tool calls) are passed through
+	return cr.underlying.Infer(ctx, req)
+}
+
 func (cr *CachedResponder) GenerateResponseAsync(ctx context.Context, req llm.InferRequest) (<-chan llm.StreamDelta, error) {
 	// For async responses, we don't cache and just pass through to the underlying provider
 	// TODO: think about if we should just cache final response and return immediately
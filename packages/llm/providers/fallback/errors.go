@@ -0,0 +1,70 @@
+package fallback
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/internal/apierr"
+)
+
+// ErrorClass groups provider errors by how they should be handled.
+type ErrorClass string
+
+const (
+	// ErrorClassRateLimited is a 429 from the provider.
+	ErrorClassRateLimited ErrorClass = "rate_limited"
+	// ErrorClassOverloaded is a 503 or Anthropic's 529.
+	ErrorClassOverloaded ErrorClass = "overloaded"
+	// ErrorClassServer is any other transient 5xx, i.e. a 500 or 502.
+	ErrorClassServer ErrorClass = "server"
+	// ErrorClassTimeout is a request that timed out, either at the provider or on the way there.
+	ErrorClassTimeout ErrorClass = "timeout"
+	// ErrorClassAuth is a 401 or 403, e.g. a bad API key or a model the key has no access to.
+	ErrorClassAuth ErrorClass = "auth"
+	// ErrorClassInvalidRequest is any other 4xx or permanent 5xx, including prompts that are too long or were
+	// filtered. The request would likely fail on any model.
+	ErrorClassInvalidRequest ErrorClass = "invalid_request"
+	// ErrorClassUnknown is everything else, e.g. connection errors or a broken stream.
+	ErrorClassUnknown ErrorClass = "unknown"
+)
+
+// Classify returns the class of an error returned by a provider, from the llm error kinds, see
+// llm.ClassifyError. Errors the provider didn't classify are classified here.
+func Classify(err error) ErrorClass {
+	err = apierr.Classify("", err)
+	var code int
+	var apiErr *llm.APIError
+	if errors.As(err, &apiErr) {
+		code = apiErr.StatusCode
+	}
+	switch {
+	case errors.Is(err, llm.ErrRateLimited):
+		return ErrorClassRateLimited
+	case errors.Is(err, llm.ErrServerOverloaded):
+		switch code {
+		case http.StatusServiceUnavailable, apierr.StatusOverloaded:
+			return ErrorClassOverloaded
+		case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+			return ErrorClassTimeout
+		default:
+			return ErrorClassServer
+		}
+	case errors.Is(err, llm.ErrAuthentication):
+		return ErrorClassAuth
+	case errors.Is(err, llm.ErrInvalidRequest), errors.Is(err, llm.ErrContextLengthExceeded),
+		errors.Is(err, llm.ErrContentFiltered):
+		return ErrorClassInvalidRequest
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorClassTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorClassTimeout
+	}
+	return ErrorClassUnknown
+}
@@ -0,0 +1,192 @@
+// Package fallback retries failed requests on other models, e.g. when a provider is overloaded.
+package fallback
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/stillmatic/gollum/packages/llm"
+)
+
+// ErrChainExhausted is returned, wrapping the last model's error, when every model in the chain failed.
+var ErrChainExhausted = errors.New("all models in fallback chain failed")
+
+// Policy decides what to do when a model fails with an error of a given class.
+type Policy int
+
+const (
+	// PolicyFallback tries the next model in the chain.
+	PolicyFallback Policy = iota
+	// PolicyFail returns the error immediately.
+	PolicyFail
+)
+
+// DefaultPolicies falls back on everything except invalid requests, which would fail on every model.
+var DefaultPolicies = map[ErrorClass]Policy{
+	ErrorClassRateLimited:    PolicyFallback,
+	ErrorClassOverloaded:     PolicyFallback,
+	ErrorClassServer:         PolicyFallback,
+	ErrorClassTimeout:        PolicyFallback,
+	ErrorClassAuth:           PolicyFallback,
+	ErrorClassInvalidRequest: PolicyFail,
+	ErrorClassUnknown:        PolicyFallback,
+}
+
+// Config for a fallback Responder.
+type Config struct {
+	// Chain of models to try, in order, after the request's own model.
+	Chain []llm.ModelConfig
+	// Policies by error class. Classes which aren't set use DefaultPolicies.
+	Policies map[ErrorClass]Policy
+	// OnAttempt, if set, is called after each attempt. err is nil for the model that answered.
+	OnAttempt func(cfg llm.ModelConfig, err error)
+}
+
+// Responder implements llm.Responder, trying each model in the chain until one answers.
+// The underlying responder must be able to serve every model in the chain, e.g. a router.Router.
+type Responder struct {
+	underlying llm.Responder
+	config     Config
+}
+
+func NewFallbackResponder(underlying llm.Responder, config Config) *Responder {
+	return &Responder{
+		underlying: underlying,
+		config:     config,
+	}
+}
+
+// models returns the configs to try: the request's model if it has one, then the chain.
+func (r *Responder) models(req llm.InferRequest) []llm.ModelConfig {
+	models := make([]llm.ModelConfig, 0, len(r.config.Chain)+1)
+	if req.ModelConfig.ModelName != "" {
+		models = append(models, req.ModelConfig)
+	}
+	for _, cfg := range r.config.Chain {
+		if cfg.ProviderType == req.ModelConfig.ProviderType && cfg.ModelName == req.ModelConfig.ModelName {
+			continue
+		}
+		models = append(models, cfg)
+	}
+	return models
+}
+
+func (r *Responder) policy(class ErrorClass) Policy {
+	if p, ok := r.config.Policies[class]; ok {
+		return p
+	}
+	return DefaultPolicies[class]
+}
+
+// shouldFallback records the attempt and reports whether to try the next model after err.
+func (r *Responder) shouldFallback(ctx context.Context, cfg llm.ModelConfig, err error) bool {
+	if r.config.OnAttempt != nil {
+		r.config.OnAttempt(cfg, err)
+	}
+	// the caller gave up, another model won't help
+	if ctx.Err() != nil {
+		return false
+	}
+	return r.policy(Classify(err)) == PolicyFallback
+}
+
+func (r *Responder) GenerateResponse(ctx context.Context, req llm.InferRequest) (string, error) {
+	res, err := r.Infer(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	return res.Content, nil
+}
+
+func (r *Responder) Infer(ctx context.Context, req llm.InferRequest) (*llm.InferResponse, error) {
+	var lastErr error
+	for _, cfg := range r.models(req) {
+		req.ModelConfig = cfg
+		res, err := r.underlying.Infer(ctx, req)
+		if err == nil {
+			if r.config.OnAttempt != nil {
+				r.config.OnAttempt(cfg, nil)
+			}
+			if res.Model == "" {
+				res.Model = cfg.ModelName
+			}
+			return res, nil
+		}
+		lastErr = err
+		if !r.shouldFallback(ctx, cfg, err) {
+			return nil, err
+		}
+	}
+	if lastErr == nil {
+		return nil, errors.New("no models to try")
+	}
+	return nil, fmt.Errorf("%w: %w", ErrChainExhausted, lastErr)
+}
+
+// GenerateResponseAsync falls back to the next model if a stream fails before emitting any text.
+// Once text has been emitted, errors are passed through as they are.
+func (r *Responder) GenerateResponseAsync(ctx context.Context, req llm.InferRequest) (<-chan llm.StreamDelta, error) {
+	var lastErr error
+	for _, cfg := range r.models(req) {
+		req.ModelConfig = cfg
+		ch, first, err := r.startStream(ctx, req)
+		if err == nil {
+			if r.config.OnAttempt != nil {
+				r.config.OnAttempt(cfg, nil)
+			}
+			return forward(ctx, cfg, first, ch), nil
+		}
+		lastErr = err
+		if !r.shouldFallback(ctx, cfg, err) {
+			return nil, err
+		}
+	}
+	if lastErr == nil {
+		return nil, errors.New("no models to try")
+	}
+	return nil, fmt.Errorf("%w: %w", ErrChainExhausted, lastErr)
+}
+
+// startStream starts a stream and waits for its first delta, returning an error if the stream failed before that.
+func (r *Responder) startStream(ctx context.Context, req llm.InferRequest) (<-chan llm.StreamDelta, llm.StreamDelta, error) {
+	ch, err := r.underlying.GenerateResponseAsync(ctx, req)
+	if err != nil {
+		return nil, llm.StreamDelta{}, err
+	}
+	select {
+	case <-ctx.Done():
+		return nil, llm.StreamDelta{}, ctx.Err()
+	case first, ok := <-ch:
+		if !ok {
+			return nil, llm.StreamDelta{}, errors.New("stream closed without a response")
+		}
+		if first.Err != nil {
+			return nil, llm.StreamDelta{}, first.Err
+		}
+		return ch, first, nil
+	}
+}
+
+// forward sends the first delta and then the rest of the stream.
+func forward(ctx context.Context, cfg llm.ModelConfig, first llm.StreamDelta, ch <-chan llm.StreamDelta) <-chan llm.StreamDelta {
+	outChan := make(chan llm.StreamDelta)
+	go func() {
+		defer close(outChan)
+		delta, ok := first, true
+		for ok {
+			if delta.EOF && delta.Model == "" {
+				delta.Model = cfg.ModelName
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case outChan <- delta:
+			}
+			delta, ok = <-ch
+		}
+	}()
+	return outChan
+}
+
+var _ llm.Responder = &Responder{}
@@ -0,0 +1,185 @@
+package fallback_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/liushuangls/go-anthropic/v2"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stillmatic/gollum/packages/llm"
+	mock_llm "github.com/stillmatic/gollum/packages/llm/internal/mocks"
+	"github.com/stillmatic/gollum/packages/llm/providers/fallback"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/api/googleapi"
+)
+
+var (
+	claude = llm.ModelConfig{ProviderType: llm.ProviderAnthropic, ModelName: "claude-3-7-sonnet-latest"}
+	gpt4o  = llm.ModelConfig{ProviderType: llm.ProviderOpenAI, ModelName: "gpt-4o"}
+	gemini = llm.ModelConfig{ProviderType: llm.ProviderGoogle, ModelName: "gemini-2.0-flash"}
+
+	errOverloaded  = fmt.Errorf("anthropic messages stream error: %w", &anthropic.APIError{Type: anthropic.ErrTypeOverloaded})
+	errRateLimited = &openai.APIError{HTTPStatusCode: http.StatusTooManyRequests}
+	errInvalid     = &openai.APIError{HTTPStatusCode: http.StatusBadRequest}
+)
+
+func withModel(req llm.InferRequest, cfg llm.ModelConfig) llm.InferRequest {
+	req.ModelConfig = cfg
+	return req
+}
+
+func stream(deltas ...llm.StreamDelta) <-chan llm.StreamDelta {
+	ch := make(chan llm.StreamDelta, len(deltas))
+	for _, d := range deltas {
+		ch <- d
+	}
+	close(ch)
+	return ch
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err  error
+		want fallback.ErrorClass
+	}{
+		{errOverloaded, fallback.ErrorClassOverloaded},
+		{errRateLimited, fallback.ErrorClassRateLimited},
+		{errInvalid, fallback.ErrorClassInvalidRequest},
+		{&openai.RequestError{HTTPStatusCode: http.StatusBadGateway}, fallback.ErrorClassServer},
+		{&anthropic.APIError{Type: anthropic.ErrTypeAuthentication}, fallback.ErrorClassAuth},
+		{&googleapi.Error{Code: http.StatusServiceUnavailable}, fallback.ErrorClassOverloaded},
+		{&googleapi.Error{Code: http.StatusGatewayTimeout}, fallback.ErrorClassTimeout},
+		{&openai.RequestError{HTTPStatusCode: http.StatusNotImplemented}, fallback.ErrorClassInvalidRequest},
+		{&llm.APIError{Kind: llm.ErrContextLengthExceeded, Err: errors.New("prompt is too long")}, fallback.ErrorClassInvalidRequest},
+		{fmt.Errorf("wrapped: %w", context.DeadlineExceeded), fallback.ErrorClassTimeout},
+		{errors.New("connection reset"), fallback.ErrorClassUnknown},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, fallback.Classify(tt.err), tt.err.Error())
+	}
+}
+
+func TestFallbackResponder(t *testing.T) {
+	ctx := context.Background()
+	req := llm.InferRequest{
+		Messages: []llm.InferMessage{{Role: "user", Content: "hello"}},
+	}
+	chain := []llm.ModelConfig{claude, gpt4o, gemini}
+
+	t.Run("falls back to the next model", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		underlying := mock_llm.NewMockResponder(ctrl)
+		var attempts []string
+		r := fallback.NewFallbackResponder(underlying, fallback.Config{
+			Chain: chain,
+			OnAttempt: func(cfg llm.ModelConfig, err error) {
+				attempts = append(attempts, fmt.Sprintf("%s:%v", cfg.ModelName, err != nil))
+			},
+		})
+
+		underlying.EXPECT().Infer(ctx, withModel(req, claude)).Return(nil, errOverloaded)
+		underlying.EXPECT().Infer(ctx, withModel(req, gpt4o)).Return(&llm.InferResponse{Content: "hi"}, nil)
+		res, err := r.Infer(ctx, req)
+		assert.NoError(t, err)
+		assert.Equal(t, "hi", res.Content)
+		assert.Equal(t, "gpt-4o", res.Model)
+		assert.Equal(t, []string{"claude-3-7-sonnet-latest:true", "gpt-4o:false"}, attempts)
+	})
+
+	t.Run("starts from the request's model", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		underlying := mock_llm.NewMockResponder(ctrl)
+		r := fallback.NewFallbackResponder(underlying, fallback.Config{Chain: chain})
+
+		underlying.EXPECT().Infer(ctx, withModel(req, gpt4o)).Return(nil, errRateLimited)
+		underlying.EXPECT().Infer(ctx, withModel(req, claude)).Return(nil, errOverloaded)
+		underlying.EXPECT().Infer(ctx, withModel(req, gemini)).Return(&llm.InferResponse{Content: "hi"}, nil)
+		resp, err := r.GenerateResponse(ctx, withModel(req, gpt4o))
+		assert.NoError(t, err)
+		assert.Equal(t, "hi", resp)
+	})
+
+	t.Run("fails on invalid requests", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		underlying := mock_llm.NewMockResponder(ctrl)
+		r := fallback.NewFallbackResponder(underlying, fallback.Config{Chain: chain})
+
+		underlying.EXPECT().Infer(ctx, withModel(req, claude)).Return(nil, errInvalid)
+		_, err := r.Infer(ctx, req)
+		assert.ErrorIs(t, err, errInvalid)
+		assert.NotErrorIs(t, err, fallback.ErrChainExhausted)
+	})
+
+	t.Run("custom policies", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		underlying := mock_llm.NewMockResponder(ctrl)
+		r := fallback.NewFallbackResponder(underlying, fallback.Config{
+			Chain:    chain,
+			Policies: map[fallback.ErrorClass]fallback.Policy{fallback.ErrorClassRateLimited: fallback.PolicyFail},
+		})
+
+		underlying.EXPECT().Infer(ctx, withModel(req, claude)).Return(nil, errRateLimited)
+		_, err := r.Infer(ctx, req)
+		assert.ErrorIs(t, err, errRateLimited)
+	})
+
+	t.Run("chain exhausted", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		underlying := mock_llm.NewMockResponder(ctrl)
+		r := fallback.NewFallbackResponder(underlying, fallback.Config{Chain: chain})
+
+		underlying.EXPECT().Infer(ctx, gomock.Any()).Return(nil, errOverloaded).Times(3)
+		_, err := r.Infer(ctx, req)
+		assert.ErrorIs(t, err, fallback.ErrChainExhausted)
+		assert.Equal(t, fallback.ErrorClassOverloaded, fallback.Classify(err))
+	})
+
+	t.Run("stream falls back before any text", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		underlying := mock_llm.NewMockResponder(ctrl)
+		r := fallback.NewFallbackResponder(underlying, fallback.Config{Chain: chain})
+
+		underlying.EXPECT().GenerateResponseAsync(ctx, withModel(req, claude)).Return(nil, errOverloaded)
+		underlying.EXPECT().GenerateResponseAsync(ctx, withModel(req, gpt4o)).Return(stream(llm.StreamDelta{Err: errRateLimited}), nil)
+		underlying.EXPECT().GenerateResponseAsync(ctx, withModel(req, gemini)).Return(stream(
+			llm.StreamDelta{Text: "hello"},
+			llm.StreamDelta{Text: " world"},
+			llm.StreamDelta{EOF: true, FinishReason: llm.FinishReasonStop},
+		), nil)
+
+		ch, err := r.GenerateResponseAsync(ctx, req)
+		assert.NoError(t, err)
+		var deltas []llm.StreamDelta
+		for d := range ch {
+			deltas = append(deltas, d)
+		}
+		assert.Len(t, deltas, 3)
+		assert.Equal(t, "hello", deltas[0].Text)
+		assert.True(t, deltas[2].EOF)
+		assert.Equal(t, "gemini-2.0-flash", deltas[2].Model)
+	})
+
+	t.Run("stream errors after text are passed through", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		underlying := mock_llm.NewMockResponder(ctrl)
+		r := fallback.NewFallbackResponder(underlying, fallback.Config{Chain: chain})
+
+		underlying.EXPECT().GenerateResponseAsync(ctx, withModel(req, claude)).Return(stream(
+			llm.StreamDelta{Text: "hello"},
+			llm.StreamDelta{Err: errOverloaded},
+		), nil)
+
+		ch, err := r.GenerateResponseAsync(ctx, req)
+		assert.NoError(t, err)
+		var deltas []llm.StreamDelta
+		for d := range ch {
+			deltas = append(deltas, d)
+		}
+		assert.Len(t, deltas, 2)
+		assert.ErrorIs(t, deltas[1].Err, errOverloaded)
+	})
+}
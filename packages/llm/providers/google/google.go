@@ -3,12 +3,17 @@ package google
 import (
 	"context"
 	"log/slog"
+	"net/http"
 	"strings"
 	"time"
 
 	"github.com/cespare/xxhash/v2"
 	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/internal/apierr"
+	"github.com/stillmatic/gollum/packages/llm/providers/internal/genaischema"
+	"github.com/stillmatic/gollum/packages/llm/providers/transport"
 	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
 
 	"github.com/google/generative-ai-go/genai"
 	"github.com/pkg/errors"
@@ -21,8 +26,12 @@ type Provider struct {
 	cachedContentMap map[string]struct{}
 }
 
-func NewGoogleProvider(ctx context.Context, apiKey string) (*Provider, error) {
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+func NewGoogleProvider(ctx context.Context, apiKey string, opts ...transport.Option) (*Provider, error) {
+	clientOpts, err := clientOptions(ctx, apiKey, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "google client error")
+	}
+	client, err := genai.NewClient(ctx, clientOpts...)
 	if err != nil {
 		return nil, errors.Wrap(err, "google client error")
 	}
@@ -37,6 +46,30 @@ func NewGoogleProvider(ctx context.Context, apiKey string) (*Provider, error) {
 	return p, nil
 }
 
+// clientOptions authenticates with the API key. A custom HTTP client replaces the one which would add the key,
+// so the key is added to its transport instead.
+func clientOptions(ctx context.Context, apiKey string, opts []transport.Option) ([]option.ClientOption, error) {
+	clientOpts := []option.ClientOption{option.WithAPIKey(apiKey)}
+	if len(opts) == 0 {
+		return clientOpts, nil
+	}
+	settings := transport.Apply(opts...)
+	if settings.BaseURL != "" {
+		clientOpts = append(clientOpts, option.WithEndpoint(settings.BaseURL))
+	}
+	client := settings.Client()
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	rt, err := htransport.NewTransport(ctx, base, option.WithAPIKey(apiKey))
+	if err != nil {
+		return nil, err
+	}
+	client.Transport = rt
+	return append(clientOpts, option.WithHTTPClient(client)), nil
+}
+
 func (p *Provider) refreshCachedFileMap(ctx context.Context) error {
 	iter := p.client.ListFiles(ctx)
 	cachedFileMap := make(map[string]string)
@@ -151,8 +184,19 @@ func (p *Provider) getModel(req llm.InferRequest) *genai.GenerativeModel {
 }
 
 func (p *Provider) GenerateResponse(ctx context.Context, req llm.InferRequest) (string, error) {
+	res, err := p.Infer(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	return res.Content, nil
+}
+
+func (p *Provider) Infer(ctx context.Context, req llm.InferRequest) (*llm.InferResponse, error) {
+	if err := llm.ValidateRequest(req, false); err != nil {
+		return nil, err
+	}
 	if len(req.Messages) > 1 {
-		return p.generateResponseChat(ctx, req)
+		return p.inferChat(ctx, req)
 	}
 
 	// it is slightly better to build a trie, indexed on hashes of each message
@@ -174,12 +218,12 @@ func (p *Provider) GenerateResponse(ctx context.Context, req llm.InferRequest) (
 		for _, message := range messagesToCache {
 			// it is possible to have collision between user + assistant content being identical
 			// this feels like a rare case especially given that we are ordering sensitive in the hash.
-			hashKeys = append(hashKeys, getHash(message.Content))
-			if len(message.Image) > 0 {
-				hashKeys = append(hashKeys, getHashBytes(message.Image))
-			}
-			if len(message.Audio) > 0 {
-				hashKeys = append(hashKeys, getHashBytes(message.Audio))
+			for _, part := range message.ContentParts() {
+				if len(part.Data) > 0 {
+					hashKeys = append(hashKeys, getHashBytes(part.Data))
+				} else {
+					hashKeys = append(hashKeys, getHash(part.Text+part.URL))
+				}
 			}
 		}
 		joinedKey := strings.Join(hashKeys, "/")
@@ -192,93 +236,223 @@ func (p *Provider) GenerateResponse(ctx context.Context, req llm.InferRequest) (
 			// otherwise, create a new cached object
 			cc, err := p.createCachedContent(ctx, joinedKey, req.ModelConfig.ModelName)
 			if err != nil {
-				return "", errors.Wrap(err, "google upload file error")
+				return nil, errors.Wrap(err, "google upload file error")
 			}
 			model = p.client.GenerativeModelFromCachedContent(cc)
 		}
 	}
+	if err := configureModel(model, req); err != nil {
+		return nil, err
+	}
 
-	parts := singleTurnMessageToParts(req.Messages[0])
+	parts, err := messageToParts(req.Messages[0], req.ModelConfig.ModelName)
+	if err != nil {
+		return nil, err
+	}
 
 	resp, err := model.GenerateContent(ctx, parts...)
 	if err != nil {
-		return "", errors.Wrap(err, "google generate content error")
+		return nil, errors.Wrap(classifyError(err), "google generate content error")
 	}
-	respStr := flattenResponse(resp)
 
-	return respStr, nil
+	return responseToInferResponse(req, resp)
+}
+
+func responseToInferResponse(req llm.InferRequest, resp *genai.GenerateContentResponse) (*llm.InferResponse, error) {
+	candidates := make([]llm.Candidate, len(resp.Candidates))
+	for i, c := range resp.Candidates {
+		toolCalls, err := toolCallsFromCandidate(c)
+		if err != nil {
+			return nil, err
+		}
+		candidates[i] = llm.Candidate{
+			Content:      flattenCandidate(c),
+			ToolCalls:    toolCalls,
+			FinishReason: finishReasonFromGenai(c.FinishReason),
+		}
+		if len(toolCalls) > 0 {
+			candidates[i].FinishReason = llm.FinishReasonToolCalls
+		}
+	}
+	res := &llm.InferResponse{
+		// the response doesn't say which model version answered
+		Model: req.ModelConfig.ModelName,
+	}
+	res.SetCandidates(candidates)
+	if resp.UsageMetadata != nil {
+		res.Usage = llm.Usage{
+			InputTokens:       int(resp.UsageMetadata.PromptTokenCount),
+			OutputTokens:      int(resp.UsageMetadata.CandidatesTokenCount),
+			CachedInputTokens: int(resp.UsageMetadata.CachedContentTokenCount),
+		}
+	}
+	res.Cost = llm.Cost(req.ModelConfig, res.Usage)
+	return res, nil
 }
 
-func singleTurnMessageToParts(message llm.InferMessage) []genai.Part {
-	parts := []genai.Part{genai.Text(message.Content)}
-	if len(message.Image) > 0 {
-		// TODO: set the image type based on the actual image type
-		parts = append(parts, genai.ImageData("png", message.Image))
+func finishReasonFromGenai(fr genai.FinishReason) llm.FinishReason {
+	switch fr {
+	case genai.FinishReasonStop:
+		return llm.FinishReasonStop
+	case genai.FinishReasonMaxTokens:
+		return llm.FinishReasonLength
+	case genai.FinishReasonSafety, genai.FinishReasonRecitation:
+		return llm.FinishReasonContentFilter
+	default:
+		return llm.FinishReasonOther
 	}
-	// if len(message.Audio) > 0 {
-	// 	// TODO: set the audio type based on the actual audio type
-	// 	parts = append(parts, genai.("wav", message.Audio))
-	// }
+}
 
-	return parts
+// messageToParts converts the content of a message to genai parts.
+func messageToParts(message llm.InferMessage, model string) ([]genai.Part, error) {
+	parts := make([]genai.Part, 0)
+	for _, part := range message.ContentParts() {
+		switch part.Type {
+		case llm.PartTypeText:
+			parts = append(parts, genai.Text(part.Text))
+		case llm.PartTypeImage, llm.PartTypeDocument, llm.PartTypeAudio:
+			parts = append(parts, genai.Blob{MIMEType: part.MIMEType, Data: part.Data})
+		default:
+			// gemini only fetches files uploaded with the files API, not arbitrary URLs
+			return nil, &llm.UnsupportedPartError{Type: part.Type, Model: model}
+		}
+	}
+	if len(parts) == 0 && len(message.ToolCalls) == 0 {
+		parts = append(parts, genai.Text(""))
+	}
+	return parts, nil
 }
 
-func multiTurnMessageToParts(messages []llm.InferMessage) ([]*genai.Content, *genai.Content) {
+func multiTurnMessageToParts(messages []llm.InferMessage, toolNames map[string]string, model string) ([]*genai.Content, *genai.Content, error) {
 	sysInstructionParts := make([]genai.Part, 0)
 	hist := make([]*genai.Content, 0, len(messages))
 	for _, message := range messages {
-		parts := []genai.Part{genai.Text(message.Content)}
-		if len(message.Image) > 0 {
-			parts = append(parts, genai.ImageData("png", message.Image))
+		if message.Role == "tool" {
+			part, err := toolResultToPart(message, toolNames)
+			if err != nil {
+				return nil, nil, err
+			}
+			// all results for a turn go in a single content
+			if len(hist) > 0 && isFunctionResponseContent(hist[len(hist)-1]) {
+				hist[len(hist)-1].Parts = append(hist[len(hist)-1].Parts, part)
+			} else {
+				hist = append(hist, &genai.Content{Parts: []genai.Part{part}, Role: "user"})
+			}
+			continue
+		}
+		parts, err := messageToParts(message, model)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, tc := range message.ToolCalls {
+			part, err := toolCallToPart(tc)
+			if err != nil {
+				return nil, nil, err
+			}
+			parts = append(parts, part)
 		}
 		if message.Role == "system" {
 			sysInstructionParts = append(sysInstructionParts, parts...)
 			continue
 		}
+		role := message.Role
+		// gemini calls the assistant "model"
+		if role == "assistant" {
+			role = "model"
+		}
 		hist = append(hist, &genai.Content{
 			Parts: parts,
-			Role:  message.Role,
+			Role:  role,
 		})
 	}
 	if len(sysInstructionParts) > 0 {
 		return hist, &genai.Content{
 			Parts: sysInstructionParts,
+		}, nil
+	}
+
+	return hist, nil, nil
+}
+
+func isFunctionResponseContent(c *genai.Content) bool {
+	for _, part := range c.Parts {
+		if _, ok := part.(genai.FunctionResponse); !ok {
+			return false
 		}
 	}
+	return len(c.Parts) > 0
+}
 
-	return hist, nil
+// splitLastTurn splits the messages into the chat history and the final turn to send.
+// Consecutive tool results at the end of the conversation make up a single turn.
+func splitLastTurn(messages []llm.InferMessage) ([]llm.InferMessage, []llm.InferMessage) {
+	i := len(messages) - 1
+	for i > 0 && messages[i].Role == "tool" && messages[i-1].Role == "tool" {
+		i--
+	}
+	return messages[:i], messages[i:]
 }
 
-func (p *Provider) generateResponseChat(ctx context.Context, req llm.InferRequest) (string, error) {
-	model := p.getModel(req)
+// lastTurnToParts converts the final turn into the parts to send with the chat session.
+func lastTurnToParts(lastTurn []llm.InferMessage, toolNames map[string]string, model string) ([]genai.Part, error) {
+	if lastTurn[0].Role != "tool" {
+		return messageToParts(lastTurn[0], model)
+	}
+	parts := make([]genai.Part, 0, len(lastTurn))
+	for _, m := range lastTurn {
+		part, err := toolResultToPart(m, toolNames)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
 
+// startChat builds a chat session from all but the last turn of the request, and returns the parts for the last turn.
+func (p *Provider) startChat(model *genai.GenerativeModel, req llm.InferRequest) (*genai.ChatSession, []genai.Part, error) {
 	// annoyingly, the last message is the one we want to generate a response to, so we need to split it out
-	msgs, sysInstr := multiTurnMessageToParts(req.Messages[:len(req.Messages)-1])
+	toolNames := genaischema.ToolCallNames(req.Messages)
+	history, lastTurn := splitLastTurn(req.Messages)
+	msgs, sysInstr, err := multiTurnMessageToParts(history, toolNames, req.ModelConfig.ModelName)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid messages")
+	}
 	if sysInstr != nil {
 		model.SystemInstruction = sysInstr
 	}
+	lastParts, err := lastTurnToParts(lastTurn, toolNames, req.ModelConfig.ModelName)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid messages")
+	}
 
 	cs := model.StartChat()
 	cs.History = msgs
-	mostRecentMessage := req.Messages[len(req.Messages)-1]
+	return cs, lastParts, nil
+}
 
-	// NB chua: this might be a bug but Google doesn't seem to accept multiple parts in the same message
-	// in the chat API. So can't send text + image if it exists.
-	//mostRecentMessagePart := []genai.Part{genai.Text(mostRecentMessage.Content)}
-	//if mostRecentMessage.Image != nil && len(*mostRecentMessage.Image) > 0 {
-	//	mostRecentMessagePart = append(mostRecentMessagePart, genai.ImageData("png", *mostRecentMessage.Image))
-	//}
+func (p *Provider) inferChat(ctx context.Context, req llm.InferRequest) (*llm.InferResponse, error) {
+	model := p.getModel(req)
+	if err := configureModel(model, req); err != nil {
+		return nil, err
+	}
+	cs, lastParts, err := p.startChat(model, req)
+	if err != nil {
+		return nil, err
+	}
 
-	resp, err := cs.SendMessage(ctx, genai.Text(mostRecentMessage.Content))
+	resp, err := cs.SendMessage(ctx, lastParts...)
 	if err != nil {
-		return "", errors.Wrap(err, "google generate content error")
+		return nil, errors.Wrap(classifyError(err), "google generate content error")
 	}
-	respStr := flattenResponse(resp)
 
-	return respStr, nil
+	return responseToInferResponse(req, resp)
 }
 
 func (p *Provider) GenerateResponseAsync(ctx context.Context, req llm.InferRequest) (<-chan llm.StreamDelta, error) {
+	if err := llm.ValidateRequest(req, true); err != nil {
+		return nil, err
+	}
 	if len(req.Messages) > 1 {
 		return p.generateResponseAsyncChat(ctx, req)
 	}
@@ -292,30 +466,17 @@ func (p *Provider) generateResponseAsyncSingle(ctx context.Context, req llm.Infe
 		defer close(outChan)
 
 		model := p.getModel(req)
-
-		parts := singleTurnMessageToParts(req.Messages[0])
-		iter := model.GenerateContentStream(ctx, parts...)
-
-		for {
-			resp, err := iter.Next()
-			if errors.Is(err, iterator.Done) {
-				outChan <- llm.StreamDelta{EOF: true}
-				break
-			}
-			if err != nil {
-				slog.Error("error from gemini stream", "err", err, "req", req.Messages[0].Content, "model", req.ModelConfig.ModelName)
-				return
-			}
-
-			content := flattenResponse(resp)
-			if content != "" {
-				select {
-				case <-ctx.Done():
-					return
-				case outChan <- llm.StreamDelta{Text: content}:
-				}
-			}
+		if err := configureModel(model, req); err != nil {
+			sendDelta(ctx, outChan, llm.StreamDelta{Err: err})
+			return
 		}
+		parts, err := messageToParts(req.Messages[0], req.ModelConfig.ModelName)
+		if err != nil {
+			sendDelta(ctx, outChan, llm.StreamDelta{Err: err})
+			return
+		}
+
+		streamResponses(ctx, req, model.GenerateContentStream(ctx, parts...), outChan)
 	}()
 
 	return outChan, nil
@@ -328,46 +489,105 @@ func (p *Provider) generateResponseAsyncChat(ctx context.Context, req llm.InferR
 		defer close(outChan)
 
 		model := p.getModel(req)
-		msgs, sysInstr := multiTurnMessageToParts(req.Messages[:len(req.Messages)-1])
-		if sysInstr != nil {
-			model.SystemInstruction = sysInstr
+		if err := configureModel(model, req); err != nil {
+			sendDelta(ctx, outChan, llm.StreamDelta{Err: err})
+			return
+		}
+		cs, lastParts, err := p.startChat(model, req)
+		if err != nil {
+			sendDelta(ctx, outChan, llm.StreamDelta{Err: err})
+			return
 		}
-		cs := model.StartChat()
-		cs.History = msgs
 
-		mostRecentMessage := req.Messages[len(req.Messages)-1]
+		streamResponses(ctx, req, cs.SendMessageStream(ctx, lastParts...), outChan)
+	}()
 
-		iter := cs.SendMessageStream(ctx, genai.Text(mostRecentMessage.Content))
+	return outChan, nil
+}
 
-		for {
-			resp, err := iter.Next()
-			if errors.Is(err, iterator.Done) {
-				outChan <- llm.StreamDelta{EOF: true}
-				break
-			}
-			if err != nil {
-				slog.Error("error from gemini stream", "err", err, "req", mostRecentMessage.Content, "model", req.ModelConfig.ModelName)
-				return
-			}
+// streamResponses forwards the text of each response, then sends a final delta built from the merged response.
+func streamResponses(ctx context.Context, req llm.InferRequest, iter *genai.GenerateContentResponseIterator, outChan chan<- llm.StreamDelta) {
+	// the merged response doesn't include usage, which is reported with the last chunk
+	var usage *genai.UsageMetadata
+	if req.MessageOptions.Candidates > 1 {
+		sendDelta(ctx, outChan, llm.StreamDelta{Err: llm.ErrStreamingCandidates})
+		return
+	}
+	for {
+		resp, err := iter.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			slog.Error("error from gemini stream", "err", err, "model", req.ModelConfig.ModelName)
+			sendDelta(ctx, outChan, llm.StreamDelta{Err: errors.Wrap(classifyError(err), "gemini stream error")})
+			return
+		}
+		if resp.UsageMetadata != nil {
+			usage = resp.UsageMetadata
+		}
 
-			content := flattenResponse(resp)
-			if content != "" {
-				select {
-				case <-ctx.Done():
-					return
-				case outChan <- llm.StreamDelta{Text: content}:
-				}
-			}
+		content := flattenResponse(resp)
+		if content != "" && !sendDelta(ctx, outChan, llm.StreamDelta{Text: content}) {
+			return
 		}
-	}()
+	}
 
-	return outChan, nil
+	merged := iter.MergedResponse()
+	if merged == nil {
+		merged = &genai.GenerateContentResponse{}
+	}
+	merged.UsageMetadata = usage
+	res, err := responseToInferResponse(req, merged)
+	if err != nil {
+		sendDelta(ctx, outChan, llm.StreamDelta{Err: err})
+		return
+	}
+	sendDelta(ctx, outChan, llm.StreamDelta{
+		EOF:          true,
+		ToolCalls:    res.ToolCalls,
+		FinishReason: res.FinishReason,
+		Model:        res.Model,
+		Usage:        res.Usage,
+		Cost:         res.Cost,
+	})
+}
+
+// classifyError maps blocked prompts and responses to llm.ErrContentFiltered, and API errors by their status.
+func classifyError(err error) error {
+	var blocked *genai.BlockedError
+	if errors.As(err, &blocked) {
+		return &llm.APIError{Kind: llm.ErrContentFiltered, Provider: llm.ProviderGoogle, Err: err}
+	}
+	return apierr.Classify(llm.ProviderGoogle, err)
+}
+
+// sendDelta sends the delta unless the context is done first, returning whether it was sent.
+func sendDelta(ctx context.Context, ch chan<- llm.StreamDelta, delta llm.StreamDelta) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case ch <- delta:
+		return true
+	}
 }
 
 // flattenResponse flattens the response from the Gemini API into a single string.
 func flattenResponse(resp *genai.GenerateContentResponse) string {
+	// streamed chunks may carry only usage or a finish reason
+	if len(resp.Candidates) == 0 {
+		return ""
+	}
+	return flattenCandidate(resp.Candidates[0])
+}
+
+// flattenCandidate joins the text parts of a candidate.
+func flattenCandidate(c *genai.Candidate) string {
 	var rtn strings.Builder
-	for i, part := range resp.Candidates[0].Content.Parts {
+	if c == nil || c.Content == nil {
+		return ""
+	}
+	for i, part := range c.Content.Parts {
 		switch part := part.(type) {
 		case genai.Text:
 			if i > 0 {
@@ -393,7 +613,7 @@ func (p *Provider) GenerateEmbedding(ctx context.Context, req llm.EmbedRequest)
 	if len(req.Input) == 1 {
 		resp, err := em.EmbedContent(ctx, genai.Text(req.Input[0]))
 		if err != nil {
-			return nil, errors.Wrap(err, "google embedding error")
+			return nil, errors.Wrap(classifyError(err), "google embedding error")
 		}
 
 		return &llm.EmbeddingResponse{Data: []llm.Embedding{{Values: resp.Embedding.Values}}}, nil
@@ -405,7 +625,7 @@ func (p *Provider) GenerateEmbedding(ctx context.Context, req llm.EmbedRequest)
 	}
 	resp, err := em.BatchEmbedContents(ctx, batchReq)
 	if err != nil {
-		return nil, errors.Wrap(err, "google batch embedding error")
+		return nil, errors.Wrap(classifyError(err), "google batch embedding error")
 	}
 
 	respVectors := make([]llm.Embedding, len(resp.Embeddings))
@@ -0,0 +1,206 @@
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/llmtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+)
+
+// finishReasonStop is FinishReason STOP, enums are sent as integers.
+const finishReasonStop = 1
+
+// serveScenario renders the scenario as a streamGenerateContent response, which is a JSON array of responses.
+func serveScenario(s llmtest.Scenario) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.Status != 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(s.Status)
+			fmt.Fprintf(w, `{"error":{"code":%d,"message":"server error","status":"INTERNAL"}}`, s.Status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		sep := "["
+		send := func(parts []map[string]any, usage map[string]any) {
+			cand := map[string]any{
+				"index":   0,
+				"content": map[string]any{"role": "model", "parts": parts},
+			}
+			resp := map[string]any{"candidates": []map[string]any{cand}}
+			// the last chunk carries the finish reason and usage
+			if usage != nil {
+				cand["finishReason"] = finishReasonStop
+				resp["usageMetadata"] = usage
+			}
+			fmt.Fprint(w, sep+llmtest.MustJSON(resp))
+			sep = ","
+			w.(http.Flusher).Flush()
+		}
+
+		for _, c := range s.Chunks {
+			send([]map[string]any{{"text": c}}, nil)
+		}
+		if s.Hang {
+			<-r.Context().Done()
+			return
+		}
+		if s.Fail {
+			fmt.Fprint(w, `,{"candidates": [{"content": `)
+			return
+		}
+		parts := []map[string]any{}
+		for _, tc := range s.ToolCalls {
+			parts = append(parts, map[string]any{"functionCall": map[string]any{
+				"name": tc.Name, "args": json.RawMessage(tc.Arguments),
+			}})
+		}
+		send(parts, map[string]any{
+			"promptTokenCount":     s.Usage.InputTokens,
+			"candidatesTokenCount": s.Usage.OutputTokens,
+			"totalTokenCount":      s.Usage.TotalTokens(),
+		})
+		fmt.Fprint(w, "]")
+	}
+}
+
+// streamReaderWorks reports whether gax's stream reader can find the end of a JSON array stream.
+// It relies on encoding/json decoder behavior which changed with the v2 implementation.
+func streamReaderWorks() bool {
+	dec := json.NewDecoder(strings.NewReader(`[{}]`))
+	if _, err := dec.Token(); err != nil {
+		return false
+	}
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		return false
+	}
+	err := dec.Decode(&raw)
+	t, _ := dec.Token()
+	return err != nil && t == json.Delim(']')
+}
+
+func TestStreaming(t *testing.T) {
+	if !streamReaderWorks() {
+		t.Skip("gax stream reader is incompatible with this encoding/json")
+	}
+	llmtest.TestStreaming(t, func(t *testing.T, s llmtest.Scenario) llm.Responder {
+		srv := httptest.NewServer(serveScenario(s))
+		t.Cleanup(srv.Close)
+		client, err := genai.NewClient(context.Background(), option.WithEndpoint(srv.URL), option.WithAPIKey("fake-key"))
+		require.NoError(t, err)
+		t.Cleanup(func() { client.Close() })
+		return &Provider{client: client}
+	})
+}
+
+type answer struct {
+	Answer     string  `json:"answer" jsonschema:"required"`
+	Confidence float64 `json:"confidence" jsonschema:"required"`
+}
+
+func TestResponseFormat(t *testing.T) {
+	var body struct {
+		GenerationConfig struct {
+			ResponseMIMEType string         `json:"responseMimeType"`
+			ResponseSchema   map[string]any `json:"responseSchema"`
+		} `json:"generationConfig"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, llmtest.MustJSON(map[string]any{
+			"candidates": []map[string]any{{
+				"content":      map[string]any{"role": "model", "parts": []map[string]any{{"text": `{"answer":"42","confidence":0.9}`}}},
+				"finishReason": finishReasonStop,
+			}},
+		}))
+	}))
+	defer srv.Close()
+	client, err := genai.NewClient(context.Background(), option.WithEndpoint(srv.URL), option.WithAPIKey("fake-key"))
+	require.NoError(t, err)
+	defer client.Close()
+
+	req := llm.InferRequest{
+		Messages:    []llm.InferMessage{{Role: "user", Content: "What is the answer?"}},
+		ModelConfig: llmtest.Request.ModelConfig,
+	}
+	got, _, err := llm.InferStructured[answer](context.Background(), &Provider{client: client}, req)
+	require.NoError(t, err)
+	assert.Equal(t, answer{Answer: "42", Confidence: 0.9}, got)
+	assert.Equal(t, "application/json", body.GenerationConfig.ResponseMIMEType)
+	assert.Contains(t, body.GenerationConfig.ResponseSchema["properties"], "answer")
+	assert.ElementsMatch(t, []any{"answer", "confidence"}, body.GenerationConfig.ResponseSchema["required"])
+}
+
+func TestUnsupportedOptions(t *testing.T) {
+	client, err := genai.NewClient(context.Background(), option.WithEndpoint("http://localhost:0"), option.WithAPIKey("fake-key"))
+	require.NoError(t, err)
+	defer client.Close()
+	p := &Provider{client: client}
+
+	seed := 1
+	req := llmtest.Request
+	req.MessageOptions.Seed = &seed
+	_, err = p.Infer(context.Background(), req)
+	assert.ErrorIs(t, err, llm.ErrUnsupportedOption)
+
+	model := client.GenerativeModel("test-model")
+	req.MessageOptions = llm.MessageOptions{TopP: 0.5, TopK: 20, StopSequences: []string{"END"}}
+	require.NoError(t, configureModel(model, req))
+	assert.Equal(t, float32(0.5), *model.TopP)
+	assert.Equal(t, int32(20), *model.TopK)
+	assert.Equal(t, []string{"END"}, model.StopSequences)
+}
+
+func TestMessageParts(t *testing.T) {
+	client, err := genai.NewClient(context.Background(), option.WithEndpoint("http://localhost:0"), option.WithAPIKey("fake-key"))
+	require.NoError(t, err)
+	defer client.Close()
+	p := &Provider{client: client}
+
+	jpeg := []byte("\xff\xd8\xff\xe0\x00\x10JFIF")
+	wav := []byte("RIFF\x24\x00\x00\x00WAVEfmt ")
+	req := llm.InferRequest{
+		Messages: []llm.InferMessage{
+			{Role: "system", Content: "You are a helpful assistant."},
+			{Role: "user", Content: "What's in this picture?", Image: jpeg},
+		},
+		ModelConfig: llm.ModelConfig{ModelName: "gemini-1.5-flash"},
+	}
+
+	t.Run("last message keeps its image", func(t *testing.T) {
+		_, parts, err := p.startChat(client.GenerativeModel("gemini-1.5-flash"), req)
+		require.NoError(t, err)
+		assert.Equal(t, []genai.Part{
+			genai.Text("What's in this picture?"),
+			genai.Blob{MIMEType: "image/jpeg", Data: jpeg},
+		}, parts)
+	})
+
+	t.Run("audio and documents are sent inline", func(t *testing.T) {
+		parts, err := messageToParts(llm.InferMessage{Role: "user", Parts: []llm.Part{
+			llm.AudioPart(wav), llm.DocumentPart([]byte("%PDF-1.7\n")), llm.TextPart("Transcribe and summarize."),
+		}}, "gemini-1.5-flash")
+		require.NoError(t, err)
+		assert.Equal(t, []genai.Part{
+			genai.Blob{MIMEType: "audio/wav", Data: wav},
+			genai.Blob{MIMEType: "application/pdf", Data: []byte("%PDF-1.7\n")},
+			genai.Text("Transcribe and summarize."),
+		}, parts)
+	})
+
+	t.Run("image URLs are not supported", func(t *testing.T) {
+		_, err := messageToParts(llm.InferMessage{Role: "user", Parts: []llm.Part{llm.ImageURLPart("https://example.com/cat.png")}}, "gemini-1.5-flash")
+		assert.ErrorIs(t, err, llm.ErrUnsupportedPart)
+	})
+}
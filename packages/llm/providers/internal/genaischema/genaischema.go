@@ -0,0 +1,197 @@
+// Package genaischema converts tools, tool calls and JSON schemas for the Gemini providers. The Google AI and
+// Vertex AI SDKs define identical but distinct genai types, so conversions go through the plain types here and
+// each provider maps them onto its own SDK.
+package genaischema
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/stillmatic/gollum/packages/llm"
+)
+
+// Schema is the subset of JSON schema that Gemini understands.
+type Schema struct {
+	// Type is the JSON type, e.g. object or string. It is empty if the schema doesn't set one.
+	Type        string
+	Nullable    bool
+	Format      string
+	Description string
+	Enum        []string
+	Items       *Schema
+	Properties  map[string]*Schema
+	Required    []string
+}
+
+type jsonSchema struct {
+	// Type is either a string or a list of strings, e.g. ["string", "null"].
+	Type        any                    `json:"type"`
+	Format      string                 `json:"format"`
+	Description string                 `json:"description"`
+	Enum        []any                  `json:"enum"`
+	Items       *jsonSchema            `json:"items"`
+	Properties  map[string]*jsonSchema `json:"properties"`
+	Required    []string               `json:"required"`
+}
+
+// Parse converts anything that marshals to JSON schema into a Schema.
+func Parse(v any) (*Schema, error) {
+	if v == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not marshal schema")
+	}
+	var js jsonSchema
+	if err := json.Unmarshal(b, &js); err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal schema")
+	}
+	return js.toSchema(), nil
+}
+
+func (js *jsonSchema) toSchema() *Schema {
+	if js == nil {
+		return nil
+	}
+	s := &Schema{
+		Format:      js.Format,
+		Description: js.Description,
+		Required:    js.Required,
+		Items:       js.Items.toSchema(),
+	}
+	switch t := js.Type.(type) {
+	case string:
+		s.Type = t
+	case []any:
+		for _, tt := range t {
+			if tt == "null" {
+				s.Nullable = true
+				continue
+			}
+			s.Type = fmt.Sprint(tt)
+		}
+	}
+	for _, e := range js.Enum {
+		// nullable enums list null as a value, gemini marks them nullable instead
+		if e == nil {
+			s.Nullable = true
+			continue
+		}
+		s.Enum = append(s.Enum, fmt.Sprint(e))
+	}
+	if len(js.Properties) > 0 {
+		s.Properties = make(map[string]*Schema, len(js.Properties))
+		for k, v := range js.Properties {
+			s.Properties[k] = v.toSchema()
+		}
+	}
+	return s
+}
+
+// FunctionDeclaration declares a tool to the model.
+type FunctionDeclaration struct {
+	Name        string
+	Description string
+	Parameters  *Schema
+}
+
+// Declarations converts the request's tools into function declarations.
+func Declarations(tools []llm.Tool) ([]FunctionDeclaration, error) {
+	decls := make([]FunctionDeclaration, len(tools))
+	for i, t := range tools {
+		params, err := Parse(t.Parameters)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid parameters for tool %s", t.Name)
+		}
+		decls[i] = FunctionDeclaration{Name: t.Name, Description: t.Description, Parameters: params}
+	}
+	return decls, nil
+}
+
+// CallingMode is how the model may call functions.
+type CallingMode int
+
+const (
+	CallingModeAuto CallingMode = iota
+	CallingModeAny
+	CallingModeNone
+)
+
+// ToolChoice converts a tool choice into a calling mode and the names of the functions the model may call.
+// Allowed is empty when any function may be called.
+func ToolChoice(choice llm.ToolChoice) (mode CallingMode, allowed []string) {
+	switch choice.Type {
+	case llm.ToolChoiceNone:
+		return CallingModeNone, nil
+	case llm.ToolChoiceRequired:
+		return CallingModeAny, nil
+	case llm.ToolChoiceTool:
+		return CallingModeAny, []string{choice.Name}
+	default:
+		return CallingModeAuto, nil
+	}
+}
+
+// ToolCallNames maps tool call IDs to the name of the tool, Gemini identifies function responses by name.
+func ToolCallNames(messages []llm.InferMessage) map[string]string {
+	names := make(map[string]string)
+	for _, m := range messages {
+		for _, tc := range m.ToolCalls {
+			names[tc.ID] = tc.Name
+		}
+	}
+	return names
+}
+
+// ToolCallArgs decodes the arguments of a tool call.
+func ToolCallArgs(tc llm.ToolCall) (map[string]any, error) {
+	args := make(map[string]any)
+	if tc.Arguments != "" {
+		if err := json.Unmarshal([]byte(tc.Arguments), &args); err != nil {
+			return nil, errors.Wrapf(err, "invalid arguments for tool call %s", tc.ID)
+		}
+	}
+	return args, nil
+}
+
+// ToolResult returns the function name and response for a tool result message.
+func ToolResult(m llm.InferMessage, names map[string]string) (name string, response map[string]any, err error) {
+	name, ok := names[m.ToolCallID]
+	if !ok {
+		return "", nil, errors.Errorf("no tool call found for tool result %s", m.ToolCallID)
+	}
+	// gemini wants an object back. pass JSON objects through, wrap anything else.
+	response = make(map[string]any)
+	if err := json.Unmarshal([]byte(m.Content), &response); err != nil {
+		response = map[string]any{"content": m.Content}
+	}
+	return name, response, nil
+}
+
+// FunctionCall is a function call returned by the model.
+type FunctionCall struct {
+	Name string
+	Args map[string]any
+}
+
+// ToolCalls converts function calls into tool calls.
+// Gemini doesn't assign call IDs, so the tool name (suffixed when repeated) is used instead.
+func ToolCalls(fcs []FunctionCall) ([]llm.ToolCall, error) {
+	var calls []llm.ToolCall
+	seen := make(map[string]int)
+	for _, fc := range fcs {
+		args, err := json.Marshal(fc.Args)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not marshal function call args")
+		}
+		id := fc.Name
+		if n := seen[fc.Name]; n > 0 {
+			id = fmt.Sprintf("%s-%d", fc.Name, n)
+		}
+		seen[fc.Name]++
+		calls = append(calls, llm.ToolCall{ID: id, Name: fc.Name, Arguments: string(args)})
+	}
+	return calls, nil
+}
@@ -0,0 +1,76 @@
+package genaischema_test
+
+import (
+	"testing"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/providers/internal/genaischema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	s, err := genaischema.Parse(map[string]any{
+		"type":     "object",
+		"required": []string{"unit"},
+		"properties": map[string]any{
+			"unit":  map[string]any{"type": "string", "enum": []any{"c", "f"}},
+			"mood":  map[string]any{"type": []string{"string", "null"}, "enum": []any{"sunny", nil}},
+			"note":  map[string]any{"type": []string{"string", "null"}},
+			"temps": map[string]any{"type": "array", "items": map[string]any{"type": "number"}},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "object", s.Type)
+	assert.Equal(t, []string{"unit"}, s.Required)
+	assert.Equal(t, []string{"c", "f"}, s.Properties["unit"].Enum)
+	assert.Equal(t, []string{"sunny"}, s.Properties["mood"].Enum)
+	assert.True(t, s.Properties["mood"].Nullable)
+	assert.Equal(t, "string", s.Properties["note"].Type)
+	assert.True(t, s.Properties["note"].Nullable)
+	assert.Equal(t, "number", s.Properties["temps"].Items.Type)
+
+	s, err = genaischema.Parse(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, s)
+}
+
+func TestToolChoice(t *testing.T) {
+	mode, allowed := genaischema.ToolChoice(llm.ToolChoice{Type: llm.ToolChoiceTool, Name: "weather"})
+	assert.Equal(t, genaischema.CallingModeAny, mode)
+	assert.Equal(t, []string{"weather"}, allowed)
+
+	mode, allowed = genaischema.ToolChoice(llm.ToolChoice{Type: llm.ToolChoiceNone})
+	assert.Equal(t, genaischema.CallingModeNone, mode)
+	assert.Empty(t, allowed)
+}
+
+func TestToolResult(t *testing.T) {
+	names := genaischema.ToolCallNames([]llm.InferMessage{
+		{Role: "assistant", ToolCalls: []llm.ToolCall{{ID: "call-1", Name: "weather"}}},
+	})
+
+	name, response, err := genaischema.ToolResult(llm.InferMessage{ToolCallID: "call-1", Content: `{"temp": 20}`}, names)
+	require.NoError(t, err)
+	assert.Equal(t, "weather", name)
+	assert.Equal(t, map[string]any{"temp": float64(20)}, response)
+
+	_, response, err = genaischema.ToolResult(llm.InferMessage{ToolCallID: "call-1", Content: "sunny"}, names)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"content": "sunny"}, response)
+
+	_, _, err = genaischema.ToolResult(llm.InferMessage{ToolCallID: "call-2"}, names)
+	assert.Error(t, err)
+}
+
+func TestToolCalls(t *testing.T) {
+	calls, err := genaischema.ToolCalls([]genaischema.FunctionCall{
+		{Name: "weather", Args: map[string]any{"city": "Paris"}},
+		{Name: "weather", Args: map[string]any{"city": "Rome"}},
+	})
+	require.NoError(t, err)
+	require.Len(t, calls, 2)
+	assert.Equal(t, "weather", calls[0].ID)
+	assert.Equal(t, "weather-1", calls[1].ID)
+	assert.JSONEq(t, `{"city": "Rome"}`, calls[1].Arguments)
+}
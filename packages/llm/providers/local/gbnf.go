@@ -0,0 +1,342 @@
+package local
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// gbnfSchema is the subset of JSON schema that can be turned into a grammar.
+type gbnfSchema struct {
+	Type        any                    `json:"type"`
+	Enum        []any                  `json:"enum"`
+	Const       json.RawMessage        `json:"const"`
+	Properties  properties             `json:"properties"`
+	Required    []string               `json:"required"`
+	Items       *gbnfSchema            `json:"items"`
+	AnyOf       []*gbnfSchema          `json:"anyOf"`
+	OneOf       []*gbnfSchema          `json:"oneOf"`
+	Ref         string                 `json:"$ref"`
+	Defs        map[string]*gbnfSchema `json:"$defs"`
+	Definitions map[string]*gbnfSchema `json:"definitions"`
+}
+
+type property struct {
+	name   string
+	schema *gbnfSchema
+}
+
+// properties keeps the order of the schema's properties, which becomes the order of the keys in the output.
+type properties []property
+
+func (p *properties) UnmarshalJSON(b []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return fmt.Errorf("properties must be an object")
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		name, _ := t.(string)
+		var s gbnfSchema
+		if err := dec.Decode(&s); err != nil {
+			return fmt.Errorf("invalid property %s: %w", name, err)
+		}
+		*p = append(*p, property{name: name, schema: &s})
+	}
+	return nil
+}
+
+// primitive rules, following llama.cpp's json_schema_to_grammar
+var primitives = map[string]string{
+	"space":   `| " " | "\n" [ \t]{0,20}`,
+	"boolean": `("true" | "false") space`,
+	"null":    `"null" space`,
+	"number":  `("-"? ([0-9] | [1-9] [0-9]{0,15})) ("." [0-9]+)? ([eE] [-+]? [0-9]{1,15})? space`,
+	"integer": `("-"? ([0-9] | [1-9] [0-9]{0,15})) space`,
+	"string":  `"\"" ([^"\\\x7F\x00-\x1F] | "\\" (["\\/bfnrt] | "u" [0-9a-fA-F]{4}))* "\"" space`,
+	"value":   `object | array | string | number | boolean | null`,
+	"object":  `"{" space (string ":" space value ("," space string ":" space value)*)? "}" space`,
+	"array":   `"[" space (value ("," space value)*)? "]" space`,
+}
+
+// primitiveDeps are the rules each primitive refers to.
+var primitiveDeps = map[string][]string{
+	"boolean": {"space"},
+	"null":    {"space"},
+	"number":  {"space"},
+	"integer": {"space"},
+	"string":  {"space"},
+	"value":   {"object", "array", "string", "number", "boolean", "null"},
+	"object":  {"space", "string", "value"},
+	"array":   {"space", "value"},
+}
+
+var invalidRuleChars = regexp.MustCompile(`[^a-zA-Z0-9-]+`)
+
+type grammarBuilder struct {
+	defs  map[string]*gbnfSchema
+	rules map[string]string
+	order []string
+	// refs maps $ref targets to their rule names, so recursive schemas terminate
+	refs map[string]string
+}
+
+// JSONSchemaToGBNF converts a JSON schema into a GBNF grammar, which constrains llama.cpp to output JSON
+// matching the schema. The schema can be anything that marshals to JSON schema, e.g. a *jsonschema.Schema.
+// Objects have exactly their properties, in order, with required properties always present. Validation keywords
+// like minLength or pattern are not enforced.
+func JSONSchemaToGBNF(schema any) (string, error) {
+	b, err := json.Marshal(schema)
+	if err != nil {
+		return "", fmt.Errorf("could not marshal schema: %w", err)
+	}
+	var s gbnfSchema
+	if err := json.Unmarshal(b, &s); err != nil {
+		return "", fmt.Errorf("could not parse schema: %w", err)
+	}
+	g := &grammarBuilder{
+		defs:  make(map[string]*gbnfSchema),
+		rules: make(map[string]string),
+		refs:  make(map[string]string),
+	}
+	for name, def := range s.Defs {
+		g.defs["#/$defs/"+name] = def
+	}
+	for name, def := range s.Definitions {
+		g.defs["#/definitions/"+name] = def
+	}
+	// reserve root, so definitions can't take the name
+	g.reserve("root")
+	root, err := g.visit(&s, "root")
+	if err != nil {
+		return "", err
+	}
+	g.rules["root"] = root
+
+	var out strings.Builder
+	for _, name := range g.order {
+		fmt.Fprintf(&out, "%s ::= %s\n", name, g.rules[name])
+	}
+	return out.String(), nil
+}
+
+// add adds a rule, renaming it if the name is taken by a different rule, and returns the name used.
+func (g *grammarBuilder) add(name, body string) string {
+	name = cleanRuleName(name)
+	if existing, ok := g.rules[name]; ok && existing == body {
+		return name
+	}
+	name = g.reserve(name)
+	g.rules[name] = body
+	return name
+}
+
+// reserve returns an unused rule name based on name, reserving it for a rule added later.
+func (g *grammarBuilder) reserve(name string) string {
+	name = cleanRuleName(name)
+	unique := name
+	for i := 1; ; i++ {
+		_, taken := g.rules[unique]
+		_, primitive := primitives[unique]
+		if !taken && !primitive {
+			break
+		}
+		unique = fmt.Sprintf("%s%d", name, i)
+	}
+	g.rules[unique] = ""
+	g.order = append(g.order, unique)
+	return unique
+}
+
+func cleanRuleName(name string) string {
+	name = strings.Trim(invalidRuleChars.ReplaceAllString(name, "-"), "-")
+	if name == "" {
+		return "rule"
+	}
+	return name
+}
+
+// primitive adds a primitive rule and the rules it depends on, returning its name.
+func (g *grammarBuilder) primitive(name string) string {
+	if _, ok := g.rules[name]; ok {
+		return name
+	}
+	g.rules[name] = primitives[name]
+	g.order = append(g.order, name)
+	for _, dep := range primitiveDeps[name] {
+		g.primitive(dep)
+	}
+	return name
+}
+
+// visit returns the grammar expression for a schema. name is used for any rules it adds.
+func (g *grammarBuilder) visit(s *gbnfSchema, name string) (string, error) {
+	if s.Ref != "" {
+		return g.visitRef(s.Ref)
+	}
+	if len(s.Const) > 0 {
+		return literal(string(s.Const)) + " " + g.primitive("space"), nil
+	}
+	if len(s.Enum) > 0 {
+		alts := make([]string, len(s.Enum))
+		for i, v := range s.Enum {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return "", err
+			}
+			alts[i] = literal(string(b))
+		}
+		return "(" + strings.Join(alts, " | ") + ") " + g.primitive("space"), nil
+	}
+	if alts := append(slices.Clone(s.AnyOf), s.OneOf...); len(alts) > 0 {
+		return g.alternatives(alts, name)
+	}
+
+	switch t := s.Type.(type) {
+	case []any:
+		alts := make([]*gbnfSchema, len(t))
+		for i, tt := range t {
+			alt := *s
+			alt.Type = tt
+			alts[i] = &alt
+		}
+		return g.alternatives(alts, name)
+	case string:
+		return g.visitType(s, t, name)
+	case nil:
+		if len(s.Properties) > 0 {
+			return g.visitType(s, "object", name)
+		}
+		return g.primitive("value"), nil
+	default:
+		return "", fmt.Errorf("invalid type %v", t)
+	}
+}
+
+func (g *grammarBuilder) visitRef(ref string) (string, error) {
+	if rule, ok := g.refs[ref]; ok {
+		return rule, nil
+	}
+	def, ok := g.defs[ref]
+	if !ok {
+		return "", fmt.Errorf("unsupported reference %s, only local $defs and definitions are supported", ref)
+	}
+	// reserve the name first, in case the definition refers to itself
+	rule := g.reserve(ref[strings.LastIndex(ref, "/")+1:])
+	g.refs[ref] = rule
+	body, err := g.visit(def, rule)
+	if err != nil {
+		return "", err
+	}
+	g.rules[rule] = body
+	return rule, nil
+}
+
+func (g *grammarBuilder) alternatives(alts []*gbnfSchema, name string) (string, error) {
+	exprs := make([]string, len(alts))
+	for i, alt := range alts {
+		expr, err := g.visit(alt, fmt.Sprintf("%s-%d", name, i))
+		if err != nil {
+			return "", err
+		}
+		exprs[i] = expr
+	}
+	return "(" + strings.Join(exprs, " | ") + ")", nil
+}
+
+func (g *grammarBuilder) visitType(s *gbnfSchema, t, name string) (string, error) {
+	switch t {
+	case "string", "number", "integer", "boolean", "null":
+		return g.primitive(t), nil
+	case "array":
+		if s.Items == nil {
+			return g.primitive("array"), nil
+		}
+		item, err := g.visit(s.Items, name+"-item")
+		if err != nil {
+			return "", err
+		}
+		item = g.add(name+"-item", item)
+		space := g.primitive("space")
+		return fmt.Sprintf(`"[" %s (%s ("," %s %s)*)? "]" %s`, space, item, space, item, space), nil
+	case "object":
+		if len(s.Properties) == 0 {
+			return g.primitive("object"), nil
+		}
+		return g.visitObject(s, name)
+	default:
+		return "", fmt.Errorf("unsupported type %s", t)
+	}
+}
+
+func (g *grammarBuilder) visitObject(s *gbnfSchema, name string) (string, error) {
+	space := g.primitive("space")
+	var required, optional []string
+	for _, p := range s.Properties {
+		value, err := g.visit(p.schema, name+"-"+p.name)
+		if err != nil {
+			return "", err
+		}
+		key, _ := json.Marshal(p.name)
+		kv := g.add(name+"-"+p.name+"-kv", fmt.Sprintf(`%s %s ":" %s %s`, literal(string(key)), space, space, value))
+		if slices.Contains(s.Required, p.name) {
+			required = append(required, kv)
+		} else {
+			optional = append(optional, kv)
+		}
+	}
+
+	// optionalTail is each optional property from i on, in order, each preceded by a comma
+	optionalTail := func(i int) string {
+		var parts []string
+		for _, kv := range optional[i:] {
+			parts = append(parts, fmt.Sprintf(`("," %s %s)?`, space, kv))
+		}
+		return strings.Join(parts, " ")
+	}
+
+	body := `"{" ` + space
+	if len(required) > 0 {
+		body += " " + strings.Join(required, ` "," `+space+" ")
+		if len(optional) > 0 {
+			body += " " + optionalTail(0)
+		}
+	} else {
+		// without required properties, any optional property can come first
+		alts := make([]string, len(optional))
+		for i, kv := range optional {
+			alts[i] = strings.TrimSpace(kv + " " + optionalTail(i+1))
+		}
+		body += " (" + strings.Join(alts, " | ") + ")?"
+	}
+	return body + ` "}" ` + space, nil
+}
+
+// literal quotes text as a GBNF string literal.
+func literal(text string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range text {
+		switch r {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,65 @@
+package local_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stillmatic/gollum/packages/llm/providers/local"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONSchemaToGBNF(t *testing.T) {
+	t.Run("object", func(t *testing.T) {
+		// properties keep their order, required ones come first
+		schema := json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"name": {"type": "string"},
+				"tags": {"type": "array", "items": {"enum": ["a", "b"]}},
+				"age": {"type": "integer"}
+			},
+			"required": ["age"]
+		}`)
+		grammar, err := local.JSONSchemaToGBNF(schema)
+		require.NoError(t, err)
+		assert.Equal(t, `root ::= "{" space root-age-kv ("," space root-name-kv)? ("," space root-tags-kv)? "}" space
+space ::= | " " | "\n" [ \t]{0,20}
+string ::= "\"" ([^"\\\x7F\x00-\x1F] | "\\" (["\\/bfnrt] | "u" [0-9a-fA-F]{4}))* "\"" space
+root-name-kv ::= "\"name\"" space ":" space string
+root-tags-item ::= ("\"a\"" | "\"b\"") space
+root-tags-kv ::= "\"tags\"" space ":" space "[" space (root-tags-item ("," space root-tags-item)*)? "]" space
+integer ::= ("-"? ([0-9] | [1-9] [0-9]{0,15})) space
+root-age-kv ::= "\"age\"" space ":" space integer
+`, grammar)
+	})
+
+	t.Run("no required properties", func(t *testing.T) {
+		grammar, err := local.JSONSchemaToGBNF(json.RawMessage(`{"properties": {"a": {"type": "boolean"}, "b": {"type": "null"}}}`))
+		require.NoError(t, err)
+		assert.Contains(t, grammar, `root ::= "{" space (root-a-kv ("," space root-b-kv)? | root-b-kv)? "}" space`)
+	})
+
+	t.Run("recursive reference", func(t *testing.T) {
+		grammar, err := local.JSONSchemaToGBNF(json.RawMessage(`{
+			"$ref": "#/$defs/root",
+			"$defs": {"root": {"type": "object", "properties": {"children": {"type": "array", "items": {"$ref": "#/$defs/root"}}}, "required": ["children"]}}
+		}`))
+		require.NoError(t, err)
+		assert.Contains(t, grammar, "root ::= root1\n")
+		assert.Contains(t, grammar, "root1-children-item ::= root1\n")
+	})
+
+	t.Run("literals and unions", func(t *testing.T) {
+		grammar, err := local.JSONSchemaToGBNF(json.RawMessage(`{"anyOf": [{"const": "say \"hi\""}, {"type": ["number", "null"]}]}`))
+		require.NoError(t, err)
+		assert.Contains(t, grammar, `root ::= ("\"say \\\"hi\\\"\"" space | (number | null))`)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := local.JSONSchemaToGBNF(json.RawMessage(`{"$ref": "https://example.com/schema.json"}`))
+		assert.ErrorContains(t, err, "unsupported reference")
+		_, err = local.JSONSchemaToGBNF(json.RawMessage(`{"type": "tuple"}`))
+		assert.ErrorContains(t, err, "unsupported type")
+	})
+}
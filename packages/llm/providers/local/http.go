@@ -0,0 +1,98 @@
+// Package local implements llm.Responder and llm.Embedder for models served locally by Ollama or a llama.cpp
+// server. Neither needs an API key.
+package local
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/internal/apierr"
+)
+
+// postJSON sends body as JSON and returns the response, which the caller must close.
+// Responses other than 200 are returned as an *apierr.HTTPError.
+func postJSON(ctx context.Context, client *http.Client, url string, body any) (*http.Response, error) {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	// the zero value is usable too
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, &apierr.HTTPError{StatusCode: resp.StatusCode, Body: string(respBody), Header: resp.Header}
+	}
+	return resp, nil
+}
+
+// doJSON posts body and decodes the JSON response into out.
+func doJSON(ctx context.Context, client *http.Client, url string, body, out any) error {
+	resp, err := postJSON(ctx, client, url, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return nil
+}
+
+// newLineScanner scans a streamed response line by line, allowing long lines.
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	return scanner
+}
+
+// defaultBaseURL returns baseURL without a trailing slash, or fallback if it is empty. Hosts without a scheme,
+// like OLLAMA_HOST often is, use http.
+func defaultBaseURL(baseURL, fallback string) string {
+	if baseURL == "" {
+		return fallback
+	}
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "http://" + baseURL
+	}
+	return strings.TrimRight(baseURL, "/")
+}
+
+// toolCallID names calls by their tool, suffixed when repeated, since local servers don't always assign IDs.
+func toolCallID(seen map[string]int, name string) string {
+	id := name
+	if n := seen[name]; n > 0 {
+		id = fmt.Sprintf("%s-%d", name, n)
+	}
+	seen[name]++
+	return id
+}
+
+// sendDelta sends the delta unless the context is done first, returning whether it was sent.
+func sendDelta(ctx context.Context, ch chan<- llm.StreamDelta, delta llm.StreamDelta) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case ch <- delta:
+		return true
+	}
+}
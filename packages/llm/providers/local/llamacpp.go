@@ -0,0 +1,345 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/internal/apierr"
+	"github.com/stillmatic/gollum/packages/llm/providers/transport"
+)
+
+const defaultLlamaCppURL = "http://localhost:8080"
+
+// LlamaCppProvider talks to a llama.cpp server through its OpenAI-compatible API. Response formats are sent as
+// GBNF grammars, see JSONSchemaToGBNF. Tools are not supported.
+type LlamaCppProvider struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewLlamaCppProvider returns a provider for the llama.cpp server at baseURL, http://localhost:8080 if empty.
+// transport.WithBaseURL, if given, takes precedence over baseURL.
+func NewLlamaCppProvider(baseURL string, opts ...transport.Option) *LlamaCppProvider {
+	settings := transport.Apply(opts...)
+	return &LlamaCppProvider{
+		baseURL: defaultBaseURL(settings.BaseURLOr(baseURL), defaultLlamaCppURL),
+		client:  settings.Client(),
+	}
+}
+
+type llamaCppMessage struct {
+	Role string `json:"role"`
+	// Content is a string, or a list of parts when the message has images.
+	Content any `json:"content"`
+}
+
+type llamaCppPart struct {
+	Type     string            `json:"type"`
+	Text     string            `json:"text,omitempty"`
+	ImageURL *llamaCppImageURL `json:"image_url,omitempty"`
+}
+
+type llamaCppImageURL struct {
+	URL string `json:"url"`
+}
+
+type llamaCppChatRequest struct {
+	Model            string            `json:"model,omitempty"`
+	Messages         []llamaCppMessage `json:"messages"`
+	MaxTokens        int               `json:"max_tokens,omitempty"`
+	Temperature      float32           `json:"temperature,omitempty"`
+	TopP             float32           `json:"top_p,omitempty"`
+	TopK             int               `json:"top_k,omitempty"`
+	Stop             []string          `json:"stop,omitempty"`
+	Seed             *int              `json:"seed,omitempty"`
+	PresencePenalty  float32           `json:"presence_penalty,omitempty"`
+	FrequencyPenalty float32           `json:"frequency_penalty,omitempty"`
+	Grammar          string            `json:"grammar,omitempty"`
+	Stream           bool              `json:"stream"`
+}
+
+type llamaCppUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+type llamaCppChatResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *llamaCppUsage `json:"usage"`
+}
+
+func chatRequestToLlamaCpp(req llm.InferRequest, stream bool) (llamaCppChatRequest, error) {
+	opts := req.MessageOptions
+	model := req.ModelConfig.ModelName
+	if len(req.Tools) > 0 {
+		return llamaCppChatRequest{}, &llm.UnsupportedCapabilityError{Capability: llm.CapabilityTools, Model: model}
+	}
+	// candidates are emulated by Infer
+	if err := opts.Check(model, llm.OptionTopP, llm.OptionTopK, llm.OptionStopSequences, llm.OptionSeed,
+		llm.OptionPresencePenalty, llm.OptionFrequencyPenalty, llm.OptionCandidates); err != nil {
+		return llamaCppChatRequest{}, err
+	}
+	msgs, err := messagesToLlamaCpp(req)
+	if err != nil {
+		return llamaCppChatRequest{}, fmt.Errorf("invalid messages: %w", err)
+	}
+	chatReq := llamaCppChatRequest{
+		Model:            model,
+		Messages:         msgs,
+		MaxTokens:        opts.MaxTokens,
+		Temperature:      opts.Temperature,
+		TopP:             opts.TopP,
+		TopK:             opts.TopK,
+		Stop:             opts.StopSequences,
+		Seed:             opts.Seed,
+		PresencePenalty:  opts.PresencePenalty,
+		FrequencyPenalty: opts.FrequencyPenalty,
+		Stream:           stream,
+	}
+	if rf := req.ResponseFormat; rf != nil {
+		grammar, err := JSONSchemaToGBNF(rf.Schema)
+		if err != nil {
+			return llamaCppChatRequest{}, fmt.Errorf("could not convert response format to a grammar: %w", err)
+		}
+		chatReq.Grammar = grammar
+	}
+	return chatReq, nil
+}
+
+func messagesToLlamaCpp(req llm.InferRequest) ([]llamaCppMessage, error) {
+	model := req.ModelConfig.ModelName
+	msgs := make([]llamaCppMessage, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		if m.Role == "tool" || len(m.ToolCalls) > 0 {
+			return nil, &llm.UnsupportedCapabilityError{Capability: llm.CapabilityTools, Model: model}
+		}
+		parts := m.ContentParts()
+		hasImage := false
+		for _, part := range parts {
+			hasImage = hasImage || part.Type != llm.PartTypeText
+		}
+		if !hasImage {
+			var text strings.Builder
+			for _, part := range parts {
+				text.WriteString(part.Text)
+			}
+			msgs = append(msgs, llamaCppMessage{Role: m.Role, Content: text.String()})
+			continue
+		}
+
+		// multimodal models take images as data URIs
+		content := make([]llamaCppPart, 0, len(parts))
+		for _, part := range parts {
+			switch part.Type {
+			case llm.PartTypeText:
+				content = append(content, llamaCppPart{Type: "text", Text: part.Text})
+			case llm.PartTypeImage:
+				url := "data:" + part.MIMEType + ";base64," + base64.StdEncoding.EncodeToString(part.Data)
+				content = append(content, llamaCppPart{Type: "image_url", ImageURL: &llamaCppImageURL{URL: url}})
+			default:
+				return nil, &llm.UnsupportedPartError{Type: part.Type, MIMEType: part.MIMEType, Model: model}
+			}
+		}
+		msgs = append(msgs, llamaCppMessage{Role: m.Role, Content: content})
+	}
+	return msgs, nil
+}
+
+func (p *LlamaCppProvider) GenerateResponse(ctx context.Context, req llm.InferRequest) (string, error) {
+	res, err := p.Infer(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	return res.Content, nil
+}
+
+// Infer generates a response. The server generates one candidate per request, so several candidates are
+// generated by parallel calls.
+func (p *LlamaCppProvider) Infer(ctx context.Context, req llm.InferRequest) (*llm.InferResponse, error) {
+	if err := llm.ValidateRequest(req, false); err != nil {
+		return nil, err
+	}
+	return llm.InferParallel(ctx, req, p.infer)
+}
+
+func (p *LlamaCppProvider) infer(ctx context.Context, req llm.InferRequest) (*llm.InferResponse, error) {
+	chatReq, err := chatRequestToLlamaCpp(req, false)
+	if err != nil {
+		return nil, err
+	}
+	var res llamaCppChatResponse
+	if err := doJSON(ctx, p.client, p.baseURL+"/v1/chat/completions", chatReq, &res); err != nil {
+		return nil, fmt.Errorf("llama.cpp chat error: %w", apierr.Classify(llm.ProviderLlamaCpp, err))
+	}
+	if len(res.Choices) == 0 {
+		return nil, errors.New("llama.cpp returned no choices")
+	}
+	choice := res.Choices[0]
+	return responseFromLlamaCpp(req, res.Model, choice.Message.Content, choice.FinishReason, res.Usage), nil
+}
+
+func responseFromLlamaCpp(req llm.InferRequest, model, content string, finishReason *string, usage *llamaCppUsage) *llm.InferResponse {
+	resp := &llm.InferResponse{
+		Content:      content,
+		Model:        model,
+		FinishReason: llm.FinishReasonOther,
+	}
+	if finishReason != nil {
+		switch *finishReason {
+		case "stop":
+			resp.FinishReason = llm.FinishReasonStop
+		case "length":
+			resp.FinishReason = llm.FinishReasonLength
+		}
+	}
+	if usage != nil {
+		resp.Usage = llm.Usage{InputTokens: usage.PromptTokens, OutputTokens: usage.CompletionTokens}
+	}
+	resp.Cost = llm.Cost(req.ModelConfig, resp.Usage)
+	return resp
+}
+
+// GenerateResponseAsync streams the response as server-sent events.
+func (p *LlamaCppProvider) GenerateResponseAsync(ctx context.Context, req llm.InferRequest) (<-chan llm.StreamDelta, error) {
+	if err := llm.ValidateRequest(req, true); err != nil {
+		return nil, err
+	}
+	outChan := make(chan llm.StreamDelta)
+	go func() {
+		defer close(outChan)
+		if req.MessageOptions.Candidates > 1 {
+			sendDelta(ctx, outChan, llm.StreamDelta{Err: llm.ErrStreamingCandidates})
+			return
+		}
+		resp, err := p.stream(ctx, req, func(text string) bool {
+			return sendDelta(ctx, outChan, llm.StreamDelta{Text: text})
+		})
+		if err != nil {
+			sendDelta(ctx, outChan, llm.StreamDelta{Err: err})
+			return
+		}
+		sendDelta(ctx, outChan, llm.StreamDelta{
+			EOF:          true,
+			FinishReason: resp.FinishReason,
+			Model:        resp.Model,
+			Usage:        resp.Usage,
+			Cost:         resp.Cost,
+		})
+	}()
+	return outChan, nil
+}
+
+// stream calls onText with each chunk of text, stopping early if it returns false, and returns the full response.
+// The stream ends with a [DONE] event, a stream without it was cut off.
+func (p *LlamaCppProvider) stream(ctx context.Context, req llm.InferRequest, onText func(string) bool) (*llm.InferResponse, error) {
+	chatReq, err := chatRequestToLlamaCpp(req, true)
+	if err != nil {
+		return nil, err
+	}
+	httpResp, err := postJSON(ctx, p.client, p.baseURL+"/v1/chat/completions", chatReq)
+	if err != nil {
+		return nil, fmt.Errorf("llama.cpp chat error: %w", apierr.Classify(llm.ProviderLlamaCpp, err))
+	}
+	defer httpResp.Body.Close()
+
+	var text strings.Builder
+	var model string
+	var finishReason *string
+	var usage *llamaCppUsage
+	scanner := newLineScanner(httpResp.Body)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		// the server reports errors part way as an error event
+		if data, ok := bytes.CutPrefix(line, []byte("error:")); ok {
+			return nil, apierr.Classify(llm.ProviderLlamaCpp, fmt.Errorf("llama.cpp stream error: %s", bytes.TrimSpace(data)))
+		}
+		data, ok := bytes.CutPrefix(line, []byte("data:"))
+		if !ok {
+			continue
+		}
+		data = bytes.TrimSpace(data)
+		if string(data) == "[DONE]" {
+			return responseFromLlamaCpp(req, model, text.String(), finishReason, usage), nil
+		}
+		var chunk llamaCppChatResponse
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal stream chunk: %w", err)
+		}
+		if chunk.Model != "" {
+			model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		choice := chunk.Choices[0]
+		if choice.FinishReason != nil {
+			finishReason = choice.FinishReason
+		}
+		if choice.Delta.Content != "" {
+			text.WriteString(choice.Delta.Content)
+			if !onText(choice.Delta.Content) {
+				return nil, ctx.Err()
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stream: %w", err)
+	}
+	return nil, errors.New("llama.cpp stream ended unexpectedly")
+}
+
+type llamaCppEmbedRequest struct {
+	Model string   `json:"model,omitempty"`
+	Input []string `json:"input"`
+}
+
+type llamaCppEmbedResponse struct {
+	Data []struct {
+		Embedding []float32 `json:"embedding"`
+		Index     int       `json:"index"`
+	} `json:"data"`
+}
+
+// GenerateEmbedding embeds the input. The server must be started with --embeddings.
+func (p *LlamaCppProvider) GenerateEmbedding(ctx context.Context, req llm.EmbedRequest) (*llm.EmbeddingResponse, error) {
+	if len(req.Image) > 0 {
+		return nil, fmt.Errorf("image embedding not supported by llama.cpp")
+	}
+	if req.Dimensions != 0 {
+		return nil, fmt.Errorf("custom dimensions not supported by llama.cpp")
+	}
+	var res llamaCppEmbedResponse
+	embedReq := llamaCppEmbedRequest{Model: req.ModelConfig.ModelName, Input: req.Input}
+	if err := doJSON(ctx, p.client, p.baseURL+"/v1/embeddings", embedReq, &res); err != nil {
+		return nil, fmt.Errorf("llama.cpp embed error: %w", apierr.Classify(llm.ProviderLlamaCpp, err))
+	}
+	sort.Slice(res.Data, func(i, j int) bool { return res.Data[i].Index < res.Data[j].Index })
+	embeddings := make([]llm.Embedding, len(res.Data))
+	for i, data := range res.Data {
+		embeddings[i] = llm.Embedding{Values: data.Embedding}
+	}
+	return &llm.EmbeddingResponse{Data: embeddings}, nil
+}
+
+var _ llm.Responder = &LlamaCppProvider{}
+var _ llm.Embedder = &LlamaCppProvider{}
@@ -0,0 +1,170 @@
+package local_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/llmtest"
+	"github.com/stillmatic/gollum/packages/llm/providers/local"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func llamaCppServer(t *testing.T, handle func(w http.ResponseWriter, path string, body map[string]any)) *local.LlamaCppProvider {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		handle(w, r.URL.Path, body)
+	}))
+	t.Cleanup(srv.Close)
+	return local.NewLlamaCppProvider(srv.URL)
+}
+
+// serveLlamaCppScenario renders the scenario as an OpenAI style chat completion event stream.
+func serveLlamaCppScenario(s llmtest.Scenario) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.Status != 0 {
+			w.WriteHeader(s.Status)
+			fmt.Fprintf(w, `{"error": {"code": %d, "message": "server error", "type": "server_error"}}`, s.Status)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		send := func(chunk map[string]any) {
+			fmt.Fprintf(w, "data: %s\n\n", llmtest.MustJSON(chunk))
+			w.(http.Flusher).Flush()
+		}
+		for _, c := range s.Chunks {
+			send(map[string]any{"model": "test-model", "choices": []map[string]any{{"index": 0, "delta": map[string]any{"content": c}}}})
+		}
+		if s.Hang {
+			<-r.Context().Done()
+			return
+		}
+		if s.Fail {
+			fmt.Fprint(w, `data: {"model": "test-model", "choi`)
+			return
+		}
+		send(map[string]any{"model": "test-model", "choices": []map[string]any{{"index": 0, "delta": map[string]any{}, "finish_reason": "stop"}}})
+		send(map[string]any{"model": "test-model", "choices": []any{}, "usage": map[string]any{
+			"prompt_tokens": s.Usage.InputTokens, "completion_tokens": s.Usage.OutputTokens,
+		}})
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}
+}
+
+func TestLlamaCppStreaming(t *testing.T) {
+	llmtest.TestStreaming(t, func(t *testing.T, s llmtest.Scenario) llm.Responder {
+		if len(s.ToolCalls) > 0 {
+			t.Skip("the llama.cpp provider doesn't support tools")
+		}
+		srv := httptest.NewServer(serveLlamaCppScenario(s))
+		t.Cleanup(srv.Close)
+		return local.NewLlamaCppProvider(srv.URL)
+	})
+}
+
+func TestLlamaCppInfer(t *testing.T) {
+	ctx := context.Background()
+	cfg := llm.ModelConfig{ProviderType: llm.ProviderLlamaCpp, ModelName: "qwen2.5-7b"}
+
+	var got map[string]any
+	p := llamaCppServer(t, func(w http.ResponseWriter, path string, body map[string]any) {
+		assert.Equal(t, "/v1/chat/completions", path)
+		got = body
+		fmt.Fprint(w, `{"model": "qwen2.5-7b", "choices": [{"index": 0, "message": {"role": "assistant", "content": "{\"name\": \"Ada\"}"}, "finish_reason": "stop"}],
+			"usage": {"prompt_tokens": 20, "completion_tokens": 6}}`)
+	})
+
+	res, err := p.Infer(ctx, llm.InferRequest{
+		ModelConfig: cfg,
+		Messages: []llm.InferMessage{
+			{Role: "user", Parts: []llm.Part{llm.TextPart("who is this?"), llm.ImagePart([]byte("\x89PNG\r\n\x1a\nimage"))}},
+		},
+		MessageOptions: llm.MessageOptions{MaxTokens: 50, TopK: 20},
+		ResponseFormat: &llm.ResponseFormat{Name: "person", Schema: json.RawMessage(`{"type": "object", "properties": {"name": {"type": "string"}}, "required": ["name"]}`)},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `{"name": "Ada"}`, res.Content)
+	assert.Equal(t, llm.FinishReasonStop, res.FinishReason)
+	assert.Equal(t, llm.Usage{InputTokens: 20, OutputTokens: 6}, res.Usage)
+
+	assert.Equal(t, 50.0, got["max_tokens"])
+	assert.Equal(t, 20.0, got["top_k"])
+	assert.Contains(t, got["grammar"], `root ::= "{" space root-name-kv "}" space`)
+	assert.Equal(t, []any{map[string]any{"role": "user", "content": []any{
+		map[string]any{"type": "text", "text": "who is this?"},
+		map[string]any{"type": "image_url", "image_url": map[string]any{"url": "data:image/png;base64,iVBORw0KGgppbWFnZQ=="}},
+	}}}, got["messages"])
+
+	_, err = p.Infer(ctx, llm.InferRequest{
+		ModelConfig: cfg,
+		Messages:    []llm.InferMessage{{Role: "user", Content: "hi"}},
+		Tools:       []llm.Tool{{Name: "weather"}},
+	})
+	assert.ErrorIs(t, err, llm.ErrUnsupportedCapability)
+}
+
+func TestLlamaCppStream(t *testing.T) {
+	ctx := context.Background()
+	req := llm.InferRequest{
+		ModelConfig: llm.ModelConfig{ProviderType: llm.ProviderLlamaCpp, ModelName: "qwen2.5-7b"},
+		Messages:    []llm.InferMessage{{Role: "user", Content: "hi"}},
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		p := llamaCppServer(t, func(w http.ResponseWriter, _ string, body map[string]any) {
+			assert.Equal(t, true, body["stream"])
+			fmt.Fprint(w, "data: {\"model\": \"qwen2.5-7b\", \"choices\": [{\"delta\": {\"content\": \"Hel\"}, \"finish_reason\": null}]}\n\n")
+			fmt.Fprint(w, "data: {\"model\": \"qwen2.5-7b\", \"choices\": [{\"delta\": {\"content\": \"lo\"}, \"finish_reason\": null}]}\n\n")
+			fmt.Fprint(w, "data: {\"model\": \"qwen2.5-7b\", \"choices\": [{\"delta\": {}, \"finish_reason\": \"length\"}], \"usage\": {\"prompt_tokens\": 3, \"completion_tokens\": 2}}\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+		})
+		ch, err := p.GenerateResponseAsync(ctx, req)
+		require.NoError(t, err)
+		var deltas []llm.StreamDelta
+		for d := range ch {
+			deltas = append(deltas, d)
+		}
+		require.Len(t, deltas, 3)
+		assert.Equal(t, "Hel", deltas[0].Text)
+		assert.Equal(t, "lo", deltas[1].Text)
+		assert.True(t, deltas[2].EOF)
+		assert.Equal(t, "qwen2.5-7b", deltas[2].Model)
+		assert.Equal(t, llm.FinishReasonLength, deltas[2].FinishReason)
+		assert.Equal(t, llm.Usage{InputTokens: 3, OutputTokens: 2}, deltas[2].Usage)
+	})
+
+	t.Run("error event", func(t *testing.T) {
+		p := llamaCppServer(t, func(w http.ResponseWriter, _ string, _ map[string]any) {
+			fmt.Fprint(w, "data: {\"choices\": [{\"delta\": {\"content\": \"Hel\"}}]}\n\n")
+			fmt.Fprint(w, "error: {\"code\": 500, \"message\": \"context shift disabled\"}\n\n")
+		})
+		ch, err := p.GenerateResponseAsync(ctx, req)
+		require.NoError(t, err)
+		var last llm.StreamDelta
+		for d := range ch {
+			last = d
+		}
+		assert.ErrorContains(t, last.Err, "context shift disabled")
+	})
+}
+
+func TestLlamaCppEmbedding(t *testing.T) {
+	p := llamaCppServer(t, func(w http.ResponseWriter, path string, body map[string]any) {
+		assert.Equal(t, "/v1/embeddings", path)
+		// out of order, to check they are sorted
+		fmt.Fprint(w, `{"data": [{"index": 1, "embedding": [0.3, 0.4]}, {"index": 0, "embedding": [0.1, 0.2]}]}`)
+	})
+	res, err := p.GenerateEmbedding(context.Background(), llm.EmbedRequest{
+		ModelConfig: llm.ModelConfig{ProviderType: llm.ProviderLlamaCpp, ModelName: "bge-small"},
+		Input:       []string{"a", "b"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []llm.Embedding{{Values: []float32{0.1, 0.2}}, {Values: []float32{0.3, 0.4}}}, res.Data)
+}
@@ -0,0 +1,372 @@
+package local
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/internal/apierr"
+	"github.com/stillmatic/gollum/packages/llm/providers/transport"
+)
+
+const defaultOllamaURL = "http://localhost:11434"
+
+// OllamaProvider talks to an Ollama server, using its native API rather than the OpenAI-compatible one, which
+// lacks keep-alive and grammar-constrained JSON schema output.
+type OllamaProvider struct {
+	// KeepAlive is how long the server keeps the model loaded after a request, negative keeps it loaded
+	// indefinitely. Zero leaves the server default, usually five minutes.
+	KeepAlive time.Duration
+
+	baseURL string
+	client  *http.Client
+}
+
+// NewOllamaProvider returns a provider for the Ollama server at baseURL, http://localhost:11434 if empty.
+// transport.WithBaseURL, if given, takes precedence over baseURL.
+func NewOllamaProvider(baseURL string, opts ...transport.Option) *OllamaProvider {
+	settings := transport.Apply(opts...)
+	return &OllamaProvider{
+		baseURL: defaultBaseURL(settings.BaseURLOr(baseURL), defaultOllamaURL),
+		client:  settings.Client(),
+	}
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Images    []string         `json:"images,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	// ToolName is the tool a "tool" message answers.
+	ToolName string `json:"tool_name,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaTool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string `json:"name"`
+		Description string `json:"description,omitempty"`
+		Parameters  any    `json:"parameters"`
+	} `json:"function"`
+}
+
+type ollamaOptions struct {
+	NumPredict       int      `json:"num_predict,omitempty"`
+	Temperature      float32  `json:"temperature,omitempty"`
+	TopP             float32  `json:"top_p,omitempty"`
+	TopK             int      `json:"top_k,omitempty"`
+	Stop             []string `json:"stop,omitempty"`
+	Seed             *int     `json:"seed,omitempty"`
+	PresencePenalty  float32  `json:"presence_penalty,omitempty"`
+	FrequencyPenalty float32  `json:"frequency_penalty,omitempty"`
+}
+
+type ollamaChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Tools    []ollamaTool    `json:"tools,omitempty"`
+	// Format is a JSON schema, which the server turns into a grammar.
+	Format    any           `json:"format,omitempty"`
+	Options   ollamaOptions `json:"options"`
+	Stream    bool          `json:"stream"`
+	KeepAlive string        `json:"keep_alive,omitempty"`
+}
+
+type ollamaChatResponse struct {
+	Model           string        `json:"model"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	// Error is set on stream chunks when generation fails part way.
+	Error string `json:"error"`
+}
+
+func (p *OllamaProvider) keepAlive() string {
+	if p.KeepAlive == 0 {
+		return ""
+	}
+	return p.KeepAlive.String()
+}
+
+func (p *OllamaProvider) chatRequest(req llm.InferRequest, stream bool) (ollamaChatRequest, error) {
+	opts := req.MessageOptions
+	model := req.ModelConfig.ModelName
+	// candidates are emulated by Infer
+	if err := opts.Check(model, llm.OptionTopP, llm.OptionTopK, llm.OptionStopSequences, llm.OptionSeed,
+		llm.OptionPresencePenalty, llm.OptionFrequencyPenalty, llm.OptionCandidates); err != nil {
+		return ollamaChatRequest{}, err
+	}
+	msgs, err := messagesToOllama(req)
+	if err != nil {
+		return ollamaChatRequest{}, fmt.Errorf("invalid messages: %w", err)
+	}
+	chatReq := ollamaChatRequest{
+		Model:    model,
+		Messages: msgs,
+		Options: ollamaOptions{
+			NumPredict:       opts.MaxTokens,
+			Temperature:      opts.Temperature,
+			TopP:             opts.TopP,
+			TopK:             opts.TopK,
+			Stop:             opts.StopSequences,
+			Seed:             opts.Seed,
+			PresencePenalty:  opts.PresencePenalty,
+			FrequencyPenalty: opts.FrequencyPenalty,
+		},
+		Stream:    stream,
+		KeepAlive: p.keepAlive(),
+	}
+	if rf := req.ResponseFormat; rf != nil {
+		chatReq.Format = rf.Schema
+	}
+
+	// ollama has no tool choice, the model always decides
+	tools := req.Tools
+	if tc := req.ToolChoice; tc != nil {
+		switch tc.Type {
+		case llm.ToolChoiceAuto:
+		case llm.ToolChoiceNone:
+			tools = nil
+		default:
+			return ollamaChatRequest{}, fmt.Errorf("tool choice %s is not supported by ollama", tc.Type)
+		}
+	}
+	for _, t := range tools {
+		ot := ollamaTool{Type: "function"}
+		ot.Function.Name = t.Name
+		ot.Function.Description = t.Description
+		ot.Function.Parameters = t.Parameters
+		if ot.Function.Parameters == nil {
+			ot.Function.Parameters = map[string]any{"type": "object"}
+		}
+		chatReq.Tools = append(chatReq.Tools, ot)
+	}
+	return chatReq, nil
+}
+
+func messagesToOllama(req llm.InferRequest) ([]ollamaMessage, error) {
+	model := req.ModelConfig.ModelName
+	// ollama links tool results to calls by tool name, so map our call IDs back to names
+	toolNames := make(map[string]string)
+	msgs := make([]ollamaMessage, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		msg := ollamaMessage{Role: m.Role}
+		if m.Role == "tool" {
+			msg.Content = m.Content
+			msg.ToolName = toolNames[m.ToolCallID]
+			msgs = append(msgs, msg)
+			continue
+		}
+
+		// ollama takes the text and images of a message separately, so the order of the parts is lost
+		var text strings.Builder
+		for _, part := range m.ContentParts() {
+			switch part.Type {
+			case llm.PartTypeText:
+				text.WriteString(part.Text)
+			case llm.PartTypeImage:
+				msg.Images = append(msg.Images, base64.StdEncoding.EncodeToString(part.Data))
+			default:
+				return nil, &llm.UnsupportedPartError{Type: part.Type, MIMEType: part.MIMEType, Model: model}
+			}
+		}
+		msg.Content = text.String()
+
+		for _, tc := range m.ToolCalls {
+			args := tc.Arguments
+			if args == "" {
+				args = "{}"
+			}
+			var call ollamaToolCall
+			call.Function.Name = tc.Name
+			call.Function.Arguments = json.RawMessage(args)
+			msg.ToolCalls = append(msg.ToolCalls, call)
+			toolNames[tc.ID] = tc.Name
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+func (p *OllamaProvider) GenerateResponse(ctx context.Context, req llm.InferRequest) (string, error) {
+	res, err := p.Infer(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	return res.Content, nil
+}
+
+// Infer generates a response. Ollama can't generate several candidates in one call, so they are generated
+// by parallel calls.
+func (p *OllamaProvider) Infer(ctx context.Context, req llm.InferRequest) (*llm.InferResponse, error) {
+	if err := llm.ValidateRequest(req, false); err != nil {
+		return nil, err
+	}
+	return llm.InferParallel(ctx, req, p.infer)
+}
+
+func (p *OllamaProvider) infer(ctx context.Context, req llm.InferRequest) (*llm.InferResponse, error) {
+	chatReq, err := p.chatRequest(req, false)
+	if err != nil {
+		return nil, err
+	}
+	var res ollamaChatResponse
+	if err := doJSON(ctx, p.client, p.baseURL+"/api/chat", chatReq, &res); err != nil {
+		return nil, fmt.Errorf("ollama chat error: %w", apierr.Classify(llm.ProviderOllama, err))
+	}
+	return responseFromOllama(req, res, res.Message.Content, res.Message.ToolCalls), nil
+}
+
+func responseFromOllama(req llm.InferRequest, res ollamaChatResponse, content string, calls []ollamaToolCall) *llm.InferResponse {
+	resp := &llm.InferResponse{
+		Content: content,
+		Model:   res.Model,
+		Usage:   llm.Usage{InputTokens: res.PromptEvalCount, OutputTokens: res.EvalCount},
+	}
+	seen := make(map[string]int)
+	for _, c := range calls {
+		resp.ToolCalls = append(resp.ToolCalls, llm.ToolCall{
+			ID:        toolCallID(seen, c.Function.Name),
+			Name:      c.Function.Name,
+			Arguments: string(c.Function.Arguments),
+		})
+	}
+	switch {
+	case len(resp.ToolCalls) > 0:
+		resp.FinishReason = llm.FinishReasonToolCalls
+	case res.DoneReason == "stop":
+		resp.FinishReason = llm.FinishReasonStop
+	case res.DoneReason == "length":
+		resp.FinishReason = llm.FinishReasonLength
+	default:
+		resp.FinishReason = llm.FinishReasonOther
+	}
+	resp.Cost = llm.Cost(req.ModelConfig, resp.Usage)
+	return resp
+}
+
+// GenerateResponseAsync streams the response. Ollama streams newline delimited JSON, ending with a chunk with
+// done set, which carries the usage.
+func (p *OllamaProvider) GenerateResponseAsync(ctx context.Context, req llm.InferRequest) (<-chan llm.StreamDelta, error) {
+	if err := llm.ValidateRequest(req, true); err != nil {
+		return nil, err
+	}
+	outChan := make(chan llm.StreamDelta)
+	go func() {
+		defer close(outChan)
+		if req.MessageOptions.Candidates > 1 {
+			sendDelta(ctx, outChan, llm.StreamDelta{Err: llm.ErrStreamingCandidates})
+			return
+		}
+		resp, err := p.stream(ctx, req, func(text string) bool {
+			return sendDelta(ctx, outChan, llm.StreamDelta{Text: text})
+		})
+		if err != nil {
+			sendDelta(ctx, outChan, llm.StreamDelta{Err: err})
+			return
+		}
+		sendDelta(ctx, outChan, llm.StreamDelta{
+			EOF:          true,
+			ToolCalls:    resp.ToolCalls,
+			FinishReason: resp.FinishReason,
+			Model:        resp.Model,
+			Usage:        resp.Usage,
+			Cost:         resp.Cost,
+		})
+	}()
+	return outChan, nil
+}
+
+// stream calls onText with each chunk of text, stopping early if it returns false, and returns the full response.
+func (p *OllamaProvider) stream(ctx context.Context, req llm.InferRequest, onText func(string) bool) (*llm.InferResponse, error) {
+	chatReq, err := p.chatRequest(req, true)
+	if err != nil {
+		return nil, err
+	}
+	httpResp, err := postJSON(ctx, p.client, p.baseURL+"/api/chat", chatReq)
+	if err != nil {
+		return nil, fmt.Errorf("ollama chat error: %w", apierr.Classify(llm.ProviderOllama, err))
+	}
+	defer httpResp.Body.Close()
+
+	var text strings.Builder
+	var calls []ollamaToolCall
+	scanner := newLineScanner(httpResp.Body)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var chunk ollamaChatResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal stream chunk: %w", err)
+		}
+		if chunk.Error != "" {
+			return nil, apierr.Classify(llm.ProviderOllama, fmt.Errorf("ollama stream error: %s", chunk.Error))
+		}
+		calls = append(calls, chunk.Message.ToolCalls...)
+		if chunk.Message.Content != "" {
+			text.WriteString(chunk.Message.Content)
+			if !onText(chunk.Message.Content) {
+				return nil, ctx.Err()
+			}
+		}
+		if chunk.Done {
+			return responseFromOllama(req, chunk, text.String(), calls), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stream: %w", err)
+	}
+	return nil, errors.New("ollama stream ended unexpectedly")
+}
+
+type ollamaEmbedRequest struct {
+	Model      string   `json:"model"`
+	Input      []string `json:"input"`
+	Dimensions int      `json:"dimensions,omitempty"`
+	KeepAlive  string   `json:"keep_alive,omitempty"`
+}
+
+type ollamaEmbedResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+func (p *OllamaProvider) GenerateEmbedding(ctx context.Context, req llm.EmbedRequest) (*llm.EmbeddingResponse, error) {
+	if len(req.Image) > 0 {
+		return nil, fmt.Errorf("image embedding not supported by ollama")
+	}
+	embedReq := ollamaEmbedRequest{
+		Model:      req.ModelConfig.ModelName,
+		Input:      req.Input,
+		Dimensions: req.Dimensions,
+		KeepAlive:  p.keepAlive(),
+	}
+	var res ollamaEmbedResponse
+	if err := doJSON(ctx, p.client, p.baseURL+"/api/embed", embedReq, &res); err != nil {
+		return nil, fmt.Errorf("ollama embed error: %w", apierr.Classify(llm.ProviderOllama, err))
+	}
+	embeddings := make([]llm.Embedding, len(res.Embeddings))
+	for i, values := range res.Embeddings {
+		embeddings[i] = llm.Embedding{Values: values}
+	}
+	return &llm.EmbeddingResponse{Data: embeddings}, nil
+}
+
+var _ llm.Responder = &OllamaProvider{}
+var _ llm.Embedder = &OllamaProvider{}
@@ -0,0 +1,235 @@
+package local_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/internal/apierr"
+	"github.com/stillmatic/gollum/packages/llm/llmtest"
+	"github.com/stillmatic/gollum/packages/llm/providers/local"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ollamaServer stands in for an Ollama server, passing each decoded request body to handle.
+func ollamaServer(t *testing.T, handle func(w http.ResponseWriter, path string, body map[string]any)) *local.OllamaProvider {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		handle(w, r.URL.Path, body)
+	}))
+	t.Cleanup(srv.Close)
+	return local.NewOllamaProvider(srv.URL + "/")
+}
+
+func TestOllamaInfer(t *testing.T) {
+	ctx := context.Background()
+	cfg := llm.ModelConfig{ProviderType: llm.ProviderOllama, ModelName: "llama3.2"}
+	image := []byte("\x89PNG\r\n\x1a\nimage")
+
+	var got map[string]any
+	p := ollamaServer(t, func(w http.ResponseWriter, path string, body map[string]any) {
+		assert.Equal(t, "/api/chat", path)
+		got = body
+		fmt.Fprint(w, `{"model": "llama3.2", "message": {"role": "assistant", "content": "",
+			"tool_calls": [{"function": {"name": "weather", "arguments": {"city": "Paris"}}}, {"function": {"name": "weather", "arguments": {"city": "Rome"}}}]},
+			"done": true, "done_reason": "stop", "prompt_eval_count": 12, "eval_count": 5}`)
+	})
+	p.KeepAlive = 10 * time.Minute
+
+	seed := 7
+	res, err := p.Infer(ctx, llm.InferRequest{
+		ModelConfig: cfg,
+		Messages: []llm.InferMessage{
+			{Role: "system", Content: "be brief"},
+			{Role: "user", Parts: []llm.Part{llm.TextPart("what's this? "), llm.ImagePart(image)}},
+			{Role: "assistant", ToolCalls: []llm.ToolCall{{ID: "call-1", Name: "lookup", Arguments: `{"q": "x"}`}}},
+			{Role: "tool", ToolCallID: "call-1", Content: "a picture"},
+		},
+		MessageOptions: llm.MessageOptions{MaxTokens: 100, TopK: 40, Seed: &seed},
+		Tools:          []llm.Tool{{Name: "weather", Description: "get the weather"}},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "llama3.2", got["model"])
+	assert.Equal(t, false, got["stream"])
+	assert.Equal(t, "10m0s", got["keep_alive"])
+	assert.Equal(t, map[string]any{"num_predict": 100.0, "top_k": 40.0, "seed": 7.0}, got["options"])
+	msgs := got["messages"].([]any)
+	require.Len(t, msgs, 4)
+	assert.Equal(t, map[string]any{"role": "user", "content": "what's this? ", "images": []any{"iVBORw0KGgppbWFnZQ=="}}, msgs[1])
+	assert.Equal(t, map[string]any{"role": "assistant", "content": "", "tool_calls": []any{
+		map[string]any{"function": map[string]any{"name": "lookup", "arguments": map[string]any{"q": "x"}}},
+	}}, msgs[2])
+	assert.Equal(t, map[string]any{"role": "tool", "content": "a picture", "tool_name": "lookup"}, msgs[3])
+	require.Len(t, got["tools"], 1)
+
+	assert.Equal(t, []llm.ToolCall{
+		{ID: "weather", Name: "weather", Arguments: `{"city": "Paris"}`},
+		{ID: "weather-1", Name: "weather", Arguments: `{"city": "Rome"}`},
+	}, res.ToolCalls)
+	assert.Equal(t, llm.FinishReasonToolCalls, res.FinishReason)
+	assert.Equal(t, llm.Usage{InputTokens: 12, OutputTokens: 5}, res.Usage)
+
+	t.Run("response format", func(t *testing.T) {
+		schema := map[string]any{"type": "object", "properties": map[string]any{"name": map[string]any{"type": "string"}}}
+		_, err := p.Infer(ctx, llm.InferRequest{
+			ModelConfig:    cfg,
+			Messages:       []llm.InferMessage{{Role: "user", Content: "hi"}},
+			ResponseFormat: &llm.ResponseFormat{Name: "person", Schema: schema},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, schema, got["format"])
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		_, err := p.Infer(ctx, llm.InferRequest{
+			ModelConfig: cfg,
+			Messages:    []llm.InferMessage{{Role: "user", Parts: []llm.Part{llm.ImageURLPart("https://example.com/cat.png")}}},
+		})
+		assert.ErrorIs(t, err, llm.ErrUnsupportedPart)
+		_, err = p.Infer(ctx, llm.InferRequest{
+			ModelConfig:    cfg,
+			Messages:       []llm.InferMessage{{Role: "user", Content: "hi"}},
+			MessageOptions: llm.MessageOptions{ReasoningEffort: llm.ReasoningEffortLow},
+		})
+		assert.ErrorIs(t, err, llm.ErrUnsupportedOption)
+	})
+}
+
+// serveOllamaScenario renders the scenario as an Ollama chat stream, newline delimited JSON.
+func serveOllamaScenario(s llmtest.Scenario) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.Status != 0 {
+			w.WriteHeader(s.Status)
+			fmt.Fprint(w, `{"error": "server error"}`)
+			return
+		}
+		send := func(chunk map[string]any) {
+			fmt.Fprintln(w, llmtest.MustJSON(chunk))
+			w.(http.Flusher).Flush()
+		}
+		for _, c := range s.Chunks {
+			send(map[string]any{"model": "test-model", "message": map[string]any{"role": "assistant", "content": c}, "done": false})
+		}
+		if s.Hang {
+			<-r.Context().Done()
+			return
+		}
+		if s.Fail {
+			fmt.Fprint(w, `{"model": "test-model", "message": {"role": "assis`)
+			return
+		}
+		if len(s.ToolCalls) > 0 {
+			var calls []map[string]any
+			for _, tc := range s.ToolCalls {
+				calls = append(calls, map[string]any{"function": map[string]any{"name": tc.Name, "arguments": json.RawMessage(tc.Arguments)}})
+			}
+			send(map[string]any{"model": "test-model", "message": map[string]any{"role": "assistant", "content": "", "tool_calls": calls}, "done": false})
+		}
+		send(map[string]any{
+			"model": "test-model", "message": map[string]any{"role": "assistant", "content": ""}, "done": true, "done_reason": "stop",
+			"prompt_eval_count": s.Usage.InputTokens, "eval_count": s.Usage.OutputTokens,
+		})
+	}
+}
+
+func TestOllamaStreaming(t *testing.T) {
+	llmtest.TestStreaming(t, func(t *testing.T, s llmtest.Scenario) llm.Responder {
+		srv := httptest.NewServer(serveOllamaScenario(s))
+		t.Cleanup(srv.Close)
+		return local.NewOllamaProvider(srv.URL)
+	})
+}
+
+func TestOllamaStream(t *testing.T) {
+	ctx := context.Background()
+	req := llm.InferRequest{
+		ModelConfig: llm.ModelConfig{ProviderType: llm.ProviderOllama, ModelName: "llama3.2"},
+		Messages:    []llm.InferMessage{{Role: "user", Content: "hi"}},
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		p := ollamaServer(t, func(w http.ResponseWriter, _ string, body map[string]any) {
+			assert.Equal(t, true, body["stream"])
+			fmt.Fprintln(w, `{"model": "llama3.2", "message": {"role": "assistant", "content": "Hel"}, "done": false}`)
+			fmt.Fprintln(w, `{"model": "llama3.2", "message": {"role": "assistant", "content": "lo"}, "done": false}`)
+			fmt.Fprintln(w, `{"model": "llama3.2", "message": {"role": "assistant", "content": ""}, "done": true, "done_reason": "length", "prompt_eval_count": 3, "eval_count": 2}`)
+		})
+		ch, err := p.GenerateResponseAsync(ctx, req)
+		require.NoError(t, err)
+		var deltas []llm.StreamDelta
+		for d := range ch {
+			deltas = append(deltas, d)
+		}
+		require.Len(t, deltas, 3)
+		assert.Equal(t, "Hel", deltas[0].Text)
+		assert.Equal(t, "lo", deltas[1].Text)
+		assert.True(t, deltas[2].EOF)
+		assert.Equal(t, llm.FinishReasonLength, deltas[2].FinishReason)
+		assert.Equal(t, llm.Usage{InputTokens: 3, OutputTokens: 2}, deltas[2].Usage)
+	})
+
+	t.Run("error chunk", func(t *testing.T) {
+		p := ollamaServer(t, func(w http.ResponseWriter, _ string, _ map[string]any) {
+			fmt.Fprintln(w, `{"model": "llama3.2", "message": {"role": "assistant", "content": "Hel"}, "done": false}`)
+			fmt.Fprintln(w, `{"error": "model crashed"}`)
+		})
+		ch, err := p.GenerateResponseAsync(ctx, req)
+		require.NoError(t, err)
+		var last llm.StreamDelta
+		for d := range ch {
+			last = d
+		}
+		assert.ErrorContains(t, last.Err, "model crashed")
+	})
+
+	t.Run("cut off", func(t *testing.T) {
+		p := ollamaServer(t, func(w http.ResponseWriter, _ string, _ map[string]any) {
+			fmt.Fprintln(w, `{"model": "llama3.2", "message": {"role": "assistant", "content": "Hel"}, "done": false}`)
+		})
+		ch, err := p.GenerateResponseAsync(ctx, req)
+		require.NoError(t, err)
+		var last llm.StreamDelta
+		for d := range ch {
+			last = d
+		}
+		assert.ErrorContains(t, last.Err, "ended unexpectedly")
+	})
+}
+
+func TestOllamaEmbedding(t *testing.T) {
+	p := ollamaServer(t, func(w http.ResponseWriter, path string, body map[string]any) {
+		if body["model"] == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error": "model \"missing\" not found, try pulling it first"}`)
+			return
+		}
+		assert.Equal(t, "/api/embed", path)
+		assert.Equal(t, []any{"a", "b"}, body["input"])
+		fmt.Fprint(w, `{"model": "nomic-embed-text", "embeddings": [[0.1, 0.2], [0.3, 0.4]]}`)
+	})
+
+	res, err := p.GenerateEmbedding(context.Background(), llm.EmbedRequest{
+		ModelConfig: llm.ModelConfig{ProviderType: llm.ProviderOllama, ModelName: "nomic-embed-text"},
+		Input:       []string{"a", "b"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []llm.Embedding{{Values: []float32{0.1, 0.2}}, {Values: []float32{0.3, 0.4}}}, res.Data)
+
+	_, err = p.GenerateEmbedding(context.Background(), llm.EmbedRequest{
+		ModelConfig: llm.ModelConfig{ProviderType: llm.ProviderOllama, ModelName: "missing"},
+		Input:       []string{"a"},
+	})
+	var httpErr *apierr.HTTPError
+	require.True(t, errors.As(err, &httpErr))
+	assert.Equal(t, http.StatusNotFound, httpErr.StatusCode)
+}
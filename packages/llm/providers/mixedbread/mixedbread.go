@@ -6,16 +6,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/internal/apierr"
+	"github.com/stillmatic/gollum/packages/llm/providers/transport"
 	"io"
 	"net/http"
 )
 
-const (
-	apiURL = "https://api.mixedbread.ai/v1/embeddings"
-)
+const defaultBaseURL = "https://api.mixedbread.ai/v1"
 
 type MixedbreadEmbedder struct {
-	APIKey string
+	APIKey  string
+	baseURL string
+	client  *http.Client
 }
 
 type mixedbreadRequest struct {
@@ -43,8 +45,9 @@ type mixedbreadResponse struct {
 	Normalized bool `json:"normalized"`
 }
 
-func NewMixedbreadEmbedder(apiKey string) *MixedbreadEmbedder {
-	return &MixedbreadEmbedder{APIKey: apiKey}
+func NewMixedbreadEmbedder(apiKey string, opts ...transport.Option) *MixedbreadEmbedder {
+	settings := transport.Apply(opts...)
+	return &MixedbreadEmbedder{APIKey: apiKey, baseURL: settings.BaseURLOr(defaultBaseURL), client: settings.Client()}
 }
 
 func ptr[T any](x T) *T {
@@ -74,7 +77,12 @@ func (e *MixedbreadEmbedder) GenerateEmbedding(ctx context.Context, req llm.Embe
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(jsonData))
+	baseURL := e.baseURL
+	// the zero value is usable too
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", baseURL+"/embeddings", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -82,7 +90,11 @@ func (e *MixedbreadEmbedder) GenerateEmbedding(ctx context.Context, req llm.Embe
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("Authorization", "Bearer "+e.APIKey)
 
-	client := &http.Client{}
+	client := e.client
+	// the zero value is usable too
+	if client == nil {
+		client = http.DefaultClient
+	}
 	resp, err := client.Do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
@@ -95,7 +107,7 @@ func (e *MixedbreadEmbedder) GenerateEmbedding(ctx context.Context, req llm.Embe
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed with status code %d: %s", resp.StatusCode, string(body))
+		return nil, apierr.Classify(llm.ProviderMixedBread, &apierr.HTTPError{StatusCode: resp.StatusCode, Body: string(body), Header: resp.Header})
 	}
 
 	var mixedResp mixedbreadResponse
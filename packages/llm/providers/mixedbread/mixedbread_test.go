@@ -0,0 +1,47 @@
+package mixedbread_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/providers/mixedbread"
+	"github.com/stillmatic/gollum/packages/llm/providers/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateEmbedding(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/embeddings", r.URL.Path)
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "Represent this sentence for searching relevant passages: ", body["prompt"])
+		fmt.Fprint(w, `{"model": "mxbai-embed-large-v1", "object": "list", "data": [{"embedding": [0.25, 0.75], "index": 0, "object": "embedding"}]}`)
+	}))
+	defer srv.Close()
+
+	e := mixedbread.NewMixedbreadEmbedder("fake-key", transport.WithBaseURL(srv.URL+"/v1"))
+	res, err := e.GenerateEmbedding(context.Background(), llm.EmbedRequest{
+		Input:       []string{"hello"},
+		Prompt:      "Represent this sentence for searching relevant passages: ",
+		ModelConfig: llm.ModelConfig{ProviderType: llm.ProviderMixedBread, ModelName: "mxbai-embed-large-v1"},
+	})
+	require.NoError(t, err)
+	require.Len(t, res.Data, 1)
+	assert.Equal(t, []float32{0.25, 0.75}, res.Data[0].Values)
+
+	t.Run("errors", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"detail": "invalid api key"}`)
+		}))
+		defer srv.Close()
+		_, err := mixedbread.NewMixedbreadEmbedder("bad-key", transport.WithBaseURL(srv.URL)).GenerateEmbedding(context.Background(), llm.EmbedRequest{Input: []string{"hello"}})
+		assert.ErrorIs(t, err, llm.ErrAuthentication)
+	})
+}
@@ -0,0 +1,87 @@
+package openai
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/stillmatic/gollum/packages/llm/internal/apierr"
+	"github.com/stillmatic/gollum/packages/llm/providers/transport"
+
+	"github.com/pkg/errors"
+	"github.com/sashabaranov/go-openai"
+)
+
+// DefaultAzureAPIVersion is the latest GA version of the Azure OpenAI data plane API.
+const DefaultAzureAPIVersion = "2024-10-21"
+
+// TokenFunc returns an Entra ID access token for the https://cognitiveservices.azure.com/.default scope.
+// It is called for every request, so it should cache tokens until they expire, as azidentity credentials do.
+type TokenFunc func(ctx context.Context) (string, error)
+
+// AzureConfig describes an Azure OpenAI resource.
+type AzureConfig struct {
+	// Endpoint is the resource's endpoint, e.g. https://my-resource.openai.azure.com.
+	Endpoint string
+	// APIVersion is sent as the api-version query parameter, DefaultAzureAPIVersion if empty.
+	APIVersion string
+	// APIKey is sent in the api-key header. Leave it empty to authenticate with Token instead.
+	APIKey string
+	// Token authenticates with Entra ID bearer tokens when there is no APIKey.
+	Token TokenFunc
+}
+
+// NewAzureProvider returns a provider for an Azure OpenAI resource. Requests are routed to the deployment in
+// their ModelConfig, which defaults to the model name.
+func NewAzureProvider(cfg AzureConfig, opts ...transport.Option) (*Provider, error) {
+	if cfg.Endpoint == "" {
+		return nil, errors.New("azure endpoint is not set")
+	}
+	if cfg.APIKey == "" && cfg.Token == nil {
+		return nil, errors.New("azure needs an API key or an Entra ID token")
+	}
+
+	config := openai.DefaultAzureConfig(cfg.APIKey, cfg.Endpoint)
+	config.APIVersion = cfg.APIVersion
+	if config.APIVersion == "" {
+		config.APIVersion = DefaultAzureAPIVersion
+	}
+	// requests already name the deployment, the default mapper would mangle names with dots
+	config.AzureModelMapperFunc = func(model string) string { return model }
+
+	settings := transport.Apply(opts...)
+	config.BaseURL = settings.BaseURLOr(config.BaseURL)
+	client := settings.Client()
+	if cfg.APIKey == "" {
+		config.APIType = openai.APITypeAzureAD
+		client.Transport = &tokenTransport{base: client.Transport, token: cfg.Token}
+	}
+	client.Transport = apierr.HeaderTransport{Base: client.Transport}
+	config.HTTPClient = client
+	return &Provider{
+		client: openai.NewClientWithConfig(config),
+		// Azure takes as many inputs as OpenAI, but older API versions only return floats
+		embed: EmbeddingConfig{MaxBatchSize: openAIEmbeddingConfig.MaxBatchSize},
+		azure: true,
+	}, nil
+}
+
+// tokenTransport sets the bearer token of each request.
+type tokenTransport struct {
+	base  http.RoundTripper
+	token TokenFunc
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	token, err := t.token(req.Context())
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get entra id token")
+	}
+	// round trippers must not modify the request
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return base.RoundTrip(req)
+}
@@ -0,0 +1,71 @@
+package openai_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/providers/openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAzure(t *testing.T) {
+	var header http.Header
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /openai/deployments/prod-gpt-4o/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		assert.Equal(t, openai.DefaultAzureAPIVersion, r.URL.Query().Get("api-version"))
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "prod-gpt-4o", body["model"])
+		fmt.Fprint(w, `{"id": "chatcmpl-1", "object": "chat.completion", "model": "gpt-4o-2024-08-06",
+			"choices": [{"index": 0, "message": {"role": "assistant", "content": "hi"}, "finish_reason": "stop"}]}`)
+	})
+	mux.HandleFunc("POST /openai/deployments/text-embedding-3-small/embeddings", func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		assert.Equal(t, "2024-06-01", r.URL.Query().Get("api-version"))
+		fmt.Fprint(w, `{"object": "list", "data": [{"object": "embedding", "embedding": [0.5, 1], "index": 0}]}`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	ctx := context.Background()
+
+	_, err := openai.NewAzureProvider(openai.AzureConfig{Endpoint: srv.URL})
+	assert.Error(t, err)
+
+	p, err := openai.NewAzureProvider(openai.AzureConfig{Endpoint: srv.URL, APIKey: "fake-key"})
+	require.NoError(t, err)
+	res, err := p.Infer(ctx, llm.InferRequest{
+		ModelConfig: llm.ModelConfig{ProviderType: llm.ProviderAzureOpenAI, ModelName: "gpt-4o", Deployment: "prod-gpt-4o"},
+		Messages:    []llm.InferMessage{{Role: "user", Content: "hello"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "hi", res.Content)
+	assert.Equal(t, "fake-key", header.Get("api-key"))
+
+	tokens := 0
+	p, err = openai.NewAzureProvider(openai.AzureConfig{
+		Endpoint:   srv.URL,
+		APIVersion: "2024-06-01",
+		Token: func(ctx context.Context) (string, error) {
+			tokens++
+			return "entra-token", nil
+		},
+	})
+	require.NoError(t, err)
+	// the deployment defaults to the model name
+	emb, err := p.GenerateEmbedding(ctx, llm.EmbedRequest{
+		Input:       []string{"hello"},
+		ModelConfig: llm.ModelConfig{ProviderType: llm.ProviderAzureOpenAI, ModelName: "text-embedding-3-small"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []float32{0.5, 1}, emb.Data[0].Values)
+	assert.Equal(t, "Bearer entra-token", header.Get("Authorization"))
+	assert.Empty(t, header.Get("api-key"))
+	assert.Equal(t, 1, tokens)
+}
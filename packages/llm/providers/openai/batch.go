@@ -0,0 +1,181 @@
+package openai
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/batch"
+	"github.com/stillmatic/gollum/packages/llm/internal/apierr"
+
+	"github.com/pkg/errors"
+	"github.com/sashabaranov/go-openai"
+)
+
+// SubmitBatch uploads the items as a JSONL file and creates a chat completions batch job from it.
+func (p *Provider) SubmitBatch(ctx context.Context, items []batch.Item) (string, error) {
+	upload := openai.UploadBatchFileRequest{}
+	for _, item := range items {
+		if err := llm.ValidateRequest(item.Request, false); err != nil {
+			return "", errors.Wrapf(err, "invalid request %s", item.CustomID)
+		}
+		oaiReq, err := p.chatRequest(item.Request)
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid request %s", item.CustomID)
+		}
+		upload.AddChatCompletion(item.CustomID, oaiReq)
+	}
+	res, err := p.client.CreateBatchWithUploadFile(ctx, openai.CreateBatchWithUploadFileRequest{
+		Endpoint:               openai.BatchEndpointChatCompletions,
+		CompletionWindow:       "24h",
+		UploadBatchFileRequest: upload,
+	})
+	if err != nil {
+		return "", errors.Wrap(apierr.Classify(llm.ProviderOpenAI, err), "openai batch error")
+	}
+	return res.ID, nil
+}
+
+func (p *Provider) BatchStatus(ctx context.Context, jobID string) (batch.Status, error) {
+	res, err := p.client.RetrieveBatch(ctx, jobID)
+	if err != nil {
+		return batch.Status{}, errors.Wrap(apierr.Classify(llm.ProviderOpenAI, err), "openai batch error")
+	}
+	return statusFromOpenAI(res.Batch), nil
+}
+
+func statusFromOpenAI(b openai.Batch) batch.Status {
+	status := batch.Status{
+		State:     batch.StateInProgress,
+		Total:     b.RequestCounts.Total,
+		Succeeded: b.RequestCounts.Completed,
+		Failed:    b.RequestCounts.Failed,
+	}
+	switch b.Status {
+	case "completed", "expired", "cancelled":
+		status.State = batch.StateEnded
+	case "failed":
+		status.State = batch.StateFailed
+		if b.Errors != nil {
+			var msgs []string
+			for _, e := range b.Errors.Data {
+				msgs = append(msgs, e.Message)
+			}
+			status.Message = strings.Join(msgs, "; ")
+		}
+	}
+	return status
+}
+
+// batchOutputLine is a line of a batch's output or error file.
+type batchOutputLine struct {
+	CustomID string `json:"custom_id"`
+	Response *struct {
+		StatusCode int             `json:"status_code"`
+		Body       json.RawMessage `json:"body"`
+	} `json:"response"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// BatchResults reads the job's output and error files. Costs are at the batch discount.
+func (p *Provider) BatchResults(ctx context.Context, jobID string, items []batch.Item) (map[string]batch.Result, error) {
+	res, err := p.client.RetrieveBatch(ctx, jobID)
+	if err != nil {
+		return nil, errors.Wrap(apierr.Classify(llm.ProviderOpenAI, err), "openai batch error")
+	}
+	reqs := make(map[string]llm.InferRequest, len(items))
+	for _, item := range items {
+		reqs[item.CustomID] = item.Request
+	}
+
+	results := make(map[string]batch.Result, len(items))
+	for _, fileID := range []*string{res.OutputFileID, res.ErrorFileID} {
+		if fileID == nil || *fileID == "" {
+			continue
+		}
+		err := p.readBatchFile(ctx, *fileID, func(line batchOutputLine) {
+			results[line.CustomID] = resultFromOpenAI(reqs[line.CustomID], line)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+func (p *Provider) readBatchFile(ctx context.Context, fileID string, onLine func(batchOutputLine)) error {
+	content, err := p.client.GetFileContent(ctx, fileID)
+	if err != nil {
+		return errors.Wrapf(apierr.Classify(llm.ProviderOpenAI, err), "could not read batch file %s", fileID)
+	}
+	defer content.Close()
+	reader := bufio.NewReader(content)
+	for {
+		data, err := reader.ReadBytes('\n')
+		if len(strings.TrimSpace(string(data))) > 0 {
+			var line batchOutputLine
+			if err := json.Unmarshal(data, &line); err != nil {
+				return errors.Wrapf(err, "invalid line in batch file %s", fileID)
+			}
+			onLine(line)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "could not read batch file %s", fileID)
+		}
+	}
+}
+
+func resultFromOpenAI(req llm.InferRequest, line batchOutputLine) batch.Result {
+	result := batch.Result{CustomID: line.CustomID}
+	switch {
+	case line.Error != nil && (line.Error.Code == "batch_expired" || line.Error.Code == "batch_cancelled"):
+		result.Err = fmt.Errorf("%w: %s", batch.ErrNotProcessed, line.Error.Message)
+	case line.Error != nil:
+		result.Err = &batch.ItemError{Type: line.Error.Code, Message: line.Error.Message}
+	case line.Response == nil:
+		result.Err = fmt.Errorf("%w: no response", batch.ErrNotProcessed)
+	case line.Response.StatusCode != http.StatusOK:
+		var body struct {
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		_ = json.Unmarshal(line.Response.Body, &body)
+		result.Err = &batch.ItemError{StatusCode: line.Response.StatusCode, Type: body.Error.Type, Message: body.Error.Message}
+	default:
+		var completion openai.ChatCompletionResponse
+		if err := json.Unmarshal(line.Response.Body, &completion); err != nil {
+			result.Err = errors.Wrap(err, "invalid chat completion in batch")
+			return result
+		}
+		resp, err := responseFromOpenAI(req, completion)
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		resp.Cost = llm.BatchCost(req.ModelConfig, resp.Usage)
+		result.Response = resp
+	}
+	return result
+}
+
+func (p *Provider) CancelBatch(ctx context.Context, jobID string) error {
+	if _, err := p.client.CancelBatch(ctx, jobID); err != nil {
+		return errors.Wrap(apierr.Classify(llm.ProviderOpenAI, err), "openai batch error")
+	}
+	return nil
+}
+
+var _ batch.Backend = &Provider{}
@@ -0,0 +1,97 @@
+package openai_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/batch"
+	"github.com/stillmatic/gollum/packages/llm/llmtest"
+	"github.com/stillmatic/gollum/packages/llm/providers/openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatch(t *testing.T) {
+	var uploaded []map[string]any
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /files", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "batch", r.FormValue("purpose"))
+		f, _, err := r.FormFile("file")
+		require.NoError(t, err)
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var line map[string]any
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+			uploaded = append(uploaded, line)
+		}
+		fmt.Fprint(w, `{"id": "file-in", "object": "file", "purpose": "batch"}`)
+	})
+	mux.HandleFunc("POST /batches", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "file-in", body["input_file_id"])
+		assert.Equal(t, "/v1/chat/completions", body["endpoint"])
+		fmt.Fprint(w, `{"id": "batch_1", "object": "batch", "status": "validating"}`)
+	})
+	polls := 0
+	mux.HandleFunc("GET /batches/batch_1", func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		if polls == 1 {
+			fmt.Fprint(w, `{"id": "batch_1", "status": "in_progress", "request_counts": {"total": 3, "completed": 1, "failed": 0}}`)
+			return
+		}
+		fmt.Fprint(w, `{"id": "batch_1", "status": "completed", "output_file_id": "file-out", "error_file_id": "file-err",
+			"request_counts": {"total": 3, "completed": 1, "failed": 2}}`)
+	})
+	mux.HandleFunc("GET /files/file-out/content", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, llmtest.MustJSON(map[string]any{
+			"custom_id": "req-0",
+			"response": map[string]any{"status_code": 200, "body": map[string]any{
+				"id": "chatcmpl-1", "object": "chat.completion", "model": "gpt-4o-mini",
+				"choices": []map[string]any{{"index": 0, "message": map[string]any{"role": "assistant", "content": "hi"}, "finish_reason": "stop"}},
+				"usage":   map[string]any{"prompt_tokens": 1_000_000, "completion_tokens": 0},
+			}},
+		}))
+	})
+	mux.HandleFunc("GET /files/file-err/content", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"custom_id": "req-1", "response": {"status_code": 400, "body": {"error": {"type": "invalid_request_error", "message": "bad model"}}}, "error": null}`)
+		fmt.Fprintln(w, `{"custom_id": "req-2", "response": null, "error": {"code": "batch_expired", "message": "expired"}}`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	cfg := llm.ModelConfig{
+		ProviderType: llm.ProviderOpenAI, ModelName: "gpt-4o-mini", CentiCentsPerMillionInputTokens: 1_500,
+		Pricing: &llm.Pricing{BatchDiscount: 0.5},
+	}
+	reqs := make([]llm.InferRequest, 3)
+	for i := range reqs {
+		reqs[i] = llm.InferRequest{ModelConfig: cfg, Messages: []llm.InferMessage{{Role: "user", Content: "hello"}}}
+	}
+
+	r := batch.NewRunner(openai.NewGenericProvider("fake-key", srv.URL), batch.Config{PollInterval: time.Millisecond})
+	results, err := r.Run(context.Background(), "test", reqs)
+	require.NoError(t, err)
+
+	require.Len(t, uploaded, 3)
+	assert.Equal(t, "req-0", uploaded[0]["custom_id"])
+	assert.Equal(t, "/v1/chat/completions", uploaded[0]["url"])
+	assert.Equal(t, "gpt-4o-mini", uploaded[0]["body"].(map[string]any)["model"])
+
+	require.Len(t, results, 3)
+	require.NoError(t, results[0].Err)
+	assert.Equal(t, "hi", results[0].Response.Content)
+	assert.InDelta(t, 0.075, results[0].Response.Cost, 1e-9)
+	var itemErr *batch.ItemError
+	require.ErrorAs(t, results[1].Err, &itemErr)
+	assert.Equal(t, http.StatusBadRequest, itemErr.StatusCode)
+	assert.Equal(t, "bad model", itemErr.Message)
+	assert.ErrorIs(t, results[2].Err, batch.ErrNotProcessed)
+}
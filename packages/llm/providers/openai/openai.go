@@ -3,9 +3,14 @@ package openai
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/internal/apierr"
+	"github.com/stillmatic/gollum/packages/llm/providers/transport"
 	"io"
 	"log/slog"
+	"net/http"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/sashabaranov/go-openai"
@@ -13,158 +18,497 @@ import (
 
 type Provider struct {
 	client *openai.Client
+	embed  EmbeddingConfig
+	// azure routes requests to the deployment in their config
+	azure bool
 }
 
-func NewOpenAIProvider(apiKey string) *Provider {
-	return &Provider{
-		client: openai.NewClient(apiKey),
-	}
+// EmbeddingConfig describes how a host serves embeddings, which varies between OpenAI compatible hosts.
+type EmbeddingConfig struct {
+	// MaxBatchSize is the most inputs the host takes in one request, larger requests are split. 0 means no limit.
+	MaxBatchSize int
+	// Base64 requests base64 encoded embeddings, which are much smaller than JSON floats. Not every host supports it.
+	Base64 bool
+}
+
+var (
+	openAIEmbeddingConfig = EmbeddingConfig{MaxBatchSize: 2048, Base64: true}
+	// most hosts don't document their limits, so split into modest batches and stick to floats
+	genericEmbeddingConfig = EmbeddingConfig{MaxBatchSize: 128}
+)
+
+func NewOpenAIProvider(apiKey string, opts ...transport.Option) *Provider {
+	return newProvider(openai.DefaultConfig(apiKey), openAIEmbeddingConfig, opts)
+}
+
+func NewGenericProvider(apiKey string, baseURL string, opts ...transport.Option) *Provider {
+	return NewGenericProviderWithEmbeddingConfig(apiKey, baseURL, genericEmbeddingConfig, opts...)
 }
 
-func NewGenericProvider(apiKey string, baseURL string) *Provider {
+// NewGenericProviderWithEmbeddingConfig is like NewGenericProvider, for hosts whose embedding limits are known.
+func NewGenericProviderWithEmbeddingConfig(apiKey string, baseURL string, embed EmbeddingConfig, opts ...transport.Option) *Provider {
 	genericConfig := openai.DefaultConfig(apiKey)
 	genericConfig.BaseURL = baseURL
+	return newProvider(genericConfig, embed, opts)
+}
+
+func newProvider(config openai.ClientConfig, embed EmbeddingConfig, opts []transport.Option) *Provider {
+	settings := transport.Apply(opts...)
+	config.BaseURL = settings.BaseURLOr(config.BaseURL)
+	// go-openai drops the response headers on errors, record them to get Retry-After
+	client := settings.Client()
+	client.Transport = apierr.HeaderTransport{Base: client.Transport}
+	config.HTTPClient = client
 	return &Provider{
-		client: openai.NewClientWithConfig(genericConfig),
+		client: openai.NewClientWithConfig(config),
+		embed:  embed,
 	}
 }
 
-func NewTogetherProvider(apiKey string) *Provider {
-	return NewGenericProvider(apiKey, "https://api.together.xyz/v1")
+func NewTogetherProvider(apiKey string, opts ...transport.Option) *Provider {
+	return NewGenericProvider(apiKey, "https://api.together.xyz/v1", opts...)
+}
+
+func NewGroqProvider(apiKey string, opts ...transport.Option) *Provider {
+	return NewGenericProvider(apiKey, "https://api.groq.com/openai/v1/", opts...)
 }
 
-func NewGroqProvider(apiKey string) *Provider {
-	return NewGenericProvider(apiKey, "https://api.groq.com/openai/v1/")
+func NewHyperbolicProvider(apiKey string, opts ...transport.Option) *Provider {
+	return NewGenericProvider(apiKey, "https://api.hyperbolic.xyz/v1", opts...)
 }
 
-func NewHyperbolicProvider(apiKey string) *Provider {
-	return NewGenericProvider(apiKey, "https://api.hyperbolic.xyz/v1")
+func NewDeepseekProvider(apiKey string, opts ...transport.Option) *Provider {
+	return NewGenericProvider(apiKey, "https://api.deepseek.com/v1", opts...)
 }
 
-func NewDeepseekProvider(apiKey string) *Provider {
-	return NewGenericProvider(apiKey, "https://api.deepseek.com/v1")
+// model returns the model to request, which on Azure is the deployment serving it.
+func (p *Provider) model(cfg llm.ModelConfig) string {
+	if p.azure && cfg.Deployment != "" {
+		return cfg.Deployment
+	}
+	return cfg.ModelName
 }
 
 func (p *Provider) GenerateResponse(ctx context.Context, req llm.InferRequest) (string, error) {
-	msgs := inferReqToOpenAIMessages(req.Messages)
+	res, err := p.Infer(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	return res.Content, nil
+}
+
+// isReasoningModel reports whether the model is one of the o-series reasoning models, which take
+// max_completion_tokens and reasoning_effort but not sampling parameters.
+func isReasoningModel(model string) bool {
+	return strings.HasPrefix(model, "o1") || strings.HasPrefix(model, "o3") || strings.HasPrefix(model, "o4")
+}
+
+func (p *Provider) chatRequest(req llm.InferRequest) (openai.ChatCompletionRequest, error) {
+	opts := req.MessageOptions
+	model := req.ModelConfig.ModelName
+	reasoning := isReasoningModel(model)
+	supported := []llm.Option{llm.OptionTopP, llm.OptionStopSequences, llm.OptionSeed, llm.OptionPresencePenalty,
+		llm.OptionFrequencyPenalty, llm.OptionCandidates}
+	if reasoning {
+		supported = []llm.Option{llm.OptionStopSequences, llm.OptionSeed, llm.OptionReasoningEffort, llm.OptionCandidates}
+	}
+	if err := opts.Check(model, supported...); err != nil {
+		return openai.ChatCompletionRequest{}, err
+	}
+
+	msgs, err := inferReqToOpenAIMessages(req.Messages, model)
+	if err != nil {
+		return openai.ChatCompletionRequest{}, err
+	}
 
 	oaiReq := openai.ChatCompletionRequest{
-		Model:       req.ModelConfig.ModelName,
-		Messages:    msgs,
-		MaxTokens:   req.MessageOptions.MaxTokens,
-		Temperature: req.MessageOptions.Temperature,
+		Model:            p.model(req.ModelConfig),
+		Messages:         msgs,
+		MaxTokens:        opts.MaxTokens,
+		Temperature:      opts.Temperature,
+		TopP:             opts.TopP,
+		Stop:             opts.StopSequences,
+		Seed:             opts.Seed,
+		PresencePenalty:  opts.PresencePenalty,
+		FrequencyPenalty: opts.FrequencyPenalty,
+		Tools:            toolsToOpenAI(req.Tools),
+	}
+	if opts.Candidates > 1 {
+		oaiReq.N = opts.Candidates
+	}
+	if reasoning {
+		// max_tokens is rejected by reasoning models, since it doesn't count the reasoning tokens
+		oaiReq.MaxTokens = 0
+		oaiReq.MaxCompletionTokens = opts.MaxTokens
+		oaiReq.ReasoningEffort = string(opts.ReasoningEffort)
+	}
+	if req.ToolChoice != nil {
+		oaiReq.ToolChoice = toolChoiceToOpenAI(*req.ToolChoice)
+	}
+	if req.ResponseFormat != nil {
+		oaiReq.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+				Name:        req.ResponseFormat.Name,
+				Description: req.ResponseFormat.Description,
+				Schema:      schemaMarshaler{req.ResponseFormat.Schema},
+				Strict:      req.ResponseFormat.Strict,
+			},
+		}
+	}
+	return oaiReq, nil
+}
+
+// schemaMarshaler adapts a schema of any type to the json.Marshaler go-openai expects.
+type schemaMarshaler struct {
+	schema any
+}
+
+func (s schemaMarshaler) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.schema)
+}
+
+func (p *Provider) Infer(ctx context.Context, req llm.InferRequest) (*llm.InferResponse, error) {
+	if err := llm.ValidateRequest(req, false); err != nil {
+		return nil, err
+	}
+	oaiReq, err := p.chatRequest(req)
+	if err != nil {
+		return nil, err
 	}
 
+	ctx, header := apierr.RecordHeaders(ctx)
 	res, err := p.client.CreateChatCompletion(ctx, oaiReq)
 	if err != nil {
 		slog.Error("error from openai", "err", err, "req", req.Messages, "model", req.ModelConfig.ModelName)
-		return "", errors.Wrap(err, "openai chat completion error")
+		return nil, errors.Wrap(apiError(req.ModelConfig, err, header), "openai chat completion error")
+	}
+	return responseFromOpenAI(req, res)
+}
+
+// apiError classifies an error from the API, with the delay from the response's Retry-After header if it has one.
+func apiError(cfg llm.ModelConfig, err error, header http.Header) error {
+	return apierr.Classify(cfg.ProviderType, apierr.WithRetryAfter(err, header))
+}
+
+func responseFromOpenAI(req llm.InferRequest, res openai.ChatCompletionResponse) (*llm.InferResponse, error) {
+	if len(res.Choices) == 0 {
+		return nil, errors.New("openai returned no choices")
 	}
 
-	return res.Choices[0].Message.Content, nil
+	candidates := make([]llm.Candidate, len(res.Choices))
+	for i, choice := range res.Choices {
+		candidates[i] = llm.Candidate{
+			Content:      choice.Message.Content,
+			ToolCalls:    toolCallsFromOpenAI(choice.Message.ToolCalls),
+			FinishReason: finishReasonFromOpenAI(choice.FinishReason),
+		}
+		if len(candidates[i].ToolCalls) > 0 {
+			candidates[i].FinishReason = llm.FinishReasonToolCalls
+		}
+	}
+	resp := &llm.InferResponse{
+		Model: res.Model,
+		Usage: usageFromOpenAI(res.Usage),
+	}
+	resp.SetCandidates(candidates)
+	resp.Cost = llm.Cost(req.ModelConfig, resp.Usage)
+	return resp, nil
 }
 
-func inferReqToOpenAIMessages(req []llm.InferMessage) []openai.ChatCompletionMessage {
+func finishReasonFromOpenAI(fr openai.FinishReason) llm.FinishReason {
+	switch fr {
+	case openai.FinishReasonStop:
+		return llm.FinishReasonStop
+	case openai.FinishReasonLength:
+		return llm.FinishReasonLength
+	case openai.FinishReasonToolCalls, openai.FinishReasonFunctionCall:
+		return llm.FinishReasonToolCalls
+	case openai.FinishReasonContentFilter:
+		return llm.FinishReasonContentFilter
+	default:
+		return llm.FinishReasonOther
+	}
+}
+
+func usageFromOpenAI(u openai.Usage) llm.Usage {
+	usage := llm.Usage{
+		InputTokens:  u.PromptTokens,
+		OutputTokens: u.CompletionTokens,
+	}
+	if u.PromptTokensDetails != nil {
+		usage.CachedInputTokens = u.PromptTokensDetails.CachedTokens
+	}
+	if u.CompletionTokensDetails != nil {
+		usage.ReasoningTokens = u.CompletionTokensDetails.ReasoningTokens
+	}
+	return usage
+}
+
+func toolsToOpenAI(tools []llm.Tool) []openai.Tool {
+	if len(tools) == 0 {
+		return nil
+	}
+	oaiTools := make([]openai.Tool, len(tools))
+	for i, t := range tools {
+		oaiTools[i] = openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.Parameters,
+			},
+		}
+	}
+	return oaiTools
+}
+
+func toolChoiceToOpenAI(tc llm.ToolChoice) any {
+	if tc.Type == llm.ToolChoiceTool {
+		return openai.ToolChoice{
+			Type:     openai.ToolTypeFunction,
+			Function: openai.ToolFunction{Name: tc.Name},
+		}
+	}
+	return string(tc.Type)
+}
+
+func toolCallsFromOpenAI(calls []openai.ToolCall) []llm.ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+	toolCalls := make([]llm.ToolCall, len(calls))
+	for i, c := range calls {
+		toolCalls[i] = llm.ToolCall{
+			ID:        c.ID,
+			Name:      c.Function.Name,
+			Arguments: c.Function.Arguments,
+		}
+	}
+	return toolCalls
+}
+
+func inferReqToOpenAIMessages(req []llm.InferMessage, model string) ([]openai.ChatCompletionMessage, error) {
 	msgs := make([]openai.ChatCompletionMessage, 0)
 
 	for _, m := range req {
 		msg := openai.ChatCompletionMessage{
-			Role:    m.Role,
-			Content: m.Content,
-		}
-		if m.Image != nil && len(m.Image) > 0 {
-			b64Image := base64.StdEncoding.EncodeToString(m.Image)
-			msg.MultiContent = []openai.ChatMessagePart{
-				{
-					Type: openai.ChatMessagePartTypeImageURL,
-					// TODO: support other image types
-					ImageURL: &openai.ChatMessageImageURL{
-						URL:    "data:image/png;base64," + b64Image,
-						Detail: openai.ImageURLDetailAuto,
-					},
-				},
-				{
-					Type: openai.ChatMessagePartTypeText,
-					Text: m.Content,
+			Role:       m.Role,
+			ToolCallID: m.ToolCallID,
+		}
+		for _, tc := range m.ToolCalls {
+			msg.ToolCalls = append(msg.ToolCalls, openai.ToolCall{
+				ID:   tc.ID,
+				Type: openai.ToolTypeFunction,
+				Function: openai.FunctionCall{
+					Name:      tc.Name,
+					Arguments: tc.Arguments,
 				},
+			})
+		}
+		parts := m.ContentParts()
+		// plain text is sent as a string, which every OpenAI compatible API accepts
+		if len(parts) == 1 && parts[0].Type == llm.PartTypeText {
+			msg.Content = parts[0].Text
+		} else {
+			for _, part := range parts {
+				oaiPart, err := partToOpenAI(part, model)
+				if err != nil {
+					return nil, err
+				}
+				msg.MultiContent = append(msg.MultiContent, oaiPart)
 			}
-			msg.Content = ""
 		}
 		msgs = append(msgs, msg)
 	}
-	return msgs
+	return msgs, nil
+}
+
+func partToOpenAI(part llm.Part, model string) (openai.ChatMessagePart, error) {
+	switch part.Type {
+	case llm.PartTypeText:
+		return openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: part.Text}, nil
+	case llm.PartTypeImage:
+		return openai.ChatMessagePart{
+			Type: openai.ChatMessagePartTypeImageURL,
+			ImageURL: &openai.ChatMessageImageURL{
+				URL:    "data:" + part.MIMEType + ";base64," + base64.StdEncoding.EncodeToString(part.Data),
+				Detail: openai.ImageURLDetailAuto,
+			},
+		}, nil
+	case llm.PartTypeImageURL:
+		return openai.ChatMessagePart{
+			Type:     openai.ChatMessagePartTypeImageURL,
+			ImageURL: &openai.ChatMessageImageURL{URL: part.URL, Detail: openai.ImageURLDetailAuto},
+		}, nil
+	default:
+		return openai.ChatMessagePart{}, &llm.UnsupportedPartError{Type: part.Type, MIMEType: part.MIMEType, Model: model}
+	}
 }
 
 func (p *Provider) GenerateResponseAsync(ctx context.Context, req llm.InferRequest) (<-chan llm.StreamDelta, error) {
+	if err := llm.ValidateRequest(req, true); err != nil {
+		return nil, err
+	}
 	outChan := make(chan llm.StreamDelta)
 	go func() {
 		defer close(outChan)
-		msgs := inferReqToOpenAIMessages(req.Messages)
-		oaiReq := openai.ChatCompletionRequest{
-			Model:       req.ModelConfig.ModelName,
-			Messages:    msgs,
-			MaxTokens:   req.MessageOptions.MaxTokens,
-			Temperature: req.MessageOptions.Temperature,
+		if req.MessageOptions.Candidates > 1 {
+			sendDelta(ctx, outChan, llm.StreamDelta{Err: llm.ErrStreamingCandidates})
+			return
 		}
+		oaiReq, err := p.chatRequest(req)
+		if err != nil {
+			sendDelta(ctx, outChan, llm.StreamDelta{Err: err})
+			return
+		}
+		oaiReq.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
 
-		stream, err := p.client.CreateChatCompletionStream(ctx, oaiReq)
+		reqCtx, header := apierr.RecordHeaders(ctx)
+		stream, err := p.client.CreateChatCompletionStream(reqCtx, oaiReq)
 		if err != nil {
 			slog.Error("error from openai", "err", err, "req", req.Messages, "model", req.ModelConfig.ModelName)
+			err = apiError(req.ModelConfig, err, header)
+			sendDelta(ctx, outChan, llm.StreamDelta{Err: errors.Wrap(err, "openai chat completion stream error")})
 			return
 		}
 		defer stream.Close()
 
-		response, err := stream.Recv()
-		if err != nil {
-			if err == io.EOF {
+		final := llm.StreamDelta{EOF: true}
+		var toolCalls []openai.ToolCall
+		for {
+			response, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				slog.Error("error receiving from openai stream", "err", err)
+				err = apierr.Classify(req.ModelConfig.ProviderType, err)
+				sendDelta(ctx, outChan, llm.StreamDelta{Err: errors.Wrap(err, "openai stream error")})
+				return
+			}
+			if response.Model != "" {
+				final.Model = response.Model
+			}
+			// only sent on the last chunk, which has no choices
+			if response.Usage != nil {
+				final.Usage = usageFromOpenAI(*response.Usage)
+			}
+			if len(response.Choices) == 0 {
+				continue
+			}
+			choice := response.Choices[0]
+			if choice.FinishReason != "" {
+				final.FinishReason = finishReasonFromOpenAI(choice.FinishReason)
+			}
+			toolCalls = mergeToolCallDeltas(toolCalls, choice.Delta.ToolCalls)
+			if choice.Delta.Content == "" {
+				continue
+			}
+			if !sendDelta(ctx, outChan, llm.StreamDelta{Text: choice.Delta.Content}) {
 				return
 			}
-			slog.Error("error receiving from openai stream", "err", err)
-			return
 		}
 
-		if len(response.Choices) > 0 {
-			content := response.Choices[0].Delta.Content
-			if content != "" {
-				select {
-				case <-ctx.Done():
-					return
-				case outChan <- llm.StreamDelta{
-					Text: content}:
-				}
-			} else {
-				outChan <- llm.StreamDelta{
-					EOF: true,
-				}
-			}
+		final.ToolCalls = toolCallsFromOpenAI(toolCalls)
+		if len(final.ToolCalls) > 0 {
+			final.FinishReason = llm.FinishReasonToolCalls
 		}
+		final.Cost = llm.Cost(req.ModelConfig, final.Usage)
+		sendDelta(ctx, outChan, final)
 	}()
 
 	return outChan, nil
 }
 
+// mergeToolCallDeltas accumulates streamed tool calls. The first delta for each call carries the ID and name,
+// later deltas append fragments of the arguments.
+func mergeToolCallDeltas(calls []openai.ToolCall, deltas []openai.ToolCall) []openai.ToolCall {
+	for _, d := range deltas {
+		idx := len(calls)
+		if d.Index != nil {
+			idx = *d.Index
+		}
+		for len(calls) <= idx {
+			calls = append(calls, openai.ToolCall{Type: openai.ToolTypeFunction})
+		}
+		if d.ID != "" {
+			calls[idx].ID = d.ID
+		}
+		if d.Function.Name != "" {
+			calls[idx].Function.Name = d.Function.Name
+		}
+		calls[idx].Function.Arguments += d.Function.Arguments
+	}
+	return calls
+}
+
+// sendDelta sends the delta unless the context is done first, returning whether it was sent.
+func sendDelta(ctx context.Context, ch chan<- llm.StreamDelta, delta llm.StreamDelta) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case ch <- delta:
+		return true
+	}
+}
+
+// GenerateEmbedding embeds the input with any OpenAI compatible host. Inputs beyond the host's batch size are
+// sent in several requests, one after the other.
 func (p *Provider) GenerateEmbedding(ctx context.Context, req llm.EmbedRequest) (*llm.EmbeddingResponse, error) {
-	// TODO: this only supports openai models, not other providers using the same interface
+	if len(req.Image) > 0 {
+		return nil, errors.New("image embedding not supported by openai compatible providers")
+	}
+	batchSize := p.embed.MaxBatchSize
+	if batchSize <= 0 {
+		batchSize = max(len(req.Input), 1)
+	}
+
+	respVectors := make([]llm.Embedding, 0, len(req.Input))
+	for start := 0; start < len(req.Input); start += batchSize {
+		batch := req.Input[start:min(start+batchSize, len(req.Input))]
+		vectors, err := p.embedBatch(ctx, req, batch)
+		if err != nil {
+			return nil, err
+		}
+		respVectors = append(respVectors, vectors...)
+	}
+
+	return &llm.EmbeddingResponse{
+		Data: respVectors,
+	}, nil
+}
+
+func (p *Provider) embedBatch(ctx context.Context, req llm.EmbedRequest, input []string) ([]llm.Embedding, error) {
 	oaiReq := openai.EmbeddingRequest{
-		Input:      req.Input,
-		Model:      openai.EmbeddingModel(req.ModelConfig.ModelName),
+		Input:      input,
+		Model:      openai.EmbeddingModel(p.model(req.ModelConfig)),
 		Dimensions: req.Dimensions,
 	}
+	// go-openai decodes base64 responses
+	if p.embed.Base64 {
+		oaiReq.EncodingFormat = openai.EmbeddingEncodingFormatBase64
+	}
 
+	ctx, header := apierr.RecordHeaders(ctx)
 	res, err := p.client.CreateEmbeddings(ctx, oaiReq)
 	if err != nil {
-		slog.Error("error from openai", "err", err, "req", req.Input, "model", req.ModelConfig.ModelName)
-		return nil, errors.Wrap(err, "openai embedding error")
+		slog.Error("error from openai", "err", err, "req", input, "model", req.ModelConfig.ModelName)
+		return nil, errors.Wrap(apiError(req.ModelConfig, err, header), "openai embedding error")
+	}
+	if len(res.Data) != len(input) {
+		return nil, errors.Errorf("openai embedding error: got %d embeddings for %d inputs", len(res.Data), len(input))
 	}
 
-	respVectors := make([]llm.Embedding, len(res.Data))
-	for i, v := range res.Data {
-		respVectors[i] = llm.Embedding{
+	// some hosts don't return embeddings in input order
+	respVectors := make([]llm.Embedding, len(input))
+	for _, v := range res.Data {
+		if v.Index < 0 || v.Index >= len(input) {
+			return nil, errors.Errorf("openai embedding error: index %d out of range", v.Index)
+		}
+		respVectors[v.Index] = llm.Embedding{
 			Values: v.Embedding,
 		}
 	}
-
-	return &llm.EmbeddingResponse{
-		Data: respVectors,
-	}, nil
+	return respVectors, nil
 }
@@ -0,0 +1,397 @@
+package openai_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	goopenai "github.com/sashabaranov/go-openai"
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/internal/apierr"
+	"github.com/stillmatic/gollum/packages/llm/llmtest"
+	"github.com/stillmatic/gollum/packages/llm/providers/openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveScenario renders the scenario as a chat completions event stream.
+func serveScenario(s llmtest.Scenario) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.Status != 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(s.Status)
+			fmt.Fprint(w, `{"error":{"message":"server error","type":"server_error"}}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		send := func(v any) {
+			fmt.Fprintf(w, "data: %s\n\n", llmtest.MustJSON(v))
+			w.(http.Flusher).Flush()
+		}
+		chunk := func(delta map[string]any, finishReason any) map[string]any {
+			return map[string]any{
+				"id":      "chatcmpl-1",
+				"object":  "chat.completion.chunk",
+				"model":   "test-model",
+				"choices": []map[string]any{{"index": 0, "delta": delta, "finish_reason": finishReason}},
+			}
+		}
+
+		for _, c := range s.Chunks {
+			send(chunk(map[string]any{"content": c}, nil))
+		}
+		if s.Hang {
+			<-r.Context().Done()
+			return
+		}
+		if s.Fail {
+			fmt.Fprint(w, `data: {"error":{"message":"stream interrupted","type":"server_error"}}`+"\n\n")
+			return
+		}
+		for i, tc := range s.ToolCalls {
+			// split the arguments to check they are accumulated
+			mid := len(tc.Arguments) / 2
+			send(chunk(map[string]any{"tool_calls": []map[string]any{{
+				"index": i, "id": tc.ID, "type": "function",
+				"function": map[string]any{"name": tc.Name, "arguments": tc.Arguments[:mid]},
+			}}}, nil))
+			send(chunk(map[string]any{"tool_calls": []map[string]any{{
+				"index": i, "function": map[string]any{"arguments": tc.Arguments[mid:]},
+			}}}, nil))
+		}
+		finishReason := "stop"
+		if len(s.ToolCalls) > 0 {
+			finishReason = "tool_calls"
+		}
+		send(chunk(map[string]any{}, finishReason))
+		send(map[string]any{
+			"id":      "chatcmpl-1",
+			"object":  "chat.completion.chunk",
+			"model":   "test-model",
+			"choices": []any{},
+			"usage": map[string]any{
+				"prompt_tokens":     s.Usage.InputTokens,
+				"completion_tokens": s.Usage.OutputTokens,
+				"total_tokens":      s.Usage.TotalTokens(),
+			},
+		})
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}
+}
+
+func TestStreaming(t *testing.T) {
+	llmtest.TestStreaming(t, func(t *testing.T, s llmtest.Scenario) llm.Responder {
+		srv := httptest.NewServer(serveScenario(s))
+		t.Cleanup(srv.Close)
+		return openai.NewGenericProvider("fake-key", srv.URL)
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", "3")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"error":{"message":"rate limited","type":"requests"}}`)
+	}))
+	defer srv.Close()
+
+	_, err := openai.NewGenericProvider("fake-key", srv.URL).Infer(context.Background(), llmtest.Request)
+	assert.Equal(t, http.StatusTooManyRequests, apierr.StatusCode(err))
+	after, ok := apierr.RetryAfter(err)
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, after)
+
+	assert.ErrorIs(t, err, llm.ErrRateLimited)
+	var apiErr *llm.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, 3*time.Second, apiErr.RetryAfter)
+}
+
+func TestContextLengthError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":{"message":"This model's maximum context length is 128000 tokens.","type":"invalid_request_error","code":"context_length_exceeded"}}`)
+	}))
+	defer srv.Close()
+
+	_, err := openai.NewGenericProvider("fake-key", srv.URL).Infer(context.Background(), llmtest.Request)
+	assert.ErrorIs(t, err, llm.ErrContextLengthExceeded)
+	assert.NotErrorIs(t, err, llm.ErrInvalidRequest)
+	// the client's error is still there
+	var oaiErr *goopenai.APIError
+	require.ErrorAs(t, err, &oaiErr)
+	assert.Equal(t, http.StatusBadRequest, oaiErr.HTTPStatusCode)
+}
+
+type answer struct {
+	Answer     string  `json:"answer" jsonschema:"required"`
+	Confidence float64 `json:"confidence" jsonschema:"required"`
+}
+
+func TestResponseFormat(t *testing.T) {
+	var body struct {
+		ResponseFormat struct {
+			Type       string `json:"type"`
+			JSONSchema struct {
+				Name   string         `json:"name"`
+				Strict bool           `json:"strict"`
+				Schema map[string]any `json:"schema"`
+			} `json:"json_schema"`
+		} `json:"response_format"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, llmtest.MustJSON(map[string]any{
+			"id":     "chatcmpl-1",
+			"object": "chat.completion",
+			"model":  "test-model",
+			"choices": []map[string]any{{
+				"index":         0,
+				"message":       map[string]any{"role": "assistant", "content": `{"answer":"42","confidence":0.9}`},
+				"finish_reason": "stop",
+			}},
+		}))
+	}))
+	defer srv.Close()
+
+	got, res, err := llm.InferStructured[answer](context.Background(), openai.NewGenericProvider("fake-key", srv.URL), llmtest.Request)
+	require.NoError(t, err)
+	assert.Equal(t, answer{Answer: "42", Confidence: 0.9}, got)
+	assert.Equal(t, llm.FinishReasonStop, res.FinishReason)
+
+	assert.Equal(t, "json_schema", body.ResponseFormat.Type)
+	assert.Equal(t, "answer", body.ResponseFormat.JSONSchema.Name)
+	assert.True(t, body.ResponseFormat.JSONSchema.Strict)
+	assert.Equal(t, "object", body.ResponseFormat.JSONSchema.Schema["type"])
+	assert.Equal(t, false, body.ResponseFormat.JSONSchema.Schema["additionalProperties"])
+}
+
+func TestMessageOptions(t *testing.T) {
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = nil
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, llmtest.MustJSON(map[string]any{
+			"id":      "chatcmpl-1",
+			"object":  "chat.completion",
+			"model":   "test-model",
+			"choices": []map[string]any{{"index": 0, "message": map[string]any{"role": "assistant", "content": "hi"}, "finish_reason": "stop"}},
+		}))
+	}))
+	defer srv.Close()
+	p := openai.NewGenericProvider("fake-key", srv.URL)
+	seed := 7
+
+	t.Run("chat models", func(t *testing.T) {
+		req := llmtest.Request
+		req.ModelConfig.ModelName = "gpt-4o"
+		req.MessageOptions = llm.MessageOptions{
+			MaxTokens: 100, TopP: 0.5, StopSequences: []string{"\n\n"}, Seed: &seed,
+			PresencePenalty: 0.25, FrequencyPenalty: 0.5,
+		}
+		_, err := p.Infer(context.Background(), req)
+		require.NoError(t, err)
+		assert.EqualValues(t, 100, body["max_tokens"])
+		assert.EqualValues(t, 0.5, body["top_p"])
+		assert.Equal(t, []any{"\n\n"}, body["stop"])
+		assert.EqualValues(t, 7, body["seed"])
+		assert.EqualValues(t, 0.25, body["presence_penalty"])
+		assert.EqualValues(t, 0.5, body["frequency_penalty"])
+
+		req.MessageOptions = llm.MessageOptions{ReasoningEffort: llm.ReasoningEffortHigh}
+		_, err = p.Infer(context.Background(), req)
+		assert.ErrorIs(t, err, llm.ErrUnsupportedOption)
+	})
+
+	t.Run("reasoning models", func(t *testing.T) {
+		req := llm.InferRequest{
+			Messages:       []llm.InferMessage{{Role: "user", Content: "Say hello."}},
+			ModelConfig:    llm.ModelConfig{ModelName: "o3-mini"},
+			MessageOptions: llm.MessageOptions{MaxTokens: 1000, ReasoningEffort: llm.ReasoningEffortLow},
+		}
+		_, err := p.Infer(context.Background(), req)
+		require.NoError(t, err)
+		assert.NotContains(t, body, "max_tokens")
+		assert.EqualValues(t, 1000, body["max_completion_tokens"])
+		assert.Equal(t, "low", body["reasoning_effort"])
+
+		req.MessageOptions.TopP = 0.5
+		_, err = p.Infer(context.Background(), req)
+		assert.ErrorIs(t, err, llm.ErrUnsupportedOption)
+	})
+
+	t.Run("unsupported options", func(t *testing.T) {
+		req := llmtest.Request
+		req.MessageOptions.TopK = 10
+		_, err := p.Infer(context.Background(), req)
+		assert.ErrorIs(t, err, llm.ErrUnsupportedOption)
+
+		// streams report the error as a delta
+		ch, err := p.GenerateResponseAsync(context.Background(), req)
+		require.NoError(t, err)
+		delta := <-ch
+		assert.ErrorIs(t, delta.Err, llm.ErrUnsupportedOption)
+	})
+}
+
+func TestCandidates(t *testing.T) {
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, llmtest.MustJSON(map[string]any{
+			"id":     "chatcmpl-1",
+			"object": "chat.completion",
+			"model":  "test-model",
+			"choices": []map[string]any{
+				{"index": 0, "message": map[string]any{"role": "assistant", "content": "hi"}, "finish_reason": "stop"},
+				{"index": 1, "message": map[string]any{"role": "assistant", "content": "hello"}, "finish_reason": "length"},
+			},
+			"usage": map[string]any{"prompt_tokens": 10, "completion_tokens": 6, "total_tokens": 16},
+		}))
+	}))
+	defer srv.Close()
+	p := openai.NewGenericProvider("fake-key", srv.URL)
+
+	req := llmtest.Request
+	req.MessageOptions.Candidates = 2
+	res, err := p.Infer(context.Background(), req)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, body["n"])
+	assert.Equal(t, []string{"hi", "hello"}, res.Contents())
+	assert.Equal(t, llm.FinishReasonLength, res.Candidates[1].FinishReason)
+	assert.Equal(t, "hi", res.Content)
+	assert.Equal(t, 16, res.Usage.TotalTokens())
+
+	ch, err := p.GenerateResponseAsync(context.Background(), req)
+	require.NoError(t, err)
+	delta := <-ch
+	assert.ErrorIs(t, delta.Err, llm.ErrStreamingCandidates)
+}
+
+func TestMessageParts(t *testing.T) {
+	var body struct {
+		Messages []struct {
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, llmtest.MustJSON(map[string]any{
+			"id":      "chatcmpl-1",
+			"object":  "chat.completion",
+			"model":   "test-model",
+			"choices": []map[string]any{{"index": 0, "message": map[string]any{"role": "assistant", "content": "cats"}, "finish_reason": "stop"}},
+		}))
+	}))
+	defer srv.Close()
+	p := openai.NewGenericProvider("fake-key", srv.URL)
+
+	jpeg := []byte("\xff\xd8\xff\xe0\x00\x10JFIF")
+	req := llm.InferRequest{
+		Messages: []llm.InferMessage{
+			{Role: "system", Content: "You are a helpful assistant."},
+			{Role: "user", Parts: []llm.Part{
+				llm.TextPart("What do these have in common?"),
+				llm.ImagePart(jpeg),
+				llm.ImageURLPart("https://example.com/cat.png"),
+			}},
+		},
+		ModelConfig: llm.ModelConfig{ModelName: "gpt-4o"},
+	}
+	_, err := p.Infer(context.Background(), req)
+	require.NoError(t, err)
+	require.Len(t, body.Messages, 2)
+	// text only messages are sent as strings
+	assert.JSONEq(t, `"You are a helpful assistant."`, string(body.Messages[0].Content))
+	assert.JSONEq(t, `[
+		{"type": "text", "text": "What do these have in common?"},
+		{"type": "image_url", "image_url": {"url": "data:image/jpeg;base64,/9j/4AAQSkZJRg==", "detail": "auto"}},
+		{"type": "image_url", "image_url": {"url": "https://example.com/cat.png", "detail": "auto"}}
+	]`, string(body.Messages[1].Content))
+
+	req.Messages[1].Parts = append(req.Messages[1].Parts, llm.AudioPart([]byte("RIFF\x24\x00\x00\x00WAVEfmt ")))
+	_, err = p.Infer(context.Background(), req)
+	assert.ErrorIs(t, err, llm.ErrUnsupportedPart)
+}
+
+func TestValidateRequest(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+	p := openai.NewGenericProvider("fake-key", srv.URL)
+
+	cfg, _ := llm.NewModelConfigStore().GetConfig(llm.ConfigDeepseekChat)
+	req := llm.InferRequest{
+		Messages:    []llm.InferMessage{{Role: "user", Parts: []llm.Part{llm.TextPart("What is this?"), llm.ImageURLPart("https://example.com/cat.png")}}},
+		ModelConfig: cfg,
+	}
+	_, err := p.Infer(context.Background(), req)
+	assert.ErrorIs(t, err, llm.ErrUnsupportedPart)
+	_, err = p.GenerateResponseAsync(context.Background(), req)
+	assert.ErrorIs(t, err, llm.ErrUnsupportedPart)
+	// the request never leaves the process
+	assert.Zero(t, calls.Load())
+}
+
+func TestEmbeddings(t *testing.T) {
+	// encodes the values as little endian float32s, like the API's base64 encoding_format
+	encode := func(values ...float32) string {
+		buf := make([]byte, 0, 4*len(values))
+		for _, v := range values {
+			buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(v))
+		}
+		return base64.StdEncoding.EncodeToString(buf)
+	}
+
+	var batches [][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input          []string `json:"input"`
+			EncodingFormat string   `json:"encoding_format"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "base64", body.EncodingFormat)
+		batches = append(batches, body.Input)
+
+		// reversed, to check the embeddings are matched to their inputs by index
+		var data []map[string]any
+		for i := len(body.Input) - 1; i >= 0; i-- {
+			v := float32(len(body.Input[i]))
+			data = append(data, map[string]any{"object": "embedding", "index": i, "embedding": encode(v, -v)})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, llmtest.MustJSON(map[string]any{"object": "list", "model": "test-embedder", "data": data}))
+	}))
+	defer srv.Close()
+
+	p := openai.NewGenericProviderWithEmbeddingConfig("fake-key", srv.URL, openai.EmbeddingConfig{MaxBatchSize: 2, Base64: true})
+	res, err := p.GenerateEmbedding(context.Background(), llm.EmbedRequest{
+		ModelConfig: llm.ModelConfig{ProviderType: llm.ProviderTogether, ModelName: "BAAI/bge-large-en-v1.5"},
+		Input:       []string{"a", "bb", "ccc"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"a", "bb"}, {"ccc"}}, batches)
+	assert.Equal(t, []llm.Embedding{
+		{Values: []float32{1, -1}},
+		{Values: []float32{2, -2}},
+		{Values: []float32{3, -3}},
+	}, res.Data)
+}
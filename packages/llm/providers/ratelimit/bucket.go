@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// bucket is a token bucket which refills its capacity over a minute.
+// Tokens can go negative when usage is corrected upwards after a call.
+type bucket struct {
+	mu        sync.Mutex
+	capacity  float64
+	tokens    float64
+	perSecond float64
+	last      time.Time
+	now       func() time.Time
+}
+
+func newBucket(perMinute int, now func() time.Time) *bucket {
+	return &bucket{
+		capacity:  float64(perMinute),
+		tokens:    float64(perMinute),
+		perSecond: float64(perMinute) / 60,
+		last:      now(),
+		now:       now,
+	}
+}
+
+func (b *bucket) refill() {
+	now := b.now()
+	b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.perSecond)
+	b.last = now
+}
+
+// take removes n tokens if they are available, otherwise it returns how long until they will be.
+// Requests larger than the capacity are let through when the bucket is full, rather than blocking forever.
+func (b *bucket) take(n float64) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if b.tokens >= n || b.tokens >= b.capacity {
+		b.tokens -= n
+		return 0, true
+	}
+	missing := math.Min(n, b.capacity) - b.tokens
+	return time.Duration(missing / b.perSecond * float64(time.Second)), false
+}
+
+// wait blocks until n tokens are available and takes them, or returns the context's error.
+func (b *bucket) wait(ctx context.Context, n int) error {
+	for {
+		wait, ok := b.take(float64(n))
+		if ok {
+			return nil
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// adjust returns n tokens to the bucket, or takes them if n is negative.
+func (b *bucket) adjust(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	b.tokens = math.Min(b.capacity, b.tokens+float64(n))
+}
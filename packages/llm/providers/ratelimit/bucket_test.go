@@ -0,0 +1,41 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucket(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	b := newBucket(60, clock)
+
+	_, ok := b.take(60)
+	assert.True(t, ok)
+	wait, ok := b.take(2)
+	assert.False(t, ok)
+	assert.Equal(t, 2*time.Second, wait)
+
+	// refills at 1 token per second
+	now = now.Add(2 * time.Second)
+	_, ok = b.take(2)
+	assert.True(t, ok)
+
+	// corrections can take the bucket below zero
+	b.adjust(-10)
+	wait, ok = b.take(1)
+	assert.False(t, ok)
+	assert.Equal(t, 11*time.Second, wait)
+
+	// but refunds don't overflow it
+	b.adjust(1000)
+	_, ok = b.take(60)
+	assert.True(t, ok)
+
+	// requests bigger than the bucket go through once it is full
+	now = now.Add(time.Minute)
+	_, ok = b.take(100)
+	assert.True(t, ok)
+}
@@ -0,0 +1,228 @@
+// Package ratelimit throttles calls to providers on the client side, so callers wait instead of getting 429s.
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/stillmatic/gollum/packages/llm"
+)
+
+// Limit is a provider's rate limit. Zero values are unlimited.
+type Limit struct {
+	RequestsPerMinute int
+	TokensPerMinute   int
+}
+
+// Config for a Limiter. A request must fit in both its provider's and its model's limits.
+type Config struct {
+	// ProviderLimits are shared by all models of a provider.
+	ProviderLimits map[llm.ProviderType]Limit
+	// ModelLimits are keyed by model name, e.g. "gpt-4o".
+	ModelLimits map[string]Limit
+	// EstimateTokens estimates the tokens a request will use before it is sent, defaults to EstimateTokens.
+	EstimateTokens func(req llm.InferRequest) int
+}
+
+// EstimateTokens roughly estimates the tokens a request will use, including all of MaxTokens,
+// which is how OpenAI counts requests against token limits.
+func EstimateTokens(req llm.InferRequest) int {
+	return llm.EstimateUsage(req).TotalTokens()
+}
+
+type buckets struct {
+	requests *bucket
+	tokens   *bucket
+}
+
+// Limiter holds the buckets for each provider and model. Share one limiter between all responders and
+// embedders which call the same accounts.
+type Limiter struct {
+	config Config
+	now    func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*buckets
+}
+
+func NewLimiter(config Config) *Limiter {
+	if config.EstimateTokens == nil {
+		config.EstimateTokens = EstimateTokens
+	}
+	return &Limiter{
+		config:  config,
+		now:     time.Now,
+		buckets: make(map[string]*buckets),
+	}
+}
+
+func (l *Limiter) bucketsFor(key string, limit Limit) *buckets {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &buckets{}
+		if limit.RequestsPerMinute > 0 {
+			b.requests = newBucket(limit.RequestsPerMinute, l.now)
+		}
+		if limit.TokensPerMinute > 0 {
+			b.tokens = newBucket(limit.TokensPerMinute, l.now)
+		}
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// applicable returns the buckets which apply to a model config.
+func (l *Limiter) applicable(cfg llm.ModelConfig) []*buckets {
+	var bs []*buckets
+	if limit, ok := l.config.ProviderLimits[cfg.ProviderType]; ok {
+		bs = append(bs, l.bucketsFor("provider:"+string(cfg.ProviderType), limit))
+	}
+	if limit, ok := l.config.ModelLimits[cfg.ModelName]; ok {
+		bs = append(bs, l.bucketsFor("model:"+cfg.ModelName, limit))
+	}
+	return bs
+}
+
+// Wait blocks until a request for the model with the estimated tokens fits in its limits, or ctx is done.
+// The returned function corrects the token buckets with the actual usage once it is known.
+func (l *Limiter) Wait(ctx context.Context, cfg llm.ModelConfig, estimatedTokens int) (func(actualTokens int), error) {
+	bs := l.applicable(cfg)
+
+	type taking struct {
+		b *bucket
+		n int
+	}
+	var takes []taking
+	for _, b := range bs {
+		if b.requests != nil {
+			takes = append(takes, taking{b.requests, 1})
+		}
+		if b.tokens != nil {
+			takes = append(takes, taking{b.tokens, estimatedTokens})
+		}
+	}
+	for i, t := range takes {
+		if err := t.b.wait(ctx, t.n); err != nil {
+			// give back what we took before giving up
+			for _, taken := range takes[:i] {
+				taken.b.adjust(taken.n)
+			}
+			return nil, err
+		}
+	}
+
+	return func(actualTokens int) {
+		for _, b := range bs {
+			if b.tokens != nil {
+				b.tokens.adjust(estimatedTokens - actualTokens)
+			}
+		}
+	}, nil
+}
+
+// Responder implements llm.Responder, waiting for the request to fit in the limiter's limits before each call.
+type Responder struct {
+	underlying llm.Responder
+	limiter    *Limiter
+}
+
+func NewRateLimitedResponder(underlying llm.Responder, limiter *Limiter) *Responder {
+	return &Responder{
+		underlying: underlying,
+		limiter:    limiter,
+	}
+}
+
+// correct updates the buckets with the tokens used, if the provider reported them.
+func correct(done func(int), usage llm.Usage) {
+	if usage.TotalTokens() > 0 {
+		done(usage.TotalTokens())
+	}
+}
+
+func (r *Responder) GenerateResponse(ctx context.Context, req llm.InferRequest) (string, error) {
+	res, err := r.Infer(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	return res.Content, nil
+}
+
+func (r *Responder) Infer(ctx context.Context, req llm.InferRequest) (*llm.InferResponse, error) {
+	done, err := r.limiter.Wait(ctx, req.ModelConfig, r.limiter.config.EstimateTokens(req))
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.underlying.Infer(ctx, req)
+	if err != nil {
+		// failed requests don't use tokens
+		done(0)
+		return nil, err
+	}
+	correct(done, res.Usage)
+	return res, nil
+}
+
+func (r *Responder) GenerateResponseAsync(ctx context.Context, req llm.InferRequest) (<-chan llm.StreamDelta, error) {
+	done, err := r.limiter.Wait(ctx, req.ModelConfig, r.limiter.config.EstimateTokens(req))
+	if err != nil {
+		return nil, err
+	}
+	ch, err := r.underlying.GenerateResponseAsync(ctx, req)
+	if err != nil {
+		done(0)
+		return nil, err
+	}
+
+	outChan := make(chan llm.StreamDelta)
+	go func() {
+		defer close(outChan)
+		// streams which fail or are cancelled before EOF are refunded like failed requests
+		var settle sync.Once
+		defer settle.Do(func() { done(0) })
+		for delta := range ch {
+			if delta.EOF {
+				settle.Do(func() { correct(done, delta.Usage) })
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case outChan <- delta:
+			}
+		}
+	}()
+	return outChan, nil
+}
+
+// Embedder implements llm.Embedder, waiting for the request to fit in the limiter's limits before each call.
+// Embedding responses don't report usage, so the estimate isn't corrected.
+type Embedder struct {
+	underlying llm.Embedder
+	limiter    *Limiter
+}
+
+func NewRateLimitedEmbedder(underlying llm.Embedder, limiter *Limiter) *Embedder {
+	return &Embedder{
+		underlying: underlying,
+		limiter:    limiter,
+	}
+}
+
+func (e *Embedder) GenerateEmbedding(ctx context.Context, req llm.EmbedRequest) (*llm.EmbeddingResponse, error) {
+	done, err := e.limiter.Wait(ctx, req.ModelConfig, llm.EstimateEmbeddingUsage(req).TotalTokens())
+	if err != nil {
+		return nil, err
+	}
+	res, err := e.underlying.GenerateEmbedding(ctx, req)
+	if err != nil {
+		done(0)
+		return nil, err
+	}
+	return res, nil
+}
+
+var _ llm.Responder = &Responder{}
+var _ llm.Embedder = &Embedder{}
@@ -0,0 +1,175 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	mock_llm "github.com/stillmatic/gollum/packages/llm/internal/mocks"
+	"github.com/stillmatic/gollum/packages/llm/providers/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestRateLimitedResponder(t *testing.T) {
+	req := llm.InferRequest{
+		Messages:       []llm.InferMessage{{Role: "user", Content: "hello"}},
+		ModelConfig:    llm.ModelConfig{ProviderType: llm.ProviderGroq, ModelName: "llama-3.1-8b-instant"},
+		MessageOptions: llm.MessageOptions{MaxTokens: 900},
+	}
+
+	t.Run("blocks until the request fits", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		underlying := mock_llm.NewMockResponder(ctrl)
+		limiter := ratelimit.NewLimiter(ratelimit.Config{
+			ProviderLimits: map[llm.ProviderType]ratelimit.Limit{llm.ProviderGroq: {RequestsPerMinute: 1}},
+		})
+		r := ratelimit.NewRateLimitedResponder(underlying, limiter)
+
+		underlying.EXPECT().Infer(gomock.Any(), req).Return(&llm.InferResponse{Content: "hi"}, nil)
+		resp, err := r.GenerateResponse(context.Background(), req)
+		assert.NoError(t, err)
+		assert.Equal(t, "hi", resp)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err = r.GenerateResponse(ctx, req)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("limits are per model", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		underlying := mock_llm.NewMockResponder(ctrl)
+		limiter := ratelimit.NewLimiter(ratelimit.Config{
+			ModelLimits: map[string]ratelimit.Limit{"llama-3.1-8b-instant": {RequestsPerMinute: 1}},
+		})
+		r := ratelimit.NewRateLimitedResponder(underlying, limiter)
+
+		other := req
+		other.ModelConfig.ModelName = "llama-3.3-70b-versatile"
+		underlying.EXPECT().Infer(gomock.Any(), req).Return(&llm.InferResponse{}, nil)
+		underlying.EXPECT().Infer(gomock.Any(), other).Return(&llm.InferResponse{}, nil).Times(2)
+		_, err := r.Infer(context.Background(), req)
+		assert.NoError(t, err)
+		_, err = r.Infer(context.Background(), other)
+		assert.NoError(t, err)
+		_, err = r.Infer(context.Background(), other)
+		assert.NoError(t, err)
+	})
+
+	t.Run("token estimates are corrected with usage", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		underlying := mock_llm.NewMockResponder(ctrl)
+		limiter := ratelimit.NewLimiter(ratelimit.Config{
+			ProviderLimits: map[llm.ProviderType]ratelimit.Limit{llm.ProviderGroq: {TokensPerMinute: 1500}},
+		})
+		r := ratelimit.NewRateLimitedResponder(underlying, limiter)
+
+		// each request is estimated at ~900 tokens but only uses 100, so the second one shouldn't wait
+		underlying.EXPECT().Infer(gomock.Any(), req).Return(&llm.InferResponse{
+			Usage: llm.Usage{InputTokens: 10, OutputTokens: 90},
+		}, nil).Times(2)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := r.Infer(ctx, req)
+		assert.NoError(t, err)
+		_, err = r.Infer(ctx, req)
+		assert.NoError(t, err)
+	})
+
+	t.Run("failed requests are refunded", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		underlying := mock_llm.NewMockResponder(ctrl)
+		limiter := ratelimit.NewLimiter(ratelimit.Config{
+			ProviderLimits: map[llm.ProviderType]ratelimit.Limit{llm.ProviderGroq: {TokensPerMinute: 1500}},
+		})
+		r := ratelimit.NewRateLimitedResponder(underlying, limiter)
+
+		underlying.EXPECT().Infer(gomock.Any(), req).Return(nil, errors.New("boom"))
+		underlying.EXPECT().Infer(gomock.Any(), req).Return(&llm.InferResponse{}, nil)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := r.Infer(ctx, req)
+		assert.Error(t, err)
+		_, err = r.Infer(ctx, req)
+		assert.NoError(t, err)
+	})
+
+	t.Run("streams are corrected on EOF", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		underlying := mock_llm.NewMockResponder(ctrl)
+		limiter := ratelimit.NewLimiter(ratelimit.Config{
+			ProviderLimits: map[llm.ProviderType]ratelimit.Limit{llm.ProviderGroq: {TokensPerMinute: 1500}},
+		})
+		r := ratelimit.NewRateLimitedResponder(underlying, limiter)
+
+		underlying.EXPECT().GenerateResponseAsync(gomock.Any(), req).DoAndReturn(func(context.Context, llm.InferRequest) (<-chan llm.StreamDelta, error) {
+			ch := make(chan llm.StreamDelta, 2)
+			ch <- llm.StreamDelta{Text: "hi"}
+			ch <- llm.StreamDelta{EOF: true, Usage: llm.Usage{InputTokens: 10, OutputTokens: 90}}
+			close(ch)
+			return ch, nil
+		})
+		underlying.EXPECT().Infer(gomock.Any(), req).Return(&llm.InferResponse{}, nil)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		ch, err := r.GenerateResponseAsync(ctx, req)
+		assert.NoError(t, err)
+		for range ch {
+		}
+		_, err = r.Infer(ctx, req)
+		assert.NoError(t, err)
+	})
+
+	t.Run("failed streams are refunded", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		underlying := mock_llm.NewMockResponder(ctrl)
+		limiter := ratelimit.NewLimiter(ratelimit.Config{
+			ProviderLimits: map[llm.ProviderType]ratelimit.Limit{llm.ProviderGroq: {TokensPerMinute: 1500}},
+		})
+		r := ratelimit.NewRateLimitedResponder(underlying, limiter)
+
+		underlying.EXPECT().GenerateResponseAsync(gomock.Any(), req).DoAndReturn(func(context.Context, llm.InferRequest) (<-chan llm.StreamDelta, error) {
+			ch := make(chan llm.StreamDelta, 2)
+			ch <- llm.StreamDelta{Text: "hi"}
+			ch <- llm.StreamDelta{Err: errors.New("boom")}
+			close(ch)
+			return ch, nil
+		})
+		underlying.EXPECT().Infer(gomock.Any(), req).Return(&llm.InferResponse{}, nil)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		ch, err := r.GenerateResponseAsync(ctx, req)
+		assert.NoError(t, err)
+		var last llm.StreamDelta
+		for delta := range ch {
+			last = delta
+		}
+		assert.Error(t, last.Err)
+		_, err = r.Infer(ctx, req)
+		assert.NoError(t, err)
+	})
+}
+
+func TestRateLimitedEmbedder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	underlying := mock_llm.NewMockEmbedder(ctrl)
+	limiter := ratelimit.NewLimiter(ratelimit.Config{
+		ProviderLimits: map[llm.ProviderType]ratelimit.Limit{llm.ProviderVoyage: {RequestsPerMinute: 1}},
+	})
+	e := ratelimit.NewRateLimitedEmbedder(underlying, limiter)
+	req := llm.EmbedRequest{Input: []string{"abc"}, ModelConfig: llm.ModelConfig{ProviderType: llm.ProviderVoyage}}
+
+	underlying.EXPECT().GenerateEmbedding(gomock.Any(), req).Return(&llm.EmbeddingResponse{}, nil)
+	_, err := e.GenerateEmbedding(context.Background(), req)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = e.GenerateEmbedding(ctx, req)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
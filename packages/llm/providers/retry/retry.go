@@ -0,0 +1,225 @@
+// Package retry retries failed provider calls with jittered exponential backoff.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/internal/apierr"
+)
+
+// Config for retries. Zero fields use the values from DefaultConfig.
+type Config struct {
+	// MaxAttempts includes the first attempt.
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// MaxElapsed bounds the total time spent on a call, including waits. If waiting for the next attempt
+	// would go past it, or past the context's deadline, the last error is returned instead. 0 means no limit.
+	MaxElapsed time.Duration
+	// Retryable decides which errors to retry, defaults to Retryable.
+	Retryable func(error) bool
+}
+
+// DefaultConfig makes up to 4 attempts, waiting around 0.5s, 1s and 2s between them.
+func DefaultConfig() Config {
+	return Config{
+		MaxAttempts:    4,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     30 * time.Second,
+		Retryable:      Retryable,
+	}
+}
+
+func (c Config) withDefaults() Config {
+	d := DefaultConfig()
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = d.MaxAttempts
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = d.InitialBackoff
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = d.MaxBackoff
+	}
+	if c.Retryable == nil {
+		c.Retryable = d.Retryable
+	}
+	return c
+}
+
+// Retryable reports whether err is worth retrying: rate limits, transient server errors, timeouts and connection
+// errors, see llm.ErrRateLimited and llm.ErrServerOverloaded. Other API errors, cancelled contexts and errors from
+// building the request are not.
+func Retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	// errors the provider didn't classify are classified here
+	err = apierr.Classify("", err)
+	var apiErr *llm.APIError
+	switch {
+	case errors.Is(err, llm.ErrRateLimited), errors.Is(err, llm.ErrServerOverloaded):
+		return true
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict:
+		// conflicts, e.g. with a concurrent request, tend to clear up
+		return true
+	case apiErr != nil:
+		return false
+	}
+	// not an API error, so either the connection failed or we never sent the request
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// retryAfter returns the wait the provider asked for, if it did.
+func retryAfter(err error) (time.Duration, bool) {
+	var apiErr *llm.APIError
+	if errors.As(apierr.Classify("", err), &apiErr) && apiErr.RetryAfter > 0 {
+		return apiErr.RetryAfter, true
+	}
+	return 0, false
+}
+
+// backoff returns the wait before the given retry, counting from 1. Waits are jittered between half and all
+// of the exponential backoff, so that concurrent callers don't retry in lockstep.
+func (c Config) backoff(retry int) time.Duration {
+	d := c.InitialBackoff << (retry - 1)
+	if d > c.MaxBackoff || d <= 0 {
+		d = c.MaxBackoff
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// do calls fn until it succeeds, returns an error which isn't retryable, or runs out of attempts or time.
+func do[T any](ctx context.Context, cfg Config, fn func() (T, error)) (T, error) {
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		res, err := fn()
+		if err == nil || !cfg.Retryable(err) {
+			return res, err
+		}
+		if attempt >= cfg.MaxAttempts {
+			return res, fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		wait := cfg.backoff(attempt)
+		// honour the provider's Retry-After, e.g. on 429 and 503
+		if after, ok := retryAfter(err); ok {
+			wait = after
+		}
+		if cfg.MaxElapsed > 0 && time.Since(start)+wait > cfg.MaxElapsed {
+			return res, fmt.Errorf("giving up after %d attempts, next retry would exceed %s: %w", attempt, cfg.MaxElapsed, err)
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			return res, fmt.Errorf("giving up after %d attempts, next retry would exceed deadline: %w", attempt, err)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return res, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Responder implements llm.Responder, retrying failed calls to the underlying responder.
+type Responder struct {
+	underlying llm.Responder
+	config     Config
+}
+
+func NewRetryResponder(underlying llm.Responder, config Config) *Responder {
+	return &Responder{
+		underlying: underlying,
+		config:     config.withDefaults(),
+	}
+}
+
+func (r *Responder) GenerateResponse(ctx context.Context, req llm.InferRequest) (string, error) {
+	return do(ctx, r.config, func() (string, error) {
+		return r.underlying.GenerateResponse(ctx, req)
+	})
+}
+
+func (r *Responder) Infer(ctx context.Context, req llm.InferRequest) (*llm.InferResponse, error) {
+	return do(ctx, r.config, func() (*llm.InferResponse, error) {
+		return r.underlying.Infer(ctx, req)
+	})
+}
+
+// GenerateResponseAsync retries streams which fail before emitting anything.
+// Once a delta has been emitted, errors are passed through as they are.
+func (r *Responder) GenerateResponseAsync(ctx context.Context, req llm.InferRequest) (<-chan llm.StreamDelta, error) {
+	type started struct {
+		ch    <-chan llm.StreamDelta
+		first llm.StreamDelta
+	}
+	s, err := do(ctx, r.config, func() (started, error) {
+		ch, err := r.underlying.GenerateResponseAsync(ctx, req)
+		if err != nil {
+			return started{}, err
+		}
+		select {
+		case <-ctx.Done():
+			return started{}, ctx.Err()
+		case first, ok := <-ch:
+			if !ok {
+				return started{}, errors.New("stream closed without a response")
+			}
+			if first.Err != nil {
+				return started{}, first.Err
+			}
+			return started{ch: ch, first: first}, nil
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	outChan := make(chan llm.StreamDelta)
+	go func() {
+		defer close(outChan)
+		delta, ok := s.first, true
+		for ok {
+			select {
+			case <-ctx.Done():
+				return
+			case outChan <- delta:
+			}
+			delta, ok = <-s.ch
+		}
+	}()
+	return outChan, nil
+}
+
+// Embedder implements llm.Embedder, retrying failed calls to the underlying embedder.
+type Embedder struct {
+	underlying llm.Embedder
+	config     Config
+}
+
+func NewRetryEmbedder(underlying llm.Embedder, config Config) *Embedder {
+	return &Embedder{
+		underlying: underlying,
+		config:     config.withDefaults(),
+	}
+}
+
+func (e *Embedder) GenerateEmbedding(ctx context.Context, req llm.EmbedRequest) (*llm.EmbeddingResponse, error) {
+	return do(ctx, e.config, func() (*llm.EmbeddingResponse, error) {
+		return e.underlying.GenerateEmbedding(ctx, req)
+	})
+}
+
+var _ llm.Responder = &Responder{}
+var _ llm.Embedder = &Embedder{}
@@ -0,0 +1,174 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/internal/apierr"
+	mock_llm "github.com/stillmatic/gollum/packages/llm/internal/mocks"
+	"github.com/stillmatic/gollum/packages/llm/providers/retry"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+var (
+	errUnavailable = &apierr.HTTPError{StatusCode: http.StatusServiceUnavailable}
+	errBadRequest  = &apierr.HTTPError{StatusCode: http.StatusBadRequest}
+)
+
+// fastConfig retries without waiting long.
+var fastConfig = retry.Config{
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     5 * time.Millisecond,
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{errUnavailable, true},
+		{&apierr.HTTPError{StatusCode: http.StatusTooManyRequests}, true},
+		{&apierr.HTTPError{StatusCode: http.StatusConflict}, true},
+		{&apierr.HTTPError{StatusCode: http.StatusNotImplemented}, false},
+		{&llm.APIError{Kind: llm.ErrServerOverloaded, Err: errors.New("stream overloaded")}, true},
+		{&llm.APIError{Kind: llm.ErrContextLengthExceeded, Err: errors.New("prompt is too long")}, false},
+		{fmt.Errorf("wrapped: %w", errBadRequest), false},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{io.ErrUnexpectedEOF, true},
+		{context.Canceled, false},
+		{errors.New("invalid messages"), false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, retry.Retryable(tt.err), tt.err.Error())
+	}
+}
+
+func TestRetryEmbedder(t *testing.T) {
+	ctx := context.Background()
+	req := llm.EmbedRequest{Input: []string{"abc"}}
+
+	t.Run("retries until success", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		underlying := mock_llm.NewMockEmbedder(ctrl)
+		gomock.InOrder(
+			underlying.EXPECT().GenerateEmbedding(ctx, req).Return(nil, errUnavailable).Times(2),
+			underlying.EXPECT().GenerateEmbedding(ctx, req).Return(&llm.EmbeddingResponse{}, nil),
+		)
+		_, err := retry.NewRetryEmbedder(underlying, fastConfig).GenerateEmbedding(ctx, req)
+		assert.NoError(t, err)
+	})
+
+	t.Run("does not retry invalid requests", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		underlying := mock_llm.NewMockEmbedder(ctrl)
+		underlying.EXPECT().GenerateEmbedding(ctx, req).Return(nil, errBadRequest)
+		_, err := retry.NewRetryEmbedder(underlying, fastConfig).GenerateEmbedding(ctx, req)
+		assert.ErrorIs(t, err, errBadRequest)
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		underlying := mock_llm.NewMockEmbedder(ctrl)
+		underlying.EXPECT().GenerateEmbedding(ctx, req).Return(nil, errUnavailable).Times(3)
+		_, err := retry.NewRetryEmbedder(underlying, fastConfig).GenerateEmbedding(ctx, req)
+		assert.ErrorIs(t, err, errUnavailable)
+	})
+
+	t.Run("honours retry-after", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		underlying := mock_llm.NewMockEmbedder(ctrl)
+		rateLimited := &apierr.HTTPError{
+			StatusCode: http.StatusTooManyRequests,
+			Header:     http.Header{"Retry-After-Ms": []string{"50"}},
+		}
+		gomock.InOrder(
+			underlying.EXPECT().GenerateEmbedding(ctx, req).Return(nil, rateLimited),
+			underlying.EXPECT().GenerateEmbedding(ctx, req).Return(&llm.EmbeddingResponse{}, nil),
+		)
+		start := time.Now()
+		_, err := retry.NewRetryEmbedder(underlying, fastConfig).GenerateEmbedding(ctx, req)
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	})
+
+	t.Run("does not wait past max elapsed", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		underlying := mock_llm.NewMockEmbedder(ctrl)
+		rateLimited := &apierr.HTTPError{
+			StatusCode: http.StatusTooManyRequests,
+			Header:     http.Header{"Retry-After": []string{"60"}},
+		}
+		underlying.EXPECT().GenerateEmbedding(ctx, req).Return(nil, rateLimited)
+		cfg := fastConfig
+		cfg.MaxElapsed = time.Second
+		start := time.Now()
+		_, err := retry.NewRetryEmbedder(underlying, cfg).GenerateEmbedding(ctx, req)
+		assert.ErrorIs(t, err, rateLimited)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("stops waiting when the context is cancelled", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		underlying := mock_llm.NewMockEmbedder(ctrl)
+		ctx, cancel := context.WithCancel(ctx)
+		underlying.EXPECT().GenerateEmbedding(ctx, req).DoAndReturn(func(context.Context, llm.EmbedRequest) (*llm.EmbeddingResponse, error) {
+			cancel()
+			return nil, errUnavailable
+		})
+		cfg := fastConfig
+		cfg.InitialBackoff = time.Minute
+		cfg.MaxBackoff = time.Minute
+		_, err := retry.NewRetryEmbedder(underlying, cfg).GenerateEmbedding(ctx, req)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestRetryResponder(t *testing.T) {
+	ctx := context.Background()
+	req := llm.InferRequest{Messages: []llm.InferMessage{{Role: "user", Content: "hello"}}}
+
+	t.Run("infer", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		underlying := mock_llm.NewMockResponder(ctrl)
+		gomock.InOrder(
+			underlying.EXPECT().Infer(ctx, req).Return(nil, errUnavailable),
+			underlying.EXPECT().Infer(ctx, req).Return(&llm.InferResponse{Content: "hi"}, nil),
+		)
+		res, err := retry.NewRetryResponder(underlying, fastConfig).Infer(ctx, req)
+		assert.NoError(t, err)
+		assert.Equal(t, "hi", res.Content)
+	})
+
+	t.Run("stream retried before first delta", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		underlying := mock_llm.NewMockResponder(ctrl)
+		failed := make(chan llm.StreamDelta, 1)
+		failed <- llm.StreamDelta{Err: errUnavailable}
+		close(failed)
+		ok := make(chan llm.StreamDelta, 2)
+		ok <- llm.StreamDelta{Text: "hi"}
+		ok <- llm.StreamDelta{EOF: true}
+		close(ok)
+		gomock.InOrder(
+			underlying.EXPECT().GenerateResponseAsync(ctx, req).Return(failed, nil),
+			underlying.EXPECT().GenerateResponseAsync(ctx, req).Return(ok, nil),
+		)
+
+		ch, err := retry.NewRetryResponder(underlying, fastConfig).GenerateResponseAsync(ctx, req)
+		assert.NoError(t, err)
+		var deltas []llm.StreamDelta
+		for d := range ch {
+			deltas = append(deltas, d)
+		}
+		assert.Equal(t, []llm.StreamDelta{{Text: "hi"}, {EOF: true}}, deltas)
+	})
+}
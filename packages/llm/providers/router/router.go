@@ -0,0 +1,268 @@
+// Package router dispatches requests to the provider for their model config.
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/providers/anthropic"
+	"github.com/stillmatic/gollum/packages/llm/providers/bedrock"
+	"github.com/stillmatic/gollum/packages/llm/providers/google"
+	"github.com/stillmatic/gollum/packages/llm/providers/local"
+	"github.com/stillmatic/gollum/packages/llm/providers/mixedbread"
+	"github.com/stillmatic/gollum/packages/llm/providers/openai"
+	"github.com/stillmatic/gollum/packages/llm/providers/vertex"
+	"github.com/stillmatic/gollum/packages/llm/providers/voyage"
+)
+
+var (
+	// ErrNoProvider is returned when no provider is registered for the request's ProviderType.
+	ErrNoProvider = errors.New("no provider registered")
+	// ErrUnknownConfig is returned when a config name is not in the router's store.
+	ErrUnknownConfig = errors.New("unknown model config")
+)
+
+// Router implements llm.Responder and llm.Embedder by dispatching each request
+// to the provider registered for its ModelConfig.ProviderType.
+// Requests are checked against the model's capabilities with llm.ValidateRequest before they are dispatched.
+type Router struct {
+	responders map[llm.ProviderType]llm.Responder
+	embedders  map[llm.ProviderType]llm.Embedder
+	store      *llm.ModelConfigStore
+}
+
+// NewRouter creates an empty router, register providers with Register.
+func NewRouter() *Router {
+	return &Router{
+		responders: make(map[llm.ProviderType]llm.Responder),
+		embedders:  make(map[llm.ProviderType]llm.Embedder),
+	}
+}
+
+// Credentials for the providers a router can build.
+type Credentials struct {
+	// APIKeys by provider type. Providers without a key are not registered.
+	APIKeys map[llm.ProviderType]string
+	// Vertex uses application default credentials, it is registered when the project ID is set.
+	VertexProjectID string
+	VertexLocation  string
+	// Local servers need no key, they are registered when their address is set.
+	OllamaHost   string
+	LlamaCppHost string
+	// Azure OpenAI is registered when the endpoint and its API key are set. The API version is optional.
+	AzureOpenAIEndpoint   string
+	AzureOpenAIAPIVersion string
+	// Bedrock is registered when the region and an access key are set.
+	AWSRegion string
+	AWS       bedrock.Credentials
+}
+
+// CredentialsFromEnv reads credentials from the conventional environment variables.
+func CredentialsFromEnv() Credentials {
+	envVars := map[llm.ProviderType]string{
+		llm.ProviderOpenAI:      "OPENAI_API_KEY",
+		llm.ProviderAzureOpenAI: "AZURE_OPENAI_API_KEY",
+		llm.ProviderAnthropic:   "ANTHROPIC_API_KEY",
+		llm.ProviderGoogle:      "GEMINI_API_KEY",
+		llm.ProviderGroq:        "GROQ_API_KEY",
+		llm.ProviderTogether:    "TOGETHER_API_KEY",
+		llm.ProviderHyperbolic:  "HYPERBOLIC_API_KEY",
+		llm.ProviderDeepseek:    "DEEPSEEK_API_KEY",
+		llm.ProviderVoyage:      "VOYAGE_API_KEY",
+		llm.ProviderMixedBread:  "MXBAI_API_KEY",
+	}
+	creds := Credentials{
+		APIKeys:               make(map[llm.ProviderType]string),
+		VertexProjectID:       os.Getenv("GOOGLE_CLOUD_PROJECT"),
+		VertexLocation:        os.Getenv("GOOGLE_CLOUD_LOCATION"),
+		OllamaHost:            os.Getenv("OLLAMA_HOST"),
+		LlamaCppHost:          os.Getenv("LLAMA_CPP_HOST"),
+		AzureOpenAIEndpoint:   os.Getenv("AZURE_OPENAI_ENDPOINT"),
+		AzureOpenAIAPIVersion: os.Getenv("AZURE_OPENAI_API_VERSION"),
+		AWSRegion:             os.Getenv("AWS_REGION"),
+		AWS:                   bedrock.CredentialsFromEnv(),
+	}
+	if creds.AWSRegion == "" {
+		creds.AWSRegion = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	for pt, envVar := range envVars {
+		if key := os.Getenv(envVar); key != "" {
+			creds.APIKeys[pt] = key
+		}
+	}
+	return creds
+}
+
+// NewRouterFromStore creates a router with a provider for every provider type used in the store
+// that there are credentials for. Requests can then be built with ModelConfig, by config name.
+func NewRouterFromStore(ctx context.Context, store *llm.ModelConfigStore, creds Credentials) (*Router, error) {
+	r := NewRouter()
+	r.store = store
+
+	seen := make(map[llm.ProviderType]bool)
+	for _, name := range store.GetConfigNames() {
+		cfg, _ := store.GetConfig(name)
+		pt := cfg.ProviderType
+		if seen[pt] {
+			continue
+		}
+		seen[pt] = true
+		provider, err := newProvider(ctx, pt, creds)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s provider: %w", pt, err)
+		}
+		if provider != nil {
+			r.Register(pt, provider)
+		}
+	}
+	return r, nil
+}
+
+// newProvider builds the provider for the given type, or returns nil if there are no credentials for it.
+func newProvider(ctx context.Context, pt llm.ProviderType, creds Credentials) (any, error) {
+	switch pt {
+	case llm.ProviderVertex:
+		if creds.VertexProjectID == "" {
+			return nil, nil
+		}
+		return vertex.NewVertexAIProvider(ctx, creds.VertexProjectID, creds.VertexLocation)
+	case llm.ProviderOllama:
+		if creds.OllamaHost == "" {
+			return nil, nil
+		}
+		return local.NewOllamaProvider(creds.OllamaHost), nil
+	case llm.ProviderLlamaCpp:
+		if creds.LlamaCppHost == "" {
+			return nil, nil
+		}
+		return local.NewLlamaCppProvider(creds.LlamaCppHost), nil
+	case llm.ProviderBedrock:
+		if creds.AWSRegion == "" || creds.AWS.AccessKeyID == "" {
+			return nil, nil
+		}
+		return bedrock.NewBedrockProvider(creds.AWSRegion, creds.AWS), nil
+	}
+
+	apiKey := creds.APIKeys[pt]
+	if apiKey == "" {
+		return nil, nil
+	}
+	switch pt {
+	case llm.ProviderOpenAI:
+		return openai.NewOpenAIProvider(apiKey), nil
+	case llm.ProviderAzureOpenAI:
+		if creds.AzureOpenAIEndpoint == "" {
+			return nil, nil
+		}
+		return openai.NewAzureProvider(openai.AzureConfig{
+			Endpoint:   creds.AzureOpenAIEndpoint,
+			APIVersion: creds.AzureOpenAIAPIVersion,
+			APIKey:     apiKey,
+		})
+	case llm.ProviderGroq:
+		return openai.NewGroqProvider(apiKey), nil
+	case llm.ProviderTogether:
+		return openai.NewTogetherProvider(apiKey), nil
+	case llm.ProviderHyperbolic:
+		return openai.NewHyperbolicProvider(apiKey), nil
+	case llm.ProviderDeepseek:
+		return openai.NewDeepseekProvider(apiKey), nil
+	case llm.ProviderAnthropic:
+		return anthropic.NewAnthropicProvider(apiKey), nil
+	case llm.ProviderGoogle:
+		return google.NewGoogleProvider(ctx, apiKey)
+	case llm.ProviderVoyage:
+		return voyage.NewVoyageAIEmbedder(apiKey), nil
+	case llm.ProviderMixedBread:
+		return mixedbread.NewMixedbreadEmbedder(apiKey), nil
+	default:
+		return nil, fmt.Errorf("unsupported provider type %q", pt)
+	}
+}
+
+// Register adds a provider for the given type, as a Responder and/or Embedder depending on what it implements.
+// It replaces any provider previously registered for the type.
+func (r *Router) Register(pt llm.ProviderType, provider any) {
+	if responder, ok := provider.(llm.Responder); ok {
+		r.responders[pt] = responder
+	}
+	if embedder, ok := provider.(llm.Embedder); ok {
+		r.embedders[pt] = embedder
+	}
+}
+
+// Responder returns the responder registered for the given type.
+func (r *Router) Responder(pt llm.ProviderType) (llm.Responder, bool) {
+	responder, ok := r.responders[pt]
+	return responder, ok
+}
+
+// Embedder returns the embedder registered for the given type.
+func (r *Router) Embedder(pt llm.ProviderType) (llm.Embedder, bool) {
+	embedder, ok := r.embedders[pt]
+	return embedder, ok
+}
+
+// ModelConfig looks up a config by name, e.g. llm.ConfigGPT4o, in the store the router was built from.
+func (r *Router) ModelConfig(configName string) (llm.ModelConfig, error) {
+	if r.store == nil {
+		return llm.ModelConfig{}, fmt.Errorf("%w: %s", ErrUnknownConfig, configName)
+	}
+	cfg, ok := r.store.GetConfig(configName)
+	if !ok {
+		return llm.ModelConfig{}, fmt.Errorf("%w: %s", ErrUnknownConfig, configName)
+	}
+	return cfg, nil
+}
+
+func (r *Router) responder(req llm.InferRequest, streaming bool) (llm.Responder, error) {
+	responder, ok := r.responders[req.ModelConfig.ProviderType]
+	if !ok {
+		return nil, fmt.Errorf("%w: responder for %q", ErrNoProvider, req.ModelConfig.ProviderType)
+	}
+	if err := llm.ValidateRequest(req, streaming); err != nil {
+		return nil, err
+	}
+	return responder, nil
+}
+
+func (r *Router) GenerateResponse(ctx context.Context, req llm.InferRequest) (string, error) {
+	responder, err := r.responder(req, false)
+	if err != nil {
+		return "", err
+	}
+	return responder.GenerateResponse(ctx, req)
+}
+
+func (r *Router) Infer(ctx context.Context, req llm.InferRequest) (*llm.InferResponse, error) {
+	responder, err := r.responder(req, false)
+	if err != nil {
+		return nil, err
+	}
+	return responder.Infer(ctx, req)
+}
+
+func (r *Router) GenerateResponseAsync(ctx context.Context, req llm.InferRequest) (<-chan llm.StreamDelta, error) {
+	responder, err := r.responder(req, true)
+	if err != nil {
+		return nil, err
+	}
+	return responder.GenerateResponseAsync(ctx, req)
+}
+
+func (r *Router) GenerateEmbedding(ctx context.Context, req llm.EmbedRequest) (*llm.EmbeddingResponse, error) {
+	embedder, ok := r.embedders[req.ModelConfig.ProviderType]
+	if !ok {
+		return nil, fmt.Errorf("%w: embedder for %q", ErrNoProvider, req.ModelConfig.ProviderType)
+	}
+	if err := llm.ValidateEmbedRequest(req); err != nil {
+		return nil, err
+	}
+	return embedder.GenerateEmbedding(ctx, req)
+}
+
+var _ llm.Responder = &Router{}
+var _ llm.Embedder = &Router{}
@@ -0,0 +1,118 @@
+package router_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	mock_llm "github.com/stillmatic/gollum/packages/llm/internal/mocks"
+	"github.com/stillmatic/gollum/packages/llm/providers/router"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestRouter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+
+	t.Run("dispatches on provider type", func(t *testing.T) {
+		anthropicProvider := mock_llm.NewMockResponder(ctrl)
+		openaiProvider := mock_llm.NewMockResponder(ctrl)
+		r := router.NewRouter()
+		r.Register(llm.ProviderAnthropic, anthropicProvider)
+		r.Register(llm.ProviderOpenAI, openaiProvider)
+
+		req := llm.InferRequest{
+			Messages:    []llm.InferMessage{{Role: "user", Content: "hello"}},
+			ModelConfig: llm.ModelConfig{ProviderType: llm.ProviderOpenAI, ModelName: "gpt-4o"},
+		}
+		openaiProvider.EXPECT().GenerateResponse(ctx, req).Return("hello from openai", nil)
+		resp, err := r.GenerateResponse(ctx, req)
+		assert.NoError(t, err)
+		assert.Equal(t, "hello from openai", resp)
+
+		req.ModelConfig.ProviderType = llm.ProviderAnthropic
+		anthropicProvider.EXPECT().Infer(ctx, req).Return(&llm.InferResponse{Content: "hello from anthropic"}, nil)
+		res, err := r.Infer(ctx, req)
+		assert.NoError(t, err)
+		assert.Equal(t, "hello from anthropic", res.Content)
+	})
+
+	t.Run("embeddings", func(t *testing.T) {
+		embedder := mock_llm.NewMockEmbedder(ctrl)
+		r := router.NewRouter()
+		r.Register(llm.ProviderVoyage, embedder)
+
+		req := llm.EmbedRequest{
+			Input:       []string{"abc"},
+			ModelConfig: llm.ModelConfig{ProviderType: llm.ProviderVoyage},
+		}
+		embedder.EXPECT().GenerateEmbedding(ctx, req).Return(&llm.EmbeddingResponse{}, nil)
+		_, err := r.GenerateEmbedding(ctx, req)
+		assert.NoError(t, err)
+
+		// voyage only embeds
+		_, ok := r.Responder(llm.ProviderVoyage)
+		assert.False(t, ok)
+	})
+
+	t.Run("validates requests before dispatching", func(t *testing.T) {
+		provider := mock_llm.NewMockResponder(ctrl)
+		r := router.NewRouter()
+		r.Register(llm.ProviderDeepseek, provider)
+
+		cfg, ok := llm.NewModelConfigStore().GetConfig(llm.ConfigDeepseekChat)
+		assert.True(t, ok)
+		req := llm.InferRequest{
+			Messages:    []llm.InferMessage{{Role: "user", Parts: []llm.Part{llm.ImageURLPart("https://example.com/cat.png")}}},
+			ModelConfig: cfg,
+		}
+		// the provider is never called
+		_, err := r.Infer(ctx, req)
+		assert.ErrorIs(t, err, llm.ErrUnsupportedPart)
+		_, err = r.GenerateResponseAsync(ctx, req)
+		assert.ErrorIs(t, err, llm.ErrUnsupportedPart)
+	})
+
+	t.Run("unregistered provider", func(t *testing.T) {
+		r := router.NewRouter()
+		req := llm.InferRequest{ModelConfig: llm.ModelConfig{ProviderType: llm.ProviderGroq}}
+		_, err := r.GenerateResponse(ctx, req)
+		assert.ErrorIs(t, err, router.ErrNoProvider)
+		_, err = r.GenerateResponseAsync(ctx, req)
+		assert.ErrorIs(t, err, router.ErrNoProvider)
+		_, err = r.GenerateEmbedding(ctx, llm.EmbedRequest{ModelConfig: req.ModelConfig})
+		assert.ErrorIs(t, err, router.ErrNoProvider)
+	})
+}
+
+func TestNewRouterFromStore(t *testing.T) {
+	store := llm.NewModelConfigStoreWithConfigs(map[string]llm.ModelConfig{
+		llm.ConfigGPT4o:             {ProviderType: llm.ProviderOpenAI, ModelName: "gpt-4o", ModelType: llm.ModelTypeLLM},
+		llm.ConfigGroqLlama70B:      {ProviderType: llm.ProviderGroq, ModelName: "llama-3.1-70b-versatile", ModelType: llm.ModelTypeLLM},
+		llm.ConfigClaude3Dot7Sonnet: {ProviderType: llm.ProviderAnthropic, ModelName: "claude-3-7-sonnet-latest", ModelType: llm.ModelTypeLLM},
+	})
+	r, err := router.NewRouterFromStore(context.Background(), store, router.Credentials{
+		APIKeys: map[llm.ProviderType]string{
+			llm.ProviderOpenAI:    "fake-key",
+			llm.ProviderAnthropic: "fake-key",
+		},
+	})
+	assert.NoError(t, err)
+
+	_, ok := r.Responder(llm.ProviderOpenAI)
+	assert.True(t, ok)
+	_, ok = r.Embedder(llm.ProviderOpenAI)
+	assert.True(t, ok)
+	_, ok = r.Responder(llm.ProviderAnthropic)
+	assert.True(t, ok)
+	// no key
+	_, ok = r.Responder(llm.ProviderGroq)
+	assert.False(t, ok)
+
+	cfg, err := r.ModelConfig(llm.ConfigGPT4o)
+	assert.NoError(t, err)
+	assert.Equal(t, "gpt-4o", cfg.ModelName)
+	_, err = r.ModelConfig("nope")
+	assert.ErrorIs(t, err, router.ErrUnknownConfig)
+}
@@ -0,0 +1,118 @@
+// Package transport configures how providers reach their APIs, e.g. through a proxy or corporate gateway, or
+// against an httptest.Server in tests. Every provider constructor takes these options.
+package transport
+
+import (
+	"net/http"
+	"time"
+)
+
+// Option configures a provider's transport.
+type Option func(*Settings)
+
+// Settings are the result of applying Options. Providers read them, callers set them with the With functions.
+type Settings struct {
+	// HTTPClient is the base client. Its transport is wrapped to add the headers, and it is copied, not modified.
+	HTTPClient *http.Client
+	// BaseURL replaces the provider's default API URL.
+	BaseURL   string
+	Header    http.Header
+	UserAgent string
+	// Timeout limits each request, including reading the response, so it also bounds streamed responses.
+	Timeout time.Duration
+}
+
+// WithHTTPClient sets the client requests are sent with, e.g. one with a proxy or custom TLS config.
+func WithHTTPClient(client *http.Client) Option {
+	return func(s *Settings) {
+		s.HTTPClient = client
+	}
+}
+
+// WithBaseURL sends requests to url instead of the provider's default.
+func WithBaseURL(url string) Option {
+	return func(s *Settings) {
+		s.BaseURL = url
+	}
+}
+
+// WithHeader adds a header to every request, replacing any the provider sets under the same key.
+// It can be given several times, including for the same key.
+func WithHeader(key, value string) Option {
+	return func(s *Settings) {
+		if s.Header == nil {
+			s.Header = make(http.Header)
+		}
+		s.Header.Add(key, value)
+	}
+}
+
+// WithUserAgent replaces the User-Agent header of every request.
+func WithUserAgent(userAgent string) Option {
+	return func(s *Settings) {
+		s.UserAgent = userAgent
+	}
+}
+
+// WithTimeout limits how long each request may take.
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *Settings) {
+		s.Timeout = timeout
+	}
+}
+
+// Apply returns the settings from opts, later options taking precedence.
+func Apply(opts ...Option) Settings {
+	var s Settings
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return s
+}
+
+// BaseURLOr returns the base URL, or def if none was set.
+func (s Settings) BaseURLOr(def string) string {
+	if s.BaseURL != "" {
+		return s.BaseURL
+	}
+	return def
+}
+
+// Client returns a client which sends the headers and user agent and applies the timeout, built on HTTPClient
+// or a new client.
+func (s Settings) Client() *http.Client {
+	client := &http.Client{}
+	if s.HTTPClient != nil {
+		c := *s.HTTPClient
+		client = &c
+	}
+	if len(s.Header) > 0 || s.UserAgent != "" {
+		client.Transport = &headerTransport{base: client.Transport, header: s.Header, userAgent: s.UserAgent}
+	}
+	if s.Timeout > 0 {
+		client.Timeout = s.Timeout
+	}
+	return client
+}
+
+type headerTransport struct {
+	base      http.RoundTripper
+	header    http.Header
+	userAgent string
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	// round trippers must not modify the request
+	req = req.Clone(req.Context())
+	for k, v := range t.header {
+		req.Header[k] = v
+	}
+	if t.userAgent != "" {
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+	return base.RoundTrip(req)
+}
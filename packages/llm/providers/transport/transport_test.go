@@ -0,0 +1,57 @@
+package transport_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stillmatic/gollum/packages/llm/providers/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		if r.URL.Path == "/slow" {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+
+	base := &http.Client{}
+	settings := transport.Apply(
+		transport.WithHTTPClient(base),
+		transport.WithBaseURL(srv.URL),
+		transport.WithHeader("X-Gateway-Key", "a"),
+		transport.WithHeader("X-Gateway-Key", "b"),
+		transport.WithHeader("Authorization", "Bearer gateway"),
+		transport.WithUserAgent("gollum-test"),
+		transport.WithTimeout(20*time.Millisecond),
+	)
+	assert.Equal(t, srv.URL, settings.BaseURLOr("https://example.com"))
+	client := settings.Client()
+	// the given client is copied
+	assert.Zero(t, base.Timeout)
+	assert.Nil(t, base.Transport)
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, settings.BaseURL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer provider")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, []string{"a", "b"}, got.Values("X-Gateway-Key"))
+	assert.Equal(t, "Bearer gateway", got.Get("Authorization"))
+	assert.Equal(t, "gollum-test", got.Get("User-Agent"))
+	// the request itself is left alone
+	assert.Equal(t, "Bearer provider", req.Header.Get("Authorization"))
+
+	_, err = client.Get(srv.URL + "/slow")
+	assert.ErrorContains(t, err, "Client.Timeout exceeded")
+
+	assert.Equal(t, "https://example.com", transport.Apply().BaseURLOr("https://example.com"))
+}
@@ -0,0 +1,192 @@
+package truncate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/stillmatic/gollum/packages/llm"
+)
+
+// history is a request's messages split into the leading system messages and turns. A turn starts at a user
+// message and runs up to the next one, so dropping whole turns never separates a tool call from its result.
+// System messages later in the conversation stay in their turn.
+type history struct {
+	system []llm.InferMessage
+	turns  [][]llm.InferMessage
+}
+
+func splitHistory(messages []llm.InferMessage) history {
+	var h history
+	for _, m := range messages {
+		switch {
+		case m.Role == "system" && len(h.turns) == 0:
+			h.system = append(h.system, m)
+		case m.Role == "user" || len(h.turns) == 0:
+			h.turns = append(h.turns, []llm.InferMessage{m})
+		default:
+			h.turns[len(h.turns)-1] = append(h.turns[len(h.turns)-1], m)
+		}
+	}
+	return h
+}
+
+// join returns the leading system messages, then extra, then the given turns.
+func (h history) join(extra []llm.InferMessage, turns ...[]llm.InferMessage) []llm.InferMessage {
+	msgs := append([]llm.InferMessage{}, h.system...)
+	msgs = append(msgs, extra...)
+	return append(msgs, flatten(turns)...)
+}
+
+func flatten(turns [][]llm.InferMessage) []llm.InferMessage {
+	var msgs []llm.InferMessage
+	for _, turn := range turns {
+		msgs = append(msgs, turn...)
+	}
+	return msgs
+}
+
+// sizes returns the tokens of the request with only its system messages, and the tokens each turn adds to it.
+func (h history) sizes(req llm.InferRequest) (int, []int) {
+	req.Messages = h.system
+	base := llm.CountTokens(req)
+	empty := llm.CountTokens(llm.InferRequest{ModelConfig: req.ModelConfig})
+	sizes := make([]int, len(h.turns))
+	for i, turn := range h.turns {
+		sizes[i] = llm.CountTokens(llm.InferRequest{ModelConfig: req.ModelConfig, Messages: turn}) - empty
+	}
+	return base, sizes
+}
+
+// dropOldest returns how many of the oldest turns must be dropped for the rest to fit in budget, keeping at least
+// the latest turn.
+func dropOldest(base int, sizes []int, budget int) int {
+	total := base
+	for _, s := range sizes {
+		total += s
+	}
+	dropped := 0
+	for dropped < len(sizes)-1 && total > budget {
+		total -= sizes[dropped]
+		dropped++
+	}
+	return dropped
+}
+
+// DropOldest drops the oldest turns until the request fits.
+type DropOldest struct{}
+
+func (DropOldest) Truncate(_ context.Context, req llm.InferRequest, budget int) ([]llm.InferMessage, error) {
+	h := splitHistory(req.Messages)
+	base, sizes := h.sizes(req)
+	return h.join(nil, h.turns[dropOldest(base, sizes, budget):]...), nil
+}
+
+// KeepFirstLast keeps the first First turns, e.g. the task description, and the last Last turns, dropping
+// everything in between. At least the latest turn is kept.
+type KeepFirstLast struct {
+	First int
+	Last  int
+}
+
+func (s KeepFirstLast) Truncate(_ context.Context, req llm.InferRequest, _ int) ([]llm.InferMessage, error) {
+	h := splitHistory(req.Messages)
+	last := max(s.Last, 1)
+	if s.First+last >= len(h.turns) {
+		return req.Messages, nil
+	}
+	turns := append(h.turns[:s.First:s.First], h.turns[len(h.turns)-last:]...)
+	return h.join(nil, turns...), nil
+}
+
+// DefaultSummaryPrompt is the system prompt used by Summarize.
+const DefaultSummaryPrompt = "Summarize the conversation below for the assistant who will continue it. " +
+	"Keep every fact, decision, name and open question the assistant needs, and leave out pleasantries. " +
+	"Respond with the summary only."
+
+// Summarize drops the oldest turns like DropOldest, then asks a model to summarize them. The summary is added
+// as a system message after the existing ones, or as a user message for models without system prompts.
+type Summarize struct {
+	// Model writes the summary.
+	Model llm.Responder
+	// Config of the model that writes the summary, defaults to the request's ModelConfig.
+	Config llm.ModelConfig
+	// Prompt defaults to DefaultSummaryPrompt.
+	Prompt string
+	// MaxTokens is the longest summary to ask for, defaults to 512.
+	MaxTokens int
+}
+
+func (s Summarize) Truncate(ctx context.Context, req llm.InferRequest, budget int) ([]llm.InferMessage, error) {
+	maxTokens := s.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = 512
+	}
+	h := splitHistory(req.Messages)
+	base, sizes := h.sizes(req)
+	// leave room for the summary message
+	dropped := dropOldest(base+maxTokens+summaryOverhead, sizes, budget)
+	if dropped == 0 {
+		return req.Messages, nil
+	}
+
+	config := s.Config
+	if config.ModelName == "" {
+		config = req.ModelConfig
+	}
+	prompt := s.Prompt
+	if prompt == "" {
+		prompt = DefaultSummaryPrompt
+	}
+	messages := []llm.InferMessage{
+		{Role: "system", Content: prompt},
+		{Role: "user", Content: transcript(flatten(h.turns[:dropped]))},
+	}
+	if !supportsSystemPrompt(config) {
+		messages = []llm.InferMessage{{Role: "user", Content: prompt + "\n\n" + messages[1].Content}}
+	}
+	summary, err := s.Model.GenerateResponse(ctx, llm.InferRequest{
+		Messages:       messages,
+		ModelConfig:    config,
+		MessageOptions: llm.MessageOptions{MaxTokens: maxTokens},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not summarize history: %w", err)
+	}
+	msg := llm.InferMessage{Role: "system", Content: summaryPrefix + strings.TrimSpace(summary)}
+	if !supportsSystemPrompt(req.ModelConfig) {
+		msg.Role = "user"
+	}
+	return h.join([]llm.InferMessage{msg}, h.turns[dropped:]...), nil
+}
+
+// supportsSystemPrompt reports whether the model takes system messages. Configs without capabilities are
+// assumed to, like llm.ValidateRequest does.
+func supportsSystemPrompt(cfg llm.ModelConfig) bool {
+	return cfg.Capabilities == nil || cfg.Capabilities.SystemPrompt
+}
+
+const summaryPrefix = "Summary of the earlier conversation:\n"
+
+// summaryOverhead covers the summary prefix and message framing.
+const summaryOverhead = 16
+
+// transcript renders messages as plain text for the summarizer.
+func transcript(messages []llm.InferMessage) string {
+	var b strings.Builder
+	for _, m := range messages {
+		var text []string
+		for _, part := range m.ContentParts() {
+			if part.Type == llm.PartTypeText {
+				text = append(text, part.Text)
+			} else {
+				text = append(text, fmt.Sprintf("[%s]", part.Type))
+			}
+		}
+		for _, tc := range m.ToolCalls {
+			text = append(text, fmt.Sprintf("[called %s(%s)]", tc.Name, tc.Arguments))
+		}
+		fmt.Fprintf(&b, "%s: %s\n", m.Role, strings.Join(text, " "))
+	}
+	return b.String()
+}
@@ -0,0 +1,121 @@
+// Package truncate shortens the conversation history of requests which don't fit in the model's context window.
+package truncate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/stillmatic/gollum/packages/llm"
+)
+
+// ErrTooLong is returned when a request can't be shortened enough to fit, e.g. because the latest turn alone
+// is too long.
+var ErrTooLong = errors.New("request does not fit in the context window")
+
+// Strategy shortens the history of a request so its input fits in budget tokens, as counted by llm.CountTokens.
+// The leading system messages and the latest turn must be kept, and the order of the messages kept must not
+// change.
+type Strategy interface {
+	Truncate(ctx context.Context, req llm.InferRequest, budget int) ([]llm.InferMessage, error)
+}
+
+// Config for truncation. Zero fields use sensible defaults.
+type Config struct {
+	// Strategy defaults to DropOldest.
+	Strategy Strategy
+	// ContextWindow overrides ModelConfig.ContextWindow. Requests for models with neither set are passed through.
+	ContextWindow int
+	// Margin is the share of the context window kept free, since token counts are estimates for most
+	// providers. Defaults to 0.05.
+	Margin float64
+	// OutputReserve is the room kept for output when the request doesn't set MaxTokens, at most the model's
+	// MaxOutputTokens. Defaults to 4096, reserving the full MaxOutputTokens of reasoning models would leave
+	// little room for history.
+	OutputReserve int
+}
+
+// Responder implements llm.Responder, shortening each request's history to fit the model's context window.
+// The room needed for output is MaxTokens if set, otherwise Config.OutputReserve.
+type Responder struct {
+	underlying llm.Responder
+	config     Config
+}
+
+func NewTruncateResponder(underlying llm.Responder, config Config) *Responder {
+	if config.Strategy == nil {
+		config.Strategy = DropOldest{}
+	}
+	if config.Margin <= 0 {
+		config.Margin = 0.05
+	}
+	if config.OutputReserve <= 0 {
+		config.OutputReserve = 4096
+	}
+	return &Responder{
+		underlying: underlying,
+		config:     config,
+	}
+}
+
+func (r *Responder) GenerateResponse(ctx context.Context, req llm.InferRequest) (string, error) {
+	req, err := r.truncate(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	return r.underlying.GenerateResponse(ctx, req)
+}
+
+func (r *Responder) Infer(ctx context.Context, req llm.InferRequest) (*llm.InferResponse, error) {
+	req, err := r.truncate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return r.underlying.Infer(ctx, req)
+}
+
+func (r *Responder) GenerateResponseAsync(ctx context.Context, req llm.InferRequest) (<-chan llm.StreamDelta, error) {
+	req, err := r.truncate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return r.underlying.GenerateResponseAsync(ctx, req)
+}
+
+// inputBudget returns the input tokens available to the request, or 0 if the context window isn't known.
+func (r *Responder) inputBudget(req llm.InferRequest) int {
+	window := r.config.ContextWindow
+	if window == 0 {
+		window = req.ModelConfig.ContextWindow
+	}
+	if window == 0 {
+		return 0
+	}
+	output := req.MessageOptions.MaxTokens
+	if output == 0 {
+		output = r.config.OutputReserve
+		if limit := req.ModelConfig.MaxOutputTokens; limit > 0 {
+			output = min(output, limit)
+		}
+	}
+	budget := window - output - int(float64(window)*r.config.Margin)
+	return max(budget, 1)
+}
+
+func (r *Responder) truncate(ctx context.Context, req llm.InferRequest) (llm.InferRequest, error) {
+	budget := r.inputBudget(req)
+	if budget == 0 || llm.CountTokens(req) <= budget {
+		return req, nil
+	}
+	msgs, err := r.config.Strategy.Truncate(ctx, req, budget)
+	if err != nil {
+		return req, err
+	}
+	req.Messages = msgs
+	if n := llm.CountTokens(req); n > budget {
+		return req, fmt.Errorf("%w: %d tokens after truncation, %d available", ErrTooLong, n, budget)
+	}
+	return req, nil
+}
+
+var _ llm.Responder = &Responder{}
@@ -0,0 +1,258 @@
+package truncate_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	mock_llm "github.com/stillmatic/gollum/packages/llm/internal/mocks"
+	"github.com/stillmatic/gollum/packages/llm/providers/truncate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+var (
+	cfg = llm.ModelConfig{ProviderType: llm.ProviderOpenAI, ModelName: "gpt-4o"}
+
+	system = llm.InferMessage{Role: "system", Content: "you are a helpful assistant"}
+	u1     = llm.InferMessage{Role: "user", Content: "my name is Alice, I live in Paris and I'm planning a trip to the Alps next week with my two children"}
+	a1     = llm.InferMessage{Role: "assistant", Content: "nice to meet you Alice"}
+	u2     = llm.InferMessage{Role: "user", Content: "what's the weather like?"}
+	a2     = llm.InferMessage{Role: "assistant", ToolCalls: []llm.ToolCall{{ID: "1", Name: "weather", Arguments: `{"city":"Paris"}`}}}
+	tool   = llm.InferMessage{Role: "tool", ToolCallID: "1", Content: "sunny"}
+	a3     = llm.InferMessage{Role: "assistant", Content: "it's sunny"}
+	u3     = llm.InferMessage{Role: "user", Content: "thanks!"}
+)
+
+func history() []llm.InferMessage {
+	return []llm.InferMessage{system, u1, a1, u2, a2, tool, a3, u3}
+}
+
+// windowFor returns a context window which fits exactly the given messages and the request's MaxTokens.
+func windowFor(req llm.InferRequest, messages ...llm.InferMessage) int {
+	req.Messages = messages
+	return llm.CountTokens(req) + req.MessageOptions.MaxTokens
+}
+
+func TestTruncateResponder(t *testing.T) {
+	req := llm.InferRequest{
+		Messages:       history(),
+		ModelConfig:    cfg,
+		MessageOptions: llm.MessageOptions{MaxTokens: 100},
+	}
+
+	t.Run("passes through requests which fit", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		underlying := mock_llm.NewMockResponder(ctrl)
+		r := truncate.NewTruncateResponder(underlying, truncate.Config{ContextWindow: 128_000})
+		underlying.EXPECT().Infer(gomock.Any(), req).Return(&llm.InferResponse{Content: "ok"}, nil)
+
+		res, err := r.Infer(context.Background(), req)
+		require.NoError(t, err)
+		assert.Equal(t, "ok", res.Content)
+	})
+
+	t.Run("passes through without a context window", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		underlying := mock_llm.NewMockResponder(ctrl)
+		r := truncate.NewTruncateResponder(underlying, truncate.Config{})
+		underlying.EXPECT().GenerateResponse(gomock.Any(), req).Return("ok", nil)
+
+		_, err := r.GenerateResponse(context.Background(), req)
+		require.NoError(t, err)
+	})
+
+	t.Run("uses the model config", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		underlying := mock_llm.NewMockResponder(ctrl)
+		r := truncate.NewTruncateResponder(underlying, truncate.Config{Margin: 0.0001})
+		req := req
+		req.ModelConfig.ContextWindow = windowFor(req, system, u3)
+		underlying.EXPECT().Infer(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, got llm.InferRequest) (*llm.InferResponse, error) {
+				assert.Equal(t, []llm.InferMessage{system, u3}, got.Messages)
+				return &llm.InferResponse{}, nil
+			})
+
+		_, err := r.Infer(context.Background(), req)
+		require.NoError(t, err)
+	})
+
+	t.Run("reserves a capped amount for output without MaxTokens", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		underlying := mock_llm.NewMockResponder(ctrl)
+		r := truncate.NewTruncateResponder(underlying, truncate.Config{Margin: 0.0001, OutputReserve: 100})
+		req := req
+		req.MessageOptions.MaxTokens = 0
+		// a reasoning model which could use most of its window for output
+		req.ModelConfig.MaxOutputTokens = 100_000
+		req.ModelConfig.ContextWindow = windowFor(req, history()...) + 100
+		underlying.EXPECT().Infer(gomock.Any(), req).Return(&llm.InferResponse{}, nil)
+
+		_, err := r.Infer(context.Background(), req)
+		require.NoError(t, err)
+	})
+
+	t.Run("fails when the latest turn doesn't fit", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		underlying := mock_llm.NewMockResponder(ctrl)
+		r := truncate.NewTruncateResponder(underlying, truncate.Config{ContextWindow: windowFor(req, system)})
+
+		_, err := r.GenerateResponseAsync(context.Background(), req)
+		assert.ErrorIs(t, err, truncate.ErrTooLong)
+	})
+}
+
+func TestStrategies(t *testing.T) {
+	req := llm.InferRequest{
+		Messages:       history(),
+		ModelConfig:    cfg,
+		MessageOptions: llm.MessageOptions{MaxTokens: 100},
+	}
+
+	tests := []struct {
+		name     string
+		strategy truncate.Strategy
+		window   int
+		want     []llm.InferMessage
+	}{
+		{
+			name:     "drop oldest keeps tool calls with their results",
+			strategy: truncate.DropOldest{},
+			window:   windowFor(req, system, u2, a2, tool, a3, u3),
+			want:     []llm.InferMessage{system, u2, a2, tool, a3, u3},
+		},
+		{
+			name:     "drop oldest drops several turns",
+			strategy: truncate.DropOldest{},
+			window:   windowFor(req, system, u2, a2, tool, a3, u3) - 1,
+			want:     []llm.InferMessage{system, u3},
+		},
+		{
+			name:     "keep first and last",
+			strategy: truncate.KeepFirstLast{First: 1, Last: 1},
+			window:   windowFor(req, system, u1, a1, u3),
+			want:     []llm.InferMessage{system, u1, a1, u3},
+		},
+		{
+			name:     "keep first and last keeps the latest turn",
+			strategy: truncate.KeepFirstLast{First: 1},
+			window:   windowFor(req, system, u1, a1, u3),
+			want:     []llm.InferMessage{system, u1, a1, u3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			underlying := mock_llm.NewMockResponder(ctrl)
+			r := truncate.NewTruncateResponder(underlying, truncate.Config{
+				Strategy:      tt.strategy,
+				ContextWindow: tt.window,
+				Margin:        0.0001,
+			})
+			underlying.EXPECT().Infer(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ context.Context, got llm.InferRequest) (*llm.InferResponse, error) {
+					assert.Equal(t, tt.want, got.Messages)
+					return &llm.InferResponse{}, nil
+				})
+
+			_, err := r.Infer(context.Background(), req)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestStrategiesKeepOrder(t *testing.T) {
+	note := llm.InferMessage{Role: "system", Content: "the user prefers short answers"}
+	req := llm.InferRequest{
+		Messages:    []llm.InferMessage{system, u1, a1, note, u2, a2, tool, a3, u3},
+		ModelConfig: cfg,
+	}
+
+	// system messages later in the conversation aren't moved to the front
+	msgs, err := truncate.DropOldest{}.Truncate(context.Background(), req, 128_000)
+	require.NoError(t, err)
+	assert.Equal(t, req.Messages, msgs)
+
+	// and are dropped with their turn
+	msgs, err = truncate.KeepFirstLast{Last: 2}.Truncate(context.Background(), req, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []llm.InferMessage{system, u2, a2, tool, a3, u3}, msgs)
+}
+
+func TestSummarize(t *testing.T) {
+	req := llm.InferRequest{
+		Messages:       history(),
+		ModelConfig:    cfg,
+		MessageOptions: llm.MessageOptions{MaxTokens: 100},
+	}
+	summary := llm.InferMessage{Role: "system", Content: "Summary of the earlier conversation:\nThe user is Alice, from Paris."}
+
+	ctrl := gomock.NewController(t)
+	underlying := mock_llm.NewMockResponder(ctrl)
+	summarizer := mock_llm.NewMockResponder(ctrl)
+	r := truncate.NewTruncateResponder(underlying, truncate.Config{
+		Strategy: truncate.Summarize{Model: summarizer, MaxTokens: 10},
+		// room for the latest turns and the summary, but not the first turn
+		ContextWindow: windowFor(req, system, u2, a2, tool, a3, u3) + 30,
+		Margin:        0.0001,
+	})
+
+	summarizer.EXPECT().GenerateResponse(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, got llm.InferRequest) (string, error) {
+			assert.Equal(t, cfg, got.ModelConfig)
+			assert.Equal(t, 10, got.MessageOptions.MaxTokens)
+			require.Len(t, got.Messages, 2)
+			assert.Equal(t, "user: my name is Alice, I live in Paris and I'm planning a trip to the Alps next week with my two children\nassistant: nice to meet you Alice\n", got.Messages[1].Content)
+			return " The user is Alice, from Paris.\n", nil
+		})
+	underlying.EXPECT().Infer(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, got llm.InferRequest) (*llm.InferResponse, error) {
+			assert.Equal(t, []llm.InferMessage{system, summary, u2, a2, tool, a3, u3}, got.Messages)
+			return &llm.InferResponse{}, nil
+		})
+
+	_, err := r.Infer(context.Background(), req)
+	require.NoError(t, err)
+}
+
+func TestSummarizeWithoutSystemPrompt(t *testing.T) {
+	noSystem := cfg
+	noSystem.Capabilities = &llm.Capabilities{SystemPrompt: false}
+	req := llm.InferRequest{
+		Messages:       []llm.InferMessage{u1, a1, u2, a2, tool, a3, u3},
+		ModelConfig:    noSystem,
+		MessageOptions: llm.MessageOptions{MaxTokens: 100},
+	}
+	summary := llm.InferMessage{Role: "user", Content: "Summary of the earlier conversation:\nThe user is Alice, from Paris."}
+
+	ctrl := gomock.NewController(t)
+	underlying := mock_llm.NewMockResponder(ctrl)
+	summarizer := mock_llm.NewMockResponder(ctrl)
+	r := truncate.NewTruncateResponder(underlying, truncate.Config{
+		Strategy:      truncate.Summarize{Model: summarizer, MaxTokens: 10},
+		ContextWindow: windowFor(req, u2, a2, tool, a3, u3) + 30,
+		Margin:        0.0001,
+	})
+
+	// the prompt and the summary are sent as user messages
+	summarizer.EXPECT().GenerateResponse(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, got llm.InferRequest) (string, error) {
+			require.Len(t, got.Messages, 1)
+			assert.Equal(t, "user", got.Messages[0].Role)
+			assert.True(t, strings.HasPrefix(got.Messages[0].Content, truncate.DefaultSummaryPrompt))
+			assert.NoError(t, llm.ValidateRequest(got, false))
+			return "The user is Alice, from Paris.", nil
+		})
+	underlying.EXPECT().Infer(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, got llm.InferRequest) (*llm.InferResponse, error) {
+			assert.Equal(t, []llm.InferMessage{summary, u2, a2, tool, a3, u3}, got.Messages)
+			assert.NoError(t, llm.ValidateRequest(got, false))
+			return &llm.InferResponse{}, nil
+		})
+
+	_, err := r.Infer(context.Background(), req)
+	require.NoError(t, err)
+}
@@ -0,0 +1,175 @@
+package vertex
+
+import (
+	"cloud.google.com/go/vertexai/genai"
+	"github.com/pkg/errors"
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/providers/internal/genaischema"
+)
+
+// toGenaiSchema converts anything that marshals to JSON schema into a genai.Schema.
+func toGenaiSchema(v any) (*genai.Schema, error) {
+	s, err := genaischema.Parse(v)
+	if err != nil {
+		return nil, err
+	}
+	return toGenai(s), nil
+}
+
+func toGenai(s *genaischema.Schema) *genai.Schema {
+	if s == nil {
+		return nil
+	}
+	gs := &genai.Schema{
+		Type:        genaiType(s.Type),
+		Nullable:    s.Nullable,
+		Format:      s.Format,
+		Description: s.Description,
+		Enum:        s.Enum,
+		Required:    s.Required,
+		Items:       toGenai(s.Items),
+	}
+	if len(s.Properties) > 0 {
+		gs.Properties = make(map[string]*genai.Schema, len(s.Properties))
+		for k, v := range s.Properties {
+			gs.Properties[k] = toGenai(v)
+		}
+	}
+	return gs
+}
+
+func genaiType(t string) genai.Type {
+	switch t {
+	case "object":
+		return genai.TypeObject
+	case "array":
+		return genai.TypeArray
+	case "string":
+		return genai.TypeString
+	case "integer":
+		return genai.TypeInteger
+	case "number":
+		return genai.TypeNumber
+	case "boolean":
+		return genai.TypeBoolean
+	default:
+		return genai.TypeUnspecified
+	}
+}
+
+// configureModel applies the request's options, tools and response format to the model.
+func configureModel(model *genai.GenerativeModel, req llm.InferRequest) error {
+	if err := applyOptions(model, req); err != nil {
+		return err
+	}
+	if err := applyTools(model, req); err != nil {
+		return err
+	}
+	return applyResponseFormat(model, req)
+}
+
+// applyOptions sets the optional sampling parameters on the model.
+func applyOptions(model *genai.GenerativeModel, req llm.InferRequest) error {
+	opts := req.MessageOptions
+	err := opts.Check(req.ModelConfig.ModelName, llm.OptionTopP, llm.OptionTopK, llm.OptionStopSequences, llm.OptionCandidates,
+		llm.OptionPresencePenalty, llm.OptionFrequencyPenalty)
+	if err != nil {
+		return err
+	}
+	if opts.TopP != 0 {
+		model.SetTopP(opts.TopP)
+	}
+	if opts.TopK != 0 {
+		model.SetTopK(int32(opts.TopK))
+	}
+	model.StopSequences = opts.StopSequences
+	if opts.Candidates > 1 {
+		model.SetCandidateCount(int32(opts.Candidates))
+	}
+	if opts.PresencePenalty != 0 {
+		model.PresencePenalty = &opts.PresencePenalty
+	}
+	if opts.FrequencyPenalty != 0 {
+		model.FrequencyPenalty = &opts.FrequencyPenalty
+	}
+	return nil
+}
+
+// applyResponseFormat asks the model for JSON matching the request's schema.
+func applyResponseFormat(model *genai.GenerativeModel, req llm.InferRequest) error {
+	if req.ResponseFormat == nil {
+		return nil
+	}
+	schema, err := toGenaiSchema(req.ResponseFormat.Schema)
+	if err != nil {
+		return errors.Wrapf(err, "invalid schema for response format %s", req.ResponseFormat.Name)
+	}
+	model.ResponseMIMEType = "application/json"
+	model.ResponseSchema = schema
+	return nil
+}
+
+// applyTools sets the tool declarations and calling config on the model.
+func applyTools(model *genai.GenerativeModel, req llm.InferRequest) error {
+	if len(req.Tools) == 0 {
+		return nil
+	}
+	decls, err := genaischema.Declarations(req.Tools)
+	if err != nil {
+		return err
+	}
+	fds := make([]*genai.FunctionDeclaration, len(decls))
+	for i, d := range decls {
+		fds[i] = &genai.FunctionDeclaration{
+			Name:        d.Name,
+			Description: d.Description,
+			Parameters:  toGenai(d.Parameters),
+		}
+	}
+	model.Tools = []*genai.Tool{{FunctionDeclarations: fds}}
+
+	if req.ToolChoice != nil {
+		mode, allowed := genaischema.ToolChoice(*req.ToolChoice)
+		fcc := &genai.FunctionCallingConfig{AllowedFunctionNames: allowed}
+		switch mode {
+		case genaischema.CallingModeNone:
+			fcc.Mode = genai.FunctionCallingNone
+		case genaischema.CallingModeAny:
+			fcc.Mode = genai.FunctionCallingAny
+		default:
+			fcc.Mode = genai.FunctionCallingAuto
+		}
+		model.ToolConfig = &genai.ToolConfig{FunctionCallingConfig: fcc}
+	}
+	return nil
+}
+
+func toolCallToPart(tc llm.ToolCall) (genai.Part, error) {
+	args, err := genaischema.ToolCallArgs(tc)
+	if err != nil {
+		return nil, err
+	}
+	return genai.FunctionCall{Name: tc.Name, Args: args}, nil
+}
+
+func toolResultToPart(m llm.InferMessage, names map[string]string) (genai.Part, error) {
+	name, response, err := genaischema.ToolResult(m, names)
+	if err != nil {
+		return nil, err
+	}
+	return genai.FunctionResponse{Name: name, Response: response}, nil
+}
+
+// toolCallsFromCandidate extracts function calls from a candidate.
+func toolCallsFromCandidate(c *genai.Candidate) ([]llm.ToolCall, error) {
+	if c == nil || c.Content == nil {
+		return nil, nil
+	}
+	var fcs []genaischema.FunctionCall
+	for _, part := range c.Content.Parts {
+		if fc, ok := part.(genai.FunctionCall); ok {
+			fcs = append(fcs, genaischema.FunctionCall{Name: fc.Name, Args: fc.Args})
+		}
+	}
+	return genaischema.ToolCalls(fcs)
+}
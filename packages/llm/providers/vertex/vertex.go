@@ -5,19 +5,32 @@ package vertex
 import (
 	"cloud.google.com/go/vertexai/genai"
 	"context"
-	"fmt"
 	"github.com/pkg/errors"
 	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/internal/apierr"
+	"github.com/stillmatic/gollum/packages/llm/providers/internal/genaischema"
+	"github.com/stillmatic/gollum/packages/llm/providers/transport"
 	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
 	"log"
+	"mime"
+	"net/http"
+	"path"
 )
 
 type VertexAIProvider struct {
 	client *genai.Client
 }
 
-func NewVertexAIProvider(ctx context.Context, projectID, location string) (*VertexAIProvider, error) {
-	client, err := genai.NewClient(ctx, projectID, location)
+// NewVertexAIProvider connects over gRPC, or over REST when transport options are given. A client given with
+// transport.WithHTTPClient must authenticate requests itself, as with option.WithHTTPClient.
+func NewVertexAIProvider(ctx context.Context, projectID, location string, opts ...transport.Option) (*VertexAIProvider, error) {
+	clientOpts, err := clientOptions(ctx, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create Vertex AI client")
+	}
+	client, err := genai.NewClient(ctx, projectID, location, clientOpts...)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create Vertex AI client")
 	}
@@ -39,6 +52,32 @@ func NewVertexAIProvider(ctx context.Context, projectID, location string) (*Vert
 	}, nil
 }
 
+// clientOptions switches to REST, since the transport options only apply to HTTP, authenticating with the
+// default credentials unless a client was given.
+func clientOptions(ctx context.Context, opts []transport.Option) ([]option.ClientOption, error) {
+	if len(opts) == 0 {
+		return nil, nil
+	}
+	settings := transport.Apply(opts...)
+	clientOpts := []option.ClientOption{genai.WithREST()}
+	if settings.BaseURL != "" {
+		clientOpts = append(clientOpts, option.WithEndpoint(settings.BaseURL))
+	}
+	client := settings.Client()
+	if settings.HTTPClient == nil {
+		base := client.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		rt, err := htransport.NewTransport(ctx, base, option.WithScopes("https://www.googleapis.com/auth/cloud-platform"))
+		if err != nil {
+			return nil, err
+		}
+		client.Transport = rt
+	}
+	return append(clientOpts, option.WithHTTPClient(client)), nil
+}
+
 func (p *VertexAIProvider) getModel(req llm.InferRequest) *genai.GenerativeModel {
 	// this does NOT validate if the model name is valid, that is done at inference time.
 	model := p.client.GenerativeModel(req.ModelConfig.ModelName)
@@ -49,46 +88,130 @@ func (p *VertexAIProvider) getModel(req llm.InferRequest) *genai.GenerativeModel
 }
 
 func (p *VertexAIProvider) GenerateResponse(ctx context.Context, req llm.InferRequest) (string, error) {
+	res, err := p.Infer(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	return res.Content, nil
+}
+
+func (p *VertexAIProvider) Infer(ctx context.Context, req llm.InferRequest) (*llm.InferResponse, error) {
+	if err := llm.ValidateRequest(req, false); err != nil {
+		return nil, err
+	}
 	if len(req.Messages) > 1 {
-		return p.generateResponseMultiTurn(ctx, req)
+		return p.inferMultiTurn(ctx, req)
 	}
-	return p.generateResponseSingleTurn(ctx, req)
+	return p.inferSingleTurn(ctx, req)
 }
 
-func (p *VertexAIProvider) generateResponseSingleTurn(ctx context.Context, req llm.InferRequest) (string, error) {
+func (p *VertexAIProvider) inferSingleTurn(ctx context.Context, req llm.InferRequest) (*llm.InferResponse, error) {
 	model := p.getModel(req)
-	parts := messageToParts(req.Messages[0])
+	if err := configureModel(model, req); err != nil {
+		return nil, err
+	}
+	parts, err := messageToParts(req.Messages[0], req.ModelConfig.ModelName)
+	if err != nil {
+		return nil, err
+	}
 
 	resp, err := model.GenerateContent(ctx, parts...)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to generate content")
+		return nil, errors.Wrap(classifyError(err), "failed to generate content")
 	}
 
-	return flattenResponse(resp), nil
+	return responseToInferResponse(req, resp)
 }
 
-func (p *VertexAIProvider) generateResponseMultiTurn(ctx context.Context, req llm.InferRequest) (string, error) {
+func (p *VertexAIProvider) inferMultiTurn(ctx context.Context, req llm.InferRequest) (*llm.InferResponse, error) {
 	model := p.getModel(req)
+	if err := configureModel(model, req); err != nil {
+		return nil, err
+	}
+	cs, lastParts, err := startChat(model, req)
+	if err != nil {
+		return nil, err
+	}
 
-	msgs, sysInstr := multiTurnMessageToParts(req.Messages[:len(req.Messages)-1])
-	if sysInstr != nil {
-		model.SystemInstruction = sysInstr
+	// Send the last message
+	resp, err := cs.SendMessage(ctx, lastParts...)
+	if err != nil {
+		return nil, errors.Wrap(classifyError(err), "failed to send message in chat")
 	}
 
-	cs := model.StartChat()
-	cs.History = msgs
-	mostRecentMessage := req.Messages[len(req.Messages)-1]
+	return responseToInferResponse(req, resp)
+}
 
-	// Send the last message
-	resp, err := cs.SendMessage(ctx, genai.Text(mostRecentMessage.Content))
+func responseToInferResponse(req llm.InferRequest, resp *genai.GenerateContentResponse) (*llm.InferResponse, error) {
+	candidates := make([]llm.Candidate, len(resp.Candidates))
+	for i, c := range resp.Candidates {
+		toolCalls, err := toolCallsFromCandidate(c)
+		if err != nil {
+			return nil, err
+		}
+		candidates[i] = llm.Candidate{
+			Content:      flattenCandidate(c),
+			ToolCalls:    toolCalls,
+			FinishReason: finishReasonFromGenai(c.FinishReason),
+		}
+		if len(toolCalls) > 0 {
+			candidates[i].FinishReason = llm.FinishReasonToolCalls
+		}
+	}
+	res := &llm.InferResponse{
+		// the response doesn't say which model version answered
+		Model: req.ModelConfig.ModelName,
+	}
+	res.SetCandidates(candidates)
+	if resp.UsageMetadata != nil {
+		res.Usage = llm.Usage{
+			InputTokens:  int(resp.UsageMetadata.PromptTokenCount),
+			OutputTokens: int(resp.UsageMetadata.CandidatesTokenCount),
+		}
+	}
+	res.Cost = llm.Cost(req.ModelConfig, res.Usage)
+	return res, nil
+}
+
+func finishReasonFromGenai(fr genai.FinishReason) llm.FinishReason {
+	switch fr {
+	case genai.FinishReasonStop:
+		return llm.FinishReasonStop
+	case genai.FinishReasonMaxTokens:
+		return llm.FinishReasonLength
+	case genai.FinishReasonSafety, genai.FinishReasonRecitation, genai.FinishReasonBlocklist,
+		genai.FinishReasonProhibitedContent, genai.FinishReasonSpii:
+		return llm.FinishReasonContentFilter
+	default:
+		return llm.FinishReasonOther
+	}
+}
+
+// startChat builds a chat session from all but the last turn of the request, and returns the parts for the last turn.
+func startChat(model *genai.GenerativeModel, req llm.InferRequest) (*genai.ChatSession, []genai.Part, error) {
+	toolNames := genaischema.ToolCallNames(req.Messages)
+	history, lastTurn := splitLastTurn(req.Messages)
+	msgs, sysInstr, err := multiTurnMessageToParts(history, toolNames, req.ModelConfig.ModelName)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid messages")
+	}
+	if sysInstr != nil {
+		model.SystemInstruction = sysInstr
+	}
+	lastParts, err := lastTurnToParts(lastTurn, toolNames, req.ModelConfig.ModelName)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to send message in chat")
+		return nil, nil, errors.Wrap(err, "invalid messages")
 	}
 
-	return flattenResponse(resp), nil
+	cs := model.StartChat()
+	cs.History = msgs
+	return cs, lastParts, nil
 }
 
 func (p *VertexAIProvider) GenerateResponseAsync(ctx context.Context, req llm.InferRequest) (<-chan llm.StreamDelta, error) {
+	if err := llm.ValidateRequest(req, true); err != nil {
+		return nil, err
+	}
 	if len(req.Messages) > 1 {
 		return p.generateResponseAsyncMultiTurn(ctx, req)
 	}
@@ -102,30 +225,17 @@ func (p *VertexAIProvider) generateResponseAsyncSingleTurn(ctx context.Context,
 		defer close(outChan)
 
 		model := p.getModel(req)
-		parts := messageToParts(req.Messages[0])
-
-		iter := model.GenerateContentStream(ctx, parts...)
-
-		for {
-			resp, err := iter.Next()
-			if errors.Is(err, iterator.Done) {
-				outChan <- llm.StreamDelta{EOF: true}
-				break
-			}
-			if err != nil {
-				log.Printf("Error from Vertex AI stream: %v", err)
-				return
-			}
-
-			content := flattenResponse(resp)
-			if content != "" {
-				select {
-				case <-ctx.Done():
-					return
-				case outChan <- llm.StreamDelta{Text: content}:
-				}
-			}
+		if err := configureModel(model, req); err != nil {
+			sendDelta(ctx, outChan, llm.StreamDelta{Err: err})
+			return
 		}
+		parts, err := messageToParts(req.Messages[0], req.ModelConfig.ModelName)
+		if err != nil {
+			sendDelta(ctx, outChan, llm.StreamDelta{Err: err})
+			return
+		}
+
+		streamResponses(ctx, req, model.GenerateContentStream(ctx, parts...), outChan)
 	}()
 
 	return outChan, nil
@@ -138,85 +248,221 @@ func (p *VertexAIProvider) generateResponseAsyncMultiTurn(ctx context.Context, r
 		defer close(outChan)
 
 		model := p.getModel(req)
-		cs := model.StartChat()
-
-		// Add previous messages to chat history
-		for _, msg := range req.Messages[:len(req.Messages)-1] {
-			parts := messageToParts(msg)
-			cs.History = append(cs.History, &genai.Content{
-				Parts: parts,
-				Role:  msg.Role,
-			})
-		}
-
-		// Send the last message
-		lastMsg := req.Messages[len(req.Messages)-1]
-		iter := cs.SendMessageStream(ctx, messageToParts(lastMsg)...)
-
-		for {
-			resp, err := iter.Next()
-			if errors.Is(err, iterator.Done) {
-				outChan <- llm.StreamDelta{EOF: true}
-				break
-			}
-			if err != nil {
-				log.Printf("Error from Vertex AI stream: %v", err)
-				return
-			}
-
-			content := flattenResponse(resp)
-			if content != "" {
-				select {
-				case <-ctx.Done():
-					return
-				case outChan <- llm.StreamDelta{Text: content}:
-				}
-			}
+		if err := configureModel(model, req); err != nil {
+			sendDelta(ctx, outChan, llm.StreamDelta{Err: err})
+			return
+		}
+		cs, lastParts, err := startChat(model, req)
+		if err != nil {
+			sendDelta(ctx, outChan, llm.StreamDelta{Err: err})
+			return
 		}
+
+		streamResponses(ctx, req, cs.SendMessageStream(ctx, lastParts...), outChan)
 	}()
 
 	return outChan, nil
 }
 
-func messageToParts(message llm.InferMessage) []genai.Part {
-	parts := []genai.Part{genai.Text(message.Content)}
-	if message.Image != nil && len(message.Image) > 0 {
-		parts = append(parts, genai.ImageData("png", message.Image))
+// streamResponses forwards the text of each response, then sends a final delta built from the merged response.
+func streamResponses(ctx context.Context, req llm.InferRequest, iter *genai.GenerateContentResponseIterator, outChan chan<- llm.StreamDelta) {
+	// the merged response doesn't include usage, which is reported with the last chunk
+	var usage *genai.UsageMetadata
+	if req.MessageOptions.Candidates > 1 {
+		sendDelta(ctx, outChan, llm.StreamDelta{Err: llm.ErrStreamingCandidates})
+		return
+	}
+	for {
+		resp, err := iter.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			log.Printf("Error from Vertex AI stream: %v", err)
+			sendDelta(ctx, outChan, llm.StreamDelta{Err: errors.Wrap(classifyError(err), "vertex stream error")})
+			return
+		}
+		if resp.UsageMetadata != nil {
+			usage = resp.UsageMetadata
+		}
+
+		content := flattenResponse(resp)
+		if content != "" && !sendDelta(ctx, outChan, llm.StreamDelta{Text: content}) {
+			return
+		}
+	}
+
+	merged := iter.MergedResponse()
+	if merged == nil {
+		merged = &genai.GenerateContentResponse{}
+	}
+	merged.UsageMetadata = usage
+	res, err := responseToInferResponse(req, merged)
+	if err != nil {
+		sendDelta(ctx, outChan, llm.StreamDelta{Err: err})
+		return
+	}
+	sendDelta(ctx, outChan, llm.StreamDelta{
+		EOF:          true,
+		ToolCalls:    res.ToolCalls,
+		FinishReason: res.FinishReason,
+		Model:        res.Model,
+		Usage:        res.Usage,
+		Cost:         res.Cost,
+	})
+}
+
+// classifyError maps blocked prompts and responses to llm.ErrContentFiltered, and API errors by their status.
+func classifyError(err error) error {
+	var blocked *genai.BlockedError
+	if errors.As(err, &blocked) {
+		return &llm.APIError{Kind: llm.ErrContentFiltered, Provider: llm.ProviderVertex, Err: err}
+	}
+	return apierr.Classify(llm.ProviderVertex, err)
+}
+
+// sendDelta sends the delta unless the context is done first, returning whether it was sent.
+func sendDelta(ctx context.Context, ch chan<- llm.StreamDelta, delta llm.StreamDelta) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case ch <- delta:
+		return true
+	}
+}
+
+// messageToParts converts the content of a message to genai parts.
+func messageToParts(message llm.InferMessage, model string) ([]genai.Part, error) {
+	parts := make([]genai.Part, 0)
+	for _, part := range message.ContentParts() {
+		switch part.Type {
+		case llm.PartTypeText:
+			parts = append(parts, genai.Text(part.Text))
+		case llm.PartTypeImage, llm.PartTypeDocument, llm.PartTypeAudio:
+			parts = append(parts, genai.Blob{MIMEType: part.MIMEType, Data: part.Data})
+		case llm.PartTypeImageURL:
+			// vertex fetches gs:// and https URLs itself, but needs to be told the type
+			mimeType := part.MIMEType
+			if mimeType == "" {
+				mimeType = mime.TypeByExtension(path.Ext(part.URL))
+			}
+			if mimeType == "" {
+				return nil, errors.Errorf("unknown image type for %s, set the part's MIMEType", part.URL)
+			}
+			parts = append(parts, genai.FileData{MIMEType: mimeType, FileURI: part.URL})
+		default:
+			return nil, &llm.UnsupportedPartError{Type: part.Type, Model: model}
+		}
+	}
+	if len(parts) == 0 && len(message.ToolCalls) == 0 {
+		parts = append(parts, genai.Text(""))
 	}
-	return parts
+	return parts, nil
 }
 
-func multiTurnMessageToParts(messages []llm.InferMessage) ([]*genai.Content, *genai.Content) {
+func multiTurnMessageToParts(messages []llm.InferMessage, toolNames map[string]string, model string) ([]*genai.Content, *genai.Content, error) {
 	sysInstructionParts := make([]genai.Part, 0)
 	hist := make([]*genai.Content, 0, len(messages))
 	for _, message := range messages {
-		parts := []genai.Part{genai.Text(message.Content)}
-		if message.Image != nil && len(message.Image) > 0 {
-			parts = append(parts, genai.ImageData("png", message.Image))
+		if message.Role == "tool" {
+			part, err := toolResultToPart(message, toolNames)
+			if err != nil {
+				return nil, nil, err
+			}
+			// all results for a turn go in a single content
+			if len(hist) > 0 && isFunctionResponseContent(hist[len(hist)-1]) {
+				hist[len(hist)-1].Parts = append(hist[len(hist)-1].Parts, part)
+			} else {
+				hist = append(hist, &genai.Content{Parts: []genai.Part{part}, Role: "user"})
+			}
+			continue
+		}
+		parts, err := messageToParts(message, model)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, tc := range message.ToolCalls {
+			part, err := toolCallToPart(tc)
+			if err != nil {
+				return nil, nil, err
+			}
+			parts = append(parts, part)
 		}
 		if message.Role == "system" {
 			sysInstructionParts = append(sysInstructionParts, parts...)
 			continue
 		}
+		role := message.Role
+		// vertex calls the assistant "model"
+		if role == "assistant" {
+			role = "model"
+		}
 		hist = append(hist, &genai.Content{
 			Parts: parts,
-			Role:  message.Role,
+			Role:  role,
 		})
 	}
 	if len(sysInstructionParts) > 0 {
 		return hist, &genai.Content{
 			Parts: sysInstructionParts,
+		}, nil
+	}
+
+	return hist, nil, nil
+}
+
+func isFunctionResponseContent(c *genai.Content) bool {
+	for _, part := range c.Parts {
+		if _, ok := part.(genai.FunctionResponse); !ok {
+			return false
 		}
 	}
+	return len(c.Parts) > 0
+}
 
-	return hist, nil
+// splitLastTurn splits the messages into the chat history and the final turn to send.
+// Consecutive tool results at the end of the conversation make up a single turn.
+func splitLastTurn(messages []llm.InferMessage) ([]llm.InferMessage, []llm.InferMessage) {
+	i := len(messages) - 1
+	for i > 0 && messages[i].Role == "tool" && messages[i-1].Role == "tool" {
+		i--
+	}
+	return messages[:i], messages[i:]
+}
+
+// lastTurnToParts converts the final turn into the parts to send with the chat session.
+func lastTurnToParts(lastTurn []llm.InferMessage, toolNames map[string]string, model string) ([]genai.Part, error) {
+	if lastTurn[0].Role != "tool" {
+		return messageToParts(lastTurn[0], model)
+	}
+	parts := make([]genai.Part, 0, len(lastTurn))
+	for _, m := range lastTurn {
+		part, err := toolResultToPart(m, toolNames)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
 }
 
 func flattenResponse(resp *genai.GenerateContentResponse) string {
+	if len(resp.Candidates) == 0 {
+		return ""
+	}
+	return flattenCandidate(resp.Candidates[0])
+}
+
+// flattenCandidate joins the text parts of a candidate.
+func flattenCandidate(c *genai.Candidate) string {
+	if c == nil || c.Content == nil {
+		return ""
+	}
 	var result string
-	for _, cand := range resp.Candidates {
-		for _, part := range cand.Content.Parts {
-			result += fmt.Sprintf("%v", part)
+	for _, part := range c.Content.Parts {
+		// function calls are returned separately, see toolCallsFromCandidate
+		if txt, ok := part.(genai.Text); ok {
+			result += string(txt)
 		}
 	}
 	return result
@@ -6,16 +6,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/internal/apierr"
+	"github.com/stillmatic/gollum/packages/llm/providers/transport"
 	"io"
 	"net/http"
 )
 
-const (
-	apiURL = "https://api.voyageai.com/v1/embeddings"
-)
+const defaultBaseURL = "https://api.voyageai.com/v1"
 
 type VoyageAIEmbedder struct {
-	APIKey string
+	APIKey  string
+	baseURL string
+	client  *http.Client
 }
 
 type voyageAIRequest struct {
@@ -36,8 +38,9 @@ type voyageAIResponse struct {
 	} `json:"usage"`
 }
 
-func NewVoyageAIEmbedder(apiKey string) *VoyageAIEmbedder {
-	return &VoyageAIEmbedder{APIKey: apiKey}
+func NewVoyageAIEmbedder(apiKey string, opts ...transport.Option) *VoyageAIEmbedder {
+	settings := transport.Apply(opts...)
+	return &VoyageAIEmbedder{APIKey: apiKey, baseURL: settings.BaseURLOr(defaultBaseURL), client: settings.Client()}
 }
 
 func (e *VoyageAIEmbedder) GenerateEmbedding(ctx context.Context, req llm.EmbedRequest) (*llm.EmbeddingResponse, error) {
@@ -59,7 +62,12 @@ func (e *VoyageAIEmbedder) GenerateEmbedding(ctx context.Context, req llm.EmbedR
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(jsonData))
+	baseURL := e.baseURL
+	// the zero value is usable too
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", baseURL+"/embeddings", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -67,7 +75,11 @@ func (e *VoyageAIEmbedder) GenerateEmbedding(ctx context.Context, req llm.EmbedR
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("Authorization", "Bearer "+e.APIKey)
 
-	client := &http.Client{}
+	client := e.client
+	// the zero value is usable too
+	if client == nil {
+		client = http.DefaultClient
+	}
 	resp, err := client.Do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
@@ -80,7 +92,7 @@ func (e *VoyageAIEmbedder) GenerateEmbedding(ctx context.Context, req llm.EmbedR
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed with status code %d: %s", resp.StatusCode, string(body))
+		return nil, apierr.Classify(llm.ProviderVoyage, &apierr.HTTPError{StatusCode: resp.StatusCode, Body: string(body), Header: resp.Header})
 	}
 
 	var voyageResp voyageAIResponse
@@ -0,0 +1,38 @@
+package voyage_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/providers/transport"
+	"github.com/stillmatic/gollum/packages/llm/providers/voyage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateEmbedding(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/embeddings", r.URL.Path)
+		assert.Equal(t, "Bearer fake-key", r.Header.Get("Authorization"))
+		assert.Equal(t, "team-a", r.Header.Get("X-Team"))
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "voyage-3", body["model"])
+		fmt.Fprint(w, `{"object": "list", "data": [{"object": "embedding", "embedding": [0.5, 1], "index": 0}], "model": "voyage-3"}`)
+	}))
+	defer srv.Close()
+
+	e := voyage.NewVoyageAIEmbedder("fake-key", transport.WithBaseURL(srv.URL+"/v1"), transport.WithHeader("X-Team", "team-a"))
+	res, err := e.GenerateEmbedding(context.Background(), llm.EmbedRequest{
+		Input:       []string{"hello"},
+		ModelConfig: llm.ModelConfig{ProviderType: llm.ProviderVoyage, ModelName: "voyage-3"},
+	})
+	require.NoError(t, err)
+	require.Len(t, res.Data, 1)
+	assert.Equal(t, []float32{0.5, 1}, res.Data[0].Values)
+}
@@ -0,0 +1,106 @@
+// Package sqlitestore persists conversations in a SQLite database.
+package sqlitestore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteStore implements llm.ConversationStore, storing each conversation as a JSON document.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := initDB(db); err != nil {
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+func (s *SQLiteStore) Save(ctx context.Context, c *llm.Conversation) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		"INSERT OR REPLACE INTO conversations (id, parent_id, conversation, updated_at) VALUES (?, ?, ?, ?)",
+		c.ID(), c.ParentID(), b, c.UpdatedAt().UnixNano())
+	return err
+}
+
+func (s *SQLiteStore) Load(ctx context.Context, id string) (*llm.Conversation, error) {
+	var b []byte
+	err := s.db.QueryRowContext(ctx, "SELECT conversation FROM conversations WHERE id = ?", id).Scan(&b)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", llm.ErrConversationNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &llm.Conversation{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *SQLiteStore) Delete(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM conversations WHERE id = ?", id)
+	return err
+}
+
+func (s *SQLiteStore) List(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id FROM conversations ORDER BY updated_at DESC, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+func initDB(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS conversations (
+			id TEXT PRIMARY KEY,
+			parent_id TEXT,
+			conversation BLOB,
+			updated_at INTEGER
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Set to WAL mode for better performance
+	_, err = db.Exec("PRAGMA journal_mode=WAL;")
+	return err
+}
+
+// Ensure SQLiteStore implements the ConversationStore interface
+var _ llm.ConversationStore = (*SQLiteStore)(nil)
@@ -0,0 +1,47 @@
+package sqlitestore_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/sqlitestore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "conversations.db")
+	store, err := sqlitestore.NewSQLiteStore(path)
+	require.NoError(t, err)
+
+	c := llm.NewConversation(llm.ModelConfig{ProviderType: llm.ProviderAnthropic, ModelName: "claude-3-5-haiku-latest"},
+		llm.MessageOptions{MaxTokens: 100}, "be brief")
+	c.Append(llm.InferMessage{Role: "user", Content: "hi"}, llm.InferMessage{Role: "assistant", Content: "hello"})
+	require.NoError(t, store.Save(ctx, c))
+
+	// saving again replaces the conversation
+	c.Append(llm.InferMessage{Role: "user", Content: "bye"})
+	require.NoError(t, store.Save(ctx, c))
+	fork := c.Fork()
+	require.NoError(t, store.Save(ctx, fork))
+	require.NoError(t, store.Close())
+
+	store, err = sqlitestore.NewSQLiteStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	got, err := store.Load(ctx, c.ID())
+	require.NoError(t, err)
+	assert.Equal(t, c.Request(), got.Request())
+
+	ids, err := store.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{fork.ID(), c.ID()}, ids)
+
+	require.NoError(t, store.Delete(ctx, c.ID()))
+	_, err = store.Load(ctx, c.ID())
+	assert.ErrorIs(t, err, llm.ErrConversationNotFound)
+}
@@ -0,0 +1,137 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/invopop/jsonschema"
+	"github.com/pkg/errors"
+	val "github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// ResponseFormat asks the model to respond with JSON matching a schema, using each provider's native mechanism:
+// json_schema response formats for OpenAI, a response schema for Gemini and a forced tool call for Anthropic.
+type ResponseFormat struct {
+	// Name of the schema, letters, digits, underscores and dashes only.
+	Name        string
+	Description string
+	// Schema is a JSON schema object, like Tool.Parameters.
+	Schema any
+	// Strict makes OpenAI guarantee the output matches the schema. It requires every property to be required
+	// and no additional properties, NewResponseFormat builds schemas that fit.
+	Strict bool
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// NewResponseFormat builds a strict ResponseFormat whose schema is the JSON schema of T, named after T.
+// T should be a struct, tagged the same way as for jsonparser.NewJSONParserGeneric. Strict mode needs every
+// property to be required, so optional (omitempty) fields are required but nullable, and the model answers
+// null when it has no value for them.
+func NewResponseFormat[T any]() *ResponseFormat {
+	var tArr [0]T
+	name := invalidNameChars.ReplaceAllString(reflect.TypeOf(tArr).Elem().Name(), "_")
+	if name == "" {
+		name = "response"
+	}
+	schema := schemaFor[T]()
+	requireAll(schema)
+	return &ResponseFormat{
+		Name:   name,
+		Schema: schema,
+		Strict: true,
+	}
+}
+
+// requireAll makes every property of the schema's objects required, optional properties become nullable.
+func requireAll(s *jsonschema.Schema) {
+	if s == nil {
+		return
+	}
+	requireAll(s.Items)
+	if s.Properties == nil {
+		return
+	}
+	for pair := s.Properties.Oldest(); pair != nil; pair = pair.Next() {
+		requireAll(pair.Value)
+		if !slices.Contains(s.Required, pair.Key) {
+			s.Required = append(s.Required, pair.Key)
+			nullable(pair.Value)
+		}
+	}
+}
+
+// nullable lets a schema also match null. Schemas without a type already match anything.
+func nullable(s *jsonschema.Schema) {
+	if len(s.Enum) > 0 {
+		s.Enum = append(s.Enum, nil)
+	}
+	switch {
+	case s.Type != "":
+		// jsonschema.Schema.Type is a single type, so the list is set through Extras
+		if s.Extras == nil {
+			s.Extras = make(map[string]any)
+		}
+		s.Extras["type"] = []string{s.Type, "null"}
+		s.Type = ""
+	case len(s.AnyOf) > 0:
+		s.AnyOf = append(s.AnyOf, &jsonschema.Schema{Type: "null"})
+	}
+}
+
+// InferStructured asks for a response as JSON matching T, then validates the response against the schema and
+// decodes it. If req has no ResponseFormat, NewResponseFormat[T] is used.
+func InferStructured[T any](ctx context.Context, r Responder, req InferRequest) (T, *InferResponse, error) {
+	var t T
+	if req.ResponseFormat == nil {
+		req.ResponseFormat = NewResponseFormat[T]()
+	}
+	res, err := r.Infer(ctx, req)
+	if err != nil {
+		return t, nil, err
+	}
+	t, err = DecodeStructured[T](req.ResponseFormat, res.Content)
+	return t, res, err
+}
+
+// DecodeStructured validates content against the format's schema and decodes it into T.
+func DecodeStructured[T any](format *ResponseFormat, content string) (T, error) {
+	var t T
+	content = stripCodeFence(content)
+
+	schemaBytes, err := json.Marshal(format.Schema)
+	if err != nil {
+		return t, errors.Wrap(err, "could not marshal schema")
+	}
+	schema, err := val.CompileString("schema.json", string(schemaBytes))
+	if err != nil {
+		return t, errors.Wrap(err, "could not compile schema")
+	}
+	var v any
+	if err := json.Unmarshal([]byte(content), &v); err != nil {
+		return t, errors.Wrap(err, "response is not valid JSON")
+	}
+	if err := schema.Validate(v); err != nil {
+		return t, errors.Wrap(err, "response does not match schema")
+	}
+	if err := json.Unmarshal([]byte(content), &t); err != nil {
+		return t, errors.Wrap(err, "could not decode response")
+	}
+	return t, nil
+}
+
+// stripCodeFence removes a markdown code fence around the content, which some models add even when asked for JSON.
+func stripCodeFence(content string) string {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "```") {
+		return content
+	}
+	content = strings.TrimPrefix(content, "```")
+	content = strings.TrimPrefix(content, "json")
+	content = strings.TrimSuffix(content, "```")
+	return strings.TrimSpace(content)
+}
@@ -0,0 +1,122 @@
+package llm_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	mock_llm "github.com/stillmatic/gollum/packages/llm/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+type weatherReport struct {
+	Location    string  `json:"location" jsonschema:"required"`
+	Temperature float64 `json:"temperature" jsonschema:"required"`
+	Unit        string  `json:"unit" jsonschema:"required,enum=celsius,enum=fahrenheit"`
+}
+
+func TestNewResponseFormat(t *testing.T) {
+	rf := llm.NewResponseFormat[weatherReport]()
+	assert.Equal(t, "weatherReport", rf.Name)
+	assert.True(t, rf.Strict)
+
+	b, err := json.Marshal(rf.Schema)
+	require.NoError(t, err)
+	var schema map[string]any
+	require.NoError(t, json.Unmarshal(b, &schema))
+	// strict mode needs every property required and no additional properties
+	assert.Equal(t, false, schema["additionalProperties"])
+	assert.ElementsMatch(t, []any{"location", "temperature", "unit"}, schema["required"])
+}
+
+type forecast struct {
+	Location string `json:"location"`
+	Summary  string `json:"summary,omitempty" jsonschema:"enum=sunny,enum=rainy"`
+	High     *int   `json:"high,omitempty"`
+}
+
+func TestNewResponseFormatOptionalFields(t *testing.T) {
+	rf := llm.NewResponseFormat[forecast]()
+	assert.True(t, rf.Strict)
+
+	b, err := json.Marshal(rf.Schema)
+	require.NoError(t, err)
+	var schema struct {
+		Required   []string                  `json:"required"`
+		Properties map[string]map[string]any `json:"properties"`
+	}
+	require.NoError(t, json.Unmarshal(b, &schema))
+	// strict mode rejects optional properties, so omitempty fields are required but nullable
+	assert.ElementsMatch(t, []string{"location", "summary", "high"}, schema.Required)
+	assert.Equal(t, "string", schema.Properties["location"]["type"])
+	assert.Equal(t, []any{"string", "null"}, schema.Properties["summary"]["type"])
+	assert.Equal(t, []any{"sunny", "rainy", nil}, schema.Properties["summary"]["enum"])
+	assert.Equal(t, []any{"integer", "null"}, schema.Properties["high"]["type"])
+
+	got, err := llm.DecodeStructured[forecast](rf, `{"location":"Paris","summary":null,"high":null}`)
+	require.NoError(t, err)
+	assert.Equal(t, forecast{Location: "Paris"}, got)
+
+	_, err = llm.DecodeStructured[forecast](rf, `{"location":"Paris","summary":"foggy","high":null}`)
+	assert.Error(t, err)
+}
+
+func TestInferStructured(t *testing.T) {
+	req := llm.InferRequest{
+		Messages:    []llm.InferMessage{{Role: "user", Content: "what's the weather in Paris?"}},
+		ModelConfig: llm.ModelConfig{ProviderType: llm.ProviderOpenAI, ModelName: "gpt-4o-mini"},
+	}
+
+	t.Run("decodes the response", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		responder := mock_llm.NewMockResponder(ctrl)
+		responder.EXPECT().Infer(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, got llm.InferRequest) (*llm.InferResponse, error) {
+				require.NotNil(t, got.ResponseFormat)
+				assert.Equal(t, "weatherReport", got.ResponseFormat.Name)
+				return &llm.InferResponse{Content: `{"location":"Paris","temperature":18.5,"unit":"celsius"}`}, nil
+			})
+
+		report, res, err := llm.InferStructured[weatherReport](context.Background(), responder, req)
+		require.NoError(t, err)
+		assert.Equal(t, weatherReport{Location: "Paris", Temperature: 18.5, Unit: "celsius"}, report)
+		assert.NotNil(t, res)
+	})
+
+	t.Run("strips code fences", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		responder := mock_llm.NewMockResponder(ctrl)
+		responder.EXPECT().Infer(gomock.Any(), gomock.Any()).Return(&llm.InferResponse{
+			Content: "```json\n{\"location\":\"Paris\",\"temperature\":18.5,\"unit\":\"celsius\"}\n```",
+		}, nil)
+
+		report, _, err := llm.InferStructured[weatherReport](context.Background(), responder, req)
+		require.NoError(t, err)
+		assert.Equal(t, "Paris", report.Location)
+	})
+
+	t.Run("rejects responses which don't match the schema", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		responder := mock_llm.NewMockResponder(ctrl)
+		responder.EXPECT().Infer(gomock.Any(), gomock.Any()).Return(&llm.InferResponse{
+			Content: `{"location":"Paris","temperature":18.5,"unit":"kelvin"}`,
+		}, nil)
+
+		_, res, err := llm.InferStructured[weatherReport](context.Background(), responder, req)
+		assert.ErrorContains(t, err, "does not match schema")
+		// the raw response is still returned, e.g. to retry with the error
+		assert.NotNil(t, res)
+	})
+
+	t.Run("rejects invalid JSON", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		responder := mock_llm.NewMockResponder(ctrl)
+		responder.EXPECT().Infer(gomock.Any(), gomock.Any()).Return(&llm.InferResponse{Content: "it's sunny"}, nil)
+
+		_, _, err := llm.InferStructured[weatherReport](context.Background(), responder, req)
+		assert.ErrorContains(t, err, "not valid JSON")
+	})
+}
@@ -0,0 +1,149 @@
+package llm
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"sync"
+)
+
+// Tokenizer counts the tokens in a piece of text.
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+// Encodings of OpenAI models, named as in OpenAI's tiktoken.
+const (
+	// EncodingCL100k is used by gpt-4, gpt-3.5-turbo and the text-embedding-3 models.
+	EncodingCL100k = "cl100k_base"
+	// EncodingO200k is used by gpt-4o, gpt-4.1 and the o-series reasoning models.
+	EncodingO200k = "o200k_base"
+)
+
+// NewBPEFunc builds an exact tokenizer for an encoding, see RegisterBPE.
+type NewBPEFunc func(encoding string) (Tokenizer, error)
+
+var (
+	bpeMu  sync.RWMutex
+	newBPE NewBPEFunc
+)
+
+// RegisterBPE sets how ModelConfig.Tokenizer builds exact tokenizers for OpenAI models. Importing
+// github.com/stillmatic/gollum/packages/llm/tokenizer/bpe registers tiktoken's, until then every model gets an
+// ApproxTokenizer. The encodings are several MB, so binaries which don't count tokens exactly leave them out.
+func RegisterBPE(fn NewBPEFunc) {
+	bpeMu.Lock()
+	defer bpeMu.Unlock()
+	newBPE = fn
+}
+
+// ApproxTokenizer estimates token counts from the length of the text, for providers whose tokenizers aren't
+// available offline.
+type ApproxTokenizer struct {
+	// CharsPerToken is the average number of bytes per token, defaults to 4.
+	CharsPerToken float64
+}
+
+func (t ApproxTokenizer) CountTokens(text string) int {
+	charsPerToken := t.CharsPerToken
+	if charsPerToken <= 0 {
+		charsPerToken = 4
+	}
+	return int(math.Ceil(float64(len(text)) / charsPerToken))
+}
+
+// Tokenizer returns the tokenizer for the model. OpenAI models get an exact BPE tokenizer, picked by model name
+// unless Encoding is set, if one is registered with RegisterBPE. Other providers get an ApproxTokenizer tuned
+// to the provider.
+func (c ModelConfig) Tokenizer() Tokenizer {
+	bpeMu.RLock()
+	fn := newBPE
+	bpeMu.RUnlock()
+	if encoding := c.encoding(); encoding != "" && fn != nil {
+		if t, err := fn(encoding); err == nil {
+			return t
+		}
+	}
+	switch c.ProviderType {
+	case ProviderAnthropic:
+		// Claude's tokenizer produces noticeably more tokens than cl100k for English text
+		return ApproxTokenizer{CharsPerToken: 3.5}
+	default:
+		return ApproxTokenizer{CharsPerToken: 4}
+	}
+}
+
+// o200kPrefixes are the OpenAI model families which use o200k_base, everything older uses cl100k_base.
+var o200kPrefixes = []string{"gpt-4o", "gpt-4.1", "gpt-4.5", "gpt-5", "chatgpt-4o", "o1", "o3", "o4"}
+
+func (c ModelConfig) encoding() string {
+	if c.Encoding != "" {
+		return c.Encoding
+	}
+	// Azure serves the same models
+	if c.ProviderType != ProviderOpenAI && c.ProviderType != ProviderAzureOpenAI {
+		return ""
+	}
+	for _, prefix := range o200kPrefixes {
+		if strings.HasPrefix(c.ModelName, prefix) {
+			return EncodingO200k
+		}
+	}
+	return EncodingCL100k
+}
+
+const (
+	// tokensPerMessage covers the role and delimiters around each message in OpenAI's chat format.
+	tokensPerMessage = 3
+	// tokensPerReply primes the assistant's reply.
+	tokensPerReply = 3
+	// tokensPerImage is roughly what a 1024x1024 image costs on OpenAI and Anthropic.
+	tokensPerImage = 765
+	// tokensPerDocument is a rough guess for a short PDF, providers charge per page.
+	tokensPerDocument = 1500
+	// tokensPerAudio is a rough guess for a short clip, providers charge per second.
+	tokensPerAudio = 500
+)
+
+// CountTokens counts the input tokens of a request with the tokenizer of its ModelConfig. It is exact for the
+// text of OpenAI requests once a BPE tokenizer is registered, other providers and non-text parts are estimates.
+func CountTokens(req InferRequest) int {
+	t := req.ModelConfig.Tokenizer()
+	total := tokensPerReply
+	for _, m := range req.Messages {
+		total += tokensPerMessage + t.CountTokens(m.Role)
+		for _, part := range m.ContentParts() {
+			total += countPartTokens(t, part)
+		}
+		for _, tc := range m.ToolCalls {
+			total += t.CountTokens(tc.Name) + t.CountTokens(tc.Arguments)
+		}
+	}
+	for _, tool := range req.Tools {
+		total += t.CountTokens(tool.Name) + t.CountTokens(tool.Description)
+		if b, err := json.Marshal(tool.Parameters); err == nil {
+			total += t.CountTokens(string(b))
+		}
+	}
+	if req.ResponseFormat != nil {
+		if b, err := json.Marshal(req.ResponseFormat.Schema); err == nil {
+			total += t.CountTokens(string(b))
+		}
+	}
+	return total
+}
+
+func countPartTokens(t Tokenizer, part Part) int {
+	switch part.Type {
+	case PartTypeText:
+		return t.CountTokens(part.Text)
+	case PartTypeImage, PartTypeImageURL:
+		return tokensPerImage
+	case PartTypeDocument:
+		return tokensPerDocument
+	case PartTypeAudio:
+		return tokensPerAudio
+	default:
+		return 0
+	}
+}
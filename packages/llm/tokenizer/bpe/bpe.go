@@ -0,0 +1,64 @@
+// Package bpe counts tokens exactly for OpenAI models with tiktoken. The rank files are embedded, so it works
+// offline. Importing the package registers it with llm.RegisterBPE, which makes llm.CountTokens exact for
+// OpenAI models:
+//
+//	import _ "github.com/stillmatic/gollum/packages/llm/tokenizer/bpe"
+package bpe
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+	"github.com/stillmatic/gollum/packages/llm"
+)
+
+func init() {
+	llm.RegisterBPE(func(encoding string) (llm.Tokenizer, error) {
+		return NewTokenizer(encoding)
+	})
+}
+
+// Tokenizer is an exact tokenizer for an OpenAI encoding.
+type Tokenizer struct {
+	encoding *tiktoken.Tiktoken
+}
+
+var (
+	loaderOnce   sync.Once
+	tokenizersMu sync.Mutex
+	tokenizers   = make(map[string]*Tokenizer)
+)
+
+// NewTokenizer returns a tokenizer for the named encoding, e.g. llm.EncodingO200k.
+// Loading an encoding takes a moment, so tokenizers are shared and safe for concurrent use.
+func NewTokenizer(encoding string) (*Tokenizer, error) {
+	// tiktoken's loader is global, so it is only replaced once a tokenizer is actually needed
+	loaderOnce.Do(func() {
+		tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+	})
+	tokenizersMu.Lock()
+	defer tokenizersMu.Unlock()
+	if t, ok := tokenizers[encoding]; ok {
+		return t, nil
+	}
+	enc, err := tiktoken.GetEncoding(encoding)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not load encoding %s", encoding)
+	}
+	t := &Tokenizer{encoding: enc}
+	tokenizers[encoding] = t
+	return t, nil
+}
+
+// Encode returns the token IDs of text. Special tokens are encoded as ordinary text.
+func (t *Tokenizer) Encode(text string) []int {
+	return t.encoding.EncodeOrdinary(text)
+}
+
+func (t *Tokenizer) CountTokens(text string) int {
+	return len(t.Encode(text))
+}
+
+var _ llm.Tokenizer = &Tokenizer{}
@@ -0,0 +1,40 @@
+package bpe_test
+
+import (
+	"testing"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/tokenizer/bpe"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenizer(t *testing.T) {
+	for _, encoding := range []string{llm.EncodingCL100k, llm.EncodingO200k} {
+		t.Run(encoding, func(t *testing.T) {
+			tok, err := bpe.NewTokenizer(encoding)
+			require.NoError(t, err)
+			assert.Equal(t, 2, tok.CountTokens("hello world"))
+			assert.Equal(t, 0, tok.CountTokens(""))
+			// special tokens are counted as text, not rejected
+			assert.Greater(t, tok.CountTokens("<|endoftext|>"), 1)
+
+			again, err := bpe.NewTokenizer(encoding)
+			require.NoError(t, err)
+			assert.Same(t, tok, again)
+		})
+	}
+
+	t.Run("encodings differ", func(t *testing.T) {
+		cl100k, err := bpe.NewTokenizer(llm.EncodingCL100k)
+		require.NoError(t, err)
+		o200k, err := bpe.NewTokenizer(llm.EncodingO200k)
+		require.NoError(t, err)
+		assert.NotEqual(t, cl100k.Encode("hello world"), o200k.Encode("hello world"))
+	})
+
+	t.Run("unknown encoding", func(t *testing.T) {
+		_, err := bpe.NewTokenizer("nope")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,89 @@
+package llm_test
+
+import (
+	"testing"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stillmatic/gollum/packages/llm/tokenizer/bpe"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApproxTokenizer(t *testing.T) {
+	assert.Equal(t, 3, llm.ApproxTokenizer{}.CountTokens("hello world"))
+	assert.Equal(t, 4, llm.ApproxTokenizer{CharsPerToken: 3.5}.CountTokens("hello world"))
+	assert.Equal(t, 0, llm.ApproxTokenizer{}.CountTokens(""))
+}
+
+func TestModelConfigTokenizer(t *testing.T) {
+	cl100k, err := bpe.NewTokenizer(llm.EncodingCL100k)
+	require.NoError(t, err)
+	o200k, err := bpe.NewTokenizer(llm.EncodingO200k)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		cfg  llm.ModelConfig
+		want llm.Tokenizer
+	}{
+		{"gpt-4o", llm.ModelConfig{ProviderType: llm.ProviderOpenAI, ModelName: "gpt-4o-mini"}, o200k},
+		{"o3", llm.ModelConfig{ProviderType: llm.ProviderOpenAI, ModelName: "o3-mini"}, o200k},
+		{"gpt-4", llm.ModelConfig{ProviderType: llm.ProviderOpenAI, ModelName: "gpt-4-turbo"}, cl100k},
+		{"embeddings", llm.ModelConfig{ProviderType: llm.ProviderOpenAI, ModelName: "text-embedding-3-small"}, cl100k},
+		{"anthropic", llm.ModelConfig{ProviderType: llm.ProviderAnthropic, ModelName: "claude-3-5-sonnet-latest"}, llm.ApproxTokenizer{CharsPerToken: 3.5}},
+		{"google", llm.ModelConfig{ProviderType: llm.ProviderGoogle, ModelName: "gemini-1.5-flash"}, llm.ApproxTokenizer{CharsPerToken: 4}},
+		{"encoding override", llm.ModelConfig{ProviderType: llm.ProviderTogether, ModelName: "openai/gpt-oss-20b", Encoding: llm.EncodingO200k}, o200k},
+		{"bad override", llm.ModelConfig{ProviderType: llm.ProviderGroq, Encoding: "nope"}, llm.ApproxTokenizer{CharsPerToken: 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.cfg.Tokenizer())
+		})
+	}
+}
+
+func TestCountTokens(t *testing.T) {
+	cfg := llm.ModelConfig{ProviderType: llm.ProviderOpenAI, ModelName: "gpt-4o"}
+
+	t.Run("messages", func(t *testing.T) {
+		req := llm.InferRequest{
+			ModelConfig: cfg,
+			Messages: []llm.InferMessage{
+				{Role: "system", Content: "hello world"},
+				{Role: "user", Content: "hello world"},
+			},
+		}
+		// 3 per message, 1 per role, 2 per "hello world" and 3 to prime the reply
+		assert.Equal(t, 15, llm.CountTokens(req))
+		assert.Equal(t, 15, llm.EstimateUsage(req).InputTokens)
+	})
+
+	t.Run("parts", func(t *testing.T) {
+		req := llm.InferRequest{
+			ModelConfig: cfg,
+			Messages: []llm.InferMessage{{
+				Role:  "user",
+				Parts: []llm.Part{llm.TextPart("hello world"), llm.ImageURLPart("https://example.com/cat.png")},
+			}},
+		}
+		text := llm.CountTokens(llm.InferRequest{
+			ModelConfig: cfg,
+			Messages:    []llm.InferMessage{{Role: "user", Content: "hello world"}},
+		})
+		assert.Equal(t, text+765, llm.CountTokens(req))
+	})
+
+	t.Run("tools", func(t *testing.T) {
+		req := llm.InferRequest{
+			ModelConfig: cfg,
+			Messages:    []llm.InferMessage{{Role: "user", Content: "what's the weather?"}},
+		}
+		without := llm.CountTokens(req)
+		req.Tools = []llm.Tool{{
+			Name:        "get_weather",
+			Description: "Get the weather for a location",
+			Parameters:  map[string]any{"type": "object", "properties": map[string]any{"location": map[string]any{"type": "string"}}},
+		}}
+		assert.Greater(t, llm.CountTokens(req), without+10)
+	})
+}
@@ -0,0 +1,69 @@
+package llm
+
+import (
+	"reflect"
+
+	"github.com/invopop/jsonschema"
+)
+
+// Tool describes a function that the model may choose to call.
+type Tool struct {
+	Name        string
+	Description string
+	// Parameters is a JSON schema describing the input to the tool.
+	// Anything that marshals to a JSON schema object works, e.g. *jsonschema.Schema or json.RawMessage.
+	Parameters any
+}
+
+// ToolCall is a request from the model to invoke a tool.
+type ToolCall struct {
+	// ID identifies the call. Tool results must reference it via InferMessage.ToolCallID.
+	ID   string
+	Name string
+	// Arguments is the JSON encoded input to the tool.
+	Arguments string
+}
+
+type ToolChoiceType string
+
+const (
+	// ToolChoiceAuto lets the model decide whether to call a tool. This is the default.
+	ToolChoiceAuto ToolChoiceType = "auto"
+	// ToolChoiceNone prevents the model from calling any tool.
+	ToolChoiceNone ToolChoiceType = "none"
+	// ToolChoiceRequired forces the model to call at least one tool.
+	ToolChoiceRequired ToolChoiceType = "required"
+	// ToolChoiceTool forces the model to call the tool given in ToolChoice.Name.
+	ToolChoiceTool ToolChoiceType = "tool"
+)
+
+// ToolChoice controls how the model uses the tools in the request.
+type ToolChoice struct {
+	Type ToolChoiceType
+	// Name is the tool to call, only used with ToolChoiceTool.
+	Name string
+}
+
+// NewTool builds a Tool whose parameters are the JSON schema of T.
+// T should be a struct, tagged the same way as for jsonparser.NewJSONParserGeneric.
+func NewTool[T any](name, description string) Tool {
+	return Tool{
+		Name:        name,
+		Description: description,
+		Parameters:  schemaFor[T](),
+	}
+}
+
+// schemaFor reflects T into a self-contained object schema, without $refs or $defs.
+func schemaFor[T any]() *jsonschema.Schema {
+	var tArr [0]T
+	r := jsonschema.Reflector{
+		Anonymous:      true,
+		DoNotReference: true,
+		ExpandedStruct: true,
+	}
+	schema := r.ReflectFromType(reflect.TypeOf(tArr).Elem())
+	// providers don't need (and some reject) the draft version
+	schema.Version = ""
+	return schema
+}
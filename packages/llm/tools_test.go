@@ -0,0 +1,35 @@
+package llm_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stretchr/testify/assert"
+)
+
+type weatherInput struct {
+	Location string `json:"location" jsonschema:"required" jsonschema_description:"The city and state, e.g. San Francisco, CA"`
+	Unit     string `json:"unit,omitempty" jsonschema:"enum=celsius,enum=fahrenheit"`
+}
+
+func TestNewTool(t *testing.T) {
+	tool := llm.NewTool[weatherInput]("get_weather", "Get the current weather in a given location")
+	assert.Equal(t, "get_weather", tool.Name)
+	assert.Equal(t, "Get the current weather in a given location", tool.Description)
+
+	b, err := json.Marshal(tool.Parameters)
+	assert.NoError(t, err)
+	var schema map[string]any
+	assert.NoError(t, json.Unmarshal(b, &schema))
+
+	// the schema should be inlined, without references or the draft version
+	assert.Equal(t, "object", schema["type"])
+	assert.NotContains(t, schema, "$schema")
+	assert.NotContains(t, schema, "$ref")
+	assert.NotContains(t, schema, "$defs")
+	assert.Equal(t, []any{"location"}, schema["required"])
+	props := schema["properties"].(map[string]any)
+	assert.Contains(t, props, "location")
+	assert.Equal(t, []any{"celsius", "fahrenheit"}, props["unit"].(map[string]any)["enum"])
+}
@@ -0,0 +1,71 @@
+package llm
+
+// FinishReason is why the model stopped generating, normalized across providers.
+type FinishReason string
+
+const (
+	// FinishReasonStop is a natural stop or a stop sequence.
+	FinishReasonStop FinishReason = "stop"
+	// FinishReasonLength means the output hit MaxTokens or the model's output limit.
+	FinishReasonLength FinishReason = "length"
+	// FinishReasonToolCalls means the model stopped to call tools.
+	// It is set whenever the response contains tool calls, even if the provider reports a plain stop.
+	FinishReasonToolCalls FinishReason = "tool_calls"
+	// FinishReasonContentFilter means the output was blocked or cut short by a safety filter.
+	FinishReasonContentFilter FinishReason = "content_filter"
+	// FinishReasonOther covers anything else the provider reports.
+	FinishReasonOther FinishReason = "other"
+)
+
+// Usage is the token usage of a request as reported by the provider.
+type Usage struct {
+	// InputTokens is the total number of prompt tokens, including any read from or written to the prompt cache.
+	InputTokens int
+	// OutputTokens is the total number of generated tokens, including reasoning tokens.
+	OutputTokens int
+
+	// CachedInputTokens is the part of InputTokens that was read from the prompt cache.
+	CachedInputTokens int
+	// CacheCreationInputTokens is the part of InputTokens that was written to the prompt cache.
+	CacheCreationInputTokens int
+	// ReasoningTokens is the part of OutputTokens spent on hidden reasoning, e.g. by o1.
+	ReasoningTokens int
+}
+
+// TotalTokens is the sum of input and output tokens.
+func (u Usage) TotalTokens() int {
+	return u.InputTokens + u.OutputTokens
+}
+
+// Add returns the sum of two usages, e.g. of several calls.
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		InputTokens:              u.InputTokens + other.InputTokens,
+		OutputTokens:             u.OutputTokens + other.OutputTokens,
+		CachedInputTokens:        u.CachedInputTokens + other.CachedInputTokens,
+		CacheCreationInputTokens: u.CacheCreationInputTokens + other.CacheCreationInputTokens,
+		ReasoningTokens:          u.ReasoningTokens + other.ReasoningTokens,
+	}
+}
+
+// EstimateUsage estimates the usage of a request before it is sent, counting input with CountTokens.
+// Output is assumed to use all of MaxTokens for every candidate, so this is an upper bound for output.
+func EstimateUsage(req InferRequest) Usage {
+	input := CountTokens(req)
+	output := req.MessageOptions.MaxTokens
+	if n := req.MessageOptions.Candidates; n > 1 {
+		output *= n
+	}
+	return Usage{InputTokens: input, OutputTokens: output}
+}
+
+// EstimateEmbeddingUsage estimates the input tokens of an embedding request with the model's tokenizer.
+func EstimateEmbeddingUsage(req EmbedRequest) Usage {
+	t := req.ModelConfig.Tokenizer()
+	prompt := t.CountTokens(req.Prompt)
+	input := 0
+	for _, s := range req.Input {
+		input += prompt + t.CountTokens(s)
+	}
+	return Usage{InputTokens: input}
+}
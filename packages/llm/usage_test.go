@@ -0,0 +1,27 @@
+package llm_test
+
+import (
+	"testing"
+
+	"github.com/stillmatic/gollum/packages/llm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCost(t *testing.T) {
+	store := llm.NewModelConfigStore()
+	t.Run("priced", func(t *testing.T) {
+		cfg, ok := store.GetConfig(llm.ConfigGPT4o)
+		assert.True(t, ok)
+		// $2.50 / M input, $10 / M output
+		cost := llm.Cost(cfg, llm.Usage{InputTokens: 1_000_000, OutputTokens: 500_000})
+		assert.InDelta(t, 7.5, cost, 1e-9)
+	})
+	t.Run("unpriced", func(t *testing.T) {
+		cfg, ok := store.GetConfig(llm.ConfigLlama405BVertex)
+		assert.True(t, ok)
+		assert.Equal(t, 0.0, llm.Cost(cfg, llm.Usage{InputTokens: 1000, OutputTokens: 1000}))
+	})
+	t.Run("total", func(t *testing.T) {
+		assert.Equal(t, 30, llm.Usage{InputTokens: 10, OutputTokens: 20}.TotalTokens())
+	})
+}